@@ -116,6 +116,7 @@ type advancedAppServices interface {
 	passwordPersistenceStrategy() passwordpersist.Strategy
 	getPasswordFromFlags(ctx context.Context, isCreate, allowPersistent bool) (string, error)
 	optionsFromFlags(ctx context.Context) *repo.Options
+	onRepositoryStorage(wrap func(st blob.Storage) blob.Storage)
 	runAppWithContext(command *kingpin.CmdClause, callback func(ctx context.Context) error) error
 	enableErrorNotifications() bool
 }
@@ -150,8 +151,10 @@ type App struct {
 	currentAction         string
 	onExitCallbacks       []func()
 	onFatalErrorCallbacks []func(err error)
+	storageWrappers       []func(st blob.Storage) blob.Storage
 
 	// subcommands
+	audit        commandAudit
 	blob         commandBlob
 	benchmark    commandBenchmark
 	cache        commandCache
@@ -306,6 +309,7 @@ func (c *App) setup(app *kingpin.Application) {
 	c.pf.setup(app)
 	c.progress.setup(c, app)
 
+	c.audit.setup(c, app)
 	c.blob.setup(c, app)
 	c.benchmark.setup(c, app)
 	c.cache.setup(c, app)
@@ -341,13 +345,17 @@ func NewApp() *App {
 
 			{"azure", "an Azure blob storage", func() StorageFlags { return &storageAzureFlags{} }},
 			{"b2", "a B2 bucket", func() StorageFlags { return &storageB2Flags{} }},
+			{"composite", "multiple storages selected by BLOB prefix", func() StorageFlags { return &storageCompositeFlags{} }},
+			{"erasure", "erasure-coded shards in multiple storages", func() StorageFlags { return &storageErasureFlags{} }},
 			{"filesystem", "a filesystem", func() StorageFlags { return &storageFilesystemFlags{} }},
 			{"gcs", "a Google Cloud Storage bucket", func() StorageFlags { return &storageGCSFlags{} }},
 			{"gdrive", "a Google Drive folder", func() StorageFlags { return &storageGDriveFlags{} }},
-
+			{"plugin", "an external storage plugin", func() StorageFlags { return &storagePluginFlags{} }},
 			{"rclone", "a rclone-based provided", func() StorageFlags { return &storageRcloneFlags{} }},
 			{"s3", "an S3 bucket", func() StorageFlags { return &storageS3Flags{} }},
 			{"sftp", "an SFTP storage", func() StorageFlags { return &storageSFTPFlags{} }},
+			{"smb", "an SMB/CIFS share", func() StorageFlags { return &storageSMBFlags{} }},
+			{"swift", "an OpenStack Swift container", func() StorageFlags { return &storageSwiftFlags{} }},
 			{"webdav", "a WebDAV storage", func() StorageFlags { return &storageWebDAVFlags{} }},
 		},
 
@@ -7,6 +7,7 @@
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/acl"
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/repo"
 )
 
@@ -15,6 +16,7 @@ type commandACLAdd struct {
 	target    string
 	level     string
 	overwrite bool
+	expires   string
 }
 
 func (c *commandACLAdd) setup(svc appServices, parent commandParent) {
@@ -23,6 +25,7 @@ func (c *commandACLAdd) setup(svc appServices, parent commandParent) {
 	cmd.Flag("target", "Manifests targeted by the rule (type:T,key1:value1,...,keyN:valueN)").Required().StringVar(&c.target)
 	cmd.Flag("access", "Access the user gets to subject").Required().EnumVar(&c.level, acl.SupportedAccessLevels()...)
 	cmd.Flag("overwrite", "Overwrite existing rule with the same user and target").BoolVar(&c.overwrite)
+	cmd.Flag("expires", "Make the rule expire after the given duration (e.g. 4h, 7d)").StringVar(&c.expires)
 	cmd.Action(svc.repositoryWriterAction(c.run))
 }
 
@@ -49,5 +52,15 @@ func (c *commandACLAdd) run(ctx context.Context, rep repo.RepositoryWriter) erro
 		Access: al,
 	}
 
+	if c.expires != "" {
+		d, err := parseDurationWithDays(c.expires)
+		if err != nil {
+			return errors.Wrap(err, "invalid expiration")
+		}
+
+		exp := clock.Now().Add(d)
+		e.Expires = &exp
+	}
+
 	return errors.Wrap(acl.AddACL(ctx, rep, e, c.overwrite), "error adding ACL entry")
 }
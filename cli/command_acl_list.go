@@ -6,6 +6,7 @@
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/acl"
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/manifest"
 )
@@ -38,7 +39,7 @@ func (c *commandACLList) run(ctx context.Context, rep repo.Repository) error {
 		if c.jo.jsonOutput {
 			jl.emit(aclListItem{e.ManifestID, e})
 		} else {
-			c.out.printStdout("id:%v user:%v access:%v target:%v\n", e.ManifestID, e.User, e.Access, e.Target)
+			c.out.printStdout("id:%v user:%v access:%v target:%v%v\n", e.ManifestID, e.User, e.Access, e.Target, aclExpirationSuffix(e))
 		}
 	}
 
@@ -49,3 +50,14 @@ type aclListItem struct {
 	ID manifest.ID `json:"id"`
 	*acl.Entry
 }
+
+func aclExpirationSuffix(e *acl.Entry) string {
+	switch {
+	case e.Expires == nil:
+		return ""
+	case e.IsExpired(clock.Now()):
+		return " expired:" + formatTimestamp(*e.Expires)
+	default:
+		return " expires:" + formatTimestamp(*e.Expires)
+	}
+}
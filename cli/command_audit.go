@@ -0,0 +1,13 @@
+package cli
+
+type commandAudit struct {
+	list   commandAuditList
+	verify commandAuditVerify
+}
+
+func (c *commandAudit) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("audit", "Commands to inspect the audit trail of repository changes.")
+
+	c.list.setup(svc, cmd)
+	c.verify.setup(svc, cmd)
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/audit"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandAuditList struct {
+	manifestType string
+	actor        string
+	manifestID   string
+	since        time.Duration
+
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandAuditList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List audit records.").Alias("ls")
+	cmd.Flag("type", "Only show changes to manifests of the given type").StringVar(&c.manifestType)
+	cmd.Flag("actor", "Only show changes made by the given user@host").StringVar(&c.actor)
+	cmd.Flag("manifest-id", "Only show changes to the given manifest").StringVar(&c.manifestID)
+	cmd.Flag("since", "Only show changes newer than the given duration").DurationVar(&c.since)
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+}
+
+func (c *commandAuditList) run(ctx context.Context, rep repo.DirectRepository) error {
+	recs, gaps, err := audit.ReadAll(ctx, rep.BlobReader(), rep.ContentReader().ContentFormat())
+	if err != nil {
+		return errors.Wrap(err, "error reading audit records")
+	}
+
+	for _, g := range gaps {
+		log(ctx).Warnf("audit trail is incomplete: %v", g)
+	}
+
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	for _, r := range recs {
+		if !c.shouldInclude(r, rep.Time()) {
+			continue
+		}
+
+		if c.jo.jsonOutput {
+			jl.emit(r)
+			continue
+		}
+
+		digest := r.AfterDigest
+		if r.Operation == audit.OperationDelete {
+			digest = r.BeforeDigest
+		}
+
+		c.out.printStdout("%v %-7v %-20v %-12v %v %v\n",
+			formatTimestamp(r.Time), r.Operation, r.Actor, r.ManifestType, r.ManifestID, digest)
+	}
+
+	return nil
+}
+
+func (c *commandAuditList) shouldInclude(r audit.Record, now time.Time) bool {
+	if c.manifestType != "" && r.ManifestType != c.manifestType {
+		return false
+	}
+
+	if c.actor != "" && r.Actor != c.actor {
+		return false
+	}
+
+	if c.manifestID != "" && r.ManifestID != c.manifestID {
+		return false
+	}
+
+	if c.since > 0 && r.Time.Before(now.Add(-c.since)) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,86 @@
+package cli_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/audit"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestAuditCommands(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndVerifyOutputLineCount(t, 0, "audit", "list", "--type=snapshot")
+
+	dir := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "snapshot", "create", dir)
+	e.RunAndVerifyOutputLineCount(t, 1, "audit", "list", "--type=snapshot")
+
+	var snaps []map[string]any
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "snapshot", "list", dir, "--json"), &snaps)
+	require.Len(t, snaps, 1)
+
+	snapID, ok := snaps[0]["id"].(string)
+	require.True(t, ok)
+
+	e.RunAndExpectSuccess(t, "snapshot", "delete", snapID, "--delete")
+
+	var recs []audit.Record
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "audit", "list", "--manifest-id", snapID, "--json"), &recs)
+	require.Len(t, recs, 2)
+	require.Equal(t, audit.OperationPut, recs[0].Operation)
+	require.Equal(t, audit.OperationDelete, recs[1].Operation)
+	require.Equal(t, recs[0].AfterDigest, recs[1].BeforeDigest)
+	require.NotEmpty(t, recs[1].Actor)
+
+	e.RunAndVerifyOutputLineCount(t, 0, "audit", "list", "--type=snapshot", "--actor=nobody@nowhere")
+	e.RunAndExpectSuccess(t, "audit", "verify")
+
+	// removing an audit blob followed by another one leaves a gap in the chain.
+	var all []map[string]any
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "audit", "list", "--json"), &all)
+
+	var removedBlobID string
+
+	for _, r := range all {
+		if p, ok := r["prevBlob"].(string); ok {
+			removedBlobID = p
+		}
+	}
+
+	require.NotEmpty(t, removedBlobID)
+
+	require.NoError(t, filepath.WalkDir(e.RepoDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		// blob ID is the path relative to the repository with separators and suffix removed.
+		rel, err := filepath.Rel(e.RepoDir, path)
+		if err == nil && strings.TrimSuffix(strings.ReplaceAll(rel, string(filepath.Separator), ""), ".f") == removedBlobID {
+			return os.Remove(path)
+		}
+
+		return err
+	}))
+
+	_, stderr := e.RunAndExpectFailure(t, "audit", "verify")
+	require.Contains(t, strings.Join(stderr, "\n"), "Gap: audit blob")
+	require.Contains(t, strings.Join(stderr, "\n"), removedBlobID)
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/audit"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandAuditVerify struct {
+	out textOutput
+}
+
+func (c *commandAuditVerify) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("verify", "Verify integrity of the audit trail.")
+	c.out.setup(svc)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+}
+
+func (c *commandAuditVerify) run(ctx context.Context, rep repo.DirectRepository) error {
+	recs, gaps, err := audit.ReadAll(ctx, rep.BlobReader(), rep.ContentReader().ContentFormat())
+	if err != nil {
+		return errors.Wrap(err, "audit trail verification failed")
+	}
+
+	for _, g := range gaps {
+		c.out.printStderr("Gap: %v\n", g)
+	}
+
+	if len(gaps) > 0 {
+		return errors.Errorf("audit trail verification failed: found %v gaps", len(gaps))
+	}
+
+	c.out.printStdout("Verified %v audit records.\n", len(recs))
+
+	return nil
+}
@@ -4,6 +4,7 @@
 	"context"
 	"strings"
 
+	"github.com/kopia/kopia/internal/audit"
 	"github.com/kopia/kopia/internal/epoch"
 	"github.com/kopia/kopia/internal/repodiag"
 	"github.com/kopia/kopia/repo"
@@ -70,6 +71,10 @@ func (c *commandBlobList) shouldInclude(b blob.Metadata) bool {
 			return false
 		}
 
+		if strings.HasPrefix(string(b.BlobID), string(audit.BlobPrefix)) {
+			return false
+		}
+
 		if strings.HasPrefix(string(b.BlobID), "kopia.") {
 			return false
 		}
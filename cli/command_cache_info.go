@@ -30,7 +30,7 @@ func (c *commandCacheInfo) setup(svc appServices, parent commandParent) {
 	c.out.setup(svc)
 }
 
-func (c *commandCacheInfo) run(ctx context.Context, _ repo.Repository) error {
+func (c *commandCacheInfo) run(ctx context.Context, rep repo.Repository) error {
 	opts, err := repo.GetCachingOptions(ctx, c.svc.repositoryConfigFileName())
 	if err != nil {
 		return errors.Wrap(err, "error getting cache options")
@@ -41,7 +41,30 @@ func (c *commandCacheInfo) run(ctx context.Context, _ repo.Repository) error {
 		return nil
 	}
 
-	entries, err := os.ReadDir(opts.CacheDirectory)
+	if dr, ok := rep.(repo.DirectRepository); ok {
+		opts.RepositoryUniqueID = dr.UniqueID()
+	}
+
+	if err := c.printCacheDirectory(opts, opts.CacheDirectory); err != nil {
+		return err
+	}
+
+	if d := opts.SharedCacheDirectoryOrEmpty(); d != "" {
+		c.out.printStdout("Shared with other users:\n")
+
+		if err := c.printCacheDirectory(opts, d); err != nil {
+			return err
+		}
+	}
+
+	c.out.printStderr("To adjust cache sizes use 'kopia cache set'.\n")
+	c.out.printStderr("To clear caches use 'kopia cache clear'.\n")
+
+	return nil
+}
+
+func (c *commandCacheInfo) printCacheDirectory(opts *content.CachingOptions, dir string) error {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return errors.Wrap(err, "unable to scan cache directory")
 	}
@@ -66,11 +89,11 @@ func (c *commandCacheInfo) run(ctx context.Context, _ repo.Repository) error {
 	}
 
 	for _, ent := range entries {
-		if !ent.IsDir() {
+		if !ent.IsDir() || ent.Name() == "locks" {
 			continue
 		}
 
-		subdir := filepath.Join(opts.CacheDirectory, ent.Name())
+		subdir := filepath.Join(dir, ent.Name())
 
 		fileCount, totalFileSize, err := scanCacheDir(subdir)
 		if err != nil {
@@ -101,8 +124,5 @@ func (c *commandCacheInfo) run(ctx context.Context, _ repo.Repository) error {
 		c.out.printStdout("%v: %v files %v%v\n", subdir, fileCount, units.BytesString(totalFileSize), maybeLimit)
 	}
 
-	c.out.printStderr("To adjust cache sizes use 'kopia cache set'.\n")
-	c.out.printStderr("To clear caches use 'kopia cache clear'.\n")
-
 	return nil
 }
@@ -39,7 +39,9 @@ func (c *cacheSizeFlags) setup(cmd *kingpin.CmdClause) {
 }
 
 type commandCacheSetParams struct {
-	directory string
+	directory          string
+	sharedDirectory    string
+	disableSharedCache bool
 
 	cacheSizeFlags
 
@@ -60,6 +62,8 @@ func (c *commandCacheSetParams) setup(svc appServices, parent commandParent) {
 	c.cacheSizeFlags.setup(cmd)
 
 	cmd.Flag("cache-directory", "Directory where to store cache files").StringVar(&c.directory)
+	cmd.Flag("shared-cache-directory", "Directory of content cache shared with other users of the repository on this host").StringVar(&c.sharedDirectory)
+	cmd.Flag("disable-shared-cache", "Stop using the shared content cache").BoolVar(&c.disableSharedCache)
 
 	cmd.Action(svc.repositoryWriterAction(c.run))
 	c.svc = svc
@@ -79,6 +83,18 @@ func (c *commandCacheSetParams) run(ctx context.Context, _ repo.RepositoryWriter
 		changed++
 	}
 
+	if v := c.sharedDirectory; v != "" {
+		log(ctx).Infof("setting shared cache directory to %v", v)
+		opts.SharedCacheDirectory = v
+		changed++
+	}
+
+	if c.disableSharedCache {
+		log(ctx).Info("disabling shared cache")
+		opts.SharedCacheDirectory = ""
+		changed++
+	}
+
 	if v := c.contentCacheSizeMB; v != -1 {
 		v *= 1e6 // convert MB to bytes
 		log(ctx).Infof("changing content cache size to %v", units.BytesString(v))
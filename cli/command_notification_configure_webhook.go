@@ -2,6 +2,7 @@
 
 import (
 	"net/http"
+	"os"
 	"strings"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -15,6 +16,10 @@ type commandNotificationConfigureWebhook struct {
 	common commonNotificationOptions
 
 	opt webhook.Options
+
+	clientCertFile string
+	clientKeyFile  string
+	caCertFile     string
 }
 
 func (c *commandNotificationConfigureWebhook) setup(svc appServices, parent commandParent) {
@@ -28,6 +33,11 @@ func (c *commandNotificationConfigureWebhook) setup(svc appServices, parent comm
 	cmd.Flag("method", "HTTP Method").EnumVar(&c.opt.Method, http.MethodPost, http.MethodPut)
 	cmd.Flag("http-header", "HTTP Header (key:value)").StringsVar(&httpHeaders)
 	cmd.Flag("format", "Format of the message").EnumVar(&c.opt.Format, sender.FormatHTML, sender.FormatPlainText)
+	cmd.Flag("signing-secret", "Secret used to sign requests with HMAC-SHA256").Envar(svc.EnvName("KOPIA_WEBHOOK_SIGNING_SECRET")).StringVar(&c.opt.SigningSecret)
+	cmd.Flag("signature-header", "HTTP header carrying the request signature").StringVar(&c.opt.SignatureHeader)
+	cmd.Flag("client-cert-file", "PEM-encoded client certificate for mutual TLS").ExistingFileVar(&c.clientCertFile)
+	cmd.Flag("client-key-file", "PEM-encoded client private key for mutual TLS").ExistingFileVar(&c.clientKeyFile)
+	cmd.Flag("ca-cert-file", "PEM-encoded CA certificates used to verify the server").ExistingFileVar(&c.caCertFile)
 
 	act := configureNotificationAction(svc, &c.common, webhook.ProviderType, &c.opt, webhook.MergeOptions)
 
@@ -43,6 +53,26 @@ func (c *commandNotificationConfigureWebhook) setup(svc appServices, parent comm
 
 		c.opt.Headers = strings.Join(httpHeaders, "\n")
 
+		for _, f := range []struct {
+			fname string
+			dst   *string
+		}{
+			{c.clientCertFile, &c.opt.ClientCertificate},
+			{c.clientKeyFile, &c.opt.ClientKey},
+			{c.caCertFile, &c.opt.CACertificates},
+		} {
+			if f.fname == "" {
+				continue
+			}
+
+			data, err := os.ReadFile(f.fname)
+			if err != nil {
+				return errors.Wrapf(err, "unable to read %v", f.fname)
+			}
+
+			*f.dst = string(data)
+		}
+
 		return act(ctx)
 	})
 }
@@ -16,6 +16,8 @@ type policyRetentionFlags struct {
 	policySetKeepMonthly              string
 	policySetKeepAnnual               string
 	policySetIgnoreIdenticalSnapshots string
+	policySetMaxSnapshots             string
+	policySetMaxTotalSizeMiB          string
 }
 
 func (c *policyRetentionFlags) setup(cmd *kingpin.CmdClause) {
@@ -26,6 +28,8 @@ func (c *policyRetentionFlags) setup(cmd *kingpin.CmdClause) {
 	cmd.Flag("keep-monthly", "Number of most-recent monthly backups to keep per source (or 'inherit')").PlaceHolder("N").StringVar(&c.policySetKeepMonthly)
 	cmd.Flag("keep-annual", "Number of most-recent annual backups to keep per source (or 'inherit')").PlaceHolder("N").StringVar(&c.policySetKeepAnnual)
 	cmd.Flag("ignore-identical-snapshots", "Do not save identical snapshots (or 'inherit')").StringVar(&c.policySetIgnoreIdenticalSnapshots)
+	cmd.Flag("max-snapshots", "Maximum total number of snapshots to keep per source (or 'inherit')").PlaceHolder("N").StringVar(&c.policySetMaxSnapshots)
+	cmd.Flag("max-total-size-mib", "Maximum amount of unique data in MiB to keep per source, oldest snapshots are expired first (or 'inherit')").PlaceHolder("N").StringVar(&c.policySetMaxTotalSizeMiB)
 }
 
 func (c *policyRetentionFlags) setRetentionPolicyFromFlags(ctx context.Context, rp *policy.RetentionPolicy, changeCount *int) error {
@@ -40,6 +44,7 @@ func (c *policyRetentionFlags) setRetentionPolicyFromFlags(ctx context.Context,
 		{"number of daily backups to keep", &rp.KeepDaily, c.policySetKeepDaily},
 		{"number of hourly backups to keep", &rp.KeepHourly, c.policySetKeepHourly},
 		{"number of latest backups to keep", &rp.KeepLatest, c.policySetKeepLatest},
+		{"maximum number of backups to keep", &rp.MaxSnapshots, c.policySetMaxSnapshots},
 	}
 
 	for _, c := range intCases {
@@ -48,5 +53,9 @@ func (c *policyRetentionFlags) setRetentionPolicyFromFlags(ctx context.Context,
 		}
 	}
 
+	if err := applyOptionalInt64MiB(ctx, "maximum total size of backups to keep", &rp.MaxTotalSize, c.policySetMaxTotalSizeMiB, changeCount); err != nil {
+		return err
+	}
+
 	return applyPolicyBoolPtr(ctx, "do not save identical snapshots", &rp.IgnoreIdenticalSnapshots, c.policySetIgnoreIdenticalSnapshots, changeCount)
 }
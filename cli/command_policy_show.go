@@ -148,6 +148,8 @@ func appendRetentionPolicyRows(rows []policyTableRow, p *policy.Policy, def *pol
 		policyTableRow{"  Daily snapshots:", valueOrNotSet(p.RetentionPolicy.KeepDaily), definitionPointToString(p.Target(), def.RetentionPolicy.KeepDaily)},
 		policyTableRow{"  Hourly snapshots:", valueOrNotSet(p.RetentionPolicy.KeepHourly), definitionPointToString(p.Target(), def.RetentionPolicy.KeepHourly)},
 		policyTableRow{"  Latest snapshots:", valueOrNotSet(p.RetentionPolicy.KeepLatest), definitionPointToString(p.Target(), def.RetentionPolicy.KeepLatest)},
+		policyTableRow{"  Maximum snapshots:", valueOrNotSet(p.RetentionPolicy.MaxSnapshots), definitionPointToString(p.Target(), def.RetentionPolicy.MaxSnapshots)},
+		policyTableRow{"  Maximum total size:", valueOrNotSetOptionalInt64Bytes(p.RetentionPolicy.MaxTotalSize), definitionPointToString(p.Target(), def.RetentionPolicy.MaxTotalSize)},
 		policyTableRow{"  Ignore identical snapshots:", boolToString(p.RetentionPolicy.IgnoreIdenticalSnapshots.OrDefault(false)), definitionPointToString(p.Target(), def.RetentionPolicy.IgnoreIdenticalSnapshots)},
 	)
 }
@@ -2,10 +2,16 @@
 
 type commandRepository struct {
 	connect          commandRepositoryConnect
+	cost             commandRepositoryCost
 	create           commandRepositoryCreate
 	disconnect       commandRepositoryDisconnect
 	repair           commandRepositoryRepair
+	replica          commandRepositoryReplica
+	retention        commandRepositoryRetention
+	rollback         commandRepositoryRollback
+	scrub            commandRepositoryScrub
 	setClient        commandRepositorySetClient
+	setCostModel     commandRepositorySetCostModel
 	setParameters    commandRepositorySetParameters
 	changePassword   commandRepositoryChangePassword
 	status           commandRepositoryStatus
@@ -19,10 +25,16 @@ func (c *commandRepository) setup(svc advancedAppServices, parent commandParent)
 	cmd := parent.Command("repository", "Commands to manipulate repository.").Alias("repo")
 
 	c.connect.setup(svc, cmd)
+	c.cost.setup(svc, cmd)
 	c.create.setup(svc, cmd)
 	c.disconnect.setup(svc, cmd)
 	c.repair.setup(svc, cmd)
+	c.replica.setup(svc, cmd)
+	c.retention.setup(svc, cmd)
+	c.rollback.setup(svc, cmd)
+	c.scrub.setup(svc, cmd)
 	c.setClient.setup(svc, cmd)
+	c.setCostModel.setup(svc, cmd)
 	c.setParameters.setup(svc, cmd)
 	c.status.setup(svc, cmd)
 	c.syncTo.setup(svc, cmd)
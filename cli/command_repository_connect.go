@@ -44,7 +44,8 @@ func (c *commandRepositoryConnect) setup(svc advancedAppServices, parent command
 }
 
 type connectOptions struct {
-	connectCacheDirectory string
+	connectCacheDirectory       string
+	connectSharedCacheDirectory string
 
 	cacheSizeFlags
 
@@ -64,6 +65,7 @@ func (c *connectOptions) setup(svc appServices, cmd *kingpin.CmdClause) {
 	// Set up flags shared between 'create' and 'connect'. Note that because those flags are used by both command
 	// we must use *Var() methods, otherwise one of the commands would always get default flag values.
 	cmd.Flag("cache-directory", "Cache directory").PlaceHolder("PATH").Envar(svc.EnvName("KOPIA_CACHE_DIRECTORY")).StringVar(&c.connectCacheDirectory)
+	cmd.Flag("shared-cache-directory", "Directory of content cache shared with other users of the repository on this host").PlaceHolder("PATH").Envar(svc.EnvName("KOPIA_SHARED_CACHE_DIRECTORY")).StringVar(&c.connectSharedCacheDirectory)
 
 	c.maxListCacheDuration = 30 * time.Second //nolint:mnd
 	c.contentCacheSizeMB = 5000
@@ -101,6 +103,7 @@ func (c *connectOptions) toRepoConnectOptions() *repo.ConnectOptions {
 			MinContentSweepAge:          content.DurationSeconds(c.contentMinSweepAge.Seconds()),
 			MinMetadataSweepAge:         content.DurationSeconds(c.metadataMinSweepAge.Seconds()),
 			MinIndexSweepAge:            content.DurationSeconds(c.indexMinSweepAge.Seconds()),
+			SharedCacheDirectory:        c.connectSharedCacheDirectory,
 		},
 		ClientOptions: repo.ClientOptions{
 			Hostname:                c.connectHostname,
@@ -4,6 +4,7 @@
 	"context"
 	"io"
 	"os"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/pkg/errors"
@@ -17,6 +18,7 @@ type storageFromConfigFlags struct {
 	connectFromConfigToken string
 	connectFromTokenFile   string
 	connectFromTokenStdin  bool
+	pointInTime            string
 
 	sps StorageProviderServices
 }
@@ -26,6 +28,7 @@ func (c *storageFromConfigFlags) Setup(sps StorageProviderServices, cmd *kingpin
 	cmd.Flag("token", "Configuration token").StringVar(&c.connectFromConfigToken)
 	cmd.Flag("token-file", "Path to the configuration token file").StringVar(&c.connectFromTokenFile)
 	cmd.Flag("token-stdin", "Read configuration token from stdin").BoolVar(&c.connectFromTokenStdin)
+	cmd.Flag("point-in-time", "Use a point-in-time view of the storage repository when supported").PlaceHolder(time.RFC3339).StringVar(&c.pointInTime)
 
 	c.sps = sps
 }
@@ -33,6 +36,10 @@ func (c *storageFromConfigFlags) Setup(sps StorageProviderServices, cmd *kingpin
 func (c *storageFromConfigFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
 	_ = formatVersion
 
+	if isCreate && c.pointInTime != "" {
+		return nil, errors.New("Cannot specify a 'point-in-time' option when creating a repository")
+	}
+
 	if !isCreate && c.connectFromConfigFile != "" {
 		return c.connectToStorageFromConfigFile(ctx)
 	}
@@ -66,8 +73,7 @@ func (c *storageFromConfigFlags) connectToStorageFromConfigFile(ctx context.Cont
 		return nil, errors.New("connection file does not specify blob storage connection parameters, kopia server connections are not supported")
 	}
 
-	//nolint:wrapcheck
-	return blob.NewStorage(ctx, *cfg.Storage, false)
+	return c.newStorage(ctx, *cfg.Storage)
 }
 
 func (c *storageFromConfigFlags) connectToStorageFromConfigToken(ctx context.Context, token string) (blob.Storage, error) {
@@ -80,6 +86,22 @@ func (c *storageFromConfigFlags) connectToStorageFromConfigToken(ctx context.Con
 		c.sps.setPasswordFromToken(pass)
 	}
 
+	return c.newStorage(ctx, ci)
+}
+
+func (c *storageFromConfigFlags) newStorage(ctx context.Context, ci blob.ConnectionInfo) (blob.Storage, error) {
+	if c.pointInTime != "" {
+		t, err := time.Parse(time.RFC3339, c.pointInTime)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid point-in-time argument")
+		}
+
+		ci, err = blob.ConnectionInfoAtPointInTime(ci, &t)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to use point-in-time view")
+		}
+	}
+
 	//nolint:wrapcheck
 	return blob.NewStorage(ctx, ci, false)
 }
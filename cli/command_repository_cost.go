@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob/storagemetrics"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/costmodel"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+// usage is extrapolated to a month only after it has been collected for at least this long.
+const minUsageDurationForMonthlyEstimate = 24 * time.Hour
+
+const monthDuration = 30 * 24 * time.Hour
+
+type commandRepositoryCost struct {
+	bySource   bool
+	resetUsage bool
+
+	svc appServices
+	out textOutput
+	jo  jsonOutput
+}
+
+// sourceCost is the monthly cost of storing the contents of snapshots of a source.
+type sourceCost struct {
+	Source      snapshot.SourceInfo `json:"source"`
+	PackedBytes int64               `json:"packedBytes"`
+	MonthlyCost float64             `json:"monthlyCost"`
+}
+
+type repositoryCostReport struct {
+	Model            *costmodel.Model        `json:"model"`
+	ByPrefix         []*costmodel.PrefixCost `json:"byPrefix"`
+	BySource         []*sourceCost           `json:"bySource,omitempty"`
+	MonthlyStorage   float64                 `json:"monthlyStorageCost"`
+	Usage            storagemetrics.Usage    `json:"usage"`
+	UsageCost        costmodel.UsageCost     `json:"usageCost"`
+	MonthlyUsageCost float64                 `json:"estimatedMonthlyUsageCost,omitempty"`
+}
+
+func (c *commandRepositoryCost) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("cost", "Estimate the cost of storing and accessing the repository.")
+	cmd.Flag("by-source", "Also break down the storage cost by snapshot source (slow, reads all snapshots)").BoolVar(&c.bySource)
+	cmd.Flag("reset-usage", "Reset storage usage accumulated on this machine after reporting").BoolVar(&c.resetUsage)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.svc = svc
+	c.out.setup(svc)
+	c.jo.setup(svc, cmd)
+}
+
+func (c *commandRepositoryCost) run(ctx context.Context, rep repo.DirectRepository) error {
+	m, err := costmodel.GetModel(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "unable to get cost model")
+	}
+
+	report := &repositoryCostReport{Model: m}
+
+	report.ByPrefix, err = costmodel.StorageCostByPrefix(ctx, rep.BlobReader(), m)
+	if err != nil {
+		return errors.Wrap(err, "unable to compute storage cost")
+	}
+
+	for _, pc := range report.ByPrefix {
+		report.MonthlyStorage += pc.MonthlyCost
+	}
+
+	if c.bySource {
+		report.BySource, err = storageCostBySource(ctx, rep, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	report.Usage, err = repo.LoadStorageUsage(c.svc.repositoryConfigFileName())
+	if err != nil {
+		return errors.Wrap(err, "unable to load storage usage")
+	}
+
+	report.UsageCost = m.UsageCost(report.Usage)
+
+	if elapsed := clock.Now().Sub(report.Usage.Since); !report.Usage.Since.IsZero() && elapsed >= minUsageDurationForMonthlyEstimate {
+		report.MonthlyUsageCost = report.UsageCost.Total * float64(monthDuration) / float64(elapsed)
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(report))
+	} else {
+		c.printReport(report)
+	}
+
+	if c.resetUsage {
+		return errors.Wrap(repo.ResetStorageUsage(c.svc.repositoryConfigFileName()), "unable to reset storage usage")
+	}
+
+	return nil
+}
+
+func storageCostBySource(ctx context.Context, rep repo.Repository, m *costmodel.Model) ([]*sourceCost, error) {
+	sources, err := snapshot.ListSources(ctx, rep)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list sources")
+	}
+
+	var result []*sourceCost
+
+	for _, src := range sources {
+		manifests, err := snapshot.ListSnapshots(ctx, rep, src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list snapshots of %v", src)
+		}
+
+		sc := &sourceCost{Source: src}
+
+		// running total of the last snapshot includes all contents referenced by snapshots of the source.
+		if err := snapshotfs.CalculateStorageStats(ctx, rep, snapshot.SortByTime(manifests, false), func(man *snapshot.Manifest) error {
+			sc.PackedBytes = man.StorageStats.RunningTotal.PackedContentBytes
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "unable to calculate storage of %v", src)
+		}
+
+		sc.MonthlyCost = m.MonthlyStorageCost(content.PackBlobIDPrefixRegular, sc.PackedBytes)
+		result = append(result, sc)
+	}
+
+	return result, nil
+}
+
+func (c *commandRepositoryCost) printReport(r *repositoryCostReport) {
+	currency := r.Model.Currency
+
+	c.out.printStdout("Monthly storage cost by blob prefix:\n\n")
+	c.out.printStdout("%-8v %-14v %10v %12v %14v\n", "PREFIX", "STORAGE CLASS", "BLOBS", "SIZE", "MONTHLY COST")
+
+	var totalBytes int64
+
+	for _, pc := range r.ByPrefix {
+		totalBytes += pc.TotalBytes
+
+		c.out.printStdout("%-8v %-14v %10v %12v %10.2f %v\n", pc.Prefix, pc.StorageClass, pc.BlobCount, units.BytesString(pc.TotalBytes), pc.MonthlyCost, currency)
+	}
+
+	c.out.printStdout("%-8v %-14v %10v %12v %10.2f %v\n", "total", "", "", units.BytesString(totalBytes), r.MonthlyStorage, currency)
+
+	if r.BySource != nil {
+		c.out.printStdout("\nMonthly storage cost by snapshot source (contents shared between sources are included in each):\n\n")
+
+		for _, sc := range r.BySource {
+			c.out.printStdout("%-50v %12v %10.2f %v\n", sc.Source, units.BytesString(sc.PackedBytes), sc.MonthlyCost, currency)
+		}
+	}
+
+	if r.Usage.Since.IsZero() {
+		c.out.printStdout("\nNo storage usage has been recorded on this machine yet.\n")
+		return
+	}
+
+	c.out.printStdout("\nStorage usage on this machine since %v:\n\n", formatTimestamp(r.Usage.Since))
+
+	var requests []string
+
+	for req := range r.Usage.Requests {
+		requests = append(requests, req)
+	}
+
+	sort.Strings(requests)
+
+	for _, req := range requests {
+		c.out.printStdout("%-14v %12v %10.2f %v\n", req, r.Usage.Requests[req], r.UsageCost.Requests[req], currency)
+	}
+
+	c.out.printStdout("%-14v %12v %10.2f %v\n", "Egress", units.BytesString(r.Usage.DownloadedBytes), r.UsageCost.Egress, currency)
+	c.out.printStdout("%-14v %12v %10.2f %v\n", "total", "", r.UsageCost.Total, currency)
+
+	if r.MonthlyUsageCost > 0 {
+		c.out.printStdout("\nEstimated monthly cost: %.2f %v (storage) + %.2f %v (usage)\n", r.MonthlyStorage, currency, r.MonthlyUsageCost, currency)
+	}
+}
@@ -0,0 +1,82 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+type costReport struct {
+	ByPrefix []struct {
+		Prefix      string  `json:"prefix"`
+		BlobCount   int     `json:"blobCount"`
+		MonthlyCost float64 `json:"monthlyCost"`
+	} `json:"byPrefix"`
+	BySource []struct {
+		PackedBytes int64   `json:"packedBytes"`
+		MonthlyCost float64 `json:"monthlyCost"`
+	} `json:"bySource"`
+	MonthlyStorage float64 `json:"monthlyStorageCost"`
+	Usage          struct {
+		Requests      map[string]int64 `json:"requests"`
+		UploadedBytes int64            `json:"uploadedBytes"`
+	} `json:"usage"`
+	UsageCost struct {
+		Total float64 `json:"total"`
+	} `json:"usageCost"`
+}
+
+func TestRepositoryCost(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	env.RunAndExpectFailure(t, "repo", "set-cost-model")
+	env.RunAndExpectFailure(t, "repo", "set-cost-model", "--storage-class", "p=abc")
+	env.RunAndExpectFailure(t, "repo", "set-cost-model", "--put-price", "-5")
+
+	env.RunAndExpectSuccess(t, "repo", "set-cost-model", "--storage-price", "100", "--storage-class", "q=0", "--put-price", "1000")
+	srcDir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "file"), bytes.Repeat([]byte("some data"), 1000), 0o600))
+
+	env.RunAndExpectSuccess(t, "snapshot", "create", srcDir)
+
+	var r costReport
+
+	require.NoError(t, json.Unmarshal([]byte(strings.Join(env.RunAndExpectSuccess(t, "repo", "cost", "--by-source", "--json"), "\n")), &r))
+
+	prefixCost := map[string]float64{}
+
+	for _, pc := range r.ByPrefix {
+		require.NotZero(t, pc.BlobCount)
+
+		prefixCost[pc.Prefix] = pc.MonthlyCost
+	}
+
+	require.Positive(t, prefixCost["p"])
+	require.Positive(t, prefixCost["kopia."])
+	require.Zero(t, prefixCost["q"])
+	require.Positive(t, r.MonthlyStorage)
+
+	require.Len(t, r.BySource, 1)
+	require.Positive(t, r.BySource[0].PackedBytes)
+	require.Positive(t, r.BySource[0].MonthlyCost)
+
+	// usage of previous commands has been recorded.
+	require.Positive(t, r.Usage.Requests["PutBlob"])
+	require.Positive(t, r.Usage.UploadedBytes)
+	require.Positive(t, r.UsageCost.Total)
+
+	env.RunAndExpectSuccess(t, "repo", "cost", "--reset-usage")
+
+	require.NoError(t, json.Unmarshal([]byte(strings.Join(env.RunAndExpectSuccess(t, "repo", "cost", "--json"), "\n")), &r))
+	require.Zero(t, r.Usage.Requests["PutBlob"])
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/replication"
+)
+
+type commandRepositoryReplica struct {
+	set    commandRepositoryReplicaSet
+	clear  commandRepositoryReplicaClear
+	sync   commandRepositoryReplicaSync
+	verify commandRepositoryReplicaVerify
+}
+
+func (c *commandRepositoryReplica) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("replica", "Manage the replica continuously kept in sync by the repository server.")
+
+	c.set.setup(svc, cmd)
+	c.clear.setup(svc, cmd)
+	c.sync.setup(svc, cmd)
+	c.verify.setup(svc, cmd)
+}
+
+// replicatorFromConfig returns the replicator for the replica configured for the repository, nil if none.
+func replicatorFromConfig(ctx context.Context, configFile string, opt replication.Options) (*replication.Replicator, error) {
+	lc, err := repo.LoadConfigFromFile(configFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil //nolint:nilnil
+		}
+
+		return nil, errors.Wrap(err, "unable to load repository configuration")
+	}
+
+	if lc.Replica == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	st, err := blob.NewStorage(ctx, *lc.Replica, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to replica storage")
+	}
+
+	return replication.New(st, opt), nil
+}
+
+// mustReplicatorFromConfig is like replicatorFromConfig but fails when no replica is configured.
+func mustReplicatorFromConfig(ctx context.Context, configFile string, opt replication.Options) (*replication.Replicator, error) {
+	r, err := replicatorFromConfig(ctx, configFile, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if r == nil {
+		return nil, errors.New("replica is not configured, use 'kopia repository replica set'")
+	}
+
+	return r, nil
+}
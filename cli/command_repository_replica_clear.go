@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+type commandRepositoryReplicaClear struct {
+	svc advancedAppServices
+}
+
+func (c *commandRepositoryReplicaClear) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("clear", "Stop replicating the repository. Data already in the replica is not removed.")
+	cmd.Action(svc.baseActionWithContext(c.run))
+
+	c.svc = svc
+}
+
+func (c *commandRepositoryReplicaClear) run(ctx context.Context) error {
+	return errors.Wrap(repo.SetReplica(ctx, c.svc.repositoryConfigFileName(), nil), "unable to clear replica configuration")
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/format"
+)
+
+type commandRepositoryReplicaSet struct {
+	out textOutput
+}
+
+func (c *commandRepositoryReplicaSet) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("set", "Set the storage to which the repository server continuously replicates the repository.")
+
+	c.out.setup(svc)
+
+	for _, prov := range svc.storageProviders() {
+		f := prov.NewFlags()
+		cc := cmd.Command(prov.Name, "Replicate repository to "+prov.Description)
+		f.Setup(svc, cc)
+		cc.Action(func(kpc *kingpin.ParseContext) error {
+			return svc.runAppWithContext(kpc.SelectedCommand, func(ctx context.Context) error {
+				st, err := f.Connect(ctx, false, 0)
+				if err != nil {
+					return errors.Wrap(err, "can't connect to storage")
+				}
+
+				defer st.Close(ctx) //nolint:errcheck
+
+				rep, err := svc.openRepository(ctx, true)
+				if err != nil {
+					return errors.Wrap(err, "open repository")
+				}
+
+				defer rep.Close(ctx) //nolint:errcheck
+
+				dr, ok := rep.(repo.DirectRepository)
+				if !ok {
+					return errors.New("replication only supports directly-connected repositories")
+				}
+
+				if err := ensureCompatibleReplica(ctx, dr.BlobReader(), st); err != nil {
+					return err
+				}
+
+				ci := st.ConnectionInfo()
+
+				if err := repo.SetReplica(ctx, svc.repositoryConfigFileName(), &ci); err != nil {
+					return errors.Wrap(err, "unable to save replica configuration")
+				}
+
+				c.out.printStderr("Replica set to %v. It will be kept in sync by the repository server.\n", st.DisplayName())
+
+				return nil
+			})
+		})
+	}
+}
+
+// ensureCompatibleReplica ensures the replica is either empty or holds a replica of the same repository.
+func ensureCompatibleReplica(ctx context.Context, src blob.Reader, dst blob.Storage) error {
+	var srcData, dstData gather.WriteBuffer
+
+	defer srcData.Close()
+	defer dstData.Close()
+
+	if err := src.GetBlob(ctx, format.KopiaRepositoryBlobID, 0, -1, &srcData); err != nil {
+		return errors.Wrap(err, "error reading format blob")
+	}
+
+	if err := dst.GetBlob(ctx, format.KopiaRepositoryBlobID, 0, -1, &dstData); err != nil {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			return nil
+		}
+
+		return errors.Wrap(err, "error reading replica format blob")
+	}
+
+	uniqueID1, err := parseUniqueID(srcData.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "error parsing unique ID of source repository")
+	}
+
+	uniqueID2, err := parseUniqueID(dstData.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "error parsing unique ID of replica")
+	}
+
+	if uniqueID1 != uniqueID2 {
+		return errors.New("replica storage contains a different repository")
+	}
+
+	return nil
+}
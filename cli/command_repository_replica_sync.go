@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/replication"
+)
+
+type commandRepositoryReplicaSync struct {
+	parallel int
+	verify   bool
+
+	svc advancedAppServices
+	out textOutput
+}
+
+func (c *commandRepositoryReplicaSync) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("sync", "Bring the replica in sync with the repository.")
+	cmd.Flag("parallel", "Replication parallelism").Default("4").IntVar(&c.parallel)
+	cmd.Flag("verify", "Verify each blob after copying it to the replica").Default("true").BoolVar(&c.verify)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.svc = svc
+	c.out.setup(svc)
+}
+
+func (c *commandRepositoryReplicaSync) run(ctx context.Context, rep repo.DirectRepository) error {
+	r, err := mustReplicatorFromConfig(ctx, c.svc.repositoryConfigFileName(), replication.Options{
+		Parallelism: c.parallel,
+		Verify:      c.verify,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer r.Close(ctx) //nolint:errcheck
+
+	blobCfg, err := rep.FormatManager().BlobCfgBlob(ctx)
+	if err != nil {
+		return errors.Wrap(err, "blob configuration")
+	}
+
+	r.SetRetention(blobCfg)
+
+	if err := r.Reconcile(ctx, rep.BlobReader()); err != nil {
+		return errors.Wrap(err, "unable to synchronize replica")
+	}
+
+	st := r.Status()
+
+	c.out.printStdout("Copied %v blobs (%v), deleted %v blobs.\n", st.CopiedBlobs, units.BytesString(st.CopiedBytes), st.DeletedBlobs)
+
+	return nil
+}
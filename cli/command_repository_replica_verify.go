@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/replication"
+)
+
+type commandRepositoryReplicaVerify struct {
+	full     bool
+	parallel int
+
+	svc advancedAppServices
+	out textOutput
+	jo  jsonOutput
+}
+
+func (c *commandRepositoryReplicaVerify) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("verify", "Verify that the replica holds the same blobs as the repository.")
+	cmd.Flag("full", "Compare contents of all blobs instead of just their lengths").BoolVar(&c.full)
+	cmd.Flag("parallel", "Verification parallelism").Default("4").IntVar(&c.parallel)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.svc = svc
+	c.out.setup(svc)
+	c.jo.setup(svc, cmd)
+}
+
+func (c *commandRepositoryReplicaVerify) run(ctx context.Context, rep repo.DirectRepository) error {
+	r, err := mustReplicatorFromConfig(ctx, c.svc.repositoryConfigFileName(), replication.Options{
+		Parallelism: c.parallel,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer r.Close(ctx) //nolint:errcheck
+
+	result, err := r.Verify(ctx, rep.BlobReader(), c.full)
+	if err != nil {
+		return errors.Wrap(err, "unable to verify replica")
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(result))
+	} else {
+		for _, id := range result.Missing {
+			c.out.printStdout("missing: %v\n", id)
+		}
+
+		for _, id := range result.Mismatched {
+			c.out.printStdout("mismatched: %v\n", id)
+		}
+
+		for _, id := range result.Extra {
+			c.out.printStdout("extra: %v\n", id)
+		}
+
+		c.out.printStderr("Checked %v blobs: %v missing, %v mismatched, %v extra.\n", result.Checked, len(result.Missing), len(result.Mismatched), len(result.Extra))
+	}
+
+	if !result.InSync() {
+		return errors.New("replica is not in sync with the repository")
+	}
+
+	return nil
+}
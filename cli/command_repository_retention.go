@@ -0,0 +1,11 @@
+package cli
+
+type commandRepositoryRetention struct {
+	status commandRepositoryRetentionStatus
+}
+
+func (c *commandRepositoryRetention) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("retention", "Inspect object lock retention of repository blobs.")
+
+	c.status.setup(svc, cmd)
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/maintenance"
+)
+
+type commandRepositoryRetentionStatus struct {
+	repair   bool
+	parallel int
+
+	out textOutput
+	jo  jsonOutput
+}
+
+func (c *commandRepositoryRetentionStatus) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("status", "Report object lock retention of blobs which are locked by the repository.")
+	cmd.Flag("repair", "Lock blobs which are missing locks using the retention configured in the repository").BoolVar(&c.repair)
+	cmd.Flag("parallel", "Number of blobs to check in parallel").Default("16").IntVar(&c.parallel)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.out.setup(svc)
+	c.jo.setup(svc, cmd)
+}
+
+func (c *commandRepositoryRetentionStatus) run(ctx context.Context, rep repo.DirectRepository) error {
+	blobCfg, err := rep.FormatManager().BlobCfgBlob(ctx)
+	if err != nil {
+		return errors.Wrap(err, "blob configuration")
+	}
+
+	// retention is reported by the storage provider itself, not the wrappers added by the repository.
+	st, err := blob.NewStorage(ctx, rep.BlobReader().ConnectionInfo(), false)
+	if err != nil {
+		return errors.Wrap(err, "unable to open storage")
+	}
+
+	defer st.Close(ctx) //nolint:errcheck
+
+	status, err := maintenance.GetBlobRetentionStatus(ctx, st, blobCfg, maintenance.BlobRetentionStatusOptions{
+		Parallel: c.parallel,
+		Repair:   c.repair,
+	})
+	if status == nil {
+		return errors.Wrap(err, "unable to get blob retention status")
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(status))
+	} else {
+		c.printStatus(status)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unable to repair blob retention")
+	}
+
+	if blobCfg.IsRetentionEnabled() && status.UnlockedBlobs() > 0 {
+		return errors.Errorf("%v blobs are not locked, use --repair to lock them", status.UnlockedBlobs())
+	}
+
+	return nil
+}
+
+func (c *commandRepositoryRetentionStatus) printStatus(status *maintenance.BlobRetentionStatus) {
+	if status.RetentionMode == "" {
+		c.out.printStdout("Object lock retention is disabled in the repository.\n\n")
+	} else {
+		c.out.printStdout("Repository retention: %v for %v\n\n", status.RetentionMode, status.RetentionPeriod)
+	}
+
+	c.out.printStdout("%-20v %10v %10v %-25v %-24v %-24v\n", "PREFIX", "BLOBS", "UNLOCKED", "MODES", "EARLIEST RETAIN", "LATEST RETAIN")
+
+	for _, ps := range status.Prefixes {
+		var modes []string
+
+		for mode, cnt := range ps.Modes {
+			modes = append(modes, mode.String()+":"+strconv.Itoa(cnt))
+		}
+
+		sort.Strings(modes)
+
+		c.out.printStdout("%-20v %10v %10v %-25v %-24v %-24v\n",
+			ps.Prefix, ps.Blobs, len(ps.Unlocked), strings.Join(modes, ","),
+			formatRetainUntil(ps.EarliestRetainUntil), formatRetainUntil(ps.LatestRetainUntil))
+	}
+
+	for _, ps := range status.Prefixes {
+		for _, id := range ps.Unlocked {
+			c.out.printStdout("unlocked: %v\n", id)
+		}
+
+		if ps.Repaired > 0 {
+			c.out.printStderr("Locked %v blobs with prefix %v.\n", ps.Repaired, ps.Prefix)
+		}
+	}
+}
+
+func formatRetainUntil(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return formatTimestamp(t)
+}
@@ -0,0 +1,19 @@
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryRetentionStatusUnsupportedStorage(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	_, stderr := env.RunAndExpectFailure(t, "repo", "retention", "status")
+	require.Contains(t, strings.Join(stderr, "\n"), "storage type 'filesystem' does not report blob retention")
+}
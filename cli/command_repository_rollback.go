@@ -0,0 +1,287 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/replication"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandRepositoryRollback struct {
+	to       string
+	dryRun   bool
+	parallel int
+	force    bool
+
+	svc advancedAppServices
+	out textOutput
+}
+
+func (c *commandRepositoryRollback) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("rollback", "Restore the entire repository to its state at a point in time using versioned storage.")
+	cmd.Flag("to", "Point in time to restore the repository to").PlaceHolder(time.RFC3339).Required().StringVar(&c.to)
+	cmd.Flag("dry-run", "Only show changes to manifests and blobs").BoolVar(&c.dryRun)
+	cmd.Flag("parallel", "Number of blobs to restore in parallel").Default("4").IntVar(&c.parallel)
+	cmd.Flag("force", "Roll back even if not the maintenance owner or other clients appear to be active").BoolVar(&c.force)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.svc = svc
+	c.out.setup(svc)
+}
+
+func (c *commandRepositoryRollback) run(ctx context.Context, rep repo.DirectRepository) error {
+	t, err := time.Parse(time.RFC3339, c.to)
+	if err != nil {
+		return errors.Wrap(err, "invalid --to argument")
+	}
+
+	if t.After(clock.Now()) {
+		return errors.Errorf("point in time %v is in the future", t)
+	}
+
+	ci := rep.BlobReader().ConnectionInfo()
+
+	// the repository may have been connected using a point-in-time view, which is read-only.
+	currentCI, err := blob.ConnectionInfoAtPointInTime(ci, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to roll back")
+	}
+
+	pitCI, err := blob.ConnectionInfoAtPointInTime(ci, &t)
+	if err != nil {
+		return errors.Wrap(err, "unable to roll back")
+	}
+
+	st, err := blob.NewStorage(ctx, currentCI, false)
+	if err != nil {
+		return errors.Wrap(err, "unable to open storage")
+	}
+
+	defer st.Close(ctx) //nolint:errcheck
+
+	pit, err := blob.NewStorage(ctx, pitCI, false)
+	if err != nil {
+		return errors.Wrap(err, "unable to open point-in-time view of storage")
+	}
+
+	defer pit.Close(ctx) //nolint:errcheck
+
+	if c.dryRun {
+		_, err := c.planAndShow(ctx, rep, st, pit, t)
+
+		return err
+	}
+
+	c.svc.advancedCommand()
+
+	// rolling back concurrently with maintenance or other writers would leave the repository
+	// in an inconsistent state, so it runs under the exclusive maintenance lock.
+	ran, rolledBack := false, false
+
+	if err := repo.DirectWriteSession(ctx, rep, repo.WriteSessionOptions{
+		Purpose: "cli:rollback",
+	}, func(ctx context.Context, dw repo.DirectRepositoryWriter) error {
+		return maintenance.RunExclusive(ctx, dw, maintenance.ModeFull, c.force, func(ctx context.Context, _ maintenance.RunParameters) error {
+			ran = true
+
+			if err := c.ensureNoActiveSessions(ctx, rep); err != nil {
+				return err
+			}
+
+			plan, err := c.planAndShow(ctx, rep, st, pit, t)
+			if err != nil || plan.IsEmpty() {
+				return err
+			}
+
+			status, err := replication.Rollback(ctx, st, pit, plan, replication.Options{
+				Parallelism: c.parallel,
+				Verify:      true,
+			})
+			if err != nil {
+				return errors.Wrap(err, "error restoring blobs")
+			}
+
+			c.out.printStdout("Restored %v blobs (%v), deleted %v blobs.\n", status.CopiedBlobs, units.BytesString(status.CopiedBytes), status.DeletedBlobs)
+
+			rolledBack = true
+
+			return nil
+		})
+	}); err != nil {
+		return errors.Wrap(err, "unable to roll back repository")
+	}
+
+	if !ran {
+		return errors.New("maintenance is in progress, try again later")
+	}
+
+	if !rolledBack {
+		return nil
+	}
+
+	return c.clearCache(ctx)
+}
+
+// planAndShow computes the rollback plan and prints the changes it would make.
+func (c *commandRepositoryRollback) planAndShow(ctx context.Context, rep repo.Repository, st, pit blob.Storage, t time.Time) (*replication.RollbackPlan, error) {
+	plan, err := replication.PlanRollback(ctx, st, pit, t)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to plan rollback")
+	}
+
+	if plan.IsEmpty() {
+		c.out.printStdout("Repository is already in its state at %v.\n", formatTimestamp(t))
+		return plan, nil
+	}
+
+	if err := c.showManifestChanges(ctx, rep, pit); err != nil {
+		return nil, err
+	}
+
+	c.out.printStdout("Blobs to restore: %v (%v)\n", len(plan.Restore), units.BytesString(plan.RestoreBytes()))
+	c.out.printStdout("Blobs to delete: %v\n", len(plan.Delete))
+
+	return plan, nil
+}
+
+// ensureNoActiveSessions fails if other clients are writing to the repository, unless forced.
+func (c *commandRepositoryRollback) ensureNoActiveSessions(ctx context.Context, rep repo.DirectRepository) error {
+	sessions, err := rep.ContentReader().ListActiveSessions(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list active sessions")
+	}
+
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	for _, s := range sessions {
+		c.out.printStderr("Active session %v of %v@%v, last checkpoint at %v\n", s.ID, s.User, s.Host, formatTimestamp(s.CheckpointTime))
+	}
+
+	if c.force {
+		log(ctx).Warnf("rolling back despite %v active sessions", len(sessions))
+		return nil
+	}
+
+	return errors.Errorf("found %v active sessions of other clients, stop them or pass --force", len(sessions))
+}
+
+// clearCache removes cached data of the repository, which no longer reflects its contents.
+func (c *commandRepositoryRollback) clearCache(ctx context.Context) error {
+	opts, err := repo.GetCachingOptions(ctx, c.svc.repositoryConfigFileName())
+	if err != nil {
+		return errors.Wrap(err, "error getting caching options")
+	}
+
+	if opts.CacheDirectory == "" {
+		return nil
+	}
+
+	return clearCacheDirectory(ctx, opts.CacheDirectory)
+}
+
+// showManifestChanges prints manifests which would be removed or restored by the rollback.
+func (c *commandRepositoryRollback) showManifestChanges(ctx context.Context, rep repo.Repository, pit blob.Storage) error {
+	pass, err := otherRepositoryPassword(ctx, c.svc, c.svc.repositoryConfigFileName(), "current")
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "kopia-rollback")
+	if err != nil {
+		return errors.Wrap(err, "unable to create temporary directory")
+	}
+
+	defer os.RemoveAll(tmpDir) //nolint:errcheck
+
+	configFile := filepath.Join(tmpDir, "repository.config")
+
+	if err := repo.Connect(ctx, configFile, pit, pass, &repo.ConnectOptions{
+		CachingOptions: content.CachingOptions{
+			CacheDirectory: filepath.Join(tmpDir, "cache"),
+		},
+	}); err != nil {
+		return errors.Wrap(err, "unable to connect to point-in-time repository")
+	}
+
+	pitRep, err := repo.Open(ctx, configFile, pass, c.svc.optionsFromFlags(ctx))
+	if err != nil {
+		return errors.Wrap(err, "unable to open point-in-time repository")
+	}
+
+	defer pitRep.Close(ctx) //nolint:errcheck
+
+	current, err := rep.FindManifests(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to list manifests")
+	}
+
+	past, err := pitRep.FindManifests(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to list manifests at point in time")
+	}
+
+	c.printManifests("Manifests to remove:", manifestsNotIn(current, past))
+	c.printManifests("Manifests to restore:", manifestsNotIn(past, current))
+
+	return nil
+}
+
+func (c *commandRepositoryRollback) printManifests(title string, entries []*manifest.EntryMetadata) {
+	if len(entries) == 0 {
+		return
+	}
+
+	c.out.printStdout("%v\n", title)
+
+	for _, e := range entries {
+		desc := e.Labels[manifest.TypeLabelKey]
+
+		if desc == snapshot.ManifestType {
+			desc += " " + snapshot.SourceInfo{
+				Host:     e.Labels[snapshot.HostnameLabel],
+				UserName: e.Labels[snapshot.UsernameLabel],
+				Path:     e.Labels[snapshot.PathLabel],
+			}.String()
+		}
+
+		c.out.printStdout("  %v %v %v\n", e.ID, formatTimestamp(e.ModTime), desc)
+	}
+}
+
+// manifestsNotIn returns entries which are not present in another list, sorted by time.
+func manifestsNotIn(entries, other []*manifest.EntryMetadata) []*manifest.EntryMetadata {
+	ids := map[manifest.ID]bool{}
+
+	for _, e := range other {
+		ids[e.ID] = true
+	}
+
+	var result []*manifest.EntryMetadata
+
+	for _, e := range entries {
+		if !ids[e.ID] {
+			result = append(result, e)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ModTime.Before(result[j].ModTime)
+	})
+
+	return result
+}
@@ -0,0 +1,46 @@
+package cli_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryRollbackUnsupportedStorage(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	past := clock.Now().Add(-time.Hour).Format(time.RFC3339)
+	future := clock.Now().Add(time.Hour).Format(time.RFC3339)
+
+	_, stderr := env.RunAndExpectFailure(t, "repo", "rollback", "--to", future)
+	require.Contains(t, strings.Join(stderr, "\n"), "is in the future")
+
+	_, stderr = env.RunAndExpectFailure(t, "repo", "rollback", "--to", past, "--dry-run")
+	require.Contains(t, strings.Join(stderr, "\n"), "storage type 'filesystem' does not support point-in-time views")
+
+	env.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	token, err := repo.EncodeToken(testenv.TestRepoPassword, blob.ConnectionInfo{
+		Type:   "filesystem",
+		Config: filesystem.Options{Path: env.RepoDir},
+	})
+	require.NoError(t, err)
+
+	_, stderr = env.RunAndExpectFailure(t, "repo", "create", "from-config", "--token", token, "--point-in-time", past)
+	require.Contains(t, strings.Join(stderr, "\n"), "Cannot specify a 'point-in-time' option when creating a repository")
+
+	_, stderr = env.RunAndExpectFailure(t, "repo", "connect", "from-config", "--token", token, "--point-in-time", past)
+	require.Contains(t, strings.Join(stderr, "\n"), "storage type 'filesystem' does not support point-in-time views")
+
+	env.RunAndExpectSuccess(t, "repo", "connect", "from-config", "--token", token)
+}
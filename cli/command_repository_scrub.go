@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob/erasure"
+)
+
+type commandRepositoryScrub struct {
+	verify   bool
+	dryRun   bool
+	parallel int
+
+	out textOutput
+	jo  jsonOutput
+}
+
+func (c *commandRepositoryScrub) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("scrub", "Find and rebuild missing or corrupted shards of erasure-coded repository.")
+	cmd.Flag("verify", "Read all shards and verify their checksums instead of only looking for missing shards").BoolVar(&c.verify)
+	cmd.Flag("dry-run", "Only report damaged shards without rebuilding them").Short('n').BoolVar(&c.dryRun)
+	cmd.Flag("parallel", "Number of blobs to scrub in parallel").Default("8").IntVar(&c.parallel)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.out.setup(svc)
+	c.jo.setup(svc, cmd)
+}
+
+func (c *commandRepositoryScrub) run(ctx context.Context, rep repo.DirectRepository) error {
+	opt, ok := rep.BlobReader().ConnectionInfo().Config.(*erasure.Options)
+	if !ok {
+		return errors.New("repository storage is not erasure-coded")
+	}
+
+	result, err := erasure.Scrub(ctx, opt, erasure.ScrubOptions{
+		Verify:   c.verify,
+		DryRun:   c.dryRun,
+		Parallel: c.parallel,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to scrub repository")
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(result))
+	} else {
+		for _, id := range result.Unrecoverable {
+			c.out.printStdout("unrecoverable: %v\n", id)
+		}
+
+		c.out.printStderr("Checked %v blobs: %v missing and %v corrupted shards, %v rebuilt.\n",
+			result.CheckedBlobs, result.MissingShards, result.CorruptShards, result.RepairedShards)
+
+		if len(result.UnavailableStorages) > 0 {
+			c.out.printStderr("Storages %v were unavailable, their shards were not checked.\n", result.UnavailableStorages)
+		}
+	}
+
+	if len(result.Unrecoverable) > 0 {
+		return errors.Errorf("found %v unrecoverable blobs", len(result.Unrecoverable))
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package cli_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob/erasure"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryScrub(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	args := []string{"repo", "create", "erasure", "--data-shards=2", "--parity-shards=1"}
+
+	var dirs []string
+
+	for range 3 {
+		dir := testutil.TempDirectory(t)
+		fname := filepath.Join(testutil.TempDirectory(t), "storage.json")
+
+		require.NoError(t, os.WriteFile(fname, []byte(`{"type":"filesystem","config":{"path":`+strconv.Quote(dir)+`}}`), 0o600))
+
+		dirs = append(dirs, dir)
+		args = append(args, "--storage", fname)
+	}
+
+	env.RunAndExpectSuccess(t, args...)
+	env.RunAndExpectSuccess(t, "snapshot", "create", testutil.TempDirectory(t))
+
+	// lose all shards in one of the storages.
+	require.NoError(t, os.RemoveAll(dirs[1]))
+	require.NoError(t, os.MkdirAll(dirs[1], 0o700))
+
+	env.RunAndExpectSuccess(t, "snapshot", "list")
+
+	var result erasure.ScrubResult
+
+	require.NoError(t, json.Unmarshal([]byte(strings.Join(env.RunAndExpectSuccess(t, "repo", "scrub", "--dry-run", "--json"), "\n")), &result))
+	require.NotZero(t, result.MissingShards)
+	require.Zero(t, result.RepairedShards)
+
+	_, stderr := env.RunAndExpectSuccessWithErrOut(t, "repo", "scrub", "--verify")
+	require.Contains(t, strings.Join(stderr, "\n"), "rebuilt")
+
+	require.NoError(t, json.Unmarshal([]byte(strings.Join(env.RunAndExpectSuccess(t, "repo", "scrub", "--verify", "--json"), "\n")), &result))
+	require.Zero(t, result.MissingShards)
+	require.Zero(t, result.CorruptShards)
+}
+
+func TestRepositoryScrubUnsupportedStorage(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	_, stderr := env.RunAndExpectFailure(t, "repo", "scrub")
+	require.Contains(t, strings.Join(stderr, "\n"), "repository storage is not erasure-coded")
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/costmodel"
+)
+
+type commandRepositorySetCostModel struct {
+	preset         string
+	currency       string
+	storagePrice   float64
+	storageClasses map[string]string
+	getPrice       float64
+	putPrice       float64
+	listPrice      float64
+	deletePrice    float64
+	egressPrice    float64
+}
+
+func (c *commandRepositorySetCostModel) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("set-cost-model", "Set prices of the storage provider used to estimate the cost of the repository.")
+
+	var presets []string
+
+	for k := range costmodel.Presets {
+		presets = append(presets, k)
+	}
+
+	sort.Strings(presets)
+
+	c.storageClasses = map[string]string{}
+	c.storagePrice = -1
+	c.getPrice = -1
+	c.putPrice = -1
+	c.listPrice = -1
+	c.deletePrice = -1
+	c.egressPrice = -1
+
+	cmd.Flag("preset", "Start with approximate prices of the standard storage class of the provider").EnumVar(&c.preset, presets...)
+	cmd.Flag("currency", "Currency of prices").StringVar(&c.currency)
+	cmd.Flag("storage-price", "Monthly price of storing 1 GB").Float64Var(&c.storagePrice)
+	cmd.Flag("storage-class", "Monthly price of storing 1 GB in blobs with the provided prefix").PlaceHolder("PREFIX=PRICE").StringMapVar(&c.storageClasses)
+	cmd.Flag("get-price", "Price of 1000 GET requests").Float64Var(&c.getPrice)
+	cmd.Flag("put-price", "Price of 1000 PUT requests").Float64Var(&c.putPrice)
+	cmd.Flag("list-price", "Price of 1000 LIST requests").Float64Var(&c.listPrice)
+	cmd.Flag("delete-price", "Price of 1000 DELETE requests").Float64Var(&c.deletePrice)
+	cmd.Flag("egress-price", "Price of downloading 1 GB").Float64Var(&c.egressPrice)
+
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+}
+
+func (c *commandRepositorySetCostModel) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	m, err := costmodel.GetModel(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "unable to get cost model")
+	}
+
+	changed := 0
+
+	if c.preset != "" {
+		log(ctx).Infof(" - using %v prices", c.preset)
+
+		p := costmodel.DefaultModel(c.preset)
+		m = &p
+		changed++
+	}
+
+	if v := c.currency; v != "" {
+		log(ctx).Infof(" - setting currency to %v", v)
+		m.Currency = v
+		changed++
+	}
+
+	if v := c.storagePrice; v != -1 {
+		log(ctx).Infof(" - setting storage price to %v", v)
+
+		sc := m.StorageClassFor("")
+		sc.PricePerGBMonth = v
+		m.SetStorageClass(sc)
+		changed++
+	}
+
+	for prefix, price := range c.storageClasses {
+		v, err := strconv.ParseFloat(price, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid price of storage class for prefix %q", prefix)
+		}
+
+		log(ctx).Infof(" - setting storage price of blobs with prefix %q to %v", prefix, v)
+		m.SetStorageClass(costmodel.StorageClass{Prefix: blob.ID(prefix), PricePerGBMonth: v})
+		changed++
+	}
+
+	setRequestPrice := func(v float64, desc string, dst *float64) {
+		if v == -1 {
+			return
+		}
+
+		log(ctx).Infof(" - setting %v price to %v", desc, v)
+		*dst = v
+		changed++
+	}
+
+	setRequestPrice(c.getPrice, "GET", &m.RequestPrices.Get)
+	setRequestPrice(c.putPrice, "PUT", &m.RequestPrices.Put)
+	setRequestPrice(c.listPrice, "LIST", &m.RequestPrices.List)
+	setRequestPrice(c.deletePrice, "DELETE", &m.RequestPrices.Delete)
+	setRequestPrice(c.egressPrice, "egress", &m.EgressPerGB)
+
+	if changed == 0 {
+		return errors.New("no changes")
+	}
+
+	return errors.Wrap(costmodel.SetModel(ctx, rep, m), "unable to set cost model")
+}
@@ -18,6 +18,7 @@
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/composite"
 	"github.com/kopia/kopia/repo/format"
 )
 
@@ -93,6 +94,10 @@ func (c *commandRepositorySyncTo) runSyncWithStorage(ctx context.Context, src bl
 		return err
 	}
 
+	// when the source is a composite storage and the destination is one of its storages,
+	// blobs routed to that storage are already there and must be neither copied nor deleted.
+	isSharedBlob := sharedCompositeStorageFilter(ctx, src, dst)
+
 	log(ctx).Info("Looking for BLOBs to synchronize...")
 
 	var (
@@ -123,6 +128,9 @@ func (c *commandRepositorySyncTo) runSyncWithStorage(ctx context.Context, src bl
 		delete(dstMetadata, srcmd.BlobID)
 
 		switch {
+		case isSharedBlob(srcmd.BlobID):
+			inSyncBlobs++
+			inSyncBytes += srcmd.Length
 		case !exists:
 			blobsToCopy = append(blobsToCopy, srcmd)
 			totalCopyBytes += srcmd.Length
@@ -146,6 +154,10 @@ func (c *commandRepositorySyncTo) runSyncWithStorage(ctx context.Context, src bl
 
 	if c.repositorySyncDelete {
 		for _, dstmd := range dstMetadata {
+			if isSharedBlob(dstmd.BlobID) {
+				continue
+			}
+
 			// found in dst, not in src since we were deleting from dst as we found a match.
 			blobsToDelete = append(blobsToDelete, dstmd)
 			totalDeleteBytes += dstmd.Length
@@ -173,6 +185,56 @@ func (c *commandRepositorySyncTo) runSyncWithStorage(ctx context.Context, src bl
 	return finalErr
 }
 
+// sharedCompositeStorageFilter returns a function which determines whether a blob is stored
+// in the destination already because it is routed there by the composite source storage.
+func sharedCompositeStorageFilter(ctx context.Context, src blob.Reader, dst blob.Storage) func(id blob.ID) bool {
+	opt, ok := src.ConnectionInfo().Config.(*composite.Options)
+	if !ok {
+		return func(blob.ID) bool { return false }
+	}
+
+	log(ctx).Info("  Source is a composite storage:")
+	log(ctx).Infof("    default: %v", opt.Default.Type)
+
+	for _, r := range opt.Routes {
+		log(ctx).Infof("    %v*: %v", r.Prefix, r.Storage.Type)
+	}
+
+	dstJSON := connectionInfoJSON(dst.ConnectionInfo())
+	if dstJSON == "" {
+		return func(blob.ID) bool { return false }
+	}
+
+	// shared[0] is the default storage, shared[i+1] is the storage of opt.Routes[i].
+	shared := []bool{connectionInfoJSON(opt.Default) == dstJSON}
+	anyShared := shared[0]
+
+	for _, r := range opt.Routes {
+		isShared := connectionInfoJSON(r.Storage) == dstJSON
+		shared = append(shared, isShared)
+		anyShared = anyShared || isShared
+	}
+
+	if !anyShared {
+		return func(blob.ID) bool { return false }
+	}
+
+	log(ctx).Info("  Destination holds some of the source BLOBs, they will be neither copied nor deleted.")
+
+	return func(id blob.ID) bool {
+		return shared[opt.StorageIndex(id)+1]
+	}
+}
+
+func connectionInfoJSON(ci blob.ConnectionInfo) string {
+	b, err := json.Marshal(ci)
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
 func (c *commandRepositorySyncTo) listDestinationBlobs(ctx context.Context, dst blob.Storage) (map[blob.ID]blob.Metadata, error) {
 	dstTotalBytes := int64(0)
 	dstMetadata := map[blob.ID]blob.Metadata{}
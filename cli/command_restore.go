@@ -21,6 +21,7 @@
 	"github.com/kopia/kopia/internal/timetrack"
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/object"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/restore"
@@ -128,6 +129,10 @@ type commandRestore struct {
 	restoreShallowAtDepth         int32
 	minSizeForPlaceholder         int32
 	snapshotTime                  string
+	rehydrate                     bool
+	rehydrateDays                 int
+	rehydratePriority             string
+	rehydratePollInterval         time.Duration
 
 	restores []restoreSourceTarget
 
@@ -158,6 +163,10 @@ func (c *commandRestore) setup(svc appServices, parent commandParent) {
 	cmd.Flag("shallow", "Shallow restore the directory hierarchy starting at this level (default is to deep restore the entire hierarchy.)").Int32Var(&c.restoreShallowAtDepth)
 	cmd.Flag("shallow-minsize", "When doing a shallow restore, write actual files instead of placeholders smaller than this size.").Int32Var(&c.minSizeForPlaceholder)
 	cmd.Flag("snapshot-time", "When using a path as the source, use the latest snapshot available before this date. Default is latest").Default("latest").StringVar(&c.snapshotTime)
+	cmd.Flag("rehydrate", "Rehydrate archived blobs needed to restore the selected files and wait until they can be read before restoring").BoolVar(&c.rehydrate)
+	cmd.Flag("rehydrate-days", "Number of days rehydrated copies of archived blobs remain available (S3)").Default("7").IntVar(&c.rehydrateDays)
+	cmd.Flag("rehydrate-priority", "Rehydration priority: Standard, Bulk or Expedited (S3), Standard or High (Azure)").StringVar(&c.rehydratePriority)
+	cmd.Flag("rehydrate-poll-interval", "How often to check whether rehydration has completed").Default("5m").DurationVar(&c.rehydratePollInterval)
 	cmd.Action(svc.repositoryReaderAction(c.run))
 }
 
@@ -432,6 +441,12 @@ func (c *commandRestore) run(ctx context.Context, rep repo.Repository) error {
 			rootEntry = re
 		}
 
+		if c.rehydrate {
+			if err := c.rehydrateEntry(ctx, rep, rootEntry); err != nil {
+				return err
+			}
+		}
+
 		restoreProgress := c.getRestoreProgress()
 		progressCallback := func(_ context.Context, stats restore.Stats) {
 			restoreProgress.SetCounters(stats)
@@ -446,6 +461,10 @@ func (c *commandRestore) run(ctx context.Context, rep repo.Repository) error {
 			MinSizeForPlaceholder:  c.minSizeForPlaceholder,
 			ProgressCallback:       progressCallback,
 		})
+		if errors.Is(err, blob.ErrBlobArchived) {
+			return errors.Wrap(err, "error restoring, some of the data must be rehydrated first using --rehydrate")
+		}
+
 		if err != nil {
 			return errors.Wrap(err, "error restoring")
 		}
@@ -458,6 +477,44 @@ func (c *commandRestore) run(ctx context.Context, rep repo.Repository) error {
 	return nil
 }
 
+// rehydrateEntry rehydrates archived pack blobs needed to restore the entry and waits until they can be read.
+func (c *commandRestore) rehydrateEntry(ctx context.Context, rep repo.Repository, rootEntry fs.Entry) error {
+	dr, ok := rep.(repo.DirectRepository)
+	if !ok {
+		return errors.New("--rehydrate requires direct connection to the repository storage")
+	}
+
+	// rehydration is requested from the storage provider itself, not the wrappers added by the repository.
+	st, err := blob.NewStorage(ctx, dr.BlobReader().ConnectionInfo(), false)
+	if err != nil {
+		return errors.Wrap(err, "unable to open storage")
+	}
+
+	defer st.Close(ctx) //nolint:errcheck
+
+	log(ctx).Info("Requesting rehydration of archived data...")
+
+	stats, err := restore.Rehydrate(ctx, dr, st, rootEntry, restore.RehydrateOptions{
+		PollInterval: c.rehydratePollInterval,
+		Blob: blob.RehydrateOptions{
+			Days:     c.rehydrateDays,
+			Priority: c.rehydratePriority,
+		},
+		ProgressCallback: func(ctx context.Context, stats restore.RehydrateStats) {
+			if stats.ReadyPacks < stats.TotalPacks {
+				log(ctx).Infof("Rehydrated %v of %v packs, next check in %v.", stats.ReadyPacks, stats.TotalPacks, c.rehydratePollInterval)
+			}
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error rehydrating")
+	}
+
+	log(ctx).Infof("All %v packs can be read.", stats.TotalPacks)
+
+	return nil
+}
+
 // tryToConvertPathToID checks if the source is a path and in this case returns the ID of the snapshot
 // containing the latest version available.
 func (c *commandRestore) tryToConvertPathToID(ctx context.Context, rep repo.Repository, source string) (string, error) {
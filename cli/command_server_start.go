@@ -16,6 +16,7 @@
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	htpasswd "github.com/tg123/go-htpasswd"
 
@@ -77,9 +78,12 @@ type commandServerStart struct {
 
 	disableCSRFTokenChecks bool // disable CSRF token checks - used for development/debugging only
 
-	sf  serverFlags
-	svc advancedAppServices
-	out textOutput
+	sf      serverFlags
+	oidc    serverOIDCFlags
+	limits  serverLimitFlags
+	replica serverReplicaFlags
+	svc     advancedAppServices
+	out     textOutput
 }
 
 func (c *commandServerStart) setup(svc advancedAppServices, parent commandParent) {
@@ -129,6 +133,9 @@ func (c *commandServerStart) setup(svc advancedAppServices, parent commandParent
 	cmd.Flag("kopiaui-notifications", "Enable notifications to be printed to stdout for KopiaUI").BoolVar(&c.kopiauiNotifications)
 
 	c.sf.setup(svc, cmd)
+	c.oidc.setup(svc, cmd)
+	c.limits.setup(cmd)
+	c.replica.setup(cmd)
 	c.co.setup(svc, cmd)
 	c.svc = svc
 	c.out.setup(svc)
@@ -137,7 +144,12 @@ func (c *commandServerStart) setup(svc advancedAppServices, parent commandParent
 }
 
 func (c *commandServerStart) serverStartOptions(ctx context.Context) (*server.Options, error) {
-	authn, err := c.getAuthenticator(ctx)
+	oidc, err := c.oidc.provider(ctx, c.sf.serverAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	authn, err := c.getAuthenticator(ctx, oidc)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to initialize authentication")
 	}
@@ -147,21 +159,24 @@ func (c *commandServerStart) serverStartOptions(ctx context.Context) (*server.Op
 		uiPreferencesFile = filepath.Join(filepath.Dir(c.svc.repositoryConfigFileName()), "ui-preferences.json")
 	}
 
-	return &server.Options{
-		ConfigFile:           c.svc.repositoryConfigFileName(),
-		ConnectOptions:       c.co.toRepoConnectOptions(),
-		RefreshInterval:      c.serverStartRefreshInterval,
-		MaxConcurrency:       c.serverStartMaxConcurrency,
-		Authenticator:        authn,
-		Authorizer:           auth.DefaultAuthorizer(),
-		AuthCookieSigningKey: c.serverAuthCookieSingingKey,
-		UIUser:               c.sf.serverUsername,
-		ServerControlUser:    c.serverControlUsername,
-		LogRequests:          c.logServerRequests,
-		PasswordPersist:      c.svc.passwordPersistenceStrategy(),
-		UIPreferencesFile:    uiPreferencesFile,
-		UITitlePrefix:        c.uiTitlePrefix,
-		PersistentLogs:       c.persistentLogs,
+	opts := &server.Options{
+		ConfigFile:              c.svc.repositoryConfigFileName(),
+		ConnectOptions:          c.co.toRepoConnectOptions(),
+		RefreshInterval:         c.serverStartRefreshInterval,
+		MaxConcurrency:          c.serverStartMaxConcurrency,
+		Authenticator:           authn,
+		Authorizer:              auth.DefaultAuthorizer(),
+		AuthCookieSigningKey:    c.serverAuthCookieSingingKey,
+		UIUser:                  c.sf.serverUsername,
+		OIDC:                    oidc,
+		OIDCUIGroups:            c.oidc.uiGroups,
+		OIDCServerControlGroups: c.oidc.serverControlGroups,
+		ServerControlUser:       c.serverControlUsername,
+		LogRequests:             c.logServerRequests,
+		PasswordPersist:         c.svc.passwordPersistenceStrategy(),
+		UIPreferencesFile:       uiPreferencesFile,
+		UITitlePrefix:           c.uiTitlePrefix,
+		PersistentLogs:          c.persistentLogs,
 
 		DebugScheduler:         c.debugScheduler,
 		MinMaintenanceInterval: c.minMaintenanceInterval,
@@ -169,7 +184,27 @@ func (c *commandServerStart) serverStartOptions(ctx context.Context) (*server.Op
 
 		EnableErrorNotifications: c.svc.enableErrorNotifications(),
 		NotifyTemplateOptions:    c.svc.notificationTemplateOptions(),
-	}, nil
+	}
+
+	if err := c.limits.apply(opts); err != nil {
+		return nil, err
+	}
+
+	rep, err := c.replica.replicator(ctx, c.svc.repositoryConfigFileName())
+	if err != nil {
+		return nil, err
+	}
+
+	if rep != nil {
+		// record all changes made to the repository storage, so that they can be replicated.
+		c.svc.onRepositoryStorage(rep.WrapStorage)
+
+		opts.Replicator = rep
+		opts.ReplicaSyncInterval = c.replica.syncInterval
+		opts.ReplicaReconcileInterval = c.replica.reconcileInterval
+	}
+
+	return opts, nil
 }
 
 func (c *commandServerStart) initRepositoryPossiblyAsync(ctx context.Context, srv *server.Server) error {
@@ -195,6 +230,10 @@ func (c *commandServerStart) run(ctx context.Context) (reterr error) {
 		return err
 	}
 
+	if opts.Replicator != nil {
+		defer opts.Replicator.Close(ctx) //nolint:errcheck
+	}
+
 	srv, err := server.New(ctx, opts)
 	if err != nil {
 		return errors.Wrap(err, "unable to initialize server")
@@ -251,9 +290,9 @@ func (c *commandServerStart) run(ctx context.Context) (reterr error) {
 
 	c.setupHandlers(srv, m)
 
-	// init prometheus after adding interceptors that require credentials, so that this
-	// handler can be called without auth
-	initPrometheus(m)
+	// init prometheus after adding interceptors that require credentials, so that process-wide
+	// metrics can be scraped without auth. Metrics of sources and repository require auth.
+	initServerPrometheus(m, srv)
 
 	var handler http.Handler = m
 
@@ -316,11 +355,17 @@ func initPrometheus(m *mux.Router) {
 	m.Handle("/metrics", promhttp.Handler())
 }
 
+// initServerPrometheus exposes process-wide metrics along with the state of sources, repository
+// and maintenance managed by the server, which require authentication.
+func initServerPrometheus(m *mux.Router, srv *server.Server) {
+	m.Handle("/metrics", srv.MetricsHandler(prometheus.DefaultGatherer))
+}
+
 func stripProtocol(addr string) string {
 	return strings.TrimPrefix(strings.TrimPrefix(addr, "https://"), "http://")
 }
 
-func (c *commandServerStart) getAuthenticator(ctx context.Context) (auth.Authenticator, error) {
+func (c *commandServerStart) getAuthenticator(ctx context.Context, oidc *auth.OIDCProvider) (auth.Authenticator, error) {
 	var authenticators []auth.Authenticator
 
 	// handle passwords (UI and remote) from htpasswd file.
@@ -384,5 +429,13 @@ func (c *commandServerStart) getAuthenticator(ctx context.Context) (auth.Authent
 	// handle user accounts stored in the repository
 	authenticators = append(authenticators, auth.AuthenticateRepositoryUsers())
 
+	// handle API tokens stored in the repository
+	authenticators = append(authenticators, auth.AuthenticateAPITokens())
+
+	// handle ID tokens issued by OpenID Connect provider passed as passwords.
+	if oidc != nil {
+		authenticators = append(authenticators, oidc)
+	}
+
 	return auth.CombineAuthenticators(authenticators...), nil
 }
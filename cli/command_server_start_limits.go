@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/server"
+)
+
+type serverLimitFlags struct {
+	maxFailedLoginsPerUser  int
+	maxFailedLoginsPerIP    int
+	loginLockoutDuration    time.Duration
+	maxLoginLockoutDuration time.Duration
+	userRequestsPerSecond   float64
+	userRequestBurst        int
+	trustedProxies          []string
+}
+
+func (c *serverLimitFlags) setup(cmd *kingpin.CmdClause) {
+	cmd.Flag("max-failed-logins-per-user", "Number of consecutive failed logins after which the user is temporarily locked out regardless of client address (0 - unlimited)").Default("0").IntVar(&c.maxFailedLoginsPerUser)
+	cmd.Flag("max-failed-logins-per-ip", "Number of consecutive failed logins after which the client address is temporarily locked out (0 - unlimited)").Default("0").IntVar(&c.maxFailedLoginsPerIP)
+	cmd.Flag("trusted-proxy", "Address or CIDR range of a reverse proxy whose X-Forwarded-For header determines the client address").StringsVar(&c.trustedProxies)
+	cmd.Flag("login-lockout-duration", "Duration of the first lockout, doubled with each consecutive one").Default("1m").DurationVar(&c.loginLockoutDuration)
+	cmd.Flag("max-login-lockout-duration", "Maximum duration of a lockout").Default("1h").DurationVar(&c.maxLoginLockoutDuration)
+	cmd.Flag("user-requests-per-second", "Maximum rate of requests per authenticated user (0 - unlimited)").Default("0").Float64Var(&c.userRequestsPerSecond)
+	cmd.Flag("user-request-burst", "Maximum burst of requests per authenticated user").Default("0").IntVar(&c.userRequestBurst)
+}
+
+func (c *serverLimitFlags) apply(o *server.Options) error {
+	for _, v := range c.trustedProxies {
+		p, err := parseAddressOrPrefix(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid trusted proxy %q", v)
+		}
+
+		o.TrustedProxies = append(o.TrustedProxies, p)
+	}
+
+	o.MaxFailedLoginsPerUser = c.maxFailedLoginsPerUser
+	o.MaxFailedLoginsPerIP = c.maxFailedLoginsPerIP
+	o.LoginLockoutDuration = c.loginLockoutDuration
+	o.MaxLoginLockoutDuration = c.maxLoginLockoutDuration
+	o.UserRequestsPerSecond = c.userRequestsPerSecond
+	o.UserRequestBurst = c.userRequestBurst
+
+	return nil
+}
+
+// parseAddressOrPrefix parses an IP address or CIDR range.
+func parseAddressOrPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+
+		return p.Masked(), errors.Wrap(err, "invalid CIDR range")
+	}
+
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, errors.Wrap(err, "invalid address")
+	}
+
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/auth"
+)
+
+type serverOIDCFlags struct {
+	issuerURL       string
+	clientID        string
+	clientSecret    string
+	redirectURL     string
+	scopes          []string
+	usernameClaim   string
+	hostnameClaim   string
+	defaultHostname string
+	groupsClaim     string
+
+	uiGroups            []string
+	serverControlGroups []string
+}
+
+func (c *serverOIDCFlags) setup(svc appServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("oidc-issuer-url", "OpenID Connect issuer URL, enables single sign-on").Envar(svc.EnvName("KOPIA_OIDC_ISSUER_URL")).StringVar(&c.issuerURL)
+	cmd.Flag("oidc-client-id", "OpenID Connect client ID").Envar(svc.EnvName("KOPIA_OIDC_CLIENT_ID")).StringVar(&c.clientID)
+	cmd.Flag("oidc-client-secret", "OpenID Connect client secret").Envar(svc.EnvName("KOPIA_OIDC_CLIENT_SECRET")).StringVar(&c.clientSecret)
+	cmd.Flag("oidc-redirect-url", "OpenID Connect redirect URL (defaults to <server-address>/oidc/callback)").StringVar(&c.redirectURL)
+	cmd.Flag("oidc-scope", "OpenID Connect scopes to request").StringsVar(&c.scopes)
+	cmd.Flag("oidc-username-claim", "ID token claim mapped to user@host").Default(auth.DefaultOIDCUsernameClaim).StringVar(&c.usernameClaim)
+	cmd.Flag("oidc-hostname-claim", "ID token claim mapped to hostname when username claim does not include it").StringVar(&c.hostnameClaim)
+	cmd.Flag("oidc-default-hostname", "Hostname used when username claim does not include it").StringVar(&c.defaultHostname)
+	cmd.Flag("oidc-groups-claim", "ID token claim holding user groups").Default(auth.DefaultOIDCGroupsClaim).StringVar(&c.groupsClaim)
+	cmd.Flag("oidc-ui-group", "OpenID Connect group allowed to access the UI").StringsVar(&c.uiGroups)
+	cmd.Flag("oidc-server-control-group", "OpenID Connect group allowed to access the server control API").StringsVar(&c.serverControlGroups)
+}
+
+// provider returns OIDC provider or nil if OIDC is not configured.
+func (c *serverOIDCFlags) provider(ctx context.Context, serverAddress string) (*auth.OIDCProvider, error) {
+	if c.issuerURL == "" {
+		//nolint:nilnil
+		return nil, nil
+	}
+
+	redirectURL := c.redirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(serverAddress, "/") + "/oidc/callback"
+	}
+
+	p, err := auth.NewOIDCProvider(ctx, auth.OIDCOptions{
+		IssuerURL:       c.issuerURL,
+		ClientID:        c.clientID,
+		ClientSecret:    c.clientSecret,
+		RedirectURL:     redirectURL,
+		Scopes:          c.scopes,
+		UsernameClaim:   c.usernameClaim,
+		HostnameClaim:   c.hostnameClaim,
+		DefaultHostname: c.defaultHostname,
+		GroupsClaim:     c.groupsClaim,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to initialize OpenID Connect")
+	}
+
+	log(ctx).Infof("Server will allow single sign-on using OpenID Connect provider %v.", c.issuerURL)
+
+	return p, nil
+}
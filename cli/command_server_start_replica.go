@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/kopia/kopia/repo/replication"
+)
+
+type serverReplicaFlags struct {
+	syncInterval      time.Duration
+	reconcileInterval time.Duration
+	parallel          int
+	verify            bool
+}
+
+func (c *serverReplicaFlags) setup(cmd *kingpin.CmdClause) {
+	cmd.Flag("replica-sync-interval", "How often changes are copied to the replica, in addition to after each flush and maintenance").Default("1m").DurationVar(&c.syncInterval)
+	cmd.Flag("replica-reconcile-interval", "How often full lists of blobs in the repository and the replica are compared to pick up changes not made through the server").Default("1h").DurationVar(&c.reconcileInterval)
+	cmd.Flag("replica-parallel", "Replication parallelism").Default("4").IntVar(&c.parallel)
+	cmd.Flag("replica-verify", "Verify each blob after copying it to the replica").Default("true").BoolVar(&c.verify)
+}
+
+// replicator returns the replicator for the replica configured for the repository, nil if none.
+func (c *serverReplicaFlags) replicator(ctx context.Context, configFile string) (*replication.Replicator, error) {
+	return replicatorFromConfig(ctx, configFile, replication.Options{
+		Parallelism: c.parallel,
+		Verify:      c.verify,
+		StateFile:   configFile + ".replica-pending",
+	})
+}
@@ -1,6 +1,7 @@
 package cli
 
 type commandSnapshot struct {
+	copy        commandSnapshotCopy
 	copyHistory commandSnapshotCopyMoveHistory
 	moveHistory commandSnapshotCopyMoveHistory
 	create      commandSnapshotCreate
@@ -17,6 +18,7 @@ type commandSnapshot struct {
 
 func (c *commandSnapshot) setup(svc advancedAppServices, parent commandParent) {
 	cmd := parent.Command("snapshot", "Commands to manipulate snapshots.").Alias("snap")
+	c.copy.setup(svc, cmd)
 	c.copyHistory.setup(svc, cmd, false)
 	c.moveHistory.setup(svc, cmd, true)
 	c.create.setup(svc, cmd)
@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+type commandSnapshotCopy struct {
+	toConfig    string
+	snapshotIDs []string
+	parallel    int
+
+	copiedFiles  atomic.Int64
+	copiedBytes  atomic.Int64
+	reusedFiles  atomic.Int64
+	reuseObjects bool
+
+	svc advancedAppServices
+	out textOutput
+}
+
+func (c *commandSnapshotCopy) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("copy", "Copy snapshots to another repository, which may use a different format")
+	cmd.Flag("to-config", "Configuration file for the destination repository").Required().ExistingFileVar(&c.toConfig)
+	cmd.Flag("parallel", "Number of parallel workers (defaults to the number of CPUs)").IntVar(&c.parallel)
+	cmd.Arg("id", "Snapshot ID or root object ID").Required().StringsVar(&c.snapshotIDs)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+
+	c.svc = svc
+	c.out.setup(svc)
+}
+
+func (c *commandSnapshotCopy) run(ctx context.Context, rep repo.Repository) error {
+	manifests, err := c.snapshotsToCopy(ctx, rep)
+	if err != nil {
+		return err
+	}
+
+	destRepo, err := openOtherRepository(ctx, c.svc, c.toConfig, "destination")
+	if err != nil {
+		return err
+	}
+
+	defer destRepo.Close(ctx) //nolint:errcheck
+
+	// when both repositories compute identical content IDs for the same data, objects
+	// already present in the destination can be referenced without reading them.
+	c.reuseObjects = haveCompatibleContentIDs(rep, destRepo)
+
+	err = repo.WriteSession(ctx, destRepo, repo.WriteSessionOptions{
+		Purpose: "snapshot copy",
+	}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		return c.copySnapshots(ctx, rep, w, manifests)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error copying snapshots")
+	}
+
+	c.out.printStderr("Copied %v files (%v), %v files were already present in the destination.\n",
+		c.copiedFiles.Load(), units.BytesString(c.copiedBytes.Load()), c.reusedFiles.Load())
+
+	return nil
+}
+
+func (c *commandSnapshotCopy) snapshotsToCopy(ctx context.Context, rep repo.Repository) ([]*snapshot.Manifest, error) {
+	var result []*snapshot.Manifest
+
+	for _, id := range c.snapshotIDs {
+		m, err := snapshot.LoadSnapshot(ctx, rep, manifest.ID(id))
+		if err == nil {
+			result = append(result, m)
+			continue
+		}
+
+		if !errors.Is(err, snapshot.ErrSnapshotNotFound) {
+			return nil, errors.Wrapf(err, "error loading snapshot %v", id)
+		}
+
+		rootOID, err := object.ParseID(id)
+		if err != nil {
+			return nil, errors.Errorf("snapshot %v not found", id)
+		}
+
+		manifests, err := snapshot.FindSnapshotsByRootObjectID(ctx, rep, rootOID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to find snapshots by root %v", id)
+		}
+
+		if len(manifests) == 0 {
+			return nil, errors.Errorf("no snapshots matched %v", id)
+		}
+
+		result = append(result, manifests...)
+	}
+
+	return result, nil
+}
+
+func (c *commandSnapshotCopy) copySnapshots(ctx context.Context, rep repo.Repository, destRepo repo.RepositoryWriter, manifests []*snapshot.Manifest) error {
+	var sources []snapshot.SourceInfo
+
+	bySource := map[snapshot.SourceInfo][]*snapshot.Manifest{}
+
+	for _, m := range manifests {
+		if bySource[m.Source] == nil {
+			sources = append(sources, m.Source)
+		}
+
+		bySource[m.Source] = append(bySource[m.Source], m)
+	}
+
+	for _, si := range sources {
+		if err := c.copySnapshotsOfSource(ctx, rep, destRepo, si, bySource[si]); err != nil {
+			return errors.Wrapf(err, "error copying snapshots of %v", si)
+		}
+	}
+
+	return nil
+}
+
+func (c *commandSnapshotCopy) copySnapshotsOfSource(ctx context.Context, rep repo.Repository, destRepo repo.RepositoryWriter, si snapshot.SourceInfo, manifests []*snapshot.Manifest) error {
+	// compression of copied objects is determined by the policies in the destination repository.
+	policyTree, err := policy.TreeForSource(ctx, destRepo, si)
+	if err != nil {
+		return errors.Wrap(err, "error generating policy tree")
+	}
+
+	// the rewriter caches rewritten entries, so directories and files shared by
+	// multiple snapshots of the same source are only copied once.
+	rw, err := snapshotfs.NewDirRewriter(ctx, destRepo, snapshotfs.DirRewriterOptions{
+		Parallel:         c.parallel,
+		RewriteEntry:     c.copyEntry(rep, destRepo, policyTree),
+		SourceRepository: rep,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to create directory rewriter")
+	}
+
+	defer rw.Close(ctx)
+
+	metadataComp := policyTree.EffectivePolicy().MetadataCompressionPolicy.MetadataCompressor()
+
+	for _, m := range manifests {
+		existing, err := findSnapshotManifestWithStartTime(ctx, destRepo, m.Source, m.StartTime)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			log(ctx).Infof("snapshot %v of %v at %v has already been copied as %v", m.ID, m.Source, formatTimestamp(m.StartTime.ToTime()), existing.ID)
+			continue
+		}
+
+		log(ctx).Infof("copying snapshot %v of %v at %v", m.ID, m.Source, formatTimestamp(m.StartTime.ToTime()))
+
+		newm := m.Clone()
+
+		if _, err := rw.RewriteSnapshotManifest(ctx, newm, metadataComp); err != nil {
+			return errors.Wrapf(err, "error copying snapshot %v", m.ID)
+		}
+
+		newID, err := snapshot.SaveSnapshot(ctx, destRepo, newm)
+		if err != nil {
+			return errors.Wrap(err, "cannot save manifest")
+		}
+
+		c.out.printStdout("Copied snapshot %v of %v at %v as %v\n", m.ID, m.Source, formatTimestamp(m.StartTime.ToTime()), newID)
+	}
+
+	return nil
+}
+
+// copyEntry returns a callback which copies the object of a file or symlink into the destination repository,
+// directories are processed recursively by the rewriter.
+func (c *commandSnapshotCopy) copyEntry(rep repo.Repository, destRepo repo.RepositoryWriter, policyTree *policy.Tree) snapshotfs.RewriteDirEntryCallback {
+	return func(ctx context.Context, entryPath string, input *snapshot.DirEntry) (*snapshot.DirEntry, error) {
+		if input.Type == snapshot.EntryTypeDirectory || input.ObjectID == object.EmptyID {
+			return input, nil
+		}
+
+		if c.reuseObjects {
+			if _, err := destRepo.VerifyObject(ctx, input.ObjectID); err == nil {
+				c.reusedFiles.Add(1)
+				return input, nil
+			}
+		}
+
+		pol := policyTree.Child(entryPath).EffectivePolicy()
+
+		opt := object.WriterOptions{
+			Description:        "SYMLINK:" + input.Name,
+			MetadataCompressor: pol.MetadataCompressionPolicy.MetadataCompressor(),
+		}
+
+		if input.Type == snapshot.EntryTypeFile {
+			e := snapshotfs.EntryFromDirEntry(rep, input)
+
+			opt.Description = "FILE:" + input.Name
+			opt.Compressor = pol.CompressionPolicy.CompressorForFile(e)
+			opt.Splitter = pol.SplitterPolicy.SplitterForFile(e)
+		}
+
+		oid, err := copyObject(ctx, rep, destRepo, input.ObjectID, opt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error copying %v", entryPath)
+		}
+
+		c.copiedFiles.Add(1)
+		c.copiedBytes.Add(input.FileSize)
+
+		result := input.Clone()
+		result.ObjectID = oid
+
+		return result, nil
+	}
+}
+
+func copyObject(ctx context.Context, rep repo.Repository, destRepo repo.RepositoryWriter, oid object.ID, opt object.WriterOptions) (object.ID, error) {
+	r, err := rep.OpenObject(ctx, oid)
+	if err != nil {
+		return object.EmptyID, errors.Wrap(err, "unable to open object")
+	}
+	defer r.Close() //nolint:errcheck
+
+	w := destRepo.NewObjectWriter(ctx, opt)
+	defer w.Close() //nolint:errcheck
+
+	// contents already present in the destination are not uploaded again.
+	if _, err := iocopy.Copy(w, r); err != nil {
+		return object.EmptyID, errors.Wrap(err, "unable to copy object data")
+	}
+
+	result, err := w.Result()
+	if err != nil {
+		return object.EmptyID, errors.Wrap(err, "unable to write object")
+	}
+
+	return result, nil
+}
+
+// haveCompatibleContentIDs returns true if both repositories compute identical content IDs for the same data.
+func haveCompatibleContentIDs(rep1, rep2 repo.Repository) bool {
+	dr1, ok1 := rep1.(repo.DirectRepository)
+	dr2, ok2 := rep2.(repo.DirectRepository)
+
+	if !ok1 || !ok2 {
+		return false
+	}
+
+	f1 := dr1.ContentReader().ContentFormat()
+	f2 := dr2.ContentReader().ContentFormat()
+
+	return f1.GetHashFunction() == f2.GetHashFunction() && bytes.Equal(f1.GetHmacSecret(), f2.GetHmacSecret())
+}
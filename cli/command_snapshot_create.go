@@ -17,6 +17,7 @@
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 	"github.com/kopia/kopia/snapshot/upload"
 )
 
@@ -46,15 +47,28 @@ type commandSnapshotCreate struct {
 
 	pins []string
 
+	alsoToConfigs []string
+	mirrorErrors  []string
+
 	logDirDetail   int
 	logEntryDetail int
 
 	jo  jsonOutput
-	svc appServices
+	svc advancedAppServices
 	out textOutput
 }
 
-func (c *commandSnapshotCreate) setup(svc appServices, parent commandParent) {
+// snapshotMirror is an additional repository receiving the snapshots created by 'snapshot create --also-to-config'.
+type snapshotMirror struct {
+	configFile string
+	rep        repo.Repository
+	w          repo.RepositoryWriter
+
+	// uploader mirror for the source being snapshotted, nil if it could not be created.
+	current *upload.Mirror
+}
+
+func (c *commandSnapshotCreate) setup(svc advancedAppServices, parent commandParent) {
 	cmd := parent.Command("create", "Creates a snapshot of local directory or file.")
 
 	cmd.Arg("source", "Files or directories to create snapshot(s) of.").StringsVar(&c.snapshotCreateSources)
@@ -75,6 +89,7 @@ func (c *commandSnapshotCreate) setup(svc appServices, parent commandParent) {
 	cmd.Flag("flush-per-source", "Flush writes at the end of each source").Hidden().BoolVar(&c.flushPerSource)
 	cmd.Flag("override-source", "Override the source of the snapshot.").StringVar(&c.sourceOverride)
 	cmd.Flag("send-snapshot-report", "Send a snapshot report notification using configured notification profiles").Default("true").BoolVar(&c.sendSnapshotReport)
+	cmd.Flag("also-to-config", "Configuration file of another repository to also write the snapshot to, from the same scan of the source (can be repeated)").ExistingFilesVar(&c.alsoToConfigs)
 
 	c.logDirDetail = -1
 	c.logEntryDetail = -1
@@ -124,6 +139,9 @@ func (c *commandSnapshotCreate) run(ctx context.Context, rep repo.RepositoryWrit
 
 	u := c.setupUploader(rep)
 
+	mirrors := c.openMirrors(ctx)
+	defer c.closeMirrors(ctx, mirrors)
+
 	var finalErrors []string
 
 	tags, err := getTags(c.snapshotCreateTags)
@@ -144,7 +162,7 @@ func (c *commandSnapshotCreate) run(ctx context.Context, rep repo.RepositoryWrit
 			finalErrors = append(finalErrors, fmt.Sprintf("failed to prepare source: %s", err))
 		}
 
-		if err := c.snapshotSingleSource(ctx, fsEntry, setManual, rep, u, sourceInfo, tags, &st); err != nil {
+		if err := c.snapshotSingleSource(ctx, fsEntry, setManual, rep, u, mirrors, sourceInfo, tags, &st); err != nil {
 			finalErrors = append(finalErrors, err.Error())
 		}
 	}
@@ -162,6 +180,8 @@ func (c *commandSnapshotCreate) run(ctx context.Context, rep repo.RepositoryWrit
 		}
 	}
 
+	finalErrors = append(finalErrors, c.mirrorErrors...)
+
 	if len(finalErrors) == 0 {
 		return nil
 	}
@@ -287,6 +307,7 @@ func (c *commandSnapshotCreate) snapshotSingleSource(
 	setManual bool,
 	rep repo.RepositoryWriter,
 	u *upload.Uploader,
+	mirrors []*snapshotMirror,
 	sourceInfo snapshot.SourceInfo,
 	tags map[string]string,
 	st *notifydata.MultiSnapshotStatus,
@@ -321,6 +342,9 @@ func (c *commandSnapshotCreate) snapshotSingleSource(
 		return errors.Wrap(finalErr, "unable to get policy tree")
 	}
 
+	u.Mirrors = c.startMirrors(ctx, mirrors, sourceInfo)
+	defer c.finishMirrors(ctx, mirrors, u)
+
 	manifest, finalErr := u.Upload(ctx, fsEntry, policyTree, sourceInfo, previous...)
 	if finalErr != nil {
 		// fail-fast uploads will fail here without recording a manifest, other uploads will
@@ -356,6 +380,8 @@ func (c *commandSnapshotCreate) snapshotSingleSource(
 
 	mwe.Manifest = *manifest
 
+	c.saveMirroredSnapshots(ctx, mirrors, manifest, setManual)
+
 	ignoreIdenticalSnapshot := policyTree.EffectivePolicy().RetentionPolicy.IgnoreIdenticalSnapshots.OrDefault(false)
 	if ignoreIdenticalSnapshot && len(previous) > 0 {
 		if previous[0].RootObjectID() == manifest.RootObjectID() {
@@ -368,7 +394,7 @@ func (c *commandSnapshotCreate) snapshotSingleSource(
 		return errors.Wrap(finalErr, "cannot save manifest")
 	}
 
-	if _, finalErr = policy.ApplyRetentionPolicy(ctx, rep, sourceInfo, true); finalErr != nil {
+	if _, finalErr = policy.ApplyRetentionPolicy(ctx, rep, sourceInfo, true, snapshotfs.CalculateStorageStats); finalErr != nil {
 		return errors.Wrap(finalErr, "unable to apply retention policy")
 	}
 
@@ -389,6 +415,146 @@ func (c *commandSnapshotCreate) snapshotSingleSource(
 	return c.reportSnapshotStatus(ctx, manifest)
 }
 
+// openMirrors opens repositories specified with --also-to-config, repositories which can't be opened
+// are reported as errors without affecting other repositories.
+func (c *commandSnapshotCreate) openMirrors(ctx context.Context) []*snapshotMirror {
+	var result []*snapshotMirror
+
+	for _, cfg := range c.alsoToConfigs {
+		r, err := openOtherRepository(ctx, c.svc, cfg, "mirror")
+		if err != nil {
+			c.mirrorFailed(ctx, cfg, err)
+			continue
+		}
+
+		_, w, err := r.NewWriter(ctx, repo.WriteSessionOptions{Purpose: "snapshot create mirror"})
+		if err != nil {
+			r.Close(ctx) //nolint:errcheck
+			c.mirrorFailed(ctx, cfg, errors.Wrap(err, "unable to create writer"))
+
+			continue
+		}
+
+		result = append(result, &snapshotMirror{configFile: cfg, rep: r, w: w})
+	}
+
+	return result
+}
+
+func (c *commandSnapshotCreate) closeMirrors(ctx context.Context, mirrors []*snapshotMirror) {
+	for _, sm := range mirrors {
+		// flush to close pending buffers even if the snapshot could not be written.
+		if err := sm.w.Flush(ctx); err != nil {
+			log(ctx).Errorf("error flushing mirror %v: %v", sm.configFile, err)
+		}
+
+		sm.w.Close(ctx)   //nolint:errcheck
+		sm.rep.Close(ctx) //nolint:errcheck
+	}
+}
+
+func (c *commandSnapshotCreate) mirrorFailed(ctx context.Context, configFile string, err error) {
+	log(ctx).Errorf("Mirror %v failed: %v", configFile, err)
+
+	c.mirrorErrors = append(c.mirrorErrors, fmt.Sprintf("mirror %v: %v", configFile, err))
+}
+
+// startMirrors returns uploader mirrors for all repositories specified with --also-to-config for the
+// given source.
+func (c *commandSnapshotCreate) startMirrors(ctx context.Context, mirrors []*snapshotMirror, sourceInfo snapshot.SourceInfo) []*upload.Mirror {
+	var result []*upload.Mirror
+
+	for _, sm := range mirrors {
+		previous, err := snapshot.FindPreviousManifests(ctx, sm.w, sourceInfo, nil)
+		if err != nil {
+			log(ctx).Debugf("unable to find previous manifests in mirror %v: %v", sm.configFile, err)
+		}
+
+		m, err := upload.NewMirror(ctx, sm.w, previous...)
+		if err != nil {
+			c.mirrorFailed(ctx, sm.configFile, err)
+			continue
+		}
+
+		sm.current = m
+		result = append(result, m)
+	}
+
+	return result
+}
+
+func (c *commandSnapshotCreate) finishMirrors(ctx context.Context, mirrors []*snapshotMirror, u *upload.Uploader) {
+	for _, sm := range mirrors {
+		if sm.current != nil {
+			sm.current.Close(ctx)
+			sm.current = nil
+		}
+	}
+
+	u.Mirrors = nil
+}
+
+// saveMirroredSnapshots saves the snapshot in all repositories which have successfully received its data.
+func (c *commandSnapshotCreate) saveMirroredSnapshots(ctx context.Context, mirrors []*snapshotMirror, manifest *snapshot.Manifest, setManual bool) {
+	for _, sm := range mirrors {
+		if sm.current == nil {
+			continue
+		}
+
+		if err := c.saveMirroredSnapshot(ctx, sm, manifest, setManual); err != nil {
+			c.mirrorFailed(ctx, sm.configFile, errors.Wrapf(err, "snapshot of %v", manifest.Source))
+		}
+	}
+}
+
+func (c *commandSnapshotCreate) saveMirroredSnapshot(ctx context.Context, sm *snapshotMirror, manifest *snapshot.Manifest, setManual bool) error {
+	mm, err := sm.current.Manifest(ctx, manifest)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	sourceInfo := mm.Source
+
+	policyTree, err := policy.TreeForSource(ctx, sm.w, sourceInfo)
+	if err != nil {
+		return errors.Wrap(err, "unable to get policy tree")
+	}
+
+	previous, err := snapshot.FindPreviousManifests(ctx, sm.w, sourceInfo, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to find previous manifests")
+	}
+
+	ignoreIdenticalSnapshot := policyTree.EffectivePolicy().RetentionPolicy.IgnoreIdenticalSnapshots.OrDefault(false)
+	if ignoreIdenticalSnapshot && len(previous) > 0 && previous[0].RootObjectID() == mm.RootObjectID() {
+		log(ctx).Infof("Not saving snapshot in mirror %v because no files have been changed since previous snapshot", sm.configFile)
+		return nil
+	}
+
+	if _, err := snapshot.SaveSnapshot(ctx, sm.w, mm); err != nil {
+		return errors.Wrap(err, "cannot save manifest")
+	}
+
+	if _, err := policy.ApplyRetentionPolicy(ctx, sm.w, sourceInfo, true, snapshotfs.CalculateStorageStats); err != nil {
+		return errors.Wrap(err, "unable to apply retention policy")
+	}
+
+	if setManual {
+		if err := policy.SetManual(ctx, sm.w, sourceInfo); err != nil {
+			return errors.Wrap(err, "unable to set manual field in scheduling policy for source")
+		}
+	}
+
+	// each mirror is flushed independently, so that its failure does not affect other repositories.
+	if err := sm.w.Flush(ctx); err != nil {
+		return errors.Wrap(err, "flush error")
+	}
+
+	log(ctx).Infof("Created snapshot with root %v and ID %v in mirror %v", mm.RootObjectID(), mm.ID, sm.configFile)
+
+	return nil
+}
+
 func (c *commandSnapshotCreate) reportSnapshotStatus(ctx context.Context, manifest *snapshot.Manifest) error {
 	var maybePartial string
 	if manifest.IncompleteReason != "" {
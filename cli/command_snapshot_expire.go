@@ -9,6 +9,7 @@
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
 type commandSnapshotExpire struct {
@@ -57,7 +58,7 @@ func (c *commandSnapshotExpire) run(ctx context.Context, rep repo.RepositoryWrit
 	})
 
 	for _, src := range sources {
-		deleted, err := policy.ApplyRetentionPolicy(ctx, rep, src, c.snapshotExpireDelete)
+		deleted, err := policy.ApplyRetentionPolicy(ctx, rep, src, c.snapshotExpireDelete, snapshotfs.CalculateStorageStats)
 		if err != nil {
 			return errors.Wrapf(err, "error applying retention policy to %v", src)
 		}
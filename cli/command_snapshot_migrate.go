@@ -138,21 +138,37 @@ func (c *commandSnapshotMigrate) run(ctx context.Context, destRepo repo.Reposito
 }
 
 func (c *commandSnapshotMigrate) openSourceRepo(ctx context.Context) (repo.Repository, error) {
-	pass, err := c.svc.passwordPersistenceStrategy().GetPassword(ctx, c.migrateSourceConfig)
+	return openOtherRepository(ctx, c.svc, c.migrateSourceConfig, "source")
+}
+
+// openOtherRepository opens the repository using the provided configuration file, other than the one
+// the command is connected to.
+func openOtherRepository(ctx context.Context, svc advancedAppServices, configFile, kind string) (repo.Repository, error) {
+	pass, err := otherRepositoryPassword(ctx, svc, configFile, kind)
 	if err != nil {
-		pass, err = c.svc.getPasswordFromFlags(ctx, false, false)
+		return nil, err
 	}
 
+	rep, err := repo.Open(ctx, configFile, pass, svc.optionsFromFlags(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open "+kind+" repository")
+	}
+
+	return rep, nil
+}
+
+// otherRepositoryPassword returns the password persisted for the given configuration file or provided in flags.
+func otherRepositoryPassword(ctx context.Context, svc advancedAppServices, configFile, kind string) (string, error) {
+	pass, err := svc.passwordPersistenceStrategy().GetPassword(ctx, configFile)
 	if err != nil {
-		return nil, errors.Wrap(err, "source repository password")
+		pass, err = svc.getPasswordFromFlags(ctx, false, false)
 	}
 
-	sourceRepo, err := repo.Open(ctx, c.migrateSourceConfig, pass, c.svc.optionsFromFlags(ctx))
 	if err != nil {
-		return nil, errors.Wrap(err, "can't open source repository")
+		return "", errors.Wrap(err, kind+" repository password")
 	}
 
-	return sourceRepo, nil
+	return pass, nil
 }
 
 func (c *commandSnapshotMigrate) migratePoliciesForSources(ctx context.Context, sourceRepo repo.Repository, destRepo repo.RepositoryWriter, sources []snapshot.SourceInfo) error {
@@ -206,7 +222,8 @@ func (c *commandSnapshotMigrate) migrateSinglePolicy(ctx context.Context, source
 	return errors.Wrap(policy.SetPolicy(ctx, destRepo, si, pol), "error setting policy")
 }
 
-func (c *commandSnapshotMigrate) findPreviousSnapshotManifestWithStartTime(ctx context.Context, rep repo.Repository, sourceInfo snapshot.SourceInfo, startTime fs.UTCTimestamp) (*snapshot.Manifest, error) {
+// findSnapshotManifestWithStartTime returns the snapshot of the provided source with the provided start time, nil if not found.
+func findSnapshotManifestWithStartTime(ctx context.Context, rep repo.Repository, sourceInfo snapshot.SourceInfo, startTime fs.UTCTimestamp) (*snapshot.Manifest, error) {
 	previous, err := snapshot.ListSnapshots(ctx, rep, sourceInfo)
 	if err != nil {
 		return nil, errors.Wrap(err, "error listing previous snapshots")
@@ -260,7 +277,7 @@ func (c *commandSnapshotMigrate) migrateSingleSourceSnapshot(ctx context.Context
 		return errors.Wrap(err, "error getting snapshot root entry")
 	}
 
-	existing, err := c.findPreviousSnapshotManifestWithStartTime(ctx, destRepo, m.Source, m.StartTime)
+	existing, err := findSnapshotManifestWithStartTime(ctx, destRepo, m.Source, m.StartTime)
 	if err != nil {
 		return err
 	}
@@ -7,6 +7,8 @@ type commandServerUser struct {
 	hash   commandServerUserHashPassword
 	info   commandServerUserInfo
 	list   commandServerUserList
+	group  commandServerUserGroup
+	token  commandServerUserToken
 }
 
 func (c *commandServerUser) setup(svc appServices, parent commandParent) {
@@ -18,4 +20,6 @@ func (c *commandServerUser) setup(svc appServices, parent commandParent) {
 	c.hash.setup(svc, cmd)
 	c.info.setup(svc, cmd)
 	c.list.setup(svc, cmd)
+	c.group.setup(svc, cmd)
+	c.token.setup(svc, cmd)
 }
@@ -0,0 +1,17 @@
+package cli
+
+type commandServerUserGroup struct {
+	add    commandServerUserGroupAdd
+	remove commandServerUserGroupRemove
+	delete commandServerUserGroupDelete
+	list   commandServerUserGroupList
+}
+
+func (c *commandServerUserGroup) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("groups", "Manage groups of repository users").Alias("group")
+
+	c.add.setup(svc, cmd)
+	c.remove.setup(svc, cmd)
+	c.delete.setup(svc, cmd)
+	c.list.setup(svc, cmd)
+}
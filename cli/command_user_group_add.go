@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserGroupAdd struct {
+	name    string
+	members []string
+}
+
+func (c *commandServerUserGroupAdd) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("add", "Add users to a group, creating it if needed")
+	cmd.Arg("group", "The name of the group.").Required().StringVar(&c.name)
+	cmd.Arg("members", "Users (username@hostname) to add.").StringsVar(&c.members)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerUserGroupAdd) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	g, err := user.GetGroup(ctx, rep, c.name)
+	if errors.Is(err, user.ErrGroupNotFound) {
+		g, err = &user.Group{Name: c.name}, nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "error getting group")
+	}
+
+	if err := g.AddMembers(c.members...); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if err := user.SetGroup(ctx, rep, g); err != nil {
+		return errors.Wrap(err, "error setting group")
+	}
+
+	log(ctx).Infof("Group %q now has %v members.", c.name, len(g.Members))
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserGroupDelete struct {
+	name string
+}
+
+func (c *commandServerUserGroupDelete) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("delete", "Delete group").Alias("rm")
+	cmd.Arg("group", "The name of the group to delete.").Required().StringVar(&c.name)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerUserGroupDelete) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	if err := user.DeleteGroup(ctx, rep, c.name); err != nil {
+		return errors.Wrap(err, "error deleting group")
+	}
+
+	log(ctx).Infof("Group %q deleted.", c.name)
+
+	return nil
+}
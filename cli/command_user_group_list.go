@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserGroupList struct {
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandServerUserGroupList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List groups").Alias("ls")
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+}
+
+func (c *commandServerUserGroupList) run(ctx context.Context, rep repo.Repository) error {
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	groups, err := user.ListGroups(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "error listing groups")
+	}
+
+	for _, g := range groups {
+		if c.jo.jsonOutput {
+			jl.emit(g)
+		} else {
+			c.out.printStdout("%v: %v\n", g.Name, strings.Join(g.Members, " "))
+		}
+	}
+
+	return nil
+}
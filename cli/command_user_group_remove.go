@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserGroupRemove struct {
+	name    string
+	members []string
+}
+
+func (c *commandServerUserGroupRemove) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("remove", "Remove users from a group")
+	cmd.Arg("group", "The name of the group.").Required().StringVar(&c.name)
+	cmd.Arg("members", "Users (username@hostname) to remove.").Required().StringsVar(&c.members)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerUserGroupRemove) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	g, err := user.GetGroup(ctx, rep, c.name)
+	if err != nil {
+		return errors.Wrap(err, "error getting group")
+	}
+
+	g.RemoveMembers(c.members...)
+
+	if err := user.SetGroup(ctx, rep, g); err != nil {
+		return errors.Wrap(err, "error setting group")
+	}
+
+	log(ctx).Infof("Group %q now has %v members.", c.name, len(g.Members))
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestUserGroupCommands(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndVerifyOutputLineCount(t, 0, "server", "user", "group", "list")
+
+	e.RunAndExpectSuccess(t, "server", "user", "group", "add", "engineering", "bob@laptop2", "alice@laptop1")
+	e.RunAndExpectSuccess(t, "server", "user", "group", "add", "support", "carol@desk")
+	e.RunAndExpectFailure(t, "server", "user", "group", "add", "support", "not-a-user")
+	e.RunAndExpectFailure(t, "server", "user", "group", "add", "Bad Name")
+
+	require.Equal(t, []string{
+		"engineering: alice@laptop1 bob@laptop2",
+		"support: carol@desk",
+	}, e.RunAndExpectSuccess(t, "server", "user", "group", "list"))
+
+	e.RunAndExpectSuccess(t, "server", "user", "group", "remove", "engineering", "bob@laptop2")
+	e.RunAndExpectSuccess(t, "server", "user", "group", "delete", "support")
+	e.RunAndExpectFailure(t, "server", "user", "group", "delete", "support")
+
+	require.Equal(t, []string{
+		"engineering: alice@laptop1",
+	}, e.RunAndExpectSuccess(t, "server", "user", "group", "list"))
+
+	// ACL entries can target groups.
+	e.RunAndExpectSuccess(t, "server", "acl", "add", "--user", "group:engineering", "--target", "type=snapshot", "--access=READ")
+	e.RunAndExpectFailure(t, "server", "acl", "add", "--user", "group:", "--target", "type=snapshot", "--access=READ")
+	e.RunAndVerifyOutputLineCount(t, 1, "server", "acl", "list")
+}
@@ -0,0 +1,15 @@
+package cli
+
+type commandServerUserToken struct {
+	create commandServerUserTokenCreate
+	list   commandServerUserTokenList
+	revoke commandServerUserTokenRevoke
+}
+
+func (c *commandServerUserToken) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("tokens", "Manage API tokens of repository users").Alias("token")
+
+	c.create.setup(svc, cmd)
+	c.list.setup(svc, cmd)
+	c.revoke.setup(svc, cmd)
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserTokenCreate struct {
+	username    string
+	description string
+	scopes      []string
+	expires     string
+
+	out textOutput
+}
+
+func (c *commandServerUserTokenCreate) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("create", "Create API token")
+	cmd.Arg("username", "The user (username@hostname) the token authenticates as.").Required().StringVar(&c.username)
+	cmd.Flag("description", "Token description").StringVar(&c.description)
+	cmd.Flag("scope", "Scope granted to the token (can be specified multiple times)").Required().EnumsVar(&c.scopes, user.SupportedTokenScopes()...)
+	cmd.Flag("expires", "Token validity (e.g. 12h, 90d), 0 means never").Default("90d").StringVar(&c.expires)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+	c.out.setup(svc)
+}
+
+func (c *commandServerUserTokenCreate) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	validity, err := parseDurationWithDays(c.expires)
+	if err != nil {
+		return errors.Wrap(err, "invalid expiration")
+	}
+
+	t, token, err := user.NewToken(c.username, c.description, c.scopes, clock.Now(), validity)
+	if err != nil {
+		return errors.Wrap(err, "error creating token")
+	}
+
+	if err := user.SetToken(ctx, rep, t); err != nil {
+		return errors.Wrap(err, "error writing token")
+	}
+
+	log(ctx).Infof("Created token %v for %v. It will not be shown again.", t.ID, t.Username)
+
+	c.out.printStdout("%v\n", token)
+
+	return nil
+}
+
+// parseDurationWithDays parses durations supporting a 'd' suffix for days in addition to time.ParseDuration units.
+func parseDurationWithDays(s string) (time.Duration, error) {
+	if d, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid number of days %q", d)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil //nolint:mnd
+	}
+
+	//nolint:wrapcheck
+	return time.ParseDuration(s)
+}
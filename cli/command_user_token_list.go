@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserTokenList struct {
+	username string
+
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandServerUserTokenList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List API tokens").Alias("ls")
+	cmd.Arg("username", "Only list tokens of the given user.").StringVar(&c.username)
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+}
+
+func (c *commandServerUserTokenList) run(ctx context.Context, rep repo.Repository) error {
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	tokens, err := user.ListTokens(ctx, rep, c.username)
+	if err != nil {
+		return errors.Wrap(err, "error listing tokens")
+	}
+
+	now := clock.Now()
+
+	for _, t := range tokens {
+		if c.jo.jsonOutput {
+			jl.emit(t)
+			continue
+		}
+
+		c.out.printStdout("%v %v scopes:%v created:%v expires:%v last-used:%v%v\n",
+			t.ID,
+			t.Username,
+			strings.Join(t.Scopes, ","),
+			formatTimestamp(t.CreatedAt),
+			tokenTimeOrDefault(t.ExpiresAt, "never"),
+			tokenTimeOrDefault(t.LastUsed, "never"),
+			expiredSuffix(t.IsExpired(now)))
+	}
+
+	return nil
+}
+
+func tokenTimeOrDefault(t time.Time, def string) string {
+	if t.IsZero() {
+		return def
+	}
+
+	return formatTimestamp(t)
+}
+
+func expiredSuffix(expired bool) string {
+	if expired {
+		return " (expired)"
+	}
+
+	return ""
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserTokenRevoke struct {
+	id string
+}
+
+func (c *commandServerUserTokenRevoke) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("revoke", "Revoke API token").Alias("delete").Alias("rm")
+	cmd.Arg("id", "The ID of the token to revoke.").Required().StringVar(&c.id)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerUserTokenRevoke) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	if err := user.DeleteToken(ctx, rep, c.id); err != nil {
+		return errors.Wrap(err, "error revoking token")
+	}
+
+	log(ctx).Infof("Token %q revoked.", c.id)
+
+	return nil
+}
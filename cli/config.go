@@ -17,6 +17,7 @@
 	"github.com/kopia/kopia/fs/localfs"
 	"github.com/kopia/kopia/internal/ospath"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
 )
 
 func deprecatedFlag(w io.Writer, help string) func(_ *kingpin.ParseContext) error {
@@ -30,6 +31,11 @@ func (c *App) onRepositoryFatalError(f func(err error)) {
 	c.onFatalErrorCallbacks = append(c.onFatalErrorCallbacks, f)
 }
 
+// onRepositoryStorage registers a wrapper applied to the storage of repositories opened by the command.
+func (c *App) onRepositoryStorage(wrap func(st blob.Storage) blob.Storage) {
+	c.storageWrappers = append(c.storageWrappers, wrap)
+}
+
 func (c *App) onTerminate(f func()) {
 	s := make(chan os.Signal, 1)
 	signal.Notify(s, os.Interrupt, syscall.SIGTERM)
@@ -91,6 +97,14 @@ func (c *App) optionsFromFlags(ctx context.Context) *repo.Options {
 			c.exitWithError(err)
 		},
 
+		WrapStorage: func(st blob.Storage) blob.Storage {
+			for _, wrap := range c.storageWrappers {
+				st = wrap(st)
+			}
+
+			return st
+		},
+
 		TestOnlyIgnoreMissingRequiredFeatures: c.testonlyIgnoreMissingRequiredFeatures,
 	}
 }
@@ -53,8 +53,10 @@ type observabilityFlags struct {
 	metricsOutputDir    string
 	outputFilePrefix    string
 
-	enableJaeger bool
-	otlpTrace    bool
+	enableJaeger      bool
+	otlpTrace         bool
+	otlpTraceEndpoint string
+	otlpTraceInsecure bool
 
 	stopPusher chan struct{}
 	pusherWG   sync.WaitGroup
@@ -77,6 +79,8 @@ func (c *observabilityFlags) setup(svc appServices, app *kingpin.Application) {
 	// tracing (OTLP) parameters
 	app.Flag("enable-jaeger-collector", "(DEPRECATED) Emit OpenTelemetry traces to Jaeger collector").Hidden().Envar(svc.EnvName("KOPIA_ENABLE_JAEGER_COLLECTOR")).BoolVar(&c.enableJaeger)
 	app.Flag("otlp-trace", "Send OpenTelemetry traces to OTLP collector using gRPC").Hidden().Envar(svc.EnvName("KOPIA_ENABLE_OTLP_TRACE")).BoolVar(&c.otlpTrace)
+	app.Flag("otlp-trace-endpoint", "Address (host:port) of the OTLP collector, defaults to OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317").Hidden().Envar(svc.EnvName("KOPIA_OTLP_TRACE_ENDPOINT")).StringVar(&c.otlpTraceEndpoint)
+	app.Flag("otlp-trace-insecure", "Connect to OTLP collector without TLS").Hidden().Envar(svc.EnvName("KOPIA_OTLP_TRACE_INSECURE")).BoolVar(&c.otlpTraceInsecure)
 
 	var formats []string
 
@@ -203,8 +207,18 @@ func (c *observabilityFlags) maybeStartTraceExporter(ctx context.Context) error
 		return nil
 	}
 
+	var opts []otlptracegrpc.Option
+
+	if c.otlpTraceEndpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(c.otlpTraceEndpoint))
+	}
+
+	if c.otlpTraceInsecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
 	// Create the OTLP exporter.
-	se := otlptracegrpc.NewUnstarted()
+	se := otlptracegrpc.NewUnstarted(opts...)
 
 	r := resource.NewWithAttributes(
 		semconv.SchemaURL,
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/composite"
+)
+
+type storageCompositeFlags struct {
+	defaultFile string
+	routes      []string
+}
+
+func (c *storageCompositeFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("default", "Path to the JSON file with connection info ({\"type\":...,\"config\":{...}}) of the storage for BLOBs not matching any route").Required().StringVar(&c.defaultFile)
+	cmd.Flag("route", "Route BLOBs with a given prefix to the storage with connection info in a JSON file (can be repeated)").PlaceHolder("PREFIX=FILE").StringsVar(&c.routes)
+}
+
+func (c *storageCompositeFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	_ = formatVersion
+
+	var opt composite.Options
+
+	var err error
+
+	if opt.Default, err = readConnectionInfoFile(c.defaultFile); err != nil {
+		return nil, errors.Wrap(err, "invalid default storage")
+	}
+
+	for _, r := range c.routes {
+		prefix, fname, ok := strings.Cut(r, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid route %q, expected PREFIX=FILE", r)
+		}
+
+		ci, err := readConnectionInfoFile(fname)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid storage for prefix %q", prefix)
+		}
+
+		opt.Routes = append(opt.Routes, composite.Route{
+			Prefix:  blob.ID(prefix),
+			Storage: ci,
+		})
+	}
+
+	//nolint:wrapcheck
+	return composite.New(ctx, &opt, isCreate)
+}
+
+func readConnectionInfoFile(fname string) (blob.ConnectionInfo, error) {
+	var ci blob.ConnectionInfo
+
+	b, err := os.ReadFile(fname) //nolint:gosec
+	if err != nil {
+		return ci, errors.Wrap(err, "unable to read connection info")
+	}
+
+	if err := json.Unmarshal(b, &ci); err != nil {
+		return ci, errors.Wrap(err, "unable to parse connection info")
+	}
+
+	return ci, nil
+}
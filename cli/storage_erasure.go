@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/erasure"
+)
+
+type storageErasureFlags struct {
+	options erasure.Options
+
+	storageFiles []string
+}
+
+func (c *storageErasureFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("data-shards", "Number of data shards, any that many shards are sufficient to read each BLOB").Required().IntVar(&c.options.DataShards)
+	cmd.Flag("parity-shards", "Number of parity shards, which is the number of storages that can be lost").Required().IntVar(&c.options.ParityShards)
+	cmd.Flag("storage", "Path to the JSON file with connection info ({\"type\":...,\"config\":{...}}) of the storage of the next shard, must be repeated for each shard").Required().StringsVar(&c.storageFiles)
+	cmd.Flag("write-quorum", "Minimum number of shards which must be written (default: all)").IntVar(&c.options.WriteQuorum)
+}
+
+func (c *storageErasureFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	_ = formatVersion
+
+	opt := c.options
+	opt.Storages = nil
+
+	for i, fname := range c.storageFiles {
+		ci, err := readConnectionInfoFile(fname)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid storage of shard %v", i)
+		}
+
+		opt.Storages = append(opt.Storages, ci)
+	}
+
+	//nolint:wrapcheck
+	return erasure.New(ctx, &opt, isCreate)
+}
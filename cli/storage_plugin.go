@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/plugin"
+)
+
+type storagePluginFlags struct {
+	opt plugin.Options
+}
+
+func (c *storagePluginFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClause) {
+	// kingpin requires map flags to be initialized.
+	c.opt.Config = map[string]string{}
+	c.opt.SecretConfig = map[string]string{}
+
+	cmd.Flag("name", "Name of the plugin, the plugin executable named '"+plugin.ExecutablePrefix+"<name>' is looked up in PATH").Required().StringVar(&c.opt.Name)
+	cmd.Flag("executable", "Path to the plugin executable").StringVar(&c.opt.Executable)
+	cmd.Flag("option", "Configuration option passed to the plugin (can be repeated)").PlaceHolder("KEY=VALUE").StringMapVar(&c.opt.Config)
+	cmd.Flag("secret-option", "Configuration option passed to the plugin which is not displayed (can be repeated)").PlaceHolder("KEY=VALUE").StringMapVar(&c.opt.SecretConfig)
+	cmd.Flag("plugin-startup-timeout", "Time to wait for the plugin to start").Default("30s").DurationVar(&c.opt.StartupTimeout.Duration)
+
+	commonThrottlingFlags(cmd, &c.opt.Limits)
+}
+
+func (c *storagePluginFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	_ = formatVersion
+
+	//nolint:wrapcheck
+	return plugin.New(ctx, &c.opt, isCreate)
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginFlags(t *testing.T) {
+	app := kingpin.New("test", "test")
+
+	var c storagePluginFlags
+
+	c.Setup(nil, app.Command("plugin", "plugin"))
+
+	_, err := app.Parse([]string{
+		"plugin",
+		"--name=test",
+		"--option", "path=/some/path",
+		"--option", "region=us-east-1",
+		"--secret-option", "token=secret-token",
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "test", c.opt.Name)
+	require.Equal(t, map[string]string{"path": "/some/path", "region": "us-east-1"}, c.opt.Config)
+	require.Equal(t, map[string]string{"token": "secret-token"}, c.opt.SecretConfig)
+}
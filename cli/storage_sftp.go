@@ -24,10 +24,14 @@ func (c *storageSFTPFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClau
 	cmd.Flag("port", "SFTP/SSH server port").Default("22").IntVar(&c.options.Port)
 	cmd.Flag("username", "SFTP/SSH server username").Required().StringVar(&c.options.Username)
 
-	// one of those 3 must be provided
+	// one of those 4 must be provided
 	cmd.Flag("sftp-password", "SFTP/SSH server password").StringVar(&c.options.Password)
 	cmd.Flag("keyfile", "path to private key file for SFTP/SSH server").StringVar(&c.options.Keyfile)
 	cmd.Flag("key-data", "private key data").StringVar(&c.options.KeyData)
+	cmd.Flag("use-agent", "Authenticate using keys held by SSH agent").BoolVar(&c.options.UseAgent)
+
+	cmd.Flag("certificate-file", "path to OpenSSH certificate of the private key").StringVar(&c.options.CertificateFile)
+	cmd.Flag("certificate-data", "OpenSSH certificate of the private key").StringVar(&c.options.CertificateData)
 
 	// one of those 2 must be provided
 	cmd.Flag("known-hosts", "path to known_hosts file").StringVar(&c.options.KnownHostsFile)
@@ -39,6 +43,9 @@ func (c *storageSFTPFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClau
 	cmd.Flag("ssh-command", "SSH command").Default("ssh").StringVar(&c.options.SSHCommand)
 	cmd.Flag("ssh-args", "Arguments to external SSH command").StringVar(&c.options.SSHArguments)
 
+	cmd.Flag("max-connections", "Maximum number of SSH connections used in parallel").Default("1").IntVar(&c.options.MaxConnections)
+	cmd.Flag("keepalive-interval", "Interval of SSH keepalive messages").Default("30s").DurationVar(&c.options.KeepaliveInterval.Duration)
+
 	cmd.Flag("flat", "Use flat directory structure").BoolVar(&c.connectFlat)
 	cmd.Flag("list-parallelism", "Set list parallelism").Hidden().IntVar(&c.options.ListParallelism)
 
@@ -51,7 +58,7 @@ func (c *storageSFTPFlags) getOptions(formatVersion int) (*sftp.Options, error)
 	//nolint:nestif
 	if !sftpo.ExternalSSH {
 		if c.embedCredentials {
-			if sftpo.KeyData == "" {
+			if sftpo.KeyData == "" && sftpo.Keyfile != "" {
 				d, err := os.ReadFile(sftpo.Keyfile)
 				if err != nil {
 					return nil, errors.Wrap(err, "unable to read key file")
@@ -70,6 +77,16 @@ func (c *storageSFTPFlags) getOptions(formatVersion int) (*sftp.Options, error)
 				sftpo.KnownHostsData = string(d)
 				sftpo.KnownHostsFile = ""
 			}
+
+			if sftpo.CertificateData == "" && sftpo.CertificateFile != "" {
+				d, err := os.ReadFile(sftpo.CertificateFile)
+				if err != nil {
+					return nil, errors.Wrap(err, "unable to read certificate file")
+				}
+
+				sftpo.CertificateData = string(d)
+				sftpo.CertificateFile = ""
+			}
 		}
 
 		switch {
@@ -85,8 +102,19 @@ func (c *storageSFTPFlags) getOptions(formatVersion int) (*sftp.Options, error)
 
 			sftpo.Keyfile = a
 
+		case sftpo.UseAgent: // ok
+
 		default:
-			return nil, errors.New("must provide either --sftp-password, --keyfile or --key-data")
+			return nil, errors.New("must provide either --sftp-password, --keyfile, --key-data or --use-agent")
+		}
+
+		if sftpo.CertificateFile != "" {
+			a, err := filepath.Abs(sftpo.CertificateFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "error getting absolute path")
+			}
+
+			sftpo.CertificateFile = a
 		}
 
 		switch {
@@ -17,9 +17,11 @@ func TestSFTPOptions(t *testing.T) {
 
 	myKeyFile := filepath.Join(td, "my-key")
 	myKnownHostsFile := filepath.Join(td, "my-known-hosts")
+	myCertFile := filepath.Join(td, "my-key-cert.pub")
 
 	require.NoError(t, os.WriteFile(myKeyFile, []byte("fake-key-data"), 0o600))
 	require.NoError(t, os.WriteFile(myKnownHostsFile, []byte("fake-known-hosts-data"), 0o600))
+	require.NoError(t, os.WriteFile(myCertFile, []byte("fake-cert-data"), 0o600))
 
 	cases := []struct {
 		input   storageSFTPFlags
@@ -83,7 +85,7 @@ func TestSFTPOptions(t *testing.T) {
 					KnownHostsFile: "my-known-hosts",
 				},
 			},
-			wantErr: "must provide either --sftp-password, --keyfile or --key-data",
+			wantErr: "must provide either --sftp-password, --keyfile, --key-data or --use-agent",
 		},
 		// 4
 		{
@@ -163,6 +165,69 @@ func TestSFTPOptions(t *testing.T) {
 				},
 			},
 		},
+		// 8
+		{
+			input: storageSFTPFlags{
+				options: sftp.Options{
+					Host:           "some-host",
+					Port:           222,
+					Username:       "user",
+					UseAgent:       true,
+					KnownHostsFile: myKnownHostsFile,
+				},
+				embedCredentials: true,
+			},
+			want: &sftp.Options{
+				Host:           "some-host",
+				Port:           222,
+				Username:       "user",
+				UseAgent:       true,
+				KnownHostsData: "fake-known-hosts-data",
+			},
+		},
+		// 9
+		{
+			input: storageSFTPFlags{
+				options: sftp.Options{
+					Host:            "some-host",
+					Port:            222,
+					Username:        "user",
+					KnownHostsFile:  "my-known-hosts",
+					Keyfile:         "my-key",
+					CertificateFile: "my-key-cert.pub",
+				},
+			},
+			want: &sftp.Options{
+				Host:            "some-host",
+				Port:            222,
+				Username:        "user",
+				KnownHostsFile:  mustFileAbs(t, "my-known-hosts"),
+				Keyfile:         mustFileAbs(t, "my-key"),
+				CertificateFile: mustFileAbs(t, "my-key-cert.pub"),
+			},
+		},
+		// 10
+		{
+			input: storageSFTPFlags{
+				options: sftp.Options{
+					Host:            "some-host",
+					Port:            222,
+					Username:        "user",
+					KnownHostsFile:  myKnownHostsFile,
+					Keyfile:         myKeyFile,
+					CertificateFile: myCertFile,
+				},
+				embedCredentials: true,
+			},
+			want: &sftp.Options{
+				Host:            "some-host",
+				Port:            222,
+				Username:        "user",
+				KeyData:         "fake-key-data",
+				KnownHostsData:  "fake-known-hosts-data",
+				CertificateData: "fake-cert-data",
+			},
+		},
 	}
 
 	for i, tc := range cases {
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/smb"
+)
+
+type storageSMBFlags struct {
+	options     smb.Options
+	connectFlat bool
+}
+
+func (c *storageSMBFlags) Setup(svc StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("host", "SMB server hostname").Required().StringVar(&c.options.Host)
+	cmd.Flag("port", "SMB server port").Default("445").IntVar(&c.options.Port)
+	cmd.Flag("share", "Name of the SMB share").Required().StringVar(&c.options.Share)
+	cmd.Flag("path", "Path to the repository relative to the root of the share").StringVar(&c.options.Path)
+	cmd.Flag("smb-username", "SMB username").Envar(svc.EnvName("KOPIA_SMB_USERNAME")).Required().StringVar(&c.options.Username)
+	cmd.Flag("smb-password", "SMB password").Envar(svc.EnvName("KOPIA_SMB_PASSWORD")).StringVar(&c.options.Password)
+	cmd.Flag("smb-ntlm-hash", "Hex-encoded NT hash of the SMB password, used instead of the password").Envar(svc.EnvName("KOPIA_SMB_NTLM_HASH")).StringVar(&c.options.NTLMHash)
+	cmd.Flag("smb-domain", "SMB (NTLM) domain").StringVar(&c.options.Domain)
+	cmd.Flag("smb-workstation", "Workstation name sent to the SMB server").StringVar(&c.options.Workstation)
+	cmd.Flag("flat", "Use flat directory structure").BoolVar(&c.connectFlat)
+	cmd.Flag("list-parallelism", "Set list parallelism").Hidden().IntVar(&c.options.ListParallelism)
+
+	commonThrottlingFlags(cmd, &c.options.Limits)
+}
+
+func (c *storageSMBFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
+	so := c.options
+
+	if so.Password == "" && so.NTLMHash == "" {
+		pass, err := askPass(os.Stdout, "Enter SMB password: ")
+		if err != nil {
+			return nil, err
+		}
+
+		so.Password = pass
+	}
+
+	so.DirectoryShards = initialDirectoryShards(c.connectFlat, formatVersion)
+
+	//nolint:wrapcheck
+	return smb.New(ctx, &so, isCreate)
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/swift"
+)
+
+type storageSwiftFlags struct {
+	options swift.Options
+}
+
+func (c *storageSwiftFlags) Setup(svc StorageProviderServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("container", "Name of the Swift container").Required().StringVar(&c.options.Container)
+	cmd.Flag("prefix", "Prefix to use for objects in the container").StringVar(&c.options.Prefix)
+	cmd.Flag("auth-url", "Keystone v3 authentication URL (overrides OS_AUTH_URL environment variable)").Required().Envar(svc.EnvName("OS_AUTH_URL")).StringVar(&c.options.AuthURL)
+	cmd.Flag("swift-username", "Keystone username (overrides OS_USERNAME environment variable)").Envar(svc.EnvName("OS_USERNAME")).StringVar(&c.options.Username)
+	cmd.Flag("swift-password", "Keystone password (overrides OS_PASSWORD environment variable)").Envar(svc.EnvName("OS_PASSWORD")).StringVar(&c.options.Password)
+	cmd.Flag("user-domain", "Domain of the user (overrides OS_USER_DOMAIN_NAME environment variable)").Envar(svc.EnvName("OS_USER_DOMAIN_NAME")).StringVar(&c.options.UserDomain)
+	cmd.Flag("application-credential-id", "Application credential ID (overrides OS_APPLICATION_CREDENTIAL_ID environment variable)").Envar(svc.EnvName("OS_APPLICATION_CREDENTIAL_ID")).StringVar(&c.options.ApplicationCredentialID)
+	cmd.Flag("application-credential-secret", "Application credential secret (overrides OS_APPLICATION_CREDENTIAL_SECRET environment variable)").Envar(svc.EnvName("OS_APPLICATION_CREDENTIAL_SECRET")).StringVar(&c.options.ApplicationCredentialSecret)
+	cmd.Flag("project-name", "Name of the project (overrides OS_PROJECT_NAME environment variable)").Envar(svc.EnvName("OS_PROJECT_NAME")).StringVar(&c.options.ProjectName)
+	cmd.Flag("project-id", "ID of the project (overrides OS_PROJECT_ID environment variable)").Envar(svc.EnvName("OS_PROJECT_ID")).StringVar(&c.options.ProjectID)
+	cmd.Flag("project-domain", "Domain of the project, if different from the user domain (overrides OS_PROJECT_DOMAIN_NAME environment variable)").Envar(svc.EnvName("OS_PROJECT_DOMAIN_NAME")).StringVar(&c.options.ProjectDomain)
+	cmd.Flag("region", "Region of the Swift endpoint (overrides OS_REGION_NAME environment variable)").Envar(svc.EnvName("OS_REGION_NAME")).StringVar(&c.options.Region)
+	cmd.Flag("endpoint-type", "Interface of the Swift endpoint").Default("public").EnumVar(&c.options.EndpointType, "public", "internal", "admin")
+	cmd.Flag("segment-size", "Blobs larger than this are stored as static large objects with segments of this size").Default("1073741824").Int64Var(&c.options.SegmentSize)
+	cmd.Flag("segment-container", "Name of the container for segments of large objects (default: <container>_segments)").StringVar(&c.options.SegmentContainer)
+
+	commonThrottlingFlags(cmd, &c.options.Limits)
+}
+
+func (c *storageSwiftFlags) Connect(ctx context.Context, isCreate bool, _ int) (blob.Storage, error) {
+	//nolint:wrapcheck
+	return swift.New(ctx, &c.options, isCreate)
+}
@@ -11,8 +11,9 @@
 )
 
 type storageWebDAVFlags struct {
-	options     webdav.Options
-	connectFlat bool
+	options      webdav.Options
+	connectFlat  bool
+	chunkSizeMiB int64
 }
 
 func (c *storageWebDAVFlags) Setup(svc StorageProviderServices, cmd *kingpin.CmdClause) {
@@ -22,6 +23,8 @@ func (c *storageWebDAVFlags) Setup(svc StorageProviderServices, cmd *kingpin.Cmd
 	cmd.Flag("webdav-password", "WebDAV password").Envar(svc.EnvName("KOPIA_WEBDAV_PASSWORD")).StringVar(&c.options.Password)
 	cmd.Flag("list-parallelism", "Set list parallelism").Hidden().IntVar(&c.options.ListParallelism)
 	cmd.Flag("atomic-writes", "Assume WebDAV provider implements atomic writes").BoolVar(&c.options.AtomicWrites)
+	cmd.Flag("chunk-size-mb", "Size of chunks used for uploads to servers supporting Nextcloud-style chunked uploads (0 disables chunked uploads)").Default("10").Int64Var(&c.chunkSizeMiB)
+	cmd.Flag("uploads-url", "URL of the collection used for chunked uploads (derived automatically for Nextcloud and ownCloud)").StringVar(&c.options.UploadsURL)
 
 	commonThrottlingFlags(cmd, &c.options.Limits)
 }
@@ -40,6 +43,12 @@ func (c *storageWebDAVFlags) Connect(ctx context.Context, isCreate bool, formatV
 
 	wo.DirectoryShards = initialDirectoryShards(c.connectFlat, formatVersion)
 
+	if c.chunkSizeMiB > 0 {
+		wo.ChunkSize = c.chunkSizeMiB << 20 //nolint:mnd
+	} else {
+		wo.ChunkSize = -1
+	}
+
 	//nolint:wrapcheck
 	return webdav.New(ctx, &wo, isCreate)
 }
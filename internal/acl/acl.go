@@ -4,6 +4,7 @@
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -23,6 +24,9 @@
 	OwnHost = "OWN_HOST"
 )
 
+// GroupPrefix is the prefix of Entry.User which makes the entry apply to all members of a group.
+const GroupPrefix = "group:"
+
 // TargetRule specifies a list of key and values that must match labels on the target manifest.
 // The value can have two special placeholders - OWN_USER and OWN_VALUE representing the matched user
 // and host respectively if wildcards are being used.
@@ -64,9 +68,15 @@ func (r TargetRule) matches(target map[string]string, username, hostname string)
 // user certain level of access to a target.
 type Entry struct {
 	ManifestID manifest.ID `json:"-"`
-	User       string      `json:"user"`   // supports wildcards such as "*@*", "user@host", "*@host, user@*"
+	User       string      `json:"user"`   // supports wildcards such as "*@*", "user@host", "*@host, user@*" and groups "group:name"
 	Target     TargetRule  `json:"target"` // supports OwnUser and OwnHost in labels
 	Access     AccessLevel `json:"access,omitempty"`
+	Expires    *time.Time  `json:"expires,omitempty"` // entry is ignored after this time and removed by maintenance
+}
+
+// IsExpired returns true if the entry has expired at the given time.
+func (e *Entry) IsExpired(now time.Time) bool {
+	return e.Expires != nil && !now.Before(*e.Expires)
 }
 
 type valueValidatorFunc func(v string) error
@@ -113,6 +123,13 @@ func oneOf(allowed ...string) valueValidatorFunc {
 	user.ManifestType: {
 		user.UsernameAtHostnameLabel: nonEmptyString,
 	},
+	user.GroupManifestType: {
+		user.GroupNameLabel: nonEmptyString,
+	},
+	user.TokenManifestType: {
+		user.UsernameAtHostnameLabel: nonEmptyString,
+		user.TokenIDLabel:            nonEmptyString,
+	},
 	aclManifestType: {},
 }
 
@@ -122,8 +139,11 @@ func (e *Entry) Validate() error {
 		return errors.New("nil acl")
 	}
 
-	parts := strings.Split(e.User, "@")
-	if len(parts) != 2 { //nolint:mnd
+	if g, ok := strings.CutPrefix(e.User, GroupPrefix); ok {
+		if err := user.ValidateGroupName(g); err != nil {
+			return errors.Wrap(err, "invalid group")
+		}
+	} else if parts := strings.Split(e.User, "@"); len(parts) != 2 { //nolint:mnd
 		return errors.New("user must be 'username@hostname' possibly including wildcards")
 	}
 
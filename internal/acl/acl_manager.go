@@ -4,10 +4,13 @@
 import (
 	"context"
 	"maps"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/manifest"
 )
@@ -24,7 +27,11 @@ func matchOrWildcard(rule, actual string) bool {
 	return rule == actual
 }
 
-func userMatches(rule, username, hostname string) bool {
+func userMatches(rule, username, hostname string, groups []string) bool {
+	if g, ok := strings.CutPrefix(rule, GroupPrefix); ok {
+		return slices.Contains(groups, g)
+	}
+
 	ruleParts := strings.Split(rule, "@")
 	if len(ruleParts) != 2 { //nolint:mnd
 		return false
@@ -35,10 +42,21 @@ func userMatches(rule, username, hostname string) bool {
 
 // EntriesForUser computes the list of ACL entries matching the given user.
 func EntriesForUser(entries []*Entry, username, hostname string) []*Entry {
+	return EntriesForUserInGroups(entries, username, hostname, nil)
+}
+
+// EntriesForUserInGroups computes the list of ACL entries matching the given user,
+// including entries targeting any of the groups the user belongs to.
+func EntriesForUserInGroups(entries []*Entry, username, hostname string, groups []string) []*Entry {
 	result := []*Entry{}
+	now := clock.Now()
 
 	for _, e := range entries {
-		if userMatches(e.User, username, hostname) {
+		if e.IsExpired(now) {
+			continue
+		}
+
+		if userMatches(e.User, username, hostname, groups) {
 			result = append(result, e)
 		}
 	}
@@ -49,10 +67,21 @@ func EntriesForUser(entries []*Entry, username, hostname string) []*Entry {
 // EffectivePermissions computes the effective access level for a given user@hostname to subject
 // for a given set of ACL Entries.
 func EffectivePermissions(username, hostname string, target map[string]string, entries []*Entry) AccessLevel {
+	return EffectivePermissionsInGroups(username, hostname, nil, target, entries)
+}
+
+// EffectivePermissionsInGroups computes the effective access level for a given user@hostname
+// belonging to the provided groups to subject for a given set of ACL Entries.
+func EffectivePermissionsInGroups(username, hostname string, groups []string, target map[string]string, entries []*Entry) AccessLevel {
 	highest := AccessLevelNone
+	now := clock.Now()
 
 	for _, e := range entries {
-		if !userMatches(e.User, username, hostname) {
+		if e.IsExpired(now) {
+			continue
+		}
+
+		if !userMatches(e.User, username, hostname, groups) {
 			continue
 		}
 
@@ -115,6 +144,12 @@ func AddACL(ctx context.Context, w repo.RepositoryWriter, e *Entry, overwrite bo
 		return errors.Wrap(err, "error validating ACL")
 	}
 
+	now := clock.Now()
+
+	if e.IsExpired(now) {
+		return errors.New("ACL expiration time must be in the future")
+	}
+
 	entries, err := LoadEntries(ctx, w, nil)
 	if err != nil {
 		return errors.Wrap(err, "unable to load ACL entries")
@@ -122,10 +157,16 @@ func AddACL(ctx context.Context, w repo.RepositoryWriter, e *Entry, overwrite bo
 
 	for _, oldE := range entries {
 		if e.User == oldE.User && maps.Equal(e.Target, oldE.Target) {
-			if !overwrite && e.Access < oldE.Access {
+			if !overwrite && e.Access < oldE.Access && !oldE.IsExpired(now) {
 				return errors.Errorf("ACL entry for a given user and target already exists %v: %v", oldE.User, oldE.Target)
 			}
 
+			// temporary entries are added next to the permanent one, which remains in effect
+			// after they expire. Replacing the permanent entry requires explicit overwrite.
+			if !overwrite && e.Expires != nil && oldE.Expires == nil {
+				continue
+			}
+
 			if err = w.DeleteManifest(ctx, oldE.ManifestID); err != nil {
 				return errors.Wrap(err, "error deleting old")
 			}
@@ -143,3 +184,27 @@ func AddACL(ctx context.Context, w repo.RepositoryWriter, e *Entry, overwrite bo
 
 	return nil
 }
+
+// DeleteExpiredEntries deletes ACL entries which have expired at the given time and returns their number.
+func DeleteExpiredEntries(ctx context.Context, w repo.RepositoryWriter, now time.Time) (int, error) {
+	entries, err := LoadEntries(ctx, w, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to load ACL entries")
+	}
+
+	deleted := 0
+
+	for _, e := range entries {
+		if !e.IsExpired(now) {
+			continue
+		}
+
+		if err := w.DeleteManifest(ctx, e.ManifestID); err != nil {
+			return deleted, errors.Wrapf(err, "error deleting expired ACL entry %v", e.ManifestID)
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
@@ -2,10 +2,12 @@
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/kopia/kopia/internal/acl"
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/repotesting"
 	"github.com/kopia/kopia/repo/manifest"
 	"github.com/kopia/kopia/snapshot"
@@ -149,6 +151,186 @@ func TestEffectivePermissions(t *testing.T) {
 	}
 }
 
+func TestEffectivePermissionsInGroups(t *testing.T) {
+	entries := []*acl.Entry{
+		{
+			User:   "group:support",
+			Target: acl.TargetRule{manifest.TypeLabelKey: snapshot.ManifestType},
+			Access: acl.AccessLevelRead,
+		},
+		{
+			User: "group:admins",
+			Target: acl.TargetRule{
+				manifest.TypeLabelKey:  snapshot.ManifestType,
+				snapshot.HostnameLabel: acl.OwnHost,
+			},
+			Access: acl.AccessLevelFull,
+		},
+	}
+
+	target := map[string]string{
+		manifest.TypeLabelKey:  snapshot.ManifestType,
+		snapshot.HostnameLabel: actualHostname,
+		snapshot.UsernameLabel: "someone-else",
+	}
+
+	cases := []struct {
+		groups []string
+		want   acl.AccessLevel
+	}{
+		{nil, acl.AccessLevelNone},
+		{[]string{"engineering"}, acl.AccessLevelNone},
+		{[]string{"support"}, acl.AccessLevelRead},
+		{[]string{"support", "admins"}, acl.AccessLevelFull},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.want, acl.EffectivePermissionsInGroups(actualUser, actualHostname, tc.groups, target, entries), "groups: %v", tc.groups)
+
+		filtered := acl.EntriesForUserInGroups(entries, actualUser, actualHostname, tc.groups)
+		require.Equal(t, tc.want, acl.EffectivePermissionsInGroups(actualUser, actualHostname, tc.groups, target, filtered), "groups: %v", tc.groups)
+	}
+
+	// group entries never match users by name.
+	require.Empty(t, acl.EntriesForUser(entries, "group:support", actualHostname))
+}
+
+func TestExpiredEntriesAreIgnored(t *testing.T) {
+	past := clock.Now().Add(-time.Hour)
+	future := clock.Now().Add(time.Hour)
+
+	target := map[string]string{
+		manifest.TypeLabelKey:  snapshot.ManifestType,
+		snapshot.HostnameLabel: actualHostname,
+		snapshot.UsernameLabel: "someone-else",
+	}
+
+	entries := []*acl.Entry{
+		{
+			User:    actualUserAtHostname,
+			Target:  acl.TargetRule{manifest.TypeLabelKey: snapshot.ManifestType},
+			Access:  acl.AccessLevelFull,
+			Expires: &past,
+		},
+	}
+
+	require.Equal(t, acl.AccessLevelNone, acl.EffectivePermissions(actualUser, actualHostname, target, entries))
+	require.Empty(t, acl.EntriesForUser(entries, actualUser, actualHostname))
+
+	entries[0].Expires = &future
+
+	require.Equal(t, acl.AccessLevelFull, acl.EffectivePermissions(actualUser, actualHostname, target, entries))
+	require.Len(t, acl.EntriesForUser(entries, actualUser, actualHostname), 1)
+}
+
+func TestDeleteExpiredEntries(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	past := clock.Now().Add(-time.Hour)
+	soon := clock.Now().Add(time.Hour)
+	later := clock.Now().Add(48 * time.Hour)
+
+	require.ErrorContains(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:    actualUserAtHostname,
+		Target:  acl.TargetRule{manifest.TypeLabelKey: acl.ContentManifestType},
+		Access:  acl.AccessLevelFull,
+		Expires: &past,
+	}, false), "must be in the future")
+
+	require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:    actualUserAtHostname,
+		Target:  acl.TargetRule{manifest.TypeLabelKey: acl.ContentManifestType},
+		Access:  acl.AccessLevelFull,
+		Expires: &soon,
+	}, false))
+
+	require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:    actualUserAtHostname,
+		Target:  acl.TargetRule{manifest.TypeLabelKey: snapshot.ManifestType},
+		Access:  acl.AccessLevelFull,
+		Expires: &later,
+	}, false))
+
+	require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:   actualUserAtHostname,
+		Target: acl.TargetRule{manifest.TypeLabelKey: policy.ManifestType},
+		Access: acl.AccessLevelFull,
+	}, false))
+
+	// nothing expired yet.
+	n, err := acl.DeleteExpiredEntries(ctx, env.RepositoryWriter, clock.Now())
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	n, err = acl.DeleteExpiredEntries(ctx, env.RepositoryWriter, clock.Now().Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	entries, err := acl.LoadEntries(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	n, err = acl.DeleteExpiredEntries(ctx, env.RepositoryWriter, clock.Now().Add(72*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	entries, err = acl.LoadEntries(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Nil(t, entries[0].Expires)
+}
+
+func TestAddExpiringEntryKeepsPermanentEntry(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	target := acl.TargetRule{manifest.TypeLabelKey: snapshot.ManifestType}
+	soon := clock.Now().Add(time.Hour)
+
+	require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:   actualUserAtHostname,
+		Target: target,
+		Access: acl.AccessLevelRead,
+	}, false))
+
+	require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:    actualUserAtHostname,
+		Target:  target,
+		Access:  acl.AccessLevelFull,
+		Expires: &soon,
+	}, false))
+
+	entries, err := acl.LoadEntries(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	labels := map[string]string{manifest.TypeLabelKey: snapshot.ManifestType}
+
+	require.Equal(t, acl.AccessLevelFull, acl.EffectivePermissions(actualUser, actualHostname, labels, entries))
+
+	// once the temporary entry expires, the permanent one remains in effect.
+	n, err := acl.DeleteExpiredEntries(ctx, env.RepositoryWriter, soon)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	entries, err = acl.LoadEntries(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, acl.AccessLevelRead, acl.EffectivePermissions(actualUser, actualHostname, labels, entries))
+
+	// explicit overwrite replaces the permanent entry.
+	require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:    actualUserAtHostname,
+		Target:  target,
+		Access:  acl.AccessLevelFull,
+		Expires: &soon,
+	}, true))
+
+	entries, err = acl.LoadEntries(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NotNil(t, entries[0].Expires)
+}
+
 func TestLoadEntries(t *testing.T) {
 	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
 
@@ -220,7 +402,7 @@ func TestACLEntryValidation(t *testing.T) {
 				},
 				Access: acl.AccessLevelFull,
 			},
-			WantErr: "invalid 'type' label, must be one of: acl, content, policy, snapshot, user",
+			WantErr: "invalid 'type' label, must be one of: acl, content, policy, snapshot, user, usergroup, usertoken",
 		},
 		{
 			Entry: &acl.Entry{
@@ -328,6 +510,26 @@ func TestACLEntryValidation(t *testing.T) {
 			},
 			WantErr: "user must be 'username@hostname' possibly including wildcards",
 		},
+		{
+			Entry: &acl.Entry{
+				User: "group:support",
+				Target: acl.TargetRule{
+					"type": "snapshot",
+				},
+				Access: acl.AccessLevelRead,
+			},
+			WantErr: "",
+		},
+		{
+			Entry: &acl.Entry{
+				User: "group:Bad Name",
+				Target: acl.TargetRule{
+					"type": "snapshot",
+				},
+				Access: acl.AccessLevelRead,
+			},
+			WantErr: "invalid group: group name must consist of lowercase letters, digits, '-', '_' or '.'",
+		},
 		{
 			Entry: &acl.Entry{
 				User: "foo@bar",
@@ -0,0 +1,446 @@
+// Package audit maintains a tamper-evident trail of repository mutations.
+//
+// Audit records are accumulated in memory by a Recorder and written on flush as encrypted
+// blobs with BlobPrefix. Records form a hash chain, which continues across blobs: the first
+// record of each blob references the last record of the most recent blob written before it.
+// Blobs are subject to the same retention (object lock) settings as other repository blobs,
+// so modification or removal of individual records or entire blobs can be detected, except
+// for removal of the most recent blob, which no other blob references.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/blobcrypto"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("audit")
+
+// BlobPrefix is the prefix of blobs storing audit records.
+const BlobPrefix blob.ID = "_audit_"
+
+// Supported operations.
+const (
+	OperationPut    = "put"
+	OperationDelete = "delete"
+)
+
+// ErrVerificationFailed is returned when audit records fail integrity verification.
+var ErrVerificationFailed = errors.New("audit trail verification failed")
+
+// Record describes a single mutation of a repository manifest.
+type Record struct {
+	Time         time.Time         `json:"time"`
+	Actor        string            `json:"actor"`
+	Operation    string            `json:"op"`
+	ManifestType string            `json:"type"`
+	ManifestID   string            `json:"manifestID,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	BeforeDigest string            `json:"before,omitempty"`
+	AfterDigest  string            `json:"after,omitempty"`
+
+	// PrevBlobID is the ID of the blob containing the previous record, only set on the first
+	// record of each blob, empty for the first record of the audit trail.
+	PrevBlobID blob.ID `json:"prevBlob,omitempty"`
+	// PrevHash is the Hash of the previous record, empty for the first record of the audit trail.
+	PrevHash string `json:"prevHash,omitempty"`
+	// Hash is the hash of the record computed over all other fields including PrevHash.
+	Hash string `json:"hash"`
+
+	// BlobID is the ID of the blob the record was read from, not persisted.
+	BlobID blob.ID `json:"-"`
+}
+
+func (r *Record) computeHash() (string, error) {
+	tmp := *r
+	tmp.Hash = ""
+
+	b, err := json.Marshal(tmp)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to marshal audit record")
+	}
+
+	h := sha256.Sum256(b)
+
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Digest returns the digest of the provided manifest payload.
+func Digest(data []byte) string {
+	h := sha256.Sum256(data)
+
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context that attributes mutations to the provided user@host
+// instead of the identity of the repository connection.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor associated with the context or empty string.
+func ActorFromContext(ctx context.Context) string {
+	s, _ := ctx.Value(actorContextKey{}).(string)
+
+	return s
+}
+
+// Gap describes an audit blob whose predecessor in the hash chain is missing from the repository.
+type Gap struct {
+	BlobID        blob.ID `json:"blobID"`
+	MissingBlobID blob.ID `json:"missingBlobID"`
+}
+
+func (g Gap) String() string {
+	return fmt.Sprintf("audit blob %v follows missing blob %v", g.BlobID, g.MissingBlobID)
+}
+
+// Recorder accumulates audit records until they are written to the repository.
+type Recorder struct {
+	mu sync.Mutex
+	// +checklocks:mu
+	pending []Record
+
+	// ID and hash of the last record of the most recent audit blob known to this recorder,
+	// which avoids listing all audit blobs on every flush.
+	// +checklocks:mu
+	lastBlobID blob.ID
+	// +checklocks:mu
+	lastHash string
+
+	// digests of deleted manifests keyed by their labels, which become the BeforeDigest
+	// of the next manifest written with the same labels.
+	// +checklocks:mu
+	replaced map[string]string
+}
+
+// Add adds a record to the list of records pending write.
+//
+// Replacing a manifest is performed as a delete followed by a put of a manifest with the same
+// labels, in which case the put record gets the digest of the deleted manifest as its BeforeDigest.
+func (r *Recorder) Add(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := labelsKey(rec.Labels)
+
+	switch rec.Operation {
+	case OperationDelete:
+		if r.replaced == nil {
+			r.replaced = map[string]string{}
+		}
+
+		r.replaced[key] = rec.BeforeDigest
+
+	case OperationPut:
+		if rec.BeforeDigest == "" {
+			rec.BeforeDigest = r.replaced[key]
+		}
+
+		delete(r.replaced, key)
+	}
+
+	r.pending = append(r.pending, rec)
+}
+
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var sb strings.Builder
+
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%q=%q;", k, labels[k])
+	}
+
+	return sb.String()
+}
+
+// Flush writes all pending records as a single encrypted blob.
+func (r *Recorder) Flush(ctx context.Context, st blob.Storage, c blobcrypto.Crypter, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) == 0 {
+		return nil
+	}
+
+	prevBlobID, prevHash, err := r.chainHeadLocked(ctx, st, c, now)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	for i := range r.pending {
+		rec := r.pending[i]
+		rec.PrevHash = prevHash
+
+		if i == 0 {
+			rec.PrevBlobID = prevBlobID
+		}
+
+		h, err := rec.computeHash()
+		if err != nil {
+			return err
+		}
+
+		rec.Hash = h
+		prevHash = h
+
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal audit record")
+		}
+
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	var rnd [4]byte
+
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return errors.Wrap(err, "unable to generate random suffix")
+	}
+
+	var encrypted gather.WriteBuffer
+	defer encrypted.Close()
+
+	prefix := BlobPrefix + blob.ID(fmt.Sprintf("%v_%x_", blobTimestamp(now), rnd))
+
+	blobID, err := blobcrypto.Encrypt(c, gather.FromSlice(buf.Bytes()), prefix, "", &encrypted)
+	if err != nil {
+		return errors.Wrap(err, "unable to encrypt audit blob")
+	}
+
+	if err := st.PutBlob(ctx, blobID, encrypted.Bytes(), blob.PutOptions{}); err != nil {
+		return errors.Wrap(err, "unable to write audit blob")
+	}
+
+	log(ctx).Debugw("wrote audit records", "blobID", blobID, "count", len(r.pending))
+
+	r.pending = nil
+	r.lastBlobID = blobID
+	r.lastHash = prevHash
+
+	return nil
+}
+
+// blobTimestamp returns the fixed-width time component of audit blob IDs, which sorts in the
+// order of writes. Nanoseconds make the order of blobs written in the same second match the order of writes.
+func blobTimestamp(t time.Time) string {
+	return fmt.Sprintf("%v%09d", t.UTC().Format("20060102150405"), t.Nanosecond())
+}
+
+// chainHeadLocked returns the ID of the most recent audit blob and the hash of its last record.
+// Concurrent writers may chain to the same blob, which forks the chain but leaves no gaps.
+//
+// Once the head of the chain is known, only blobs written between the cached head and now are
+// listed to detect blobs written by other clients, so the cost of a flush does not grow with the
+// size of the audit trail.
+//
+// +checklocks:r.mu
+func (r *Recorder) chainHeadLocked(ctx context.Context, st blob.Reader, c blobcrypto.Crypter, now time.Time) (blob.ID, string, error) {
+	blobs, err := blob.ListAllBlobs(ctx, st, r.listPrefixLocked(now))
+	if err != nil {
+		return "", "", errors.Wrap(err, "unable to list audit blobs")
+	}
+
+	// blob IDs start with the time of the flush, so the most recent blob sorts last.
+	latest := r.lastBlobID
+	for _, bm := range blobs {
+		if bm.BlobID > latest {
+			latest = bm.BlobID
+		}
+	}
+
+	if latest == r.lastBlobID {
+		return r.lastBlobID, r.lastHash, nil
+	}
+
+	recs, err := readBlob(ctx, st, c, latest)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(recs) == 0 {
+		return "", "", errors.Wrapf(ErrVerificationFailed, "blob %v: no records", latest)
+	}
+
+	r.lastBlobID = latest
+	r.lastHash = recs[len(recs)-1].Hash
+
+	return r.lastBlobID, r.lastHash, nil
+}
+
+// listPrefixLocked returns the prefix of audit blobs that may have been written after the cached
+// head of the chain. All blob IDs with timestamps between the head and now share the common
+// prefix of both timestamps.
+//
+// +checklocks:r.mu
+func (r *Recorder) listPrefixLocked(now time.Time) blob.ID {
+	if r.lastBlobID == "" {
+		return BlobPrefix
+	}
+
+	headTS := strings.TrimPrefix(string(r.lastBlobID), string(BlobPrefix))
+	nowTS := blobTimestamp(now)
+
+	// clock went backwards or unexpected blob ID format, list everything.
+	if len(headTS) < len(nowTS) || headTS[:len(nowTS)] > nowTS {
+		return BlobPrefix
+	}
+
+	n := 0
+	for n < len(nowTS) && headTS[n] == nowTS[n] {
+		n++
+	}
+
+	return BlobPrefix + blob.ID(nowTS[:n])
+}
+
+// ReadAll reads, decrypts and verifies all audit records stored in the repository.
+// Records are returned in chronological order along with gaps in the chain of blobs, which
+// indicate that audit blobs have been removed. If any blob fails verification,
+// an error wrapping ErrVerificationFailed is returned.
+func ReadAll(ctx context.Context, st blob.Reader, c blobcrypto.Crypter) ([]Record, []Gap, error) {
+	blobs, err := blob.ListAllBlobs(ctx, st, BlobPrefix)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to list audit blobs")
+	}
+
+	var (
+		result   []Record
+		gaps     []Gap
+		firstRec = map[blob.ID]Record{}
+		lastHash = map[blob.ID]string{}
+	)
+
+	for _, bm := range blobs {
+		recs, err := readBlob(ctx, st, c, bm.BlobID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(recs) == 0 {
+			return nil, nil, errors.Wrapf(ErrVerificationFailed, "blob %v: no records", bm.BlobID)
+		}
+
+		firstRec[bm.BlobID] = recs[0]
+		lastHash[bm.BlobID] = recs[len(recs)-1].Hash
+
+		result = append(result, recs...)
+	}
+
+	for _, bm := range blobs {
+		first := firstRec[bm.BlobID]
+		if first.PrevBlobID == "" {
+			continue
+		}
+
+		h, ok := lastHash[first.PrevBlobID]
+		if !ok {
+			gaps = append(gaps, Gap{BlobID: bm.BlobID, MissingBlobID: first.PrevBlobID})
+			continue
+		}
+
+		if h != first.PrevHash {
+			return nil, nil, errors.Wrapf(ErrVerificationFailed, "blob %v: broken hash chain with previous blob %v", bm.BlobID, first.PrevBlobID)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+
+	return result, gaps, nil
+}
+
+// readBlob reads, decrypts and verifies records stored in the provided audit blob.
+func readBlob(ctx context.Context, st blob.Reader, c blobcrypto.Crypter, blobID blob.ID) ([]Record, error) {
+	var data, decrypted gather.WriteBuffer
+
+	defer data.Close()
+	defer decrypted.Close()
+
+	if err := st.GetBlob(ctx, blobID, 0, -1, &data); err != nil {
+		return nil, errors.Wrapf(err, "unable to read audit blob %v", blobID)
+	}
+
+	if err := blobcrypto.Decrypt(c, data.Bytes(), blobID, &decrypted); err != nil {
+		return nil, errors.Wrapf(ErrVerificationFailed, "blob %v: %v", blobID, err)
+	}
+
+	return parseAndVerify(blobID, decrypted.ToByteSlice())
+}
+
+func parseAndVerify(blobID blob.ID, data []byte) ([]Record, error) {
+	var result []Record
+
+	prevHash := ""
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, len(data)+1)
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		var rec Record
+
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, errors.Wrapf(ErrVerificationFailed, "blob %v: malformed record: %v", blobID, err)
+		}
+
+		// the first record continues the chain from the previous blob, which is verified by the caller.
+		switch {
+		case len(result) == 0 && rec.PrevBlobID == "" && rec.PrevHash != "",
+			len(result) > 0 && (rec.PrevBlobID != "" || rec.PrevHash != prevHash):
+			return nil, errors.Wrapf(ErrVerificationFailed, "blob %v: broken hash chain at record %v", blobID, len(result))
+		}
+
+		h, err := rec.computeHash()
+		if err != nil {
+			return nil, err
+		}
+
+		if h != rec.Hash {
+			return nil, errors.Wrapf(ErrVerificationFailed, "blob %v: hash mismatch at record %v", blobID, len(result))
+		}
+
+		prevHash = rec.Hash
+		rec.BlobID = blobID
+
+		result = append(result, rec)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrapf(err, "unable to read audit blob %v", blobID)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,252 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/audit"
+	"github.com/kopia/kopia/internal/blobcrypto"
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/encryption"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/hashing"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+func TestRecorderFlushAndReadAll(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	c := newStaticCrypter(t)
+
+	var r audit.Recorder
+
+	// flushing with no pending records is a no-op.
+	require.NoError(t, r.Flush(ctx, st, c, time.Now()))
+	require.Empty(t, data)
+
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	r.Add(audit.Record{Time: t0, Actor: "a@h", Operation: audit.OperationPut, ManifestType: "snapshot", ManifestID: "m1", AfterDigest: audit.Digest([]byte("x"))})
+	r.Add(audit.Record{Time: t0.Add(time.Second), Actor: "a@h", Operation: audit.OperationDelete, ManifestType: "snapshot", ManifestID: "m1", BeforeDigest: audit.Digest([]byte("x"))})
+	require.NoError(t, r.Flush(ctx, st, c, t0))
+
+	r.Add(audit.Record{Time: t0.Add(2 * time.Second), Actor: "b@h", Operation: audit.OperationPut, ManifestType: "policy", ManifestID: "m2"})
+	require.NoError(t, r.Flush(ctx, st, c, t0.Add(2*time.Second)))
+
+	require.Len(t, data, 2)
+
+	recs, gaps, err := audit.ReadAll(ctx, st, c)
+	require.NoError(t, err)
+	require.Empty(t, gaps)
+	require.Len(t, recs, 3)
+
+	require.Equal(t, "m1", recs[0].ManifestID)
+	require.Equal(t, audit.OperationPut, recs[0].Operation)
+	require.Empty(t, recs[0].PrevHash)
+	require.Empty(t, recs[0].PrevBlobID)
+	require.Equal(t, recs[0].Hash, recs[1].PrevHash)
+	require.Equal(t, audit.OperationDelete, recs[1].Operation)
+	require.Equal(t, "b@h", recs[2].Actor)
+	require.NotEqual(t, recs[0].BlobID, recs[2].BlobID)
+
+	// the chain continues across blobs.
+	require.Equal(t, recs[1].Hash, recs[2].PrevHash)
+	require.Equal(t, recs[1].BlobID, recs[2].PrevBlobID)
+}
+
+func TestReadAllReportsRemovedBlobs(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	c := newStaticCrypter(t)
+
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// each recorder is a separate repository connection.
+	for i := range 3 {
+		var r audit.Recorder
+
+		r.Add(audit.Record{Time: t0.Add(time.Duration(i) * time.Second), Actor: "a@h", Operation: audit.OperationPut, ManifestID: "m1"})
+		require.NoError(t, r.Flush(ctx, st, c, t0.Add(time.Duration(i)*time.Second)))
+	}
+
+	recs, gaps, err := audit.ReadAll(ctx, st, c)
+	require.NoError(t, err)
+	require.Empty(t, gaps)
+	require.Len(t, recs, 3)
+
+	// remove the blob in the middle of the chain.
+	require.NoError(t, st.DeleteBlob(ctx, recs[1].BlobID))
+
+	recs2, gaps, err := audit.ReadAll(ctx, st, c)
+	require.NoError(t, err)
+	require.Len(t, recs2, 2)
+	require.Equal(t, []audit.Gap{{BlobID: recs[2].BlobID, MissingBlobID: recs[1].BlobID}}, gaps)
+}
+
+func TestRecorderListsOnlyBlobsAfterCachedHead(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := &listPrefixRecorder{Storage: blobtesting.NewMapStorage(data, nil, nil)}
+	c := newStaticCrypter(t)
+
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var r1, r2 audit.Recorder
+
+	r1.Add(audit.Record{Time: t0, Actor: "a@h", Operation: audit.OperationPut, ManifestID: "m1"})
+	require.NoError(t, r1.Flush(ctx, st, c, t0))
+
+	// another connection continues the chain.
+	r2.Add(audit.Record{Time: t0.Add(time.Second), Actor: "b@h", Operation: audit.OperationPut, ManifestID: "m2"})
+	require.NoError(t, r2.Flush(ctx, st, c, t0.Add(time.Second)))
+
+	st.prefixes = nil
+
+	r1.Add(audit.Record{Time: t0.Add(2 * time.Second), Actor: "a@h", Operation: audit.OperationPut, ManifestID: "m3"})
+	require.NoError(t, r1.Flush(ctx, st, c, t0.Add(2*time.Second)))
+
+	// only blobs written between the cached head and now are listed.
+	require.Equal(t, []blob.ID{audit.BlobPrefix + "2026010203040"}, st.prefixes)
+
+	recs, gaps, err := audit.ReadAll(ctx, st, c)
+	require.NoError(t, err)
+	require.Empty(t, gaps)
+	require.Len(t, recs, 3)
+
+	// the blob written by the other connection was detected and chained to.
+	require.Equal(t, recs[1].BlobID, recs[2].PrevBlobID)
+	require.Equal(t, recs[1].Hash, recs[2].PrevHash)
+}
+
+func TestRecorderReplacedManifestDigest(t *testing.T) {
+	ctx := testlogging.Context(t)
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	c := newStaticCrypter(t)
+
+	var r audit.Recorder
+
+	labels := map[string]string{"type": "policy", "path": "/tmp"}
+
+	r.Add(audit.Record{Time: time.Now(), Operation: audit.OperationDelete, ManifestID: "m1", Labels: labels, BeforeDigest: "sha256:old"})
+	r.Add(audit.Record{Time: time.Now(), Operation: audit.OperationPut, ManifestID: "m2", Labels: labels, AfterDigest: "sha256:new"})
+	r.Add(audit.Record{Time: time.Now(), Operation: audit.OperationPut, ManifestID: "m3", Labels: labels, AfterDigest: "sha256:newer"})
+	require.NoError(t, r.Flush(ctx, st, c, time.Now()))
+
+	recs, _, err := audit.ReadAll(ctx, st, c)
+	require.NoError(t, err)
+	require.Len(t, recs, 3)
+
+	require.Equal(t, "sha256:old", recs[1].BeforeDigest)
+	require.Empty(t, recs[2].BeforeDigest)
+}
+
+type listPrefixRecorder struct {
+	blob.Storage
+
+	prefixes []blob.ID
+}
+
+func (s *listPrefixRecorder) ListBlobs(ctx context.Context, prefix blob.ID, cb func(bm blob.Metadata) error) error {
+	s.prefixes = append(s.prefixes, prefix)
+
+	//nolint:wrapcheck
+	return s.Storage.ListBlobs(ctx, prefix, cb)
+}
+
+func TestReadAllDetectsTampering(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	c := newStaticCrypter(t)
+
+	var r audit.Recorder
+
+	r.Add(audit.Record{Time: time.Now(), Actor: "a@h", Operation: audit.OperationPut, ManifestID: "m1"})
+	require.NoError(t, r.Flush(ctx, st, c, time.Now()))
+
+	for k, v := range data {
+		v[len(v)-1] ^= 1
+		data[k] = v
+	}
+
+	_, _, err := audit.ReadAll(ctx, st, c)
+	require.ErrorIs(t, err, audit.ErrVerificationFailed)
+}
+
+func TestDigest(t *testing.T) {
+	require.Equal(t, "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", audit.Digest([]byte("hello")))
+}
+
+func TestRepositoryManifestMutationsAreAudited(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	var (
+		id1, id2 manifest.ID
+		err      error
+	)
+
+	labels := map[string]string{manifest.TypeLabelKey: "test", "name": "a"}
+
+	require.NoError(t, repo.WriteSession(audit.WithActor(ctx, "alice@laptop"), env.Repository, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		id1, err = w.PutManifest(ctx, labels, map[string]string{"v": "1"})
+		require.NoError(t, err)
+
+		id2, err = w.ReplaceManifests(ctx, labels, map[string]string{"v": "2"})
+		require.NoError(t, err)
+
+		// deleting non-existent manifest is not recorded.
+		return w.DeleteManifest(ctx, "no-such-manifest")
+	}))
+
+	dr, ok := env.Repository.(repo.DirectRepository)
+	require.True(t, ok)
+
+	recs, gaps, err := audit.ReadAll(ctx, dr.BlobReader(), dr.ContentReader().ContentFormat())
+	require.NoError(t, err)
+	require.Empty(t, gaps)
+	require.Len(t, recs, 3)
+
+	require.Equal(t, audit.OperationPut, recs[0].Operation)
+	require.Equal(t, string(id1), recs[0].ManifestID)
+	require.Equal(t, "alice@laptop", recs[0].Actor)
+	require.Equal(t, "test", recs[0].ManifestType)
+	require.Equal(t, audit.Digest([]byte(`{"v":"1"}`)), recs[0].AfterDigest)
+
+	require.Equal(t, audit.OperationDelete, recs[1].Operation)
+	require.Equal(t, string(id1), recs[1].ManifestID)
+	require.Equal(t, recs[0].AfterDigest, recs[1].BeforeDigest)
+
+	require.Equal(t, audit.OperationPut, recs[2].Operation)
+	require.Equal(t, string(id2), recs[2].ManifestID)
+	require.Equal(t, audit.Digest([]byte(`{"v":"2"}`)), recs[2].AfterDigest)
+	require.Equal(t, recs[1].BeforeDigest, recs[2].BeforeDigest)
+}
+
+func newStaticCrypter(t *testing.T) blobcrypto.Crypter {
+	t.Helper()
+
+	p := &format.ContentFormat{
+		Encryption: encryption.DefaultAlgorithm,
+		Hash:       hashing.DefaultAlgorithm,
+	}
+
+	enc, err := encryption.CreateEncryptor(p)
+	require.NoError(t, err)
+
+	hf, err := hashing.CreateHashFunc(p)
+	require.NoError(t, err)
+
+	return blobcrypto.StaticCrypter{
+		Hash:       hf,
+		Encryption: enc,
+	}
+}
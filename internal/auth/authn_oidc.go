@@ -0,0 +1,458 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+)
+
+const (
+	// DefaultOIDCUsernameClaim is the ID token claim used as the user identity by default.
+	DefaultOIDCUsernameClaim = "email"
+
+	// DefaultOIDCGroupsClaim is the ID token claim that holds group memberships by default.
+	DefaultOIDCGroupsClaim = "groups"
+
+	oidcEmailClaim         = "email"
+	oidcEmailVerifiedClaim = "email_verified"
+
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+
+	// minimum time between JWKS refreshes triggered by tokens signed with unknown keys.
+	minJWKSRefreshInterval = 30 * time.Second
+)
+
+//nolint:gochecknoglobals
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// OIDCOptions specifies configuration of OpenID Connect authentication.
+type OIDCOptions struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// UsernameClaim is the claim mapped to user identity. If the value contains '@' it is used
+	// as user@host directly, otherwise it is combined with HostnameClaim or DefaultHostname.
+	UsernameClaim   string
+	HostnameClaim   string
+	DefaultHostname string
+
+	// GroupsClaim is the claim holding the list of groups the user belongs to.
+	GroupsClaim string
+
+	HTTPClient *http.Client
+}
+
+// OIDCIdentity describes the identity of a user authenticated using OpenID Connect.
+type OIDCIdentity struct {
+	Subject        string
+	UsernameAtHost string
+	Groups         []string
+	Expiry         time.Time
+}
+
+type oidcDiscoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	KeyID string `json:"kid"`
+	Kty   string `json:"kty"`
+	Use   string `json:"use"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+	Crv   string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// OIDCProvider verifies ID tokens issued by an OpenID Connect provider and implements
+// authorization code flow. It also implements Authenticator which accepts ID tokens
+// passed as passwords.
+type OIDCProvider struct {
+	opts      OIDCOptions
+	discovery oidcDiscoveryDocument
+
+	mu sync.Mutex
+	// +checklocks:mu
+	keys map[string]any
+	// +checklocks:mu
+	lastKeysFetch time.Time
+}
+
+// NewOIDCProvider creates OIDCProvider by fetching discovery document of the provided issuer.
+func NewOIDCProvider(ctx context.Context, opts OIDCOptions) (*OIDCProvider, error) {
+	if opts.IssuerURL == "" {
+		return nil, errors.New("missing OIDC issuer URL")
+	}
+
+	if opts.ClientID == "" {
+		return nil, errors.New("missing OIDC client ID")
+	}
+
+	if opts.UsernameClaim == "" {
+		opts.UsernameClaim = DefaultOIDCUsernameClaim
+	}
+
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = DefaultOIDCGroupsClaim
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	p := &OIDCProvider{opts: opts}
+
+	if err := p.getJSON(ctx, strings.TrimSuffix(opts.IssuerURL, "/")+oidcDiscoveryPath, &p.discovery); err != nil {
+		return nil, errors.Wrap(err, "unable to fetch OIDC discovery document")
+	}
+
+	if p.discovery.Issuer != opts.IssuerURL {
+		return nil, errors.Errorf("OIDC issuer mismatch: got %q, expected %q", p.discovery.Issuer, opts.IssuerURL)
+	}
+
+	if err := p.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+
+	resp, err := p.opts.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error fetching %v", u)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("error fetching %v: %v", u, resp.Status)
+	}
+
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "error decoding %v", u)
+}
+
+// Refresh re-fetches signing keys of the provider.
+func (p *OIDCProvider) Refresh(ctx context.Context) error {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := p.getJSON(ctx, p.discovery.JWKSURI, &jwks); err != nil {
+		return errors.Wrap(err, "unable to fetch OIDC signing keys")
+	}
+
+	keys := map[string]any{}
+
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.publicKey()
+		if err != nil {
+			log(ctx).Warnf("ignoring OIDC signing key %q: %v", k.KeyID, err)
+			continue
+		}
+
+		keys[k.KeyID] = pub
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keys = keys
+	p.lastKeysFetch = clock.Now()
+
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid modulus")
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid exponent")
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid x coordinate")
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid y coordinate")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	default:
+		return nil, errors.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	canRefresh := clock.Now().Sub(p.lastKeysFetch) > minJWKSRefreshInterval
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if !canRefresh {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+
+	// keys may have been rotated.
+	if err := p.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, errors.Errorf("unknown signing key %q", kid)
+}
+
+// OAuth2Config returns the configuration for authorization code flow.
+func (p *OIDCProvider) OAuth2Config() *oauth2.Config {
+	scopes := p.opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.opts.ClientID,
+		ClientSecret: p.opts.ClientSecret,
+		RedirectURL:  p.opts.RedirectURL,
+		Scopes:       scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.discovery.AuthorizationEndpoint,
+			TokenURL: p.discovery.TokenEndpoint,
+		},
+	}
+}
+
+// AuthCodeURL returns the URL of the provider's login page.
+func (p *OIDCProvider) AuthCodeURL(state, nonce string) string {
+	return p.OAuth2Config().AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce))
+}
+
+// Exchange exchanges the authorization code for tokens and returns verified identity.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string) (*OIDCIdentity, error) {
+	tok, err := p.OAuth2Config().Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.opts.HTTPClient), code)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to exchange authorization code")
+	}
+
+	rawIDToken, ok := tok.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response does not contain ID token")
+	}
+
+	return p.verify(ctx, rawIDToken, nonce)
+}
+
+// VerifyIDToken verifies the provided raw ID token and returns identity of the user.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken string) (*OIDCIdentity, error) {
+	return p.verify(ctx, rawIDToken, "")
+}
+
+func (p *OIDCProvider) verify(ctx context.Context, rawIDToken, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+
+	parser := jwt.NewParser(jwt.WithValidMethods(oidcSigningMethods))
+
+	if _, err := parser.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		return p.signingKey(ctx, kid)
+	}); err != nil {
+		return nil, errors.Wrap(err, "invalid ID token")
+	}
+
+	if !claims.VerifyIssuer(p.discovery.Issuer, true) {
+		return nil, errors.New("invalid ID token issuer")
+	}
+
+	if !claims.VerifyAudience(p.opts.ClientID, true) {
+		return nil, errors.New("invalid ID token audience")
+	}
+
+	if !claims.VerifyExpiresAt(clock.Now().Unix(), true) {
+		return nil, errors.New("ID token expired")
+	}
+
+	if nonce != "" {
+		if n, _ := claims["nonce"].(string); n != nonce {
+			return nil, errors.New("invalid ID token nonce")
+		}
+	}
+
+	return p.identityFromClaims(claims)
+}
+
+func (p *OIDCProvider) identityFromClaims(claims jwt.MapClaims) (*OIDCIdentity, error) {
+	username, _ := claims[p.opts.UsernameClaim].(string)
+	if username == "" {
+		return nil, errors.Errorf("ID token is missing %q claim", p.opts.UsernameClaim)
+	}
+
+	// identity providers may allow users to set arbitrary email addresses, which must not
+	// be trusted unless the provider asserts that they have been verified.
+	if p.opts.UsernameClaim == oidcEmailClaim {
+		if verified, _ := claims[oidcEmailVerifiedClaim].(bool); !verified {
+			return nil, errors.Errorf("email address %q has not been verified by the identity provider", username)
+		}
+	}
+
+	if !strings.Contains(username, "@") {
+		hostname := p.opts.DefaultHostname
+
+		if p.opts.HostnameClaim != "" {
+			if h, _ := claims[p.opts.HostnameClaim].(string); h != "" {
+				hostname = h
+			}
+		}
+
+		if hostname == "" {
+			return nil, errors.Errorf("unable to determine hostname for OIDC user %q", username)
+		}
+
+		username += "@" + hostname
+	}
+
+	id := &OIDCIdentity{
+		UsernameAtHost: username,
+		Groups:         claimStrings(claims[p.opts.GroupsClaim]),
+	}
+
+	id.Subject, _ = claims["sub"].(string)
+
+	if exp, ok := claims["exp"].(float64); ok {
+		id.Expiry = time.Unix(int64(exp), 0)
+	}
+
+	return id, nil
+}
+
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+
+	case []any:
+		var result []string
+
+		for _, it := range v {
+			if s, ok := it.(string); ok {
+				result = append(result, s)
+			}
+		}
+
+		return result
+
+	default:
+		return nil
+	}
+}
+
+// IsValid implements Authenticator by accepting an ID token issued to the provided user as password.
+func (p *OIDCProvider) IsValid(ctx context.Context, _ repo.Repository, username, password string) bool {
+	// cheap check to avoid verifying passwords that can't possibly be tokens.
+	if strings.Count(password, ".") != 2 { //nolint:mnd
+		return false
+	}
+
+	id, err := p.VerifyIDToken(ctx, password)
+	if err != nil {
+		log(ctx).Debugf("OIDC token rejected for %v: %v", username, err)
+		return false
+	}
+
+	return id.UsernameAtHost == username
+}
+
+// HasAnyGroup returns true if the identity belongs to any of the provided groups.
+func (id *OIDCIdentity) HasAnyGroup(groups []string) bool {
+	for _, g := range groups {
+		if slices.Contains(id.Groups, g) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type groupsContextKey struct{}
+
+// WithGroups returns a context carrying the groups of the authenticated user, as asserted by
+// the identity provider.
+func WithGroups(ctx context.Context, groups []string) context.Context {
+	return context.WithValue(ctx, groupsContextKey{}, groups)
+}
+
+// GroupsFromContext returns the groups of the authenticated user stored in the context.
+func GroupsFromContext(ctx context.Context) []string {
+	g, _ := ctx.Value(groupsContextKey{}).([]string)
+
+	return g
+}
+
+var _ Authenticator = (*OIDCProvider)(nil)
@@ -0,0 +1,138 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/oidctesting"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	ctx := testlogging.Context(t)
+	p := oidctesting.NewProvider(t)
+
+	op, err := auth.NewOIDCProvider(ctx, auth.OIDCOptions{
+		IssuerURL:       p.IssuerURL(),
+		ClientID:        p.ClientID,
+		ClientSecret:    p.ClientSecret,
+		DefaultHostname: "sso",
+	})
+	require.NoError(t, err)
+
+	id, err := op.VerifyIDToken(ctx, p.IssueIDToken(map[string]any{
+		"sub":            "123",
+		"email":          "alice@laptop",
+		"email_verified": true,
+		"groups":         []string{"engineering", "admins"},
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "alice@laptop", id.UsernameAtHost)
+	require.Equal(t, "123", id.Subject)
+	require.Equal(t, []string{"engineering", "admins"}, id.Groups)
+	require.True(t, id.HasAnyGroup([]string{"support", "admins"}))
+	require.False(t, id.HasAnyGroup([]string{"support"}))
+
+	// username without host is combined with default hostname
+	id, err = op.VerifyIDToken(ctx, p.IssueIDToken(map[string]any{"email": "bob", "email_verified": true}))
+	require.NoError(t, err)
+	require.Equal(t, "bob@sso", id.UsernameAtHost)
+	require.Empty(t, id.Groups)
+
+	cases := []struct {
+		desc   string
+		claims map[string]any
+	}{
+		{"wrong audience", map[string]any{"email": "alice@laptop", "email_verified": true, "aud": "other-client"}},
+		{"wrong issuer", map[string]any{"email": "alice@laptop", "email_verified": true, "iss": "https://evil.example.com"}},
+		{"expired", map[string]any{"email": "alice@laptop", "email_verified": true, "exp": time.Now().Add(-time.Hour).Unix()}},
+		{"missing username", map[string]any{"sub": "123"}},
+		{"unverified email", map[string]any{"email": "alice@laptop", "email_verified": false}},
+		{"missing email_verified", map[string]any{"email": "alice@laptop"}},
+	}
+
+	for _, tc := range cases {
+		_, err := op.VerifyIDToken(ctx, p.IssueIDToken(tc.claims))
+		require.Error(t, err, tc.desc)
+	}
+
+	_, err = op.VerifyIDToken(ctx, "not-a-token")
+	require.Error(t, err)
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	ctx := testlogging.Context(t)
+	p := oidctesting.NewProvider(t)
+
+	op, err := auth.NewOIDCProvider(ctx, auth.OIDCOptions{
+		IssuerURL:     p.IssuerURL(),
+		ClientID:      p.ClientID,
+		UsernameClaim: "preferred_username",
+		HostnameClaim: "device",
+	})
+	require.NoError(t, err)
+
+	tok := p.IssueIDToken(map[string]any{"preferred_username": "alice", "device": "laptop"})
+
+	verifyAuthenticator(t, op, "alice@laptop", tok, true)
+	verifyAuthenticator(t, op, "bob@laptop", tok, false)
+	verifyAuthenticator(t, op, "alice@laptop", "password", false)
+
+	// no hostname claim and no default hostname.
+	verifyAuthenticator(t, op, "alice@laptop", p.IssueIDToken(map[string]any{"preferred_username": "alice"}), false)
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	ctx := testlogging.Context(t)
+	p := oidctesting.NewProvider(t)
+
+	op, err := auth.NewOIDCProvider(ctx, auth.OIDCOptions{
+		IssuerURL:    p.IssuerURL(),
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  "http://localhost/callback",
+	})
+	require.NoError(t, err)
+
+	p.SetLoginClaims(map[string]any{"email": "alice@laptop", "email_verified": true, "groups": "engineering"})
+
+	// follow the login page, which redirects back to the callback immediately.
+	client := &http.Client{
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(op.AuthCodeURL("some-state", "some-nonce"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "some-state", loc.Query().Get("state"))
+
+	_, err = op.Exchange(ctx, loc.Query().Get("code"), "wrong-nonce")
+	require.Error(t, err)
+
+	resp, err = client.Get(op.AuthCodeURL("some-state", "some-nonce"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	loc, err = url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	id, err := op.Exchange(ctx, loc.Query().Get("code"), "some-nonce")
+	require.NoError(t, err)
+	require.Equal(t, "alice@laptop", id.UsernameAtHost)
+	require.Equal(t, []string{"engineering"}, id.Groups)
+
+	// codes can't be reused
+	_, err = op.Exchange(ctx, loc.Query().Get("code"), "some-nonce")
+	require.Error(t, err)
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+const (
+	defaultTokenRefreshFrequency = 10 * time.Second
+
+	// minUnknownTokenReloadInterval limits how often tokens are reloaded when presented with
+	// an unknown token ID, so that requests with random tokens can't force constant reloads.
+	minUnknownTokenReloadInterval = time.Second
+
+	// tokenLastUsedGranularity determines how often the last-used timestamp of a token is persisted.
+	tokenLastUsedGranularity = time.Hour
+)
+
+type apiTokenAuthenticator struct {
+	mu sync.Mutex
+	// +checklocks:mu
+	lastRep repo.Repository
+	// +checklocks:mu
+	nextRefreshTime time.Time
+	// +checklocks:mu
+	lastReloadTime time.Time
+	// +checklocks:mu
+	tokens map[string]*user.Token
+	// last-used times of tokens to be persisted on the next refresh.
+	// +checklocks:mu
+	lastUsedUpdates map[string]time.Time
+	// +checklocks:mu
+	tokenRefreshFrequency time.Duration
+}
+
+// lookup returns the token matching the provided credentials or nil if they are not valid.
+func (ac *apiTokenAuthenticator) lookup(ctx context.Context, rep repo.Repository, username, password string) *user.Token {
+	id, ok := user.TokenID(password)
+	if !ok {
+		return nil
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	// if the server switched to serving another repository, discard cache.
+	if rep != ac.lastRep {
+		ac.tokens = nil
+		ac.lastUsedUpdates = nil
+		ac.lastRep = rep
+
+		// ensure tokens are reloaded below
+		ac.nextRefreshTime = time.Time{}
+	}
+
+	now := clock.Now()
+
+	// see if we're due for a refresh, newly created tokens are picked up quickly.
+	if now.After(ac.nextRefreshTime) || (ac.tokens[id] == nil && now.Sub(ac.lastReloadTime) >= minUnknownTokenReloadInterval) {
+		ac.nextRefreshTime = now.Add(ac.tokenRefreshFrequency)
+		ac.lastReloadTime = now
+
+		newTokens, err := user.LoadTokenMap(ctx, rep, ac.tokens)
+		if err != nil {
+			log(ctx).Errorf("unable to load API tokens: %v", err)
+		} else {
+			ac.tokens = newTokens
+		}
+	}
+
+	t := ac.tokens[id]
+	if t == nil || t.Username != username || !t.IsValid(password, clock.Now()) {
+		return nil
+	}
+
+	return t
+}
+
+func (ac *apiTokenAuthenticator) IsValid(ctx context.Context, rep repo.Repository, username, password string) bool {
+	t := ac.lookup(ctx, rep, username, password)
+	if t == nil {
+		return false
+	}
+
+	ac.maybeUpdateLastUsed(t)
+
+	return true
+}
+
+// Scopes implements scopedAuthenticator.
+func (ac *apiTokenAuthenticator) Scopes(ctx context.Context, rep repo.Repository, username, password string) ([]string, bool) {
+	t := ac.lookup(ctx, rep, username, password)
+	if t == nil {
+		return nil, false
+	}
+
+	return t.Scopes, true
+}
+
+// maybeUpdateLastUsed schedules the last-used time of the token to be persisted on the next
+// refresh, at most once per tokenLastUsedGranularity, so that authentication does not wait
+// for manifest writes.
+func (ac *apiTokenAuthenticator) maybeUpdateLastUsed(t *user.Token) {
+	now := clock.Now()
+
+	if now.Sub(t.LastUsed) <= tokenLastUsedGranularity {
+		return
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.lastUsedUpdates == nil {
+		ac.lastUsedUpdates = map[string]time.Time{}
+	}
+
+	ac.lastUsedUpdates[t.ID] = now
+}
+
+// persistLastUsed writes last-used times of tokens used since the previous refresh in a single write session.
+func (ac *apiTokenAuthenticator) persistLastUsed(ctx context.Context) {
+	ac.mu.Lock()
+	rep := ac.lastRep
+	pending := ac.lastUsedUpdates
+	ac.lastUsedUpdates = nil
+
+	var updated []*user.Token
+
+	for id, lastUsed := range pending {
+		if t := ac.tokens[id]; t != nil {
+			u := *t
+			u.LastUsed = lastUsed
+			updated = append(updated, &u)
+		}
+	}
+	ac.mu.Unlock()
+
+	if rep == nil || len(updated) == 0 {
+		return
+	}
+
+	if err := repo.WriteSession(ctx, rep, repo.WriteSessionOptions{
+		Purpose: "UpdateTokenLastUsed",
+	}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		for _, u := range updated {
+			if err := user.SetToken(ctx, w, u); err != nil {
+				return errors.Wrapf(err, "token %v", u.ID)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		log(ctx).Debugf("unable to update last-used time of tokens: %v", err)
+		return
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if rep != ac.lastRep {
+		return
+	}
+
+	for _, u := range updated {
+		if ac.tokens[u.ID] != nil {
+			ac.tokens[u.ID] = u
+		}
+	}
+}
+
+// Refresh persists last-used times of recently used tokens and ensures tokens are reloaded on next use.
+func (ac *apiTokenAuthenticator) Refresh(ctx context.Context) error {
+	ac.persistLastUsed(ctx)
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ac.nextRefreshTime = time.Time{}
+
+	return nil
+}
+
+// AuthenticateAPITokens returns authenticator that accepts API tokens stored in 'usertoken'
+// manifests in the repository in place of passwords.
+func AuthenticateAPITokens() Authenticator {
+	return &apiTokenAuthenticator{
+		tokenRefreshFrequency: defaultTokenRefreshFrequency,
+	}
+}
+
+// scopedAuthenticator is implemented by authenticators which accept credentials limited to certain scopes.
+type scopedAuthenticator interface {
+	Scopes(ctx context.Context, rep repo.Repository, username, password string) ([]string, bool)
+}
+
+// CredentialScopes returns the scopes the provided credentials are limited to.
+// Returns false if the credentials are not limited.
+func CredentialScopes(ctx context.Context, a Authenticator, rep repo.Repository, username, password string) ([]string, bool) {
+	if !user.IsToken(password) {
+		return nil, false
+	}
+
+	switch a := a.(type) {
+	case combinedAuthenticator:
+		for _, e := range a {
+			if s, ok := CredentialScopes(ctx, e, rep, username, password); ok {
+				return s, true
+			}
+		}
+
+	case scopedAuthenticator:
+		return a.Scopes(ctx, rep, username, password)
+	}
+
+	return nil, false
+}
+
+// HasScope determines whether the provided scopes grant the given scope.
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, user.ScopeAll) || slices.Contains(scopes, scope)
+}
+
+type scopedAuthorizationInfo struct {
+	inner  AuthorizationInfo
+	scopes []string
+}
+
+func (s scopedAuthorizationInfo) ContentAccessLevel() AccessLevel {
+	limit := AccessLevelNone
+
+	for _, sc := range s.scopes {
+		switch {
+		case sc == user.ScopeAll:
+			limit = max(limit, AccessLevelFull)
+		case strings.HasSuffix(sc, ":write"):
+			limit = max(limit, AccessLevelAppend)
+		case strings.HasSuffix(sc, ":read"):
+			limit = max(limit, AccessLevelRead)
+		}
+	}
+
+	return min(limit, s.inner.ContentAccessLevel())
+}
+
+func (s scopedAuthorizationInfo) ManifestAccessLevel(labels map[string]string) AccessLevel {
+	var readScope, writeScope string
+
+	switch labels[manifest.TypeLabelKey] {
+	case snapshot.ManifestType:
+		readScope, writeScope = user.ScopeSnapshotRead, user.ScopeSnapshotWrite
+	case policy.ManifestType:
+		readScope, writeScope = user.ScopePolicyRead, user.ScopePolicyWrite
+	}
+
+	limit := AccessLevelNone
+
+	switch {
+	case slices.Contains(s.scopes, user.ScopeAll):
+		limit = AccessLevelFull
+	case writeScope != "" && slices.Contains(s.scopes, writeScope):
+		limit = AccessLevelFull
+	case readScope != "" && slices.Contains(s.scopes, readScope):
+		limit = AccessLevelRead
+	}
+
+	return min(limit, s.inner.ManifestAccessLevel(labels))
+}
+
+// RestrictToScopes returns AuthorizationInfo which grants at most the access allowed by the provided scopes.
+func RestrictToScopes(ai AuthorizationInfo, scopes []string) AuthorizationInfo {
+	return scopedAuthorizationInfo{ai, scopes}
+}
+
+type scopesContextKey struct{}
+
+// WithScopes returns a context carrying the scopes the authenticated credentials are limited to.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesContextKey{}, scopes)
+}
+
+// ScopesFromContext returns the scopes stored in the context and true if the credentials are limited.
+func ScopesFromContext(ctx context.Context) ([]string, bool) {
+	s, ok := ctx.Value(scopesContextKey{}).([]string)
+
+	return s, ok
+}
@@ -0,0 +1,104 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+func TestAPITokenAuthenticator(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	tok, secret, err := user.NewToken("ci@builder", "", []string{user.ScopeSnapshotWrite}, clock.Now(), time.Hour)
+	require.NoError(t, err)
+
+	expired, expiredSecret, err := user.NewToken("ci@builder", "", []string{user.ScopeAll}, clock.Now().Add(-2*time.Hour), time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.WriteSession(ctx, env.Repository, repo.WriteSessionOptions{},
+		func(ctx context.Context, w repo.RepositoryWriter) error {
+			require.NoError(t, user.SetToken(ctx, w, tok))
+			return user.SetToken(ctx, w, expired)
+		}))
+
+	a := auth.CombineAuthenticators(auth.AuthenticateRepositoryUsers(), auth.AuthenticateAPITokens())
+
+	require.True(t, a.IsValid(ctx, env.Repository, "ci@builder", secret))
+	require.False(t, a.IsValid(ctx, env.Repository, "other@builder", secret))
+	require.False(t, a.IsValid(ctx, env.Repository, "ci@builder", expiredSecret))
+	require.False(t, a.IsValid(ctx, env.Repository, "ci@builder", "not-a-token"))
+
+	scopes, ok := auth.CredentialScopes(ctx, a, env.Repository, "ci@builder", secret)
+	require.True(t, ok)
+	require.Equal(t, []string{user.ScopeSnapshotWrite}, scopes)
+
+	_, ok = auth.CredentialScopes(ctx, a, env.Repository, "ci@builder", "not-a-token")
+	require.False(t, ok)
+
+	// last-used time is recorded on refresh.
+	require.NoError(t, a.Refresh(ctx))
+	require.NoError(t, env.Repository.Refresh(ctx))
+
+	tokens, err := user.ListTokens(ctx, env.Repository, "ci@builder")
+	require.NoError(t, err)
+
+	for _, v := range tokens {
+		if v.ID == tok.ID {
+			require.False(t, v.LastUsed.IsZero())
+		}
+	}
+
+	// unknown tokens trigger a reload, but not more often than once per second.
+	unknown, unknownSecret, err := user.NewToken("ci@builder", "", []string{user.ScopeAll}, clock.Now(), time.Hour)
+	require.NoError(t, err)
+	require.False(t, a.IsValid(ctx, env.Repository, "ci@builder", unknownSecret))
+
+	require.NoError(t, repo.WriteSession(ctx, env.Repository, repo.WriteSessionOptions{},
+		func(ctx context.Context, w repo.RepositoryWriter) error {
+			return user.SetToken(ctx, w, unknown)
+		}))
+
+	require.False(t, a.IsValid(ctx, env.Repository, "ci@builder", unknownSecret))
+	require.NoError(t, a.Refresh(ctx))
+	require.True(t, a.IsValid(ctx, env.Repository, "ci@builder", unknownSecret))
+
+	// revoked tokens are rejected after refresh.
+	require.NoError(t, repo.WriteSession(ctx, env.Repository, repo.WriteSessionOptions{},
+		func(ctx context.Context, w repo.RepositoryWriter) error {
+			return user.DeleteToken(ctx, w, tok.ID)
+		}))
+
+	require.NoError(t, a.Refresh(ctx))
+	require.False(t, a.IsValid(ctx, env.Repository, "ci@builder", secret))
+}
+
+func TestRestrictToScopes(t *testing.T) {
+	full := auth.LegacyAuthorizer().Authorize(testlogging.Context(t), nil, "foo@bar")
+
+	ro := auth.RestrictToScopes(full, []string{user.ScopeSnapshotRead})
+	require.Equal(t, auth.AccessLevelRead, ro.ContentAccessLevel())
+	verifyManifestAccessLevel(t, ro, fooAtBarSnapshot, auth.AccessLevelRead)
+	verifyManifestAccessLevel(t, ro, fooAtBarPolicy, auth.AccessLevelNone)
+
+	rw := auth.RestrictToScopes(full, []string{user.ScopeSnapshotWrite, user.ScopePolicyRead})
+	require.Equal(t, auth.AccessLevelAppend, rw.ContentAccessLevel())
+	verifyManifestAccessLevel(t, rw, fooAtBarSnapshot, auth.AccessLevelFull)
+	verifyManifestAccessLevel(t, rw, fooAtBarPolicy, auth.AccessLevelRead)
+
+	// scopes never grant more than the user has.
+	all := auth.RestrictToScopes(full, []string{user.ScopeAll})
+	require.Equal(t, auth.AccessLevelFull, all.ContentAccessLevel())
+	verifyManifestAccessLevel(t, all, fooAtBazSnapshot, auth.AccessLevelNone)
+
+	require.True(t, auth.HasScope([]string{user.ScopeAll}, user.ScopeServerControl))
+	require.False(t, auth.HasScope([]string{user.ScopeUI}, user.ScopeServerControl))
+}
@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -97,6 +98,8 @@ type aclCache struct {
 	nextRefreshTime time.Time
 	// +checklocks:mu
 	aclEntries []*acl.Entry
+	// +checklocks:mu
+	groups map[string]*user.Group
 }
 
 // Authorize returns authorization info based on ACLs stored in the repository falling back to legacy authorizer
@@ -116,6 +119,7 @@ func (ac *aclCache) Authorize(ctx context.Context, rep repo.Repository, username
 	if rep == ac.lastRep {
 		// the server switched to another repository, discard cache.
 		ac.aclEntries = nil
+		ac.groups = nil
 		ac.lastRep = rep
 
 		// ensure ACL entries are reloaded below
@@ -132,13 +136,28 @@ func (ac *aclCache) Authorize(ctx context.Context, rep repo.Repository, username
 		} else {
 			ac.aclEntries = newMap
 		}
+
+		newGroups, err := user.LoadGroupMap(ctx, rep, ac.groups)
+		if err != nil {
+			log(ctx).Errorf("unable to load user groups: %v", err)
+		} else {
+			ac.groups = newGroups
+		}
 	}
 
 	if len(ac.aclEntries) == 0 {
 		return legacyAuthorizationInfo{usernameAtHostname}
 	}
 
-	return aclEntriesAuthorizer{acl.EntriesForUser(ac.aclEntries, u, h), u, h}
+	// groups stored in the repository plus groups asserted by the identity provider.
+	groups := user.GroupsForUser(ac.groups, usernameAtHostname)
+	for _, g := range GroupsFromContext(ctx) {
+		if !slices.Contains(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+
+	return aclEntriesAuthorizer{acl.EntriesForUserInGroups(ac.aclEntries, u, h, groups), u, h, groups}
 }
 
 func (ac *aclCache) Refresh(_ context.Context) error {
@@ -155,14 +174,15 @@ type aclEntriesAuthorizer struct {
 	entries  []*acl.Entry
 	username string
 	hostname string
+	groups   []string
 }
 
 func (a aclEntriesAuthorizer) ContentAccessLevel() AccessLevel {
-	return acl.EffectivePermissions(a.username, a.hostname, ContentRule, a.entries)
+	return acl.EffectivePermissionsInGroups(a.username, a.hostname, a.groups, ContentRule, a.entries)
 }
 
 func (a aclEntriesAuthorizer) ManifestAccessLevel(labels map[string]string) AccessLevel {
-	return acl.EffectivePermissions(a.username, a.hostname, labels, a.entries)
+	return acl.EffectivePermissionsInGroups(a.username, a.hostname, a.groups, labels, a.entries)
 }
 
 // DefaultAuthorizer returns Authorizer that will fetch ACLs from the repository
@@ -9,6 +9,7 @@
 	"github.com/kopia/kopia/internal/acl"
 	"github.com/kopia/kopia/internal/auth"
 	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/user"
 	"github.com/kopia/kopia/repo"
 )
 
@@ -115,6 +116,40 @@ func TestDefaultAuthorizer_DefaultACLs(t *testing.T) {
 	verifyLegacyAuthorizer(ctx, t, env.Repository, auth.DefaultAuthorizer())
 }
 
+func TestDefaultAuthorizer_GroupACLs(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	for _, e := range auth.DefaultACLs {
+		require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, e, false))
+	}
+
+	require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:   "group:support",
+		Target: acl.TargetRule{"type": "snapshot"},
+		Access: auth.AccessLevelRead,
+	}, false))
+
+	require.NoError(t, user.SetGroup(ctx, env.RepositoryWriter, &user.Group{
+		Name:    "support",
+		Members: []string{"helpdesk@elsewhere"},
+	}))
+
+	a := auth.DefaultAuthorizer()
+
+	// member of the group stored in the repository.
+	verifyManifestAccessLevel(t, a.Authorize(ctx, env.RepositoryWriter, "helpdesk@elsewhere"), fooAtBarSnapshot, auth.AccessLevelRead)
+	verifyManifestAccessLevel(t, a.Authorize(ctx, env.RepositoryWriter, "helpdesk@elsewhere"), fooAtBarPolicy, auth.AccessLevelNone)
+
+	// not a member.
+	verifyManifestAccessLevel(t, a.Authorize(ctx, env.RepositoryWriter, "evil@elsewhere"), fooAtBarSnapshot, auth.AccessLevelNone)
+
+	// member of the group asserted by the identity provider.
+	verifyManifestAccessLevel(t, a.Authorize(auth.WithGroups(ctx, []string{"support"}), env.RepositoryWriter, "evil@elsewhere"), fooAtBarSnapshot, auth.AccessLevelRead)
+
+	// group members retain their own permissions.
+	verifyManifestAccessLevel(t, a.Authorize(auth.WithGroups(ctx, []string{"support"}), env.RepositoryWriter, "foo@bar"), fooAtBarSnapshot, auth.AccessLevelFull)
+}
+
 //nolint:thelper
 func verifyLegacyAuthorizer(ctx context.Context, t *testing.T, rep repo.Repository, authorizer auth.Authorizer) {
 	cases := []struct {
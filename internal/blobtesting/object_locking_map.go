@@ -200,7 +200,8 @@ func (s *objectLockingMap) DeleteBlob(ctx context.Context, id blob.ID) error {
 	return nil
 }
 
-// ExtendBlobRetention will alter the retention time on a blob if it exists.
+// ExtendBlobRetention will alter the retention time on a blob if it exists,
+// locking the blob if it was not locked before.
 func (s *objectLockingMap) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -215,9 +216,8 @@ func (s *objectLockingMap) ExtendBlobRetention(ctx context.Context, id blob.ID,
 	// by the given delta because we'd like to align with the S3 storage's current
 	// time and the S3 storage code extends retention periods based off the
 	// current time, not object mod time.
-	if !e.retentionTime.IsZero() {
-		e.retentionTime = s.timeNow().Add(opts.RetentionPeriod)
-	}
+	e.retentionTime = s.timeNow().Add(opts.RetentionPeriod)
+	e.retentionMode = opts.RetentionMode
 
 	return nil
 }
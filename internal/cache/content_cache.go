@@ -23,13 +23,14 @@ type ContentCache interface {
 
 // Options encapsulates all content cache options.
 type Options struct {
-	BaseCacheDirectory string
-	CacheSubDir        string
-	Storage            Storage // force particular storage, used for testing
-	HMACSecret         []byte
-	FetchFullBlobs     bool
-	Sweep              SweepSettings
-	TimeNow            func() time.Time
+	BaseCacheDirectory   string
+	CacheSubDir          string
+	SharedCacheDirectory string  // directory shared with other processes, used instead of BaseCacheDirectory
+	Storage              Storage // force particular storage, used for testing
+	HMACSecret           []byte
+	FetchFullBlobs       bool
+	Sweep                SweepSettings
+	TimeNow              func() time.Time
 }
 
 type contentCacheImpl struct {
@@ -65,6 +66,8 @@ func (c *contentCacheImpl) getContentFromFullBlob(ctx context.Context, blobID bl
 	c.pc.exclusiveLock(string(blobID))
 	defer c.pc.exclusiveUnlock(string(blobID))
 
+	defer c.pc.lockFetch(ctx, string(blobID))()
+
 	// check again to see if we perhaps lost the race and the data is now in cache.
 	if c.pc.getPartial(ctx, BlobIDCacheKey(blobID), offset, length, output) {
 		return nil
@@ -124,6 +127,8 @@ func (c *contentCacheImpl) getContentFromFullOrPartialBlob(ctx context.Context,
 	c.pc.exclusiveLock(contentID)
 	defer c.pc.exclusiveUnlock(contentID)
 
+	defer c.pc.lockFetch(ctx, contentID)()
+
 	output.Reset()
 
 	if c.pc.getFull(ctx, ContentIDCacheKey(contentID), output) {
@@ -160,6 +165,8 @@ func (c *contentCacheImpl) PrefetchBlob(ctx context.Context, blobID blob.ID) err
 	c.pc.exclusiveLock(string(blobID))
 	defer c.pc.exclusiveUnlock(string(blobID))
 
+	defer c.pc.lockFetch(ctx, string(blobID))()
+
 	if c.pc.getPartial(ctx, BlobIDCacheKey(blobID), 0, 1, &blobData) {
 		return nil
 	}
@@ -175,13 +182,18 @@ func (c *contentCacheImpl) CacheStorage() Storage {
 func NewContentCache(ctx context.Context, st blob.Storage, opt Options, mr *metrics.Registry) (ContentCache, error) {
 	cacheStorage := opt.Storage
 	if cacheStorage == nil {
-		if opt.BaseCacheDirectory == "" {
+		if opt.BaseCacheDirectory == "" && opt.SharedCacheDirectory == "" {
 			return passthroughContentCache{st}, nil
 		}
 
 		var err error
 
-		cacheStorage, err = NewStorageOrNil(ctx, opt.BaseCacheDirectory, opt.Sweep.MaxSizeBytes, opt.CacheSubDir)
+		if opt.SharedCacheDirectory != "" {
+			cacheStorage, err = NewSharedStorageOrNil(ctx, opt.SharedCacheDirectory, opt.Sweep.MaxSizeBytes, opt.CacheSubDir)
+		} else {
+			cacheStorage, err = NewStorageOrNil(ctx, opt.BaseCacheDirectory, opt.Sweep.MaxSizeBytes, opt.CacheSubDir)
+		}
+
 		if err != nil {
 			return nil, errors.Wrap(err, "error initializing cache storage")
 		}
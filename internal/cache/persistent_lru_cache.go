@@ -45,6 +45,11 @@ type PersistentCache struct {
 	// +checklocks:listCacheMutex
 	lastCacheWarning time.Time
 
+	// set when the cache storage is shared with other processes.
+	shared *sharedStorage
+	// +checklocks:listCacheMutex
+	lastSharedScan time.Time
+
 	description string
 
 	metricsStruct
@@ -72,6 +77,8 @@ func (c *PersistentCache) GetOrLoad(ctx context.Context, key string, fetch func(
 	c.exclusiveLock(key)
 	defer c.exclusiveUnlock(key)
 
+	defer c.lockFetch(ctx, key)()
+
 	// check again while holding the mutex
 	if c.getFull(ctx, key, output) {
 		return nil
@@ -289,6 +296,18 @@ func (c *PersistentCache) aboveHardLimit(extraBytes int64) bool {
 
 // +checklocks:c.listCacheMutex
 func (c *PersistentCache) sweepLocked(ctx context.Context) {
+	if c.shared != nil {
+		// only one of the processes sharing the cache sweeps it at a time.
+		unlock := c.shared.tryLockSweep(ctx)
+		if unlock == nil {
+			return
+		}
+
+		defer unlock()
+
+		c.rescanSharedLocked(ctx)
+	}
+
 	var (
 		unsuccessfulDeletes     []blob.Metadata
 		unsuccessfulDeleteBytes int64
@@ -325,6 +344,48 @@ func (c *PersistentCache) sweepLocked(ctx context.Context) {
 	}
 }
 
+// rescanSharedLocked periodically lists the shared cache to account for items added and removed
+// by other processes.
+//
+// +checklocks:c.listCacheMutex
+func (c *PersistentCache) rescanSharedLocked(ctx context.Context) {
+	now := c.timeNow()
+	if now.Sub(c.lastSharedScan) < sharedCacheRescanInterval {
+		return
+	}
+
+	c.lastSharedScan = now
+
+	c.applySharedSettingsLocked(ctx)
+
+	h := newContentMetadataHeap()
+
+	if err := c.cacheStorage.ListBlobs(ctx, "", func(it blob.Metadata) error {
+		heap.Push(&h, it)
+		return nil
+	}); err != nil {
+		log(ctx).Warnw("unable to list shared cache", "cache", c.description, "err", err)
+		return
+	}
+
+	c.listCache = h
+}
+
+// applySharedSettingsLocked applies size limits of the shared cache, which may have been changed
+// by other processes, so that the same limits apply regardless of which process sweeps the cache.
+//
+// +checklocks:c.listCacheMutex
+func (c *PersistentCache) applySharedSettingsLocked(ctx context.Context) {
+	v, err := c.shared.readSettings()
+	if err != nil {
+		log(ctx).Debugw("unable to read shared cache settings", "cache", c.description, "err", err)
+		return
+	}
+
+	c.sweep.MaxSizeBytes = v.MaxSizeBytes
+	c.sweep.LimitBytes = v.LimitBytes
+}
+
 func (c *PersistentCache) initialScan(ctx context.Context) error {
 	timer := timetrack.StartTimer()
 
@@ -352,6 +413,8 @@ func (c *PersistentCache) initialScan(ctx context.Context) error {
 		return errors.Wrapf(err, "error listing %v", c.description)
 	}
 
+	c.lastSharedScan = now
+
 	c.sweepLocked(ctx)
 
 	dur := timer.Elapsed()
@@ -379,6 +442,16 @@ func (c *PersistentCache) initialScan(ctx context.Context) error {
 	return nil
 }
 
+// lockFetch prevents other processes sharing the cache from fetching the item at the same time
+// and returns the function releasing the lock.
+func (c *PersistentCache) lockFetch(ctx context.Context, key string) func() {
+	if c == nil || c.shared == nil {
+		return func() {}
+	}
+
+	return c.shared.lockFetch(ctx, key)
+}
+
 func (c *PersistentCache) exclusiveLock(key string) {
 	if c != nil {
 		c.fetchMutexes.exclusiveLock(key)
@@ -454,6 +527,15 @@ func NewPersistentCache(ctx context.Context, description string, cacheStorage St
 		c.timeNow = clock.Now
 	}
 
+	if ss, ok := cacheStorage.(*sharedStorage); ok {
+		c.shared = ss
+
+		// the most recently opened process determines the size limits of the shared cache.
+		if err := ss.writeSettings(sweep); err != nil {
+			log(ctx).Warnw("unable to store shared cache settings", "cache", description, "err", err)
+		}
+	}
+
 	// verify that cache storage is functional by listing from it
 	if _, err := c.cacheStorage.GetMetadata(ctx, "test-blob"); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
 		return nil, errors.Wrapf(err, "unable to open %v", c.description)
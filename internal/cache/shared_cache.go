@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/ospath"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+	"github.com/kopia/kopia/repo/blob/sharded"
+)
+
+const (
+	// SharedDirMode is the directory mode for caches shared between users, which should be members
+	// of the group owning the shared cache directory.
+	SharedDirMode = 0o770 | os.ModeSetgid
+
+	sharedFileMode = 0o660
+
+	// number of lock files used to prevent concurrent fetches of the same item by multiple processes.
+	sharedFetchLockBuckets = 256
+
+	// maximum time to wait for another process to fetch the item before fetching it again.
+	sharedFetchLockTimeout = time.Minute
+	sharedLockRetryDelay   = 50 * time.Millisecond
+
+	// items written by other processes are discovered by listing the cache this often.
+	sharedCacheRescanInterval = time.Minute
+)
+
+// SharedDirectoryForRepository returns the subdirectory of the shared cache directory used by the
+// repository with the provided unique ID.
+func SharedDirectoryForRepository(sharedCacheDir string, uniqueID []byte) string {
+	h := sha256.Sum256(uniqueID)
+
+	return filepath.Join(sharedCacheDir, hex.EncodeToString(h[:])[0:16])
+}
+
+// sharedStorage is the cache storage in a directory shared by multiple processes, possibly running
+// as different users. Cross-process locks are held in files in the 'locks' subdirectory and
+// the size limits applied by all processes are stored in the settings file next to it.
+type sharedStorage struct {
+	Storage
+
+	lockDir      string
+	settingsFile string
+	subdir       string
+
+	shardDirsMu sync.Mutex
+	// +checklocks:shardDirsMu
+	shardDirs map[string]bool // shard directories known to be writable by the group
+}
+
+// shardedStorage is implemented by the filesystem storage.
+type shardedStorage interface {
+	GetShardedPathAndFilePath(ctx context.Context, blobID blob.ID) (shardPath, filePath string, err error)
+}
+
+func (s *sharedStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	// shard directories are created by the filesystem storage with permissions reduced by umask,
+	// make sure other users can add files to them.
+	if ss, ok := s.Storage.(shardedStorage); ok {
+		if shardPath, _, err := ss.GetShardedPathAndFilePath(ctx, id); err == nil {
+			s.ensureSharedDir(ctx, shardPath)
+		}
+	}
+
+	//nolint:wrapcheck
+	return s.Storage.PutBlob(ctx, id, data, opts)
+}
+
+func (s *sharedStorage) ensureSharedDir(ctx context.Context, dir string) {
+	s.shardDirsMu.Lock()
+	defer s.shardDirsMu.Unlock()
+
+	if s.shardDirs[dir] {
+		return
+	}
+
+	if err := ensureSharedDir(dir); err != nil {
+		log(ctx).Debugw("unable to ensure permissions of shared cache directory", "dir", dir, "err", err)
+	}
+
+	s.shardDirs[dir] = true
+}
+
+// ensureSharedDir creates the directory accessible to the group if it does not exist.
+func ensureSharedDir(dir string) error {
+	if err := mkdirAll(dir, SharedDirMode); err != nil {
+		return errors.Wrap(err, "error creating shared cache directory")
+	}
+
+	st, err := os.Stat(dir)
+	if err != nil {
+		return errors.Wrap(err, "error reading shared cache directory")
+	}
+
+	if st.Mode()&SharedDirMode == SharedDirMode {
+		return nil
+	}
+
+	// this only succeeds for the owner of the directory.
+	return errors.Wrap(os.Chmod(dir, SharedDirMode), "error changing permissions of shared cache directory")
+}
+
+func (s *sharedStorage) newLock(name string) *flock.Flock {
+	return flock.New(filepath.Join(s.lockDir, s.subdir+"-"+name+".lock"), flock.SetPermissions(sharedFileMode))
+}
+
+// lockFetch acquires the cross-process lock preventing other processes from fetching the item
+// with the provided key at the same time and returns the function releasing it.
+// When the lock can't be acquired in a reasonable time, the item is fetched without the lock.
+func (s *sharedStorage) lockFetch(ctx context.Context, key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	l := s.newLock(hex.EncodeToString([]byte{byte(h.Sum32() % sharedFetchLockBuckets)}))
+
+	lockCtx, cancel := context.WithTimeout(ctx, sharedFetchLockTimeout)
+	defer cancel()
+
+	if ok, err := l.TryLockContext(lockCtx, sharedLockRetryDelay); !ok || err != nil {
+		log(ctx).Debugw("unable to lock shared cache item", "key", key, "err", err)
+
+		return func() {}
+	}
+
+	return func() {
+		l.Unlock() //nolint:errcheck
+	}
+}
+
+// tryLockSweep acquires the cross-process lock allowing the sweep of the cache and returns the
+// function releasing it or nil if another process holds the lock.
+func (s *sharedStorage) tryLockSweep(ctx context.Context) func() {
+	l := s.newLock("sweep")
+
+	if ok, err := l.TryLock(); !ok || err != nil {
+		if err != nil {
+			log(ctx).Debugw("unable to lock shared cache for sweeping", "err", err)
+		}
+
+		return nil
+	}
+
+	return func() {
+		l.Unlock() //nolint:errcheck
+	}
+}
+
+// sharedCacheSettings are the size limits of the shared cache, which apply to all processes using it.
+type sharedCacheSettings struct {
+	MaxSizeBytes int64 `json:"maxSizeBytes"`
+	LimitBytes   int64 `json:"limitBytes,omitempty"`
+}
+
+// writeSettings stores the size limits of the cache, which replace the limits of all processes using it.
+func (s *sharedStorage) writeSettings(sweep SweepSettings) error {
+	b, err := json.Marshal(sharedCacheSettings{
+		MaxSizeBytes: sweep.MaxSizeBytes,
+		LimitBytes:   sweep.LimitBytes,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal shared cache settings")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.settingsFile), filepath.Base(s.settingsFile)+".tmp*")
+	if err != nil {
+		return errors.Wrap(err, "unable to create shared cache settings")
+	}
+
+	tmpName := f.Name()
+
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmpName, sharedFileMode)
+	}
+
+	if err == nil {
+		err = os.Rename(tmpName, s.settingsFile)
+	}
+
+	if err != nil {
+		os.Remove(tmpName) //nolint:errcheck
+
+		return errors.Wrap(err, "unable to write shared cache settings")
+	}
+
+	return nil
+}
+
+// readSettings returns the size limits of the cache stored by the process which most recently opened it.
+func (s *sharedStorage) readSettings() (sharedCacheSettings, error) {
+	var v sharedCacheSettings
+
+	b, err := os.ReadFile(s.settingsFile)
+	if err != nil {
+		return v, errors.Wrap(err, "unable to read shared cache settings")
+	}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, errors.Wrap(err, "invalid shared cache settings")
+	}
+
+	return v, nil
+}
+
+// NewSharedStorageOrNil returns cache.Storage backed by the provided directory shared by multiple
+// processes and users on the host.
+func NewSharedStorageOrNil(ctx context.Context, sharedCacheDir string, maxBytes int64, subdir string) (Storage, error) {
+	if maxBytes <= 0 || sharedCacheDir == "" {
+		return nil, nil
+	}
+
+	if !ospath.IsAbs(sharedCacheDir) {
+		return nil, errors.Errorf("shared cache dir %q was not absolute", sharedCacheDir)
+	}
+
+	contentCacheDir := filepath.Join(sharedCacheDir, subdir)
+	lockDir := filepath.Join(sharedCacheDir, "locks")
+
+	for _, d := range []string{sharedCacheDir, contentCacheDir, lockDir} {
+		if err := ensureSharedDir(d); err != nil {
+			if _, statErr := os.Stat(d); statErr != nil {
+				return nil, err
+			}
+
+			// owned by another user, which should have created it with correct permissions.
+			log(ctx).Debugw("unable to ensure permissions of shared cache directory", "dir", d, "err", err)
+		}
+	}
+
+	fs, err := filesystem.New(context.WithoutCancel(ctx), &filesystem.Options{
+		Path:          contentCacheDir,
+		FileMode:      sharedFileMode,
+		DirectoryMode: SharedDirMode,
+		Options: sharded.Options{
+			DirectoryShards: []int{2},
+		},
+	}, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "error initializing shared filesystem cache")
+	}
+
+	return &sharedStorage{
+		Storage:      fs.(Storage), //nolint:forcetypeassert
+		lockDir:      lockDir,
+		settingsFile: filepath.Join(sharedCacheDir, subdir+".settings.json"),
+		subdir:       subdir,
+		shardDirs:    map[string]bool{},
+	}, nil
+}
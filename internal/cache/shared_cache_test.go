@@ -0,0 +1,192 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/cache"
+	"github.com/kopia/kopia/internal/cacheprot"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// newSharedCache simulates another process using the shared cache directory.
+func newSharedCache(ctx context.Context, t *testing.T, dir string, maxSizeBytes int64, timeNow func() time.Time) (*cache.PersistentCache, cache.Storage) {
+	t.Helper()
+
+	cs, err := cache.NewSharedStorageOrNil(ctx, dir, maxSizeBytes, "contents")
+	require.NoError(t, err)
+
+	pc, err := cache.NewPersistentCache(ctx, "testing", cs, cacheprot.ChecksumProtection([]byte{1, 2, 3}), cache.SweepSettings{
+		MaxSizeBytes: maxSizeBytes,
+	}, nil, timeNow)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { pc.Close(ctx) })
+
+	return pc, cs
+}
+
+func TestSharedCache(t *testing.T) {
+	ctx := testlogging.Context(t)
+	dir := cache.SharedDirectoryForRepository(testutil.TempDirectory(t), []byte("unique-id"))
+
+	pc1, _ := newSharedCache(ctx, t, dir, 10000, clock.Now)
+	pc2, _ := newSharedCache(ctx, t, dir, 10000, clock.Now)
+
+	someData := bytes.Repeat([]byte{1}, 300)
+
+	pc1.Put(ctx, "0123456789abcdef0123456789abcdef", gather.FromSlice(someData))
+
+	verifyCached(ctx, t, pc2, "0123456789abcdef0123456789abcdef", someData)
+
+	if runtime.GOOS != "windows" {
+		// shard directory must be writable by other users.
+		shardDir := filepath.Join(dir, "contents", "01")
+
+		st, err := os.Stat(shardDir)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o770), st.Mode().Perm())
+	}
+}
+
+func TestSharedCache_FetchedOnce(t *testing.T) {
+	ctx := testlogging.Context(t)
+	dir := testutil.TempDirectory(t)
+
+	pc1, _ := newSharedCache(ctx, t, dir, 10000, clock.Now)
+	pc2, _ := newSharedCache(ctx, t, dir, 10000, clock.Now)
+
+	var (
+		fetchStarted = make(chan struct{})
+		finishFetch  = make(chan struct{})
+		fetchCount   atomic.Int32
+		done         = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+
+		var tmp gather.WriteBuffer
+		defer tmp.Close()
+
+		require.NoError(t, pc1.GetOrLoad(ctx, "key1", func(output *gather.WriteBuffer) error {
+			fetchCount.Add(1)
+			close(fetchStarted)
+			<-finishFetch
+			output.Append([]byte{1, 2, 3})
+
+			return nil
+		}, &tmp))
+	}()
+
+	<-fetchStarted
+
+	time.AfterFunc(100*time.Millisecond, func() { close(finishFetch) })
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	// the other process waits for the item to be fetched and reads it from the cache.
+	require.NoError(t, pc2.GetOrLoad(ctx, "key1", func(output *gather.WriteBuffer) error {
+		fetchCount.Add(1)
+		output.Append([]byte{1, 2, 3})
+
+		return nil
+	}, &tmp))
+
+	<-done
+
+	require.Equal(t, []byte{1, 2, 3}, tmp.ToByteSlice())
+	require.EqualValues(t, 1, fetchCount.Load())
+}
+
+func TestSharedCache_Quota(t *testing.T) {
+	ctx := testlogging.Context(t)
+	dir := testutil.TempDirectory(t)
+
+	const maxSizeBytes = 1000
+
+	var now atomic.Pointer[time.Time]
+
+	t0 := clock.Now()
+	now.Store(&t0)
+
+	timeNow := func() time.Time { return *now.Load() }
+
+	pc1, cs := newSharedCache(ctx, t, dir, maxSizeBytes, timeNow)
+	pc2, _ := newSharedCache(ctx, t, dir, maxSizeBytes, timeNow)
+
+	someData := bytes.Repeat([]byte{1}, 300)
+
+	pc1.Put(ctx, "key1", gather.FromSlice(someData))
+	pc1.Put(ctx, "key2", gather.FromSlice(someData))
+	pc2.Put(ctx, "key3", gather.FromSlice(someData))
+
+	// each process only knows about its own items.
+	require.Equal(t, 3, countBlobs(ctx, t, cs))
+
+	// after a while the items added by other processes are included when sweeping.
+	t1 := t0.Add(time.Hour)
+	now.Store(&t1)
+
+	pc2.Put(ctx, "key4", gather.FromSlice(someData))
+
+	verifyBlobDoesNotExist(ctx, t, cs, "key1")
+	verifyBlobExists(ctx, t, cs, "key4")
+	require.Equal(t, 3, countBlobs(ctx, t, cs))
+}
+
+func TestSharedCache_QuotaFromMostRecentProcess(t *testing.T) {
+	ctx := testlogging.Context(t)
+	dir := testutil.TempDirectory(t)
+
+	var now atomic.Pointer[time.Time]
+
+	t0 := clock.Now()
+	now.Store(&t0)
+
+	timeNow := func() time.Time { return *now.Load() }
+
+	pc1, cs := newSharedCache(ctx, t, dir, 1000, timeNow)
+
+	someData := bytes.Repeat([]byte{1}, 300)
+
+	pc1.Put(ctx, "key1", gather.FromSlice(someData))
+	pc1.Put(ctx, "key2", gather.FromSlice(someData))
+
+	// another process opens the cache with a lower limit, which applies to all processes.
+	newSharedCache(ctx, t, dir, 400, timeNow)
+
+	t1 := t0.Add(time.Hour)
+	now.Store(&t1)
+
+	pc1.Put(ctx, "key3", gather.FromSlice(someData))
+
+	verifyBlobExists(ctx, t, cs, "key3")
+	require.Equal(t, 1, countBlobs(ctx, t, cs))
+}
+
+func countBlobs(ctx context.Context, t *testing.T, cs cache.Storage) int {
+	t.Helper()
+
+	var cnt int
+
+	require.NoError(t, cs.ListBlobs(ctx, "", func(blob.Metadata) error {
+		cnt++
+		return nil
+	}))
+
+	return cnt
+}
@@ -27,32 +27,92 @@ type ConnectorImpl interface {
 	IsConnectionClosedError(err error) bool
 }
 
-// Reconnector manages active Connection with automatic retrying and reconnection.
+// Reconnector manages a pool of active Connections with automatic retrying and reconnection.
+// Connections are established lazily, each operation uses the connection with the fewest
+// operations in progress.
 type Reconnector struct {
 	connector ConnectorImpl
 
+	// protects inUse counters of slots, which are not modified after creation.
+	mu    sync.Mutex
+	slots []*connectionSlot
+}
+
+// connectionSlot holds a single connection of the pool, which is re-established when it fails.
+type connectionSlot struct {
+	inUse int // number of operations using the slot
+
 	mu sync.Mutex
 	// +checklocks:mu
 	activeConnection Connection
 }
 
-// GetOrOpenConnection gets or establishes new connection and returns it.
-func (r *Reconnector) GetOrOpenConnection(ctx context.Context) (Connection, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (s *connectionSlot) getOrOpenConnection(ctx context.Context, connector ConnectorImpl) (Connection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if r.activeConnection == nil {
+	if s.activeConnection == nil {
 		log(ctx).Debug("establishing new connection...")
 
-		conn, err := r.connector.NewConnection(ctx)
+		conn, err := connector.NewConnection(ctx)
 		if err != nil {
 			return nil, errors.Wrap(err, "error establishing connecting")
 		}
 
-		r.activeConnection = conn
+		s.activeConnection = conn
+	}
+
+	return s.activeConnection, nil
+}
+
+// closeConnection closes the active connection of the slot, if it is the provided connection
+// or the provided connection is nil.
+func (s *connectionSlot) closeConnection(ctx context.Context, conn Connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.activeConnection
+	if c == nil || (conn != nil && c != conn) {
+		// already closed or re-established.
+		return
+	}
+
+	s.activeConnection = nil
+
+	log(ctx).Debug("closing active connection.")
+
+	if err := c.Close(); err != nil {
+		log(ctx).Errorf("error closing active connection: %v", err)
+	}
+}
+
+func (r *Reconnector) acquireSlot() *connectionSlot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	best := r.slots[0]
+
+	for _, s := range r.slots[1:] {
+		if s.inUse < best.inUse {
+			best = s
+		}
 	}
 
-	return r.activeConnection, nil
+	best.inUse++
+
+	return best
+}
+
+func (r *Reconnector) releaseSlot(s *connectionSlot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s.inUse--
+}
+
+// GetOrOpenConnection gets or establishes the first connection of the pool and returns it.
+func (r *Reconnector) GetOrOpenConnection(ctx context.Context) (Connection, error) {
+	return r.slots[0].getOrOpenConnection(ctx, r.connector)
 }
 
 // UsingConnection invokes the provided callback for a Connection.
@@ -60,14 +120,15 @@ func UsingConnection[T any](ctx context.Context, r *Reconnector, desc string, cb
 	var defaultT T
 
 	return retry.WithExponentialBackoff(ctx, desc, func() (T, error) {
-		conn, err := r.GetOrOpenConnection(ctx)
+		s := r.acquireSlot()
+		defer r.releaseSlot(s)
+
+		conn, err := s.getOrOpenConnection(ctx, r.connector)
 		if err != nil {
 			if r.connector.IsConnectionClosedError(err) {
 				log(ctx).Errorf("connection failed: %v, will retry", err)
 			}
 
-			r.CloseActiveConnection(ctx)
-
 			return defaultT, errors.Wrap(err, "error opening connection")
 		}
 
@@ -76,7 +137,7 @@ func UsingConnection[T any](ctx context.Context, r *Reconnector, desc string, cb
 			if r.connector.IsConnectionClosedError(err) {
 				log(ctx).Errorf("connection closed: %v, will retry", err)
 
-				r.CloseActiveConnection(ctx)
+				s.closeConnection(ctx, conn)
 			}
 		}
 
@@ -93,26 +154,32 @@ func (r *Reconnector) UsingConnectionNoResult(ctx context.Context, desc string,
 	return err
 }
 
-// CloseActiveConnection closes the active connection if any.
+// CloseActiveConnection closes all active connections of the pool.
 func (r *Reconnector) CloseActiveConnection(ctx context.Context) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	c := r.activeConnection
-	r.activeConnection = nil
-
-	if c != nil {
-		log(ctx).Debug("closing active connection.")
-
-		if err := c.Close(); err != nil {
-			log(ctx).Errorf("error closing active connection: %v", err)
-		}
+	for _, s := range r.slots {
+		s.closeConnection(ctx, nil)
 	}
 }
 
-// NewReconnector creates a new Pool for a given connector.
+// NewReconnector creates a new Reconnector for a given connector, which uses a single connection.
 func NewReconnector(conn ConnectorImpl) *Reconnector {
-	return &Reconnector{
+	return NewReconnectorPool(conn, 1)
+}
+
+// NewReconnectorPool creates a new Reconnector for a given connector, which uses up to the
+// provided number of connections in parallel.
+func NewReconnectorPool(conn ConnectorImpl, poolSize int) *Reconnector {
+	if poolSize < 1 {
+		poolSize = 1
+	}
+
+	r := &Reconnector{
 		connector: conn,
 	}
+
+	for range poolSize {
+		r.slots = append(r.slots, &connectionSlot{})
+	}
+
+	return r
 }
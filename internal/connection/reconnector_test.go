@@ -197,3 +197,68 @@ func TestConnection(t *testing.T) {
 
 	require.NoError(t, eg.Wait())
 }
+
+func TestConnectionPool(t *testing.T) {
+	fc := &fakeConnector{}
+
+	ctx := testlogging.Context(t)
+
+	r := connection.NewReconnectorPool(fc, 2)
+
+	// sequential operations share the first connection.
+	for range 3 {
+		require.NoError(t, r.UsingConnectionNoResult(ctx, "sequential", func(cli connection.Connection) error {
+			require.EqualValues(t, 1, testutil.EnsureType[*fakeConnection](t, cli).id)
+			return nil
+		}))
+	}
+
+	// concurrent operations use different connections, up to the pool size.
+	require.NoError(t, r.UsingConnectionNoResult(ctx, "outer", func(cli connection.Connection) error {
+		require.EqualValues(t, 1, testutil.EnsureType[*fakeConnection](t, cli).id)
+
+		return r.UsingConnectionNoResult(ctx, "inner", func(cli connection.Connection) error {
+			require.EqualValues(t, 2, testutil.EnsureType[*fakeConnection](t, cli).id)
+
+			return r.UsingConnectionNoResult(ctx, "innermost", func(cli connection.Connection) error {
+				require.EqualValues(t, 1, testutil.EnsureType[*fakeConnection](t, cli).id)
+				return nil
+			})
+		})
+	}))
+
+	require.EqualValues(t, 2, fc.nextConnectionID.Load())
+
+	// failure of one connection only re-establishes that connection.
+	failed := false
+
+	require.NoError(t, r.UsingConnectionNoResult(ctx, "outer", func(cli connection.Connection) error {
+		require.EqualValues(t, 1, testutil.EnsureType[*fakeConnection](t, cli).id)
+
+		return r.UsingConnectionNoResult(ctx, "inner", func(cli connection.Connection) error {
+			if !failed {
+				failed = true
+
+				require.EqualValues(t, 2, testutil.EnsureType[*fakeConnection](t, cli).id)
+
+				return errFakeConnectionFailed
+			}
+
+			require.EqualValues(t, 3, testutil.EnsureType[*fakeConnection](t, cli).id)
+
+			return nil
+		})
+	}))
+
+	require.NoError(t, r.UsingConnectionNoResult(ctx, "after-failure", func(cli connection.Connection) error {
+		require.EqualValues(t, 1, testutil.EnsureType[*fakeConnection](t, cli).id)
+		return nil
+	}))
+
+	r.CloseActiveConnection(ctx)
+
+	require.NoError(t, r.UsingConnectionNoResult(ctx, "after-close", func(cli connection.Connection) error {
+		require.EqualValues(t, 4, testutil.EnsureType[*fakeConnection](t, cli).id)
+		return nil
+	}))
+}
@@ -0,0 +1,211 @@
+// Package oidctesting implements a minimal OpenID Connect provider for use in tests.
+package oidctesting
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/clock"
+)
+
+const (
+	testKeyID        = "test-key"
+	rsaKeyBits       = 2048
+	idTokenTTL       = time.Hour
+	testClientID     = "kopia-test"
+	testClientSecret = "kopia-test-secret"
+)
+
+// Provider is a mock OpenID Connect provider.
+type Provider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// ClientID and ClientSecret are the credentials expected by the token endpoint.
+	ClientID     string
+	ClientSecret string
+
+	mu sync.Mutex
+	// +checklocks:mu
+	nextClaims jwt.MapClaims
+	// +checklocks:mu
+	codes map[string]jwt.MapClaims
+}
+
+// NewProvider starts a mock OpenID Connect provider which is stopped at the end of the test.
+func NewProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	require.NoError(t, err)
+
+	p := &Provider{
+		t:            t,
+		key:          key,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		codes:        map[string]jwt.MapClaims{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/authorize", p.handleAuthorize)
+	mux.HandleFunc("/token", p.handleToken)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// IssuerURL returns the URL of the issuer.
+func (p *Provider) IssuerURL() string {
+	return p.server.URL
+}
+
+// SetLoginClaims sets the claims of the user that will be logged in by the authorization endpoint.
+func (p *Provider) SetLoginClaims(claims map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextClaims = claims
+}
+
+// IssueIDToken returns a signed ID token with the provided claims merged with default ones.
+func (p *Provider) IssueIDToken(claims map[string]any) string {
+	p.t.Helper()
+
+	now := clock.Now()
+
+	c := jwt.MapClaims{
+		"iss": p.IssuerURL(),
+		"aud": p.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(idTokenTTL).Unix(),
+	}
+
+	for k, v := range claims {
+		c[k] = v
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+	tok.Header["kid"] = testKeyID
+
+	s, err := tok.SignedString(p.key)
+	require.NoError(p.t, err)
+
+	return s
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"issuer":                 p.IssuerURL(),
+		"authorization_endpoint": p.IssuerURL() + "/authorize",
+		"token_endpoint":         p.IssuerURL() + "/token",
+		"jwks_uri":               p.IssuerURL() + "/jwks",
+	})
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"keys": []map[string]string{
+			{
+				"kid": testKeyID,
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			},
+		},
+	})
+}
+
+// handleAuthorize immediately logs in the user with claims set using SetLoginClaims and redirects back.
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != p.ClientID {
+		http.Error(w, "invalid client", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	claims := jwt.MapClaims{}
+
+	for k, v := range p.nextClaims {
+		claims[k] = v
+	}
+
+	claims["nonce"] = q.Get("nonce")
+	code := uuid.NewString()
+	p.codes[code] = claims
+	p.mu.Unlock()
+
+	u, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	rq := u.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	u.RawQuery = rq.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		http.Error(w, "invalid client credentials", http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	claims, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": uuid.NewString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(idTokenTTL.Seconds()),
+		"id_token":     p.IssueIDToken(claims),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
@@ -40,6 +40,11 @@ func ScrubSensitiveData(v reflect.Value) reflect.Value {
 						fv = ScrubSensitiveData(fv.Elem())
 					}
 
+				case reflect.Slice:
+					if !fv.IsNil() && fv.Type().Elem().Kind() == reflect.Struct {
+						fv = scrubSlice(fv)
+					}
+
 				default: // Set the field as-is.
 				}
 
@@ -53,3 +58,13 @@ func ScrubSensitiveData(v reflect.Value) reflect.Value {
 		panic("Unsupported type: " + v.String())
 	}
 }
+
+func scrubSlice(v reflect.Value) reflect.Value {
+	res := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+
+	for i := range v.Len() {
+		res.Index(i).Set(ScrubSensitiveData(v.Index(i)))
+	}
+
+	return res
+}
@@ -17,6 +17,8 @@ type S struct {
 	InnerStruct   Q
 	NilPtr        *Q
 	NilIf         any
+	InnerSlice    []Q
+	NilSlice      []Q
 }
 
 type Q struct {
@@ -42,6 +44,10 @@ func TestScrubber(t *testing.T) {
 		},
 		NilPtr: nil,
 		NilIf:  nil,
+		InnerSlice: []Q{
+			{SomePassword1: "foo", NonPassword: "bar"},
+			{SomePassword1: "foobar", NonPassword: "baz"},
+		},
 	}
 
 	want := &S{
@@ -61,6 +67,10 @@ func TestScrubber(t *testing.T) {
 		},
 		NilPtr: nil,
 		NilIf:  nil,
+		InnerSlice: []Q{
+			{SomePassword1: "***", NonPassword: "bar"},
+			{SomePassword1: "******", NonPassword: "baz"},
+		},
 	}
 
 	output := scrubber.ScrubSensitiveData(reflect.ValueOf(input)).Interface()
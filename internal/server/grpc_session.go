@@ -18,9 +18,11 @@
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
+	"github.com/kopia/kopia/internal/audit"
 	"github.com/kopia/kopia/internal/auth"
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/grpcapi"
+	"github.com/kopia/kopia/internal/user"
 	"github.com/kopia/kopia/notification"
 	"github.com/kopia/kopia/notification/notifydata"
 	"github.com/kopia/kopia/repo"
@@ -30,6 +32,7 @@
 	"github.com/kopia/kopia/repo/object"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
 type grpcServerState struct {
@@ -54,24 +57,66 @@ func (s *Server) send(srv grpcapi.KopiaRepository_SessionServer, requestID int64
 	return nil
 }
 
-func (s *Server) authenticateGRPCSession(ctx context.Context, rep repo.Repository) (string, error) {
+// authenticateGRPCSession authenticates the session and returns the username@hostname of the caller along
+// with the context carrying the groups asserted by the identity provider and API token scopes, if any.
+func (s *Server) authenticateGRPCSession(ctx context.Context, rep repo.Repository) (context.Context, string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return "", status.Errorf(codes.PermissionDenied, "metadata not found in context")
+		return ctx, "", status.Errorf(codes.PermissionDenied, "metadata not found in context")
+	}
+
+	if a := md.Get("authorization"); len(a) == 1 && s.options.OIDC != nil {
+		if tok, ok := strings.CutPrefix(a[0], "Bearer "); ok {
+			id, err := s.options.OIDC.VerifyIDToken(ctx, tok)
+			if err != nil {
+				return ctx, "", status.Errorf(codes.PermissionDenied, "invalid bearer token")
+			}
+
+			return auth.WithGroups(ctx, id.Groups), id.UsernameAtHost, nil
+		}
 	}
 
 	if u, h, p := md.Get("kopia-username"), md.Get("kopia-hostname"), md.Get("kopia-password"); len(u) == 1 && len(p) == 1 && len(h) == 1 {
 		username := u[0] + "@" + h[0]
 		password := p[0]
 
+		var remoteAddr string
+		if pi, ok := peer.FromContext(ctx); ok {
+			remoteAddr = s.clientAddress(pi.Addr.String(), md.Get("x-forwarded-for"))
+		}
+
+		if _, locked := s.loginLockedUntil(username, remoteAddr); locked {
+			return ctx, "", status.Errorf(codes.ResourceExhausted, "too many failed login attempts for %v, try again later", username)
+		}
+
 		if s.authenticator.IsValid(ctx, rep, username, password) {
-			return username, nil
+			s.recordSuccessfulLogin(username)
+
+			if s.options.OIDC != nil {
+				// ID token passed as a password, make its groups available for authorization.
+				if id, err := s.options.OIDC.VerifyIDToken(ctx, password); err == nil {
+					ctx = auth.WithGroups(ctx, id.Groups)
+				}
+			}
+
+			if user.IsToken(password) {
+				scopes, ok := auth.CredentialScopes(ctx, s.authenticator, rep, username, password)
+				if !ok {
+					return ctx, "", status.Errorf(codes.PermissionDenied, "unable to determine scopes of API token for %v", username)
+				}
+
+				ctx = auth.WithScopes(ctx, scopes)
+			}
+
+			return ctx, username, nil
 		}
 
-		return "", status.Errorf(codes.PermissionDenied, "access denied for %v", username)
+		s.recordFailedLogin(ctx, rep, username, remoteAddr)
+
+		return ctx, "", status.Errorf(codes.PermissionDenied, "access denied for %v", username)
 	}
 
-	return "", status.Errorf(codes.PermissionDenied, "missing credentials")
+	return ctx, "", status.Errorf(codes.PermissionDenied, "missing credentials")
 }
 
 // Session handles GRPC session from a repository client.
@@ -86,7 +131,7 @@ func (s *Server) Session(srv grpcapi.KopiaRepository_SessionServer) error {
 		return status.Errorf(codes.Unavailable, "not connected to a direct repository")
 	}
 
-	usernameAtHostname, err := s.authenticateGRPCSession(ctx, dr)
+	ctx, usernameAtHostname, err := s.authenticateGRPCSession(ctx, dr)
 	if err != nil {
 		return err
 	}
@@ -96,6 +141,10 @@ func (s *Server) Session(srv grpcapi.KopiaRepository_SessionServer) error {
 		authz = auth.NoAccess()
 	}
 
+	if scopes, ok := auth.ScopesFromContext(ctx); ok {
+		authz = auth.RestrictToScopes(authz, scopes)
+	}
+
 	p, ok := peer.FromContext(ctx)
 	if !ok {
 		return status.Errorf(codes.PermissionDenied, "peer not found in context")
@@ -125,6 +174,11 @@ func (s *Server) Session(srv grpcapi.KopiaRepository_SessionServer) error {
 			default:
 			}
 
+			// enforce per-user request rate limit
+			if err := s.waitForUserRequest(ctx, usernameAtHostname); err != nil {
+				return err
+			}
+
 			// enforce limit on concurrent handling
 			if err := s.sem.Acquire(ctx, 1); err != nil {
 				return errors.Wrap(err, "unable to acquire semaphore")
@@ -156,6 +210,9 @@ func (s *Server) handleSessionRequest(ctx context.Context, dw repo.DirectReposit
 		ctx = tc.Extract(ctx, propagation.MapCarrier(req.GetTraceContext()))
 	}
 
+	// attribute repository mutations to the remote user rather than the server.
+	ctx = audit.WithActor(ctx, usernameAtHostname)
+
 	switch inner := req.GetRequest().(type) {
 	case *grpcapi.SessionRequest_GetContentInfo:
 		respond(handleGetContentInfoRequest(ctx, dw, authz, inner.GetContentInfo))
@@ -168,6 +225,7 @@ func (s *Server) handleSessionRequest(ctx context.Context, dw repo.DirectReposit
 
 	case *grpcapi.SessionRequest_Flush:
 		respond(handleFlushRequest(ctx, dw, authz, inner.Flush))
+		s.triggerReplication()
 
 	case *grpcapi.SessionRequest_GetManifest:
 		respond(handleGetManifestRequest(ctx, dw, authz, inner.GetManifest))
@@ -475,7 +533,7 @@ func handleApplyRetentionPolicyRequest(ctx context.Context, rep repo.RepositoryW
 		Host:     hostname,
 		UserName: username,
 		Path:     req.GetSourcePath(),
-	}, req.GetReallyDelete())
+	}, req.GetReallyDelete(), snapshotfs.CalculateStorageStats)
 	if err != nil {
 		return errorResponse(err)
 	}
@@ -45,6 +45,12 @@ type requestContext struct {
 	body []byte
 	rep  repo.Repository
 	srv  serverInterface
+
+	// identity of the caller when authenticated using OIDC.
+	oidcIdentity *auth.OIDCIdentity
+
+	// scopes the caller is limited to when authenticated using an API token, nil otherwise.
+	tokenScopes []string
 }
 
 func (r *requestContext) muxVar(s string) string {
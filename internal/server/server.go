@@ -8,8 +8,11 @@
 	"fmt"
 	"html"
 	"io"
+	"math"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +29,7 @@
 	"github.com/kopia/kopia/internal/scheduler"
 	"github.com/kopia/kopia/internal/serverapi"
 	"github.com/kopia/kopia/internal/uitask"
+	"github.com/kopia/kopia/internal/user"
 	"github.com/kopia/kopia/notification"
 	"github.com/kopia/kopia/notification/notifydata"
 	"github.com/kopia/kopia/notification/notifytemplate"
@@ -33,6 +37,7 @@
 	"github.com/kopia/kopia/repo/logging"
 	"github.com/kopia/kopia/repo/maintenance"
 	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/repo/replication"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
 	"github.com/kopia/kopia/snapshot/snapshotmaintenance"
@@ -71,6 +76,9 @@ type Server struct {
 	authenticator auth.Authenticator
 	authorizer    auth.Authorizer
 
+	loginLimiter    *loginLimiter
+	userRateLimiter *userRateLimiter
+
 	initTaskMutex sync.Mutex
 	// +checklocks:initTaskMutex
 	initRepositoryTaskID string // non-empty - repository is currently being opened.
@@ -94,6 +102,10 @@ type Server struct {
 	rep repo.Repository
 	// +checklocks:serverMutex
 	maint *srvMaintenance
+
+	replMutex sync.Mutex
+	// +checklocks:replMutex
+	repl *srvReplication
 	// +checklocks:serverMutex
 	sourceManagers map[snapshot.SourceInfo]*sourceManager
 	// +checklocks:serverMutex
@@ -118,6 +130,10 @@ type Server struct {
 
 // SetupHTMLUIAPIHandlers registers API requests required by the HTMLUI.
 func (s *Server) SetupHTMLUIAPIHandlers(m *mux.Router) {
+	if s.options.OIDC != nil {
+		s.setupOIDCHandlers(m)
+	}
+
 	// sources
 	m.HandleFunc("/api/v1/sources", s.handleUI(handleSourcesList)).Methods(http.MethodGet)
 	m.HandleFunc("/api/v1/sources", s.handleUI(handleSourcesCreate)).Methods(http.MethodPost)
@@ -193,21 +209,35 @@ func (s *Server) rootContext() context.Context {
 	return s.rootctx
 }
 
-func (s *Server) isAuthenticated(rc requestContext) bool {
+func (s *Server) isAuthenticated(rc *requestContext) bool {
 	authn := rc.srv.getAuthenticator()
 	if authn == nil {
 		return true
 	}
 
+	if s.options.OIDC != nil {
+		if id := s.oidcIdentityFromRequest(rc.req); id != nil {
+			rc.oidcIdentity = id
+			return true
+		}
+	}
+
 	username, password, ok := rc.req.BasicAuth()
 	if !ok {
+		if s.options.OIDC != nil && redirectToOIDCLogin(rc.w, rc.req) {
+			return false
+		}
+
 		rc.w.Header().Set("WWW-Authenticate", `Basic realm="Kopia"`)
 		http.Error(rc.w, "Missing credentials.\n", http.StatusUnauthorized)
 
 		return false
 	}
 
-	if c, err := rc.req.Cookie(kopiaAuthCookie); err == nil && c != nil {
+	// API tokens may be limited to certain scopes, which the auth cookie does not carry.
+	isToken := user.IsToken(password)
+
+	if c, err := rc.req.Cookie(kopiaAuthCookie); err == nil && c != nil && !isToken {
 		if rc.srv.isAuthCookieValid(username, c.Value) {
 			// found a short-term JWT cookie that matches given username, trust it.
 			// this avoids potentially expensive password hashing inside the authenticator.
@@ -215,16 +245,47 @@ func (s *Server) isAuthenticated(rc requestContext) bool {
 		}
 	}
 
+	clientAddr := s.clientAddress(rc.req.RemoteAddr, rc.req.Header.Values("X-Forwarded-For"))
+
+	if until, locked := s.loginLockedUntil(username, clientAddr); locked {
+		rc.w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(until.Sub(clock.Now()).Seconds()))))
+		http.Error(rc.w, "Too many failed login attempts, try again later.\n", http.StatusTooManyRequests)
+
+		return false
+	}
+
 	if !authn.IsValid(rc.req.Context(), rc.rep, username, password) {
 		rc.w.Header().Set("WWW-Authenticate", `Basic realm="Kopia"`)
 		http.Error(rc.w, "Access denied.\n", http.StatusUnauthorized)
 
 		// Log failed authentication attempt
-		log(rc.req.Context()).Warnf("failed login attempt by client %s for user %s", rc.req.RemoteAddr, username)
+		log(rc.req.Context()).Warnf("failed login attempt by client %s for user %s", clientAddr, username)
+
+		s.recordFailedLogin(rc.req.Context(), rc.rep, username, clientAddr)
 
 		return false
 	}
 
+	s.recordSuccessfulLogin(username)
+
+	if isToken {
+		scopes, ok := auth.CredentialScopes(rc.req.Context(), authn, rc.rep, username, password)
+		if !ok {
+			// the token may have been revoked or expired since it was validated, in which case
+			// its scopes are unknown and the request must not be granted unrestricted access.
+			rc.w.Header().Set("WWW-Authenticate", `Basic realm="Kopia"`)
+			http.Error(rc.w, "Access denied.\n", http.StatusUnauthorized)
+
+			log(rc.req.Context()).Warnf("unable to determine scopes of API token used by client %s for user %s", rc.req.RemoteAddr, username)
+
+			return false
+		}
+
+		rc.tokenScopes = scopes
+
+		return true
+	}
+
 	now := clock.Now()
 
 	ac, err := rc.srv.generateShortTermAuthCookie(username, now)
@@ -256,7 +317,7 @@ func (s *Server) isAuthCookieValid(username, cookieValue string) bool {
 	}
 
 	sc, ok := tok.Claims.(*jwt.RegisteredClaims)
-	if !ok {
+	if !ok || !sc.VerifyAudience(kopiaAuthCookieAudience, true) {
 		return false
 	}
 
@@ -309,11 +370,12 @@ func (s *Server) requireAuth(checkCSRFToken csrfTokenOption, f func(ctx context.
 		rc := s.captureRequestContext(w, r)
 
 		//nolint:contextcheck
-		if !s.isAuthenticated(rc) {
+		if !s.isAuthenticated(&rc) || s.isRateLimited(rc) {
 			return
 		}
 
-		if checkCSRFToken == csrfTokenRequired {
+		// requests carrying bearer tokens can't be forged by the browser.
+		if checkCSRFToken == csrfTokenRequired && !isOIDCBearerRequest(rc) {
 			if !s.validateCSRFToken(r) {
 				http.Error(w, "Invalid or missing CSRF token.\n", http.StatusUnauthorized)
 				return
@@ -621,6 +683,16 @@ func (s *Server) SetRepository(ctx context.Context, rep repo.Repository) error {
 		s.stopAllSourceManagersLocked(ctx)
 		log(ctx).Debug("stopped all source managers")
 
+		// replicate remaining changes before closing the repository.
+		s.setReplicationManager(ctx, nil)
+
+		// persist pending authenticator state, such as last-used times of API tokens.
+		if s.authenticator != nil {
+			if err := s.authenticator.Refresh(ctx); err != nil {
+				log(ctx).Errorf("unable to refresh authenticator: %v", err)
+			}
+		}
+
 		if err := s.rep.Close(ctx); err != nil {
 			return errors.Wrap(err, "unable to close previous repository")
 		}
@@ -645,6 +717,7 @@ func (s *Server) SetRepository(ctx context.Context, rep repo.Repository) error {
 	}
 
 	s.maint = maybeStartMaintenanceManager(ctx, s.rep, s, s.options.MinMaintenanceInterval)
+	s.setReplicationManager(ctx, maybeStartReplicationManager(ctx, s.rep, s.options.Replicator, s.options.ReplicaSyncInterval, s.options.ReplicaReconcileInterval))
 
 	s.sched = scheduler.Start(context.WithoutCancel(ctx), s.getSchedulerItems, scheduler.Options{
 		TimeNow:        clock.Now,
@@ -805,7 +878,7 @@ func (s *Server) ServeStaticFiles(m *mux.Router, fs http.FileSystem) {
 		rc := s.captureRequestContext(w, r)
 
 		//nolint:contextcheck
-		if !s.isAuthenticated(rc) {
+		if !s.isAuthenticated(&rc) || s.isRateLimited(rc) {
 			return
 		}
 
@@ -852,8 +925,11 @@ type Options struct {
 	AuthCookieSigningKey     string
 	LogRequests              bool
 	UIUser                   string // name of the user allowed to access the UI API
-	UIPreferencesFile        string // name of the JSON file storing UI preferences
-	ServerControlUser        string // name of the user allowed to access the server control API
+	OIDC                     *auth.OIDCProvider
+	OIDCUIGroups             []string // OIDC groups allowed to access the UI API
+	OIDCServerControlGroups  []string // OIDC groups allowed to access the server control API
+	UIPreferencesFile        string   // name of the JSON file storing UI preferences
+	ServerControlUser        string   // name of the user allowed to access the server control API
 	DisableCSRFTokenChecks   bool
 	PersistentLogs           bool
 	UITitlePrefix            string
@@ -861,6 +937,18 @@ type Options struct {
 	MinMaintenanceInterval   time.Duration
 	EnableErrorNotifications bool
 	NotifyTemplateOptions    notifytemplate.Options
+
+	MaxFailedLoginsPerUser  int            // number of failed logins after which the user is locked out, 0 - unlimited
+	MaxFailedLoginsPerIP    int            // number of failed logins after which the client address is locked out, 0 - unlimited
+	LoginLockoutDuration    time.Duration  // duration of the first lockout, doubled with each consecutive one
+	MaxLoginLockoutDuration time.Duration  // maximum duration of a lockout
+	UserRequestsPerSecond   float64        // maximum rate of requests per authenticated user, 0 - unlimited
+	UserRequestBurst        int            // maximum burst of requests per authenticated user
+	TrustedProxies          []netip.Prefix // reverse proxies whose X-Forwarded-For header determines the client address
+
+	Replicator               *replication.Replicator // optional replicator keeping the replica in sync with the repository
+	ReplicaSyncInterval      time.Duration           // how often changes are replicated
+	ReplicaReconcileInterval time.Duration           // how often full blob lists of the repository and the replica are compared
 }
 
 // InitRepositoryFunc is a function that attempts to connect to/open repository.
@@ -981,6 +1069,7 @@ func (s *Server) runSnapshotTask(ctx context.Context, src snapshot.SourceInfo, i
 	result.Manifest.Source = src
 
 	defer s.endUpload(ctx, src, &result)
+	defer s.triggerReplication()
 
 	err := errors.Wrap(s.taskmgr.Run(
 		ctx,
@@ -997,6 +1086,8 @@ func(ctx context.Context, ctrl uitask.Controller) error {
 }
 
 func (s *Server) runMaintenanceTask(ctx context.Context, dr repo.DirectRepository) error {
+	defer s.triggerReplication()
+
 	return errors.Wrap(s.taskmgr.Run(ctx, "Maintenance", "Periodic maintenance", func(ctx context.Context, _ uitask.Controller) error {
 		return repo.DirectWriteSession(ctx, dr, repo.WriteSessionOptions{
 			Purpose: "periodicMaintenance",
@@ -1135,6 +1226,8 @@ func New(ctx context.Context, options *Options) (*Server, error) {
 		grpcServerState:      makeGRPCServerState(options.MaxConcurrency),
 		authenticator:        options.Authenticator,
 		authorizer:           options.Authorizer,
+		loginLimiter:         newLoginLimiter(options),
+		userRateLimiter:      newUserRateLimiter(options),
 		taskmgr:              uitask.NewManager(options.PersistentLogs),
 		mounts:               map[object.ID]mount.Controller{},
 		authCookieSigningKey: []byte(options.AuthCookieSigningKey),
@@ -10,6 +10,8 @@
 	"net/http"
 
 	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/user"
 )
 
 // kopiaSessionCookie is the name of the session cookie that Kopia server will generate for all
@@ -63,13 +65,21 @@ func requireUIUser(_ context.Context, rc requestContext) bool {
 		return true
 	}
 
+	if id := rc.oidcIdentity; id != nil {
+		return (id.UsernameAtHost == rc.srv.getOptions().UIUser && rc.srv.getOptions().UIUser != "") || id.HasAnyGroup(rc.srv.getOptions().OIDCUIGroups)
+	}
+
+	if rc.tokenScopes != nil && !auth.HasScope(rc.tokenScopes, user.ScopeUI) {
+		return false
+	}
+
 	if rc.srv.getOptions().UIUser == "" {
 		return false
 	}
 
-	user, _, _ := rc.req.BasicAuth()
+	username, _, _ := rc.req.BasicAuth()
 
-	return user == rc.srv.getOptions().UIUser
+	return username == rc.srv.getOptions().UIUser
 }
 
 func requireServerControlUser(_ context.Context, rc requestContext) bool {
@@ -77,13 +87,21 @@ func requireServerControlUser(_ context.Context, rc requestContext) bool {
 		return true
 	}
 
+	if id := rc.oidcIdentity; id != nil {
+		return id.HasAnyGroup(rc.srv.getOptions().OIDCServerControlGroups)
+	}
+
+	if rc.tokenScopes != nil && !auth.HasScope(rc.tokenScopes, user.ScopeServerControl) {
+		return false
+	}
+
 	if rc.srv.getOptions().ServerControlUser == "" {
 		return false
 	}
 
-	user, _, _ := rc.req.BasicAuth()
+	username, _, _ := rc.req.BasicAuth()
 
-	return user == rc.srv.getOptions().ServerControlUser
+	return username == rc.srv.getOptions().ServerControlUser
 }
 
 func anyAuthenticatedUser(_ context.Context, _ requestContext) bool {
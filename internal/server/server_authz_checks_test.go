@@ -4,11 +4,16 @@
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/passwordpersist"
+	"github.com/kopia/kopia/internal/testlogging"
 )
 
 func TestGenerateCSRFToken(t *testing.T) {
@@ -97,3 +102,31 @@ func TestValidateCSRFToken(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenWithUnknownScopesIsRejected(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	// token-shaped credential accepted by an authenticator which does not know its scopes,
+	// which is also what happens when the token is revoked right after being validated.
+	token := "kopia_" + strings.Repeat("a", 16) + "_" + strings.Repeat("b", 64)
+
+	s, err := New(ctx, &Options{
+		Authorizer:      auth.LegacyAuthorizer(),
+		Authenticator:   auth.AuthenticateSingleUser("foo@bar", token),
+		PasswordPersist: passwordpersist.File(),
+		UIUser:          "foo@bar",
+	})
+	require.NoError(t, err)
+
+	h := s.requireAuth(csrfTokenNotRequired, func(_ context.Context, rc requestContext) {
+		rc.w.WriteHeader(http.StatusOK)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/repo/status", http.NoBody)
+	r.SetBasicAuth("foo@bar", token)
+
+	w := httptest.NewRecorder()
+	h(w, r)
+
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,375 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/notification"
+	"github.com/kopia/kopia/notification/notifydata"
+	"github.com/kopia/kopia/repo"
+)
+
+const (
+	// how often stale login tracking and rate limiting entries are removed.
+	loginLimiterSweepInterval = time.Minute
+
+	loginKeyUserPrefix = "user:"
+	loginKeyIPPrefix   = "ip:"
+)
+
+// loginFailures tracks consecutive failed logins for a single user or client address.
+type loginFailures struct {
+	failures    int       // failed attempts since the last lockout or successful login
+	lockouts    int       // number of consecutive lockouts, determines the length of next one
+	lastFailure time.Time // time of last failed attempt
+	lockedUntil time.Time // attempts are rejected until this time
+}
+
+// loginLimiter implements exponential lockout of users and client addresses after repeated failed logins.
+type loginLimiter struct {
+	maxFailuresPerUser int
+	maxFailuresPerIP   int
+	lockoutDuration    time.Duration
+	maxLockoutDuration time.Duration
+
+	mu sync.Mutex
+	// +checklocks:mu
+	entries map[string]*loginFailures
+	// +checklocks:mu
+	lastSweep time.Time
+}
+
+func newLoginLimiter(o *Options) *loginLimiter {
+	l := &loginLimiter{
+		maxFailuresPerUser: o.MaxFailedLoginsPerUser,
+		maxFailuresPerIP:   o.MaxFailedLoginsPerIP,
+		lockoutDuration:    o.LoginLockoutDuration,
+		maxLockoutDuration: o.MaxLoginLockoutDuration,
+		entries:            map[string]*loginFailures{},
+	}
+
+	if l.lockoutDuration <= 0 {
+		l.lockoutDuration = time.Minute
+	}
+
+	if l.maxLockoutDuration < l.lockoutDuration {
+		l.maxLockoutDuration = l.lockoutDuration
+	}
+
+	return l
+}
+
+// lockedUntil returns the time until which logins by the provided user or from the provided address are rejected.
+func (l *loginLimiter) lockedUntil(username, remoteAddr string, now time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var until time.Time
+
+	for _, k := range []string{loginKeyUserPrefix + username, loginKeyIPPrefix + clientIP(remoteAddr)} {
+		if e := l.entries[k]; e != nil && e.lockedUntil.After(until) {
+			until = e.lockedUntil
+		}
+	}
+
+	return until, until.After(now)
+}
+
+// loginLockout describes a user or client address which has just been locked out.
+type loginLockout struct {
+	subject string // "user <name>" or "client address <ip>"
+	until   time.Time
+}
+
+// recordFailure records failed login attempt and returns the users and addresses which have just been locked out.
+func (l *loginLimiter) recordFailure(username, remoteAddr string, now time.Time) []loginLockout {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweepLocked(now)
+
+	var result []loginLockout
+
+	if until, ok := l.recordFailureLocked(loginKeyUserPrefix+username, l.maxFailuresPerUser, now); ok {
+		result = append(result, loginLockout{"user " + username, until})
+	}
+
+	ip := clientIP(remoteAddr)
+
+	if until, ok := l.recordFailureLocked(loginKeyIPPrefix+ip, l.maxFailuresPerIP, now); ok {
+		result = append(result, loginLockout{"client address " + ip, until})
+	}
+
+	return result
+}
+
+// +checklocks:l.mu
+func (l *loginLimiter) recordFailureLocked(key string, maxFailures int, now time.Time) (time.Time, bool) {
+	if maxFailures <= 0 {
+		return time.Time{}, false
+	}
+
+	e := l.entries[key]
+	if e == nil {
+		e = &loginFailures{}
+		l.entries[key] = e
+	}
+
+	e.failures++
+	e.lastFailure = now
+
+	if e.failures < maxFailures {
+		return time.Time{}, false
+	}
+
+	// each consecutive lockout doubles in length, up to the maximum.
+	d := l.lockoutDuration
+	for range e.lockouts {
+		d *= 2
+
+		if d >= l.maxLockoutDuration {
+			d = l.maxLockoutDuration
+			break
+		}
+	}
+
+	e.failures = 0
+	e.lockouts++
+	e.lockedUntil = now.Add(d)
+
+	return e.lockedUntil, true
+}
+
+// recordSuccess resets failed login tracking for the user after a successful login.
+// Tracking of the client address is not reset, so that attackers holding valid
+// credentials for one account can't use them to keep guessing passwords of other accounts.
+func (l *loginLimiter) recordSuccess(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, loginKeyUserPrefix+username)
+}
+
+// +checklocks:l.mu
+func (l *loginLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < loginLimiterSweepInterval {
+		return
+	}
+
+	l.lastSweep = now
+
+	for k, e := range l.entries {
+		// forget entries that are no longer locked and have not seen failures for a while.
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > l.maxLockoutDuration {
+			delete(l.entries, k)
+		}
+	}
+}
+
+type userRateLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// userRateLimiter limits the rate of requests made by each authenticated user.
+type userRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu sync.Mutex
+	// +checklocks:mu
+	users map[string]*userRateLimiterEntry
+	// +checklocks:mu
+	lastSweep time.Time
+}
+
+func newUserRateLimiter(o *Options) *userRateLimiter {
+	if o.UserRequestsPerSecond <= 0 {
+		return nil
+	}
+
+	burst := o.UserRequestBurst
+	if burst <= 0 {
+		burst = max(1, int(o.UserRequestsPerSecond))
+	}
+
+	return &userRateLimiter{
+		limit: rate.Limit(o.UserRequestsPerSecond),
+		burst: burst,
+		users: map[string]*userRateLimiterEntry{},
+	}
+}
+
+// forUser returns the rate limiter for the provided user or nil if requests are not limited.
+func (r *userRateLimiter) forUser(username string, now time.Time) *rate.Limiter {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.lastSweep) >= loginLimiterSweepInterval {
+		r.lastSweep = now
+
+		for k, e := range r.users {
+			if now.Sub(e.lastUsed) >= loginLimiterSweepInterval {
+				delete(r.users, k)
+			}
+		}
+	}
+
+	e := r.users[username]
+	if e == nil {
+		e = &userRateLimiterEntry{limiter: rate.NewLimiter(r.limit, r.burst)}
+		r.users[username] = e
+	}
+
+	e.lastUsed = now
+
+	return e.limiter
+}
+
+// allow returns true if the user is allowed to make another request now.
+func (r *userRateLimiter) allow(username string, now time.Time) bool {
+	l := r.forUser(username, now)
+	if l == nil {
+		return true
+	}
+
+	return l.AllowN(now, 1)
+}
+
+// clientAddress returns the address of the client which made the request. When the request has been
+// forwarded by a trusted reverse proxy, the client address is the right-most address in the
+// X-Forwarded-For header which does not belong to a trusted proxy.
+func (s *Server) clientAddress(remoteAddr string, forwardedFor []string) string {
+	if !s.isTrustedProxy(clientIP(remoteAddr)) {
+		return remoteAddr
+	}
+
+	var hops []string
+
+	for _, v := range forwardedFor {
+		for h := range strings.SplitSeq(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hops = append(hops, h)
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !s.isTrustedProxy(hops[i]) {
+			return hops[i]
+		}
+	}
+
+	if len(hops) > 0 {
+		return hops[0]
+	}
+
+	return remoteAddr
+}
+
+func (s *Server) isTrustedProxy(ip string) bool {
+	a, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	a = a.Unmap()
+
+	for _, p := range s.options.TrustedProxies {
+		if p.Contains(a) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the host part of the provided remote address.
+func clientIP(remoteAddr string) string {
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return h
+	}
+
+	return remoteAddr
+}
+
+// loginLockedUntil returns the time until which logins by the user from the provided address are rejected.
+func (s *Server) loginLockedUntil(username, remoteAddr string) (time.Time, bool) {
+	return s.loginLimiter.lockedUntil(username, remoteAddr, clock.Now())
+}
+
+// recordFailedLogin records failed login attempt and notifies about the user or client address being locked out.
+func (s *Server) recordFailedLogin(ctx context.Context, rep repo.Repository, username, remoteAddr string) {
+	now := clock.Now()
+
+	for _, lo := range s.loginLimiter.recordFailure(username, remoteAddr, now) {
+		log(ctx).Warnf("%v has been locked out until %v after repeated failed login attempts, last one by %v from %v", lo.subject, lo.until, username, remoteAddr)
+
+		if rep == nil {
+			continue
+		}
+
+		// sending notifications may be slow, don't hold up the response to the failed login.
+		go notification.Send(context.WithoutCancel(ctx), rep, "generic-error", notifydata.NewErrorInfo(
+			"Login",
+			fmt.Sprintf("Authentication of %v from %v", username, clientIP(remoteAddr)),
+			now,
+			now,
+			errors.Errorf("%v has been locked out until %v after repeated failed login attempts", lo.subject, lo.until.Format(time.RFC3339)),
+		), notification.SeverityWarning, s.notificationTemplateOptions())
+	}
+}
+
+// recordSuccessfulLogin resets failed login tracking for the user.
+func (s *Server) recordSuccessfulLogin(username string) {
+	s.loginLimiter.recordSuccess(username)
+}
+
+// allowUserRequest returns true if the authenticated user has not exceeded the request rate limit.
+func (s *Server) allowUserRequest(username string) bool {
+	return s.userRateLimiter.allow(username, clock.Now())
+}
+
+// isRateLimited returns true and writes an error response if the authenticated caller
+// has exceeded the request rate limit.
+func (s *Server) isRateLimited(rc requestContext) bool {
+	username := ""
+
+	if rc.oidcIdentity != nil {
+		username = rc.oidcIdentity.UsernameAtHost
+	} else if u, _, ok := rc.req.BasicAuth(); ok {
+		username = u
+	}
+
+	if s.allowUserRequest(username) {
+		return false
+	}
+
+	http.Error(rc.w, "Too many requests.\n", http.StatusTooManyRequests)
+
+	return true
+}
+
+// waitForUserRequest blocks until the authenticated user is allowed to make another request.
+func (s *Server) waitForUserRequest(ctx context.Context, username string) error {
+	l := s.userRateLimiter.forUser(username, clock.Now())
+	if l == nil {
+		return nil
+	}
+
+	return errors.Wrap(l.Wait(ctx), "rate limit")
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/passwordpersist"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestLoginLimiter_ExponentialLockout(t *testing.T) {
+	l := newLoginLimiter(&Options{
+		MaxFailedLoginsPerUser:  3,
+		MaxFailedLoginsPerIP:    100,
+		LoginLockoutDuration:    time.Minute,
+		MaxLoginLockoutDuration: 5 * time.Minute,
+	})
+
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := t0
+
+	lockOut := func(wantDuration time.Duration) {
+		t.Helper()
+
+		for range 2 {
+			require.Empty(t, l.recordFailure("foo@bar", "10.0.0.1:1234", now))
+		}
+
+		until := now.Add(wantDuration)
+		require.Equal(t, []loginLockout{{"user foo@bar", until}}, l.recordFailure("foo@bar", "10.0.0.1:1234", now))
+
+		_, locked := l.lockedUntil("foo@bar", "10.0.0.2:1234", now)
+		require.True(t, locked)
+
+		// other users are not affected.
+		_, locked = l.lockedUntil("other@bar", "10.0.0.2:1234", now)
+		require.False(t, locked)
+
+		now = until
+
+		_, locked = l.lockedUntil("foo@bar", "10.0.0.2:1234", now)
+		require.False(t, locked)
+	}
+
+	lockOut(time.Minute)
+	lockOut(2 * time.Minute)
+	lockOut(4 * time.Minute)
+	lockOut(5 * time.Minute)
+	lockOut(5 * time.Minute)
+
+	// successful login resets the lockout duration.
+	l.recordSuccess("foo@bar")
+	lockOut(time.Minute)
+}
+
+func TestLoginLimiter_PerIP(t *testing.T) {
+	l := newLoginLimiter(&Options{
+		MaxFailedLoginsPerUser: 10,
+		MaxFailedLoginsPerIP:   3,
+		LoginLockoutDuration:   time.Minute,
+	})
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// password spraying across different users from the same address.
+	require.Empty(t, l.recordFailure("a@h", "10.0.0.1:1234", now))
+	require.Empty(t, l.recordFailure("b@h", "10.0.0.1:1234", now))
+	require.Equal(t, []loginLockout{{"client address 10.0.0.1", now.Add(time.Minute)}}, l.recordFailure("c@h", "10.0.0.1:1234", now))
+
+	// successful login to another account does not reset the address.
+	l.recordSuccess("d@h")
+
+	_, locked := l.lockedUntil("d@h", "10.0.0.1:5555", now)
+	require.True(t, locked)
+
+	_, locked = l.lockedUntil("d@h", "10.0.0.2:5555", now)
+	require.False(t, locked)
+}
+
+func TestLoginLimiter_Sweep(t *testing.T) {
+	l := newLoginLimiter(&Options{
+		MaxFailedLoginsPerUser:  10,
+		MaxFailedLoginsPerIP:    10,
+		LoginLockoutDuration:    time.Minute,
+		MaxLoginLockoutDuration: time.Hour,
+	})
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	l.recordFailure("a@h", "10.0.0.1:1234", now)
+	l.recordFailure("b@h", "10.0.0.2:1234", now.Add(2*time.Hour))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	require.Len(t, l.entries, 2)
+}
+
+func TestServerClientAddress(t *testing.T) {
+	s := &Server{options: Options{
+		TrustedProxies: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/24"),
+			netip.MustParsePrefix("::1/128"),
+		},
+	}}
+
+	cases := []struct {
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		// not a trusted proxy, the header is ignored.
+		{"192.168.0.1:1234", []string{"1.2.3.4"}, "192.168.0.1:1234"},
+		{"10.0.0.1:1234", nil, "10.0.0.1:1234"},
+		{"10.0.0.1:1234", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"[::1]:1234", []string{"1.2.3.4"}, "1.2.3.4"},
+		// addresses added by the client itself are ignored.
+		{"10.0.0.1:1234", []string{"5.6.7.8, 1.2.3.4"}, "1.2.3.4"},
+		// chain of trusted proxies.
+		{"10.0.0.1:1234", []string{"5.6.7.8, 1.2.3.4", "10.0.0.2"}, "1.2.3.4"},
+		{"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.want, s.clientAddress(tc.remoteAddr, tc.forwardedFor), "%v %v", tc.remoteAddr, tc.forwardedFor)
+	}
+}
+
+func TestUserRateLimiter(t *testing.T) {
+	require.Nil(t, newUserRateLimiter(&Options{}))
+	require.True(t, newUserRateLimiter(&Options{}).allow("foo@bar", time.Now()))
+
+	r := newUserRateLimiter(&Options{
+		UserRequestsPerSecond: 1,
+		UserRequestBurst:      2,
+	})
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.True(t, r.allow("foo@bar", now))
+	require.True(t, r.allow("foo@bar", now))
+	require.False(t, r.allow("foo@bar", now))
+
+	// each user has independent limit.
+	require.True(t, r.allow("other@bar", now))
+
+	require.True(t, r.allow("foo@bar", now.Add(time.Second)))
+}
+
+func TestServerLoginLockout(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	s, err := New(ctx, &Options{
+		Authorizer:             auth.LegacyAuthorizer(),
+		Authenticator:          auth.AuthenticateSingleUser("foo@bar", "correct-password"),
+		PasswordPersist:        passwordpersist.File(),
+		MaxFailedLoginsPerUser: 3,
+		LoginLockoutDuration:   time.Hour,
+		UserRequestsPerSecond:  0.001,
+		UserRequestBurst:       4,
+	})
+	require.NoError(t, err)
+
+	h := s.requireAuth(csrfTokenNotRequired, func(_ context.Context, rc requestContext) {
+		rc.w.WriteHeader(http.StatusOK)
+	})
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/repo/status", http.NoBody)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.SetBasicAuth(username, password)
+
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, login("foo@bar", "correct-password").Code)
+
+	for range 3 {
+		require.Equal(t, http.StatusUnauthorized, login("foo@bar", "wrong-password").Code)
+	}
+
+	// locked out, even with the correct password.
+	w := login("foo@bar", "correct-password")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// simulate lockout expiration.
+	s.loginLimiter.recordSuccess("foo@bar")
+
+	require.Equal(t, http.StatusOK, login("foo@bar", "correct-password").Code)
+	require.Equal(t, http.StatusOK, login("foo@bar", "correct-password").Code)
+	require.Equal(t, http.StatusOK, login("foo@bar", "correct-password").Code)
+
+	// request burst exceeded.
+	require.Equal(t, http.StatusTooManyRequests, login("foo@bar", "correct-password").Code)
+}
+
+func TestServerLoginLockoutBehindProxy(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	s, err := New(ctx, &Options{
+		Authorizer:           auth.LegacyAuthorizer(),
+		Authenticator:        auth.AuthenticateSingleUser("foo@bar", "correct-password"),
+		PasswordPersist:      passwordpersist.File(),
+		MaxFailedLoginsPerIP: 2,
+		LoginLockoutDuration: time.Hour,
+		TrustedProxies:       []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")},
+	})
+	require.NoError(t, err)
+
+	h := s.requireAuth(csrfTokenNotRequired, func(_ context.Context, rc requestContext) {
+		rc.w.WriteHeader(http.StatusOK)
+	})
+
+	login := func(clientAddr, password string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/repo/status", http.NoBody)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", clientAddr)
+		r.SetBasicAuth("foo@bar", password)
+
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, login("1.2.3.4", "wrong-password"))
+	require.Equal(t, http.StatusUnauthorized, login("1.2.3.4", "wrong-password"))
+	require.Equal(t, http.StatusTooManyRequests, login("1.2.3.4", "correct-password"))
+
+	// other clients behind the same proxy are not affected.
+	require.Equal(t, http.StatusOK, login("5.6.7.8", "correct-password"))
+}
@@ -0,0 +1,476 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/repo/replication"
+	"github.com/kopia/kopia/snapshot"
+)
+
+const (
+	// repository-wide metrics require listing all blobs, so we compute them at most this often.
+	repositoryMetricsCacheDuration = 5 * time.Minute
+	repositoryMetricsTimeout       = 5 * time.Minute
+)
+
+//nolint:gochecknoglobals
+var (
+	sourceLabels = []string{"host", "user", "path"}
+
+	metricSourceStatus = prometheus.NewDesc(
+		"kopia_source_status",
+		"Current status of the snapshot source (always 1, status is provided as a label).",
+		append(append([]string(nil), sourceLabels...), "status"), nil)
+	metricSourceLastSnapshotStart = prometheus.NewDesc(
+		"kopia_source_last_snapshot_start_timestamp_seconds",
+		"Start time of the most recent snapshot of the source.",
+		sourceLabels, nil)
+	metricSourceLastSnapshotEnd = prometheus.NewDesc(
+		"kopia_source_last_snapshot_end_timestamp_seconds",
+		"End time of the most recent snapshot of the source.",
+		sourceLabels, nil)
+	metricSourceLastSnapshotDuration = prometheus.NewDesc(
+		"kopia_source_last_snapshot_duration_seconds",
+		"Duration of the most recent snapshot of the source.",
+		sourceLabels, nil)
+	metricSourceLastSnapshotSize = prometheus.NewDesc(
+		"kopia_source_last_snapshot_size_bytes",
+		"Total size of files in the most recent snapshot of the source.",
+		sourceLabels, nil)
+	metricSourceLastSnapshotFiles = prometheus.NewDesc(
+		"kopia_source_last_snapshot_files",
+		"Number of files in the most recent snapshot of the source.",
+		sourceLabels, nil)
+	metricSourceLastSnapshotDirs = prometheus.NewDesc(
+		"kopia_source_last_snapshot_dirs",
+		"Number of directories in the most recent snapshot of the source.",
+		sourceLabels, nil)
+	metricSourceLastSnapshotErrors = prometheus.NewDesc(
+		"kopia_source_last_snapshot_errors",
+		"Number of errors encountered in the most recent snapshot of the source.",
+		append(append([]string(nil), sourceLabels...), "kind"), nil)
+	metricSourceLastSnapshotIncomplete = prometheus.NewDesc(
+		"kopia_source_last_snapshot_incomplete",
+		"1 if the most recent snapshot of the source is incomplete, 0 otherwise.",
+		sourceLabels, nil)
+	metricSourceLastCompleteSnapshotEnd = prometheus.NewDesc(
+		"kopia_source_last_complete_snapshot_end_timestamp_seconds",
+		"End time of the most recent complete snapshot of the source.",
+		sourceLabels, nil)
+	metricSourceNextSnapshot = prometheus.NewDesc(
+		"kopia_source_next_snapshot_timestamp_seconds",
+		"Time of the next scheduled snapshot of the source.",
+		sourceLabels, nil)
+	metricSourceLastAttemptFailed = prometheus.NewDesc(
+		"kopia_source_last_snapshot_attempt_failed",
+		"1 if the most recent snapshot attempt made by the server has failed, 0 otherwise.",
+		sourceLabels, nil)
+	metricSourceSnapshotFailures = prometheus.NewDesc(
+		"kopia_source_snapshot_failures_total",
+		"Number of failed snapshot attempts made by the server since it started.",
+		sourceLabels, nil)
+
+	metricRepositoryBlobCount = prometheus.NewDesc(
+		"kopia_repository_blobs",
+		"Number of blobs in the repository by blob ID prefix.",
+		[]string{"prefix"}, nil)
+	metricRepositoryBlobBytes = prometheus.NewDesc(
+		"kopia_repository_blob_bytes",
+		"Total size of blobs in the repository by blob ID prefix.",
+		[]string{"prefix"}, nil)
+	metricRepositoryMetricsTimestamp = prometheus.NewDesc(
+		"kopia_repository_metrics_timestamp_seconds",
+		"Time when repository-wide metrics were last computed.",
+		nil, nil)
+
+	metricMaintenanceLastRunStart = prometheus.NewDesc(
+		"kopia_maintenance_last_run_start_timestamp_seconds",
+		"Start time of the most recent run of the maintenance task.",
+		[]string{"task"}, nil)
+	metricMaintenanceLastRunEnd = prometheus.NewDesc(
+		"kopia_maintenance_last_run_end_timestamp_seconds",
+		"End time of the most recent run of the maintenance task.",
+		[]string{"task"}, nil)
+	metricMaintenanceLastRunSuccess = prometheus.NewDesc(
+		"kopia_maintenance_last_run_success",
+		"1 if the most recent run of the maintenance task succeeded, 0 otherwise.",
+		[]string{"task"}, nil)
+	metricReplicationPendingBlobs = prometheus.NewDesc(
+		"kopia_replication_pending_blobs",
+		"Number of blob changes not yet copied to the replica.",
+		nil, nil)
+	metricReplicationPendingBytes = prometheus.NewDesc(
+		"kopia_replication_pending_bytes",
+		"Total size of blobs not yet copied to the replica.",
+		nil, nil)
+	metricReplicationLag = prometheus.NewDesc(
+		"kopia_replication_lag_seconds",
+		"Age of the oldest blob change not yet copied to the replica.",
+		nil, nil)
+	metricReplicationLastSync = prometheus.NewDesc(
+		"kopia_replication_last_sync_timestamp_seconds",
+		"Time of the most recent replication attempt.",
+		nil, nil)
+	metricReplicationLastSyncSuccess = prometheus.NewDesc(
+		"kopia_replication_last_sync_success",
+		"1 if the most recent replication attempt succeeded, 0 otherwise.",
+		nil, nil)
+	metricReplicationCopiedBlobs = prometheus.NewDesc(
+		"kopia_replication_copied_blobs_total",
+		"Number of blobs copied to the replica since the server started.",
+		nil, nil)
+	metricReplicationCopiedBytes = prometheus.NewDesc(
+		"kopia_replication_copied_bytes_total",
+		"Number of bytes copied to the replica since the server started.",
+		nil, nil)
+	metricReplicationDeletedBlobs = prometheus.NewDesc(
+		"kopia_replication_deleted_blobs_total",
+		"Number of blobs deleted from the replica since the server started.",
+		nil, nil)
+	metricReplicationVerificationFailures = prometheus.NewDesc(
+		"kopia_replication_verification_failures_total",
+		"Number of replicated blobs which failed verification since the server started.",
+		nil, nil)
+
+	metricMaintenanceNextRun = prometheus.NewDesc(
+		"kopia_maintenance_next_run_timestamp_seconds",
+		"Time of the next scheduled maintenance by maintenance mode.",
+		[]string{"mode"}, nil)
+)
+
+// repositoryMetrics holds cached repository-wide metrics.
+type repositoryMetrics struct {
+	computedAt  time.Time
+	blobCounts  map[string]int64
+	blobBytes   map[string]int64
+	maintenance *maintenance.Schedule
+}
+
+type serverMetricsCollector struct {
+	s *Server
+
+	mu sync.Mutex
+	// +checklocks:mu
+	cached *repositoryMetrics
+	// +checklocks:mu
+	cachedRepo repo.Repository
+	// +checklocks:mu
+	lastRefreshStart time.Time
+	// +checklocks:mu
+	refreshing bool
+}
+
+// MetricsCollector returns a Prometheus collector which exposes the state of all
+// sources managed by the server, the repository and its maintenance.
+func (s *Server) MetricsCollector() prometheus.Collector {
+	return &serverMetricsCollector{s: s}
+}
+
+// MetricsHandler returns a handler which exposes metrics from the provided gatherer to all clients.
+// Metrics describing sources, repository and maintenance reveal who backs up what, so they are only
+// exposed to clients authenticated as the UI or server control user.
+func (s *Server) MetricsHandler(public prometheus.Gatherer) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(s.MetricsCollector())
+
+	publicHandler := promhttp.HandlerFor(public, promhttp.HandlerOpts{})
+	fullHandler := promhttp.HandlerFor(prometheus.Gatherers{public, reg}, promhttp.HandlerOpts{})
+
+	authenticated := s.requireAuth(csrfTokenNotRequired, func(ctx context.Context, rc requestContext) {
+		if !requireServerControlUser(ctx, rc) && !requireUIUser(ctx, rc) {
+			http.Error(rc.w, "Access denied.\n", http.StatusForbidden)
+			return
+		}
+
+		fullHandler.ServeHTTP(rc.w, rc.req)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.getAuthenticator() != nil && r.Header.Get("Authorization") == "" {
+			publicHandler.ServeHTTP(w, r)
+			return
+		}
+
+		authenticated(w, r)
+	})
+}
+
+func (c *serverMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		metricSourceStatus,
+		metricSourceLastSnapshotStart,
+		metricSourceLastSnapshotEnd,
+		metricSourceLastSnapshotDuration,
+		metricSourceLastSnapshotSize,
+		metricSourceLastSnapshotFiles,
+		metricSourceLastSnapshotDirs,
+		metricSourceLastSnapshotErrors,
+		metricSourceLastSnapshotIncomplete,
+		metricSourceLastCompleteSnapshotEnd,
+		metricSourceNextSnapshot,
+		metricSourceLastAttemptFailed,
+		metricSourceSnapshotFailures,
+		metricRepositoryBlobCount,
+		metricRepositoryBlobBytes,
+		metricRepositoryMetricsTimestamp,
+		metricMaintenanceLastRunStart,
+		metricMaintenanceLastRunEnd,
+		metricMaintenanceLastRunSuccess,
+		metricMaintenanceNextRun,
+		metricReplicationPendingBlobs,
+		metricReplicationPendingBytes,
+		metricReplicationLag,
+		metricReplicationLastSync,
+		metricReplicationLastSyncSuccess,
+		metricReplicationCopiedBlobs,
+		metricReplicationCopiedBytes,
+		metricReplicationDeletedBlobs,
+		metricReplicationVerificationFailures,
+	} {
+		ch <- d
+	}
+}
+
+func (c *serverMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for src, sm := range c.s.snapshotAllSourceManagers() {
+		collectSourceMetrics(ch, src, sm.metricsState())
+	}
+
+	if st, ok := c.s.replicationStatus(); ok {
+		collectReplicationMetrics(ch, st)
+	}
+
+	c.s.serverMutex.RLock()
+	rep := c.s.rep
+	c.s.serverMutex.RUnlock()
+
+	dr, ok := rep.(repo.DirectRepository)
+	if !ok {
+		return
+	}
+
+	if rm := c.getRepositoryMetrics(dr); rm != nil {
+		collectRepositoryMetrics(ch, rm)
+	}
+}
+
+// getRepositoryMetrics returns the most recently computed repository metrics, which may be nil,
+// and starts computing them in the background when they are missing or stale.
+func (c *serverMetricsCollector) getRepositoryMetrics(dr repo.DirectRepository) *repositoryMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cachedRepo != dr {
+		c.cached = nil
+		c.cachedRepo = dr
+		c.lastRefreshStart = time.Time{}
+	}
+
+	if !c.refreshing && clock.Now().Sub(c.lastRefreshStart) >= repositoryMetricsCacheDuration {
+		c.refreshing = true
+		c.lastRefreshStart = clock.Now()
+
+		go c.refreshRepositoryMetrics(dr)
+	}
+
+	return c.cached
+}
+
+func (c *serverMetricsCollector) refreshRepositoryMetrics(dr repo.DirectRepository) {
+	ctx, cancel := context.WithTimeout(c.s.rootContext(), repositoryMetricsTimeout)
+	defer cancel()
+
+	rm, err := computeRepositoryMetrics(ctx, dr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refreshing = false
+
+	if err != nil {
+		// keep serving previous values, the next attempt is made after the cache duration.
+		log(ctx).Debugw("unable to compute repository metrics", "err", err)
+		return
+	}
+
+	if c.cachedRepo == dr {
+		c.cached = rm
+	}
+}
+
+func computeRepositoryMetrics(ctx context.Context, dr repo.DirectRepository) (*repositoryMetrics, error) {
+	rm := &repositoryMetrics{
+		computedAt: clock.Now(),
+		blobCounts: map[string]int64{},
+		blobBytes:  map[string]int64{},
+	}
+
+	if err := dr.BlobReader().ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		p := blobIDPrefix(bm.BlobID)
+
+		rm.blobCounts[p]++
+		rm.blobBytes[p] += bm.Length
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing blobs")
+	}
+
+	sched, err := maintenance.GetSchedule(ctx, dr)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get maintenance schedule")
+	}
+
+	rm.maintenance = sched
+
+	return rm, nil
+}
+
+// blobIDPrefix returns the prefix used to group blobs in metrics, which is the first character
+// of the blob ID for regular blobs, or the part up to and including the second underscore
+// for special blobs such as "_log_".
+func blobIDPrefix(id blob.ID) string {
+	s := string(id)
+
+	if strings.HasPrefix(s, "_") {
+		if p := strings.Index(s[1:], "_"); p >= 0 {
+			return s[0 : p+2]
+		}
+
+		return s
+	}
+
+	if strings.HasPrefix(s, "kopia.") {
+		return "kopia."
+	}
+
+	if s == "" {
+		return s
+	}
+
+	return s[0:1]
+}
+
+func collectSourceMetrics(ch chan<- prometheus.Metric, src snapshot.SourceInfo, st sourceMetricsState) {
+	labels := []string{src.Host, src.UserName, src.Path}
+
+	gauge := func(d *prometheus.Desc, v float64, extraLabels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, append(append([]string(nil), labels...), extraLabels...)...)
+	}
+
+	gauge(metricSourceStatus, 1, st.status)
+	gauge(metricSourceLastAttemptFailed, boolToFloat(st.lastSnapshotFailed))
+
+	ch <- prometheus.MustNewConstMetric(metricSourceSnapshotFailures, prometheus.CounterValue, float64(st.snapshotFailureCount), labels...)
+
+	if st.nextSnapshotTime != nil {
+		gauge(metricSourceNextSnapshot, toUnixSeconds(*st.nextSnapshotTime))
+	}
+
+	if m := st.lastCompleteSnapshot; m != nil {
+		gauge(metricSourceLastCompleteSnapshotEnd, toUnixSeconds(m.EndTime.ToTime()))
+	}
+
+	m := st.lastSnapshot
+	if m == nil {
+		return
+	}
+
+	gauge(metricSourceLastSnapshotStart, toUnixSeconds(m.StartTime.ToTime()))
+	gauge(metricSourceLastSnapshotEnd, toUnixSeconds(m.EndTime.ToTime()))
+	gauge(metricSourceLastSnapshotDuration, m.EndTime.Sub(m.StartTime).Seconds())
+	gauge(metricSourceLastSnapshotIncomplete, boolToFloat(m.IncompleteReason != ""))
+
+	if m.RootEntry != nil && m.RootEntry.DirSummary != nil {
+		ds := m.RootEntry.DirSummary
+
+		gauge(metricSourceLastSnapshotSize, float64(ds.TotalFileSize))
+		gauge(metricSourceLastSnapshotFiles, float64(ds.TotalFileCount))
+		gauge(metricSourceLastSnapshotDirs, float64(ds.TotalDirCount))
+		gauge(metricSourceLastSnapshotErrors, float64(ds.FatalErrorCount), "fatal")
+		gauge(metricSourceLastSnapshotErrors, float64(ds.IgnoredErrorCount), "ignored")
+	}
+}
+
+func collectRepositoryMetrics(ch chan<- prometheus.Metric, rm *repositoryMetrics) {
+	ch <- prometheus.MustNewConstMetric(metricRepositoryMetricsTimestamp, prometheus.GaugeValue, toUnixSeconds(rm.computedAt))
+
+	for p, cnt := range rm.blobCounts {
+		ch <- prometheus.MustNewConstMetric(metricRepositoryBlobCount, prometheus.GaugeValue, float64(cnt), p)
+		ch <- prometheus.MustNewConstMetric(metricRepositoryBlobBytes, prometheus.GaugeValue, float64(rm.blobBytes[p]), p)
+	}
+
+	sched := rm.maintenance
+	if sched == nil {
+		return
+	}
+
+	if !sched.NextFullMaintenanceTime.IsZero() {
+		ch <- prometheus.MustNewConstMetric(metricMaintenanceNextRun, prometheus.GaugeValue, toUnixSeconds(sched.NextFullMaintenanceTime), string(maintenance.ModeFull))
+	}
+
+	if !sched.NextQuickMaintenanceTime.IsZero() {
+		ch <- prometheus.MustNewConstMetric(metricMaintenanceNextRun, prometheus.GaugeValue, toUnixSeconds(sched.NextQuickMaintenanceTime), string(maintenance.ModeQuick))
+	}
+
+	for task, runs := range sched.Runs {
+		if len(runs) == 0 {
+			continue
+		}
+
+		// runs are stored most recent first.
+		last := runs[0]
+
+		ch <- prometheus.MustNewConstMetric(metricMaintenanceLastRunStart, prometheus.GaugeValue, toUnixSeconds(last.Start), string(task))
+		ch <- prometheus.MustNewConstMetric(metricMaintenanceLastRunEnd, prometheus.GaugeValue, toUnixSeconds(last.End), string(task))
+		ch <- prometheus.MustNewConstMetric(metricMaintenanceLastRunSuccess, prometheus.GaugeValue, boolToFloat(last.Success), string(task))
+	}
+}
+
+func collectReplicationMetrics(ch chan<- prometheus.Metric, st replication.Status) {
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+
+	counter := func(d *prometheus.Desc, v int64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v))
+	}
+
+	gauge(metricReplicationPendingBlobs, float64(st.PendingBlobs))
+	gauge(metricReplicationPendingBytes, float64(st.PendingBytes))
+	gauge(metricReplicationLag, st.Lag(clock.Now()).Seconds())
+
+	if !st.LastSyncTime.IsZero() {
+		gauge(metricReplicationLastSync, toUnixSeconds(st.LastSyncTime))
+		gauge(metricReplicationLastSyncSuccess, boolToFloat(st.LastSyncError == ""))
+	}
+
+	counter(metricReplicationCopiedBlobs, st.CopiedBlobs)
+	counter(metricReplicationCopiedBytes, st.CopiedBytes)
+	counter(metricReplicationDeletedBlobs, st.DeletedBlobs)
+	counter(metricReplicationVerificationFailures, st.VerificationFailures)
+}
+
+func toUnixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
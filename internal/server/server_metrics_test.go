@@ -0,0 +1,183 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/passwordpersist"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestServerMetricsCollector(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	src := snapshot.SourceInfo{Host: "host1", UserName: "user1", Path: "/some/path"}
+	startTime := clock.Now().Add(-time.Minute)
+
+	srv := &Server{
+		rootctx:        ctx,
+		rep:            env.RepositoryWriter,
+		sourceManagers: map[snapshot.SourceInfo]*sourceManager{},
+	}
+
+	sm := newSourceManager(src, srv, env.RepositoryWriter)
+	sm.state = "IDLE"
+	sm.lastSnapshot = &snapshot.Manifest{
+		Source:    src,
+		StartTime: fs.UTCTimestampFromTime(startTime),
+		EndTime:   fs.UTCTimestampFromTime(startTime.Add(30 * time.Second)),
+		RootEntry: &snapshot.DirEntry{
+			DirSummary: &fs.DirectorySummary{
+				TotalFileSize:   12345,
+				TotalFileCount:  10,
+				TotalDirCount:   3,
+				FatalErrorCount: 2,
+			},
+		},
+	}
+	sm.setLastSnapshotFailed(true)
+
+	srv.sourceManagers[src] = sm
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(srv.MetricsCollector())
+
+	gather := func() map[string]*dto.MetricFamily {
+		t.Helper()
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+
+		result := map[string]*dto.MetricFamily{}
+		for _, f := range families {
+			result[f.GetName()] = f
+		}
+
+		return result
+	}
+
+	byName := gather()
+
+	// repository-wide metrics are computed in the background and are not available on the first scrape.
+	require.Nil(t, byName["kopia_repository_blobs"])
+
+	gaugeValue := func(name string) float64 {
+		t.Helper()
+
+		f := byName[name]
+		require.NotNil(t, f, name)
+
+		return f.GetMetric()[0].GetGauge().GetValue()
+	}
+
+	require.InDelta(t, 30, gaugeValue("kopia_source_last_snapshot_duration_seconds"), 0.001)
+	require.InDelta(t, 12345, gaugeValue("kopia_source_last_snapshot_size_bytes"), 0)
+	require.InDelta(t, 10, gaugeValue("kopia_source_last_snapshot_files"), 0)
+	require.InDelta(t, 1, gaugeValue("kopia_source_last_snapshot_attempt_failed"), 0)
+	require.InDelta(t, float64(startTime.Unix()), gaugeValue("kopia_source_last_snapshot_start_timestamp_seconds"), 1)
+	require.InDelta(t, 1, byName["kopia_source_snapshot_failures_total"].GetMetric()[0].GetCounter().GetValue(), 0)
+
+	statusLabels := map[string]string{}
+	for _, l := range byName["kopia_source_status"].GetMetric()[0].GetLabel() {
+		statusLabels[l.GetName()] = l.GetValue()
+	}
+
+	require.Equal(t, map[string]string{
+		"host":   "host1",
+		"user":   "user1",
+		"path":   "/some/path",
+		"status": "IDLE",
+	}, statusLabels)
+
+	require.Len(t, byName["kopia_source_last_snapshot_errors"].GetMetric(), 2)
+
+	// repository-wide metrics are present for direct repositories.
+	require.Eventually(t, func() bool {
+		byName = gather()
+		return byName["kopia_repository_blobs"] != nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	require.NotNil(t, byName["kopia_repository_blob_bytes"])
+	require.NotNil(t, byName["kopia_repository_metrics_timestamp_seconds"])
+}
+
+func TestServerMetricsHandler(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	s, err := New(ctx, &Options{
+		Authorizer:        auth.LegacyAuthorizer(),
+		Authenticator:     auth.CombineAuthenticators(auth.AuthenticateSingleUser("ui-user", "ui-password"), auth.AuthenticateSingleUser("control-user", "control-password"), auth.AuthenticateSingleUser("other@host", "other-password")),
+		PasswordPersist:   passwordpersist.File(),
+		UIUser:            "ui-user",
+		ServerControlUser: "control-user",
+	})
+	require.NoError(t, err)
+
+	src := snapshot.SourceInfo{Host: "host1", UserName: "user1", Path: "/some/path"}
+
+	s.serverMutex.Lock()
+	s.sourceManagers[src] = newSourceManager(src, s, nil)
+	s.serverMutex.Unlock()
+
+	public := prometheus.NewRegistry()
+	public.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "test_process_metric"}))
+
+	h := s.MetricsHandler(public)
+
+	scrape := func(username, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+		if username != "" {
+			r.SetBasicAuth(username, password)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	// process-wide metrics are available without authentication, source metrics are not.
+	w := scrape("", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "test_process_metric")
+	require.NotContains(t, w.Body.String(), "kopia_source_status")
+
+	for u, p := range map[string]string{"ui-user": "ui-password", "control-user": "control-password"} {
+		w = scrape(u, p)
+		require.Equal(t, http.StatusOK, w.Code, u)
+		require.Contains(t, w.Body.String(), "test_process_metric")
+		require.Contains(t, w.Body.String(), `kopia_source_status{host="host1",path="/some/path"`)
+	}
+
+	require.Equal(t, http.StatusUnauthorized, scrape("ui-user", "wrong-password").Code)
+	require.Equal(t, http.StatusForbidden, scrape("other@host", "other-password").Code)
+}
+
+func TestBlobIDPrefix(t *testing.T) {
+	cases := map[blob.ID]string{
+		"":                    "",
+		"p1234":               "p",
+		"xn0_1234":            "x",
+		"_log_20200101_1234":  "_log_",
+		"_nounderscore":       "_nounderscore",
+		"kopia.repository":    "kopia.",
+		"kopia.blobcfg":       "kopia.",
+		"q0123456789abcdef01": "q",
+	}
+
+	for id, want := range cases {
+		require.Equal(t, want, blobIDPrefix(id), id)
+	}
+}
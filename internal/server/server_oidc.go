@@ -0,0 +1,240 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/clock"
+)
+
+const (
+	kopiaOIDCSessionCookie   = "Kopia-OIDC-Session"
+	kopiaOIDCStateCookie     = "Kopia-OIDC-State"
+	kopiaOIDCSessionTTL      = 8 * time.Hour
+	kopiaOIDCStateTTL        = 10 * time.Minute
+	kopiaOIDCSessionAudience = "kopia-oidc-session"
+	kopiaOIDCStateAudience   = "kopia-oidc-state"
+
+	oidcLoginPath    = "/oidc/login"
+	oidcCallbackPath = "/oidc/callback"
+)
+
+// oidcSessionClaims are stored in a cookie signed by the server after a successful OIDC login.
+type oidcSessionClaims struct {
+	jwt.RegisteredClaims
+
+	Groups []string `json:"groups,omitempty"`
+}
+
+// oidcStateClaims are stored in a cookie for the duration of the authorization code flow.
+type oidcStateClaims struct {
+	jwt.RegisteredClaims
+
+	Nonce    string `json:"nonce"`
+	Redirect string `json:"redirect,omitempty"`
+}
+
+// setupOIDCHandlers registers handlers implementing OIDC authorization code flow.
+func (s *Server) setupOIDCHandlers(m *mux.Router) {
+	m.HandleFunc(oidcLoginPath, s.handleOIDCLogin).Methods(http.MethodGet)
+	m.HandleFunc(oidcCallbackPath, s.handleOIDCCallback).Methods(http.MethodGet)
+}
+
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	now := clock.Now()
+	state := uuid.NewString()
+	nonce := uuid.NewString()
+
+	redirect := localRedirectPath(r.URL.Query().Get("redirect"))
+
+	v, err := s.signClaims(&oidcStateClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        state,
+			Audience:  jwt.ClaimStrings{kopiaOIDCStateAudience},
+			Issuer:    kopiaAuthCookieIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(kopiaOIDCStateTTL)),
+		},
+		Nonce:    nonce,
+		Redirect: redirect,
+	})
+	if err != nil {
+		http.Error(w, "unable to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     kopiaOIDCStateCookie,
+		Value:    v,
+		Path:     "/oidc/",
+		Expires:  now.Add(kopiaOIDCStateTTL),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, s.options.OIDC.AuthCodeURL(state, nonce), http.StatusFound)
+}
+
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	c, err := r.Cookie(kopiaOIDCStateCookie)
+	if err != nil {
+		http.Error(w, "missing login state", http.StatusBadRequest)
+		return
+	}
+
+	var st oidcStateClaims
+
+	if err := s.parseSignedClaims(c.Value, kopiaOIDCStateAudience, &st); err != nil || st.ID != r.URL.Query().Get("state") {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		log(ctx).Warnf("OIDC login failed for client %v: %v", r.RemoteAddr, e)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+
+		return
+	}
+
+	id, err := s.options.OIDC.Exchange(ctx, r.URL.Query().Get("code"), st.Nonce)
+	if err != nil {
+		log(ctx).Warnf("OIDC login failed for client %v: %v", r.RemoteAddr, err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+
+		return
+	}
+
+	now := clock.Now()
+
+	v, err := s.signClaims(&oidcSessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   id.UsernameAtHost,
+			ID:        uuid.NewString(),
+			Audience:  jwt.ClaimStrings{kopiaOIDCSessionAudience},
+			Issuer:    kopiaAuthCookieIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(kopiaOIDCSessionTTL)),
+		},
+		Groups: id.Groups,
+	})
+	if err != nil {
+		http.Error(w, "unable to create session", http.StatusInternalServerError)
+		return
+	}
+
+	if s.options.LogRequests {
+		log(ctx).Infof("successful OIDC login by client %s for user %s", r.RemoteAddr, id.UsernameAtHost)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   kopiaOIDCStateCookie,
+		Path:   "/oidc/",
+		MaxAge: -1,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     kopiaOIDCSessionCookie,
+		Value:    v,
+		Path:     "/",
+		Expires:  now.Add(kopiaOIDCSessionTTL),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, localRedirectPath(st.Redirect), http.StatusFound)
+}
+
+// localRedirectPath returns the provided redirect target if it refers to a path on this server, "/" otherwise.
+func localRedirectPath(redirect string) string {
+	// browsers treat backslashes as slashes, so "/\evil.com" would be interpreted as "//evil.com".
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, "\\") {
+		return "/"
+	}
+
+	u, err := url.Parse(redirect)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return "/"
+	}
+
+	return redirect
+}
+
+// oidcIdentityFromRequest returns the OIDC identity of the caller based on the session cookie
+// or the bearer token, nil if the request was not authenticated using OIDC.
+func (s *Server) oidcIdentityFromRequest(r *http.Request) *auth.OIDCIdentity {
+	if tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		id, err := s.options.OIDC.VerifyIDToken(r.Context(), tok)
+		if err != nil {
+			log(r.Context()).Warnf("invalid bearer token from client %s: %v", r.RemoteAddr, err)
+			return nil
+		}
+
+		return id
+	}
+
+	c, err := r.Cookie(kopiaOIDCSessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	var sc oidcSessionClaims
+
+	if err := s.parseSignedClaims(c.Value, kopiaOIDCSessionAudience, &sc); err != nil || sc.Subject == "" {
+		return nil
+	}
+
+	return &auth.OIDCIdentity{
+		UsernameAtHost: sc.Subject,
+		Groups:         sc.Groups,
+		Expiry:         sc.ExpiresAt.Time,
+	}
+}
+
+// isOIDCBearerRequest returns true if the request was authenticated using OIDC bearer token.
+func isOIDCBearerRequest(rc requestContext) bool {
+	return rc.oidcIdentity != nil && strings.HasPrefix(rc.req.Header.Get("Authorization"), "Bearer ")
+}
+
+// redirectToOIDCLogin redirects browser requests to the login page, returns false for other requests.
+func redirectToOIDCLogin(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+
+	http.Redirect(w, r, oidcLoginPath+"?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+
+	return true
+}
+
+func (s *Server) signClaims(c jwt.Claims) (string, error) {
+	//nolint:wrapcheck
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString(s.authCookieSigningKey)
+}
+
+func (s *Server) parseSignedClaims(v, audience string, c jwt.Claims) error {
+	tok, err := jwt.ParseWithClaims(v, c, func(_ *jwt.Token) (any, error) {
+		return s.authCookieSigningKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return errors.Wrap(err, "invalid token")
+	}
+
+	rc, ok := tok.Claims.(interface{ VerifyAudience(string, bool) bool })
+	if !ok || !rc.VerifyAudience(audience, true) {
+		return errors.New("invalid audience")
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/oidctesting"
+	"github.com/kopia/kopia/internal/passwordpersist"
+	"github.com/kopia/kopia/internal/repotesting"
+)
+
+func TestServerOIDCLogin(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+	op := oidctesting.NewProvider(t)
+
+	m := mux.NewRouter()
+	hs := httptest.NewServer(m)
+	t.Cleanup(hs.Close)
+
+	p, err := auth.NewOIDCProvider(ctx, auth.OIDCOptions{
+		IssuerURL:    op.IssuerURL(),
+		ClientID:     op.ClientID,
+		ClientSecret: op.ClientSecret,
+		RedirectURL:  hs.URL + oidcCallbackPath,
+	})
+	require.NoError(t, err)
+
+	s, err := New(ctx, &Options{
+		ConfigFile:              env.ConfigFile(),
+		PasswordPersist:         passwordpersist.File(),
+		Authorizer:              auth.LegacyAuthorizer(),
+		Authenticator:           auth.CombineAuthenticators(auth.AuthenticateSingleUser("ui-user", "ui-password"), p),
+		RefreshInterval:         time.Minute,
+		UIUser:                  "ui-user",
+		UIPreferencesFile:       filepath.Join(t.TempDir(), "ui-pref.json"),
+		OIDC:                    p,
+		OIDCUIGroups:            []string{"admins"},
+		OIDCServerControlGroups: []string{"admins"},
+		AuthCookieSigningKey:    "some-signing-key",
+	})
+	require.NoError(t, err)
+
+	s.SetRepository(ctx, env.Repository)
+	t.Cleanup(func() { s.SetRepository(ctx, nil) })
+
+	s.SetupHTMLUIAPIHandlers(m)
+	s.SetupControlAPIHandlers(m)
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	cli := &http.Client{Jar: jar}
+
+	get := func(t *testing.T, c *http.Client, path string, header http.Header) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, hs.URL+path, http.NoBody)
+		require.NoError(t, err)
+
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	// API requests without credentials are rejected without redirect.
+	require.Equal(t, http.StatusUnauthorized, get(t, cli, "/api/v1/control/status", nil).StatusCode)
+
+	// browser requests are redirected through the login flow and end up authenticated.
+	op.SetLoginClaims(map[string]any{"sub": "u1", "email": "alice@laptop", "email_verified": true, "groups": []string{"admins"}})
+
+	resp := get(t, cli, "/api/v1/control/status", http.Header{"Accept": {"text/html"}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "/api/v1/control/status", resp.Request.URL.Path)
+
+	// session cookie is now sufficient for API requests.
+	require.Equal(t, http.StatusOK, get(t, cli, "/api/v1/control/status", nil).StatusCode)
+
+	// members of other groups are authenticated, but not authorized.
+	jar2, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	op.SetLoginClaims(map[string]any{"sub": "u2", "email": "bob@laptop", "email_verified": true, "groups": []string{"users"}})
+	require.Equal(t, http.StatusForbidden, get(t, &http.Client{Jar: jar2}, "/api/v1/control/status", http.Header{"Accept": {"text/html"}}).StatusCode)
+
+	// bearer ID tokens are accepted by API clients and don't require CSRF tokens.
+	tok := op.IssueIDToken(map[string]any{"sub": "u3", "email": "ci@builder", "email_verified": true, "groups": []string{"admins"}})
+	require.Equal(t, http.StatusOK, get(t, http.DefaultClient, "/api/v1/sources", http.Header{"Authorization": {"Bearer " + tok}}).StatusCode)
+	require.Equal(t, http.StatusUnauthorized, get(t, http.DefaultClient, "/api/v1/sources", http.Header{"Authorization": {"Bearer " + tok + "x"}}).StatusCode)
+
+	// session cookies are not bearer tokens, UI API still requires CSRF token.
+	require.Equal(t, http.StatusUnauthorized, get(t, cli, "/api/v1/sources", nil).StatusCode)
+}
+
+func TestLocalRedirectPath(t *testing.T) {
+	cases := map[string]string{
+		"":                          "/",
+		"/":                         "/",
+		"/snapshots?x=1":            "/snapshots?x=1",
+		"snapshots":                 "/",
+		"//evil.com":                "/",
+		"/\\evil.com":               "/",
+		"/\\/evil.com":              "/",
+		"https://evil.com/":         "/",
+		"/\t/evil.com":              "/",
+		"/path\\with\\backslashes":  "/",
+		"/api/v1/sources?path=%2Fx": "/api/v1/sources?path=%2Fx",
+	}
+
+	for input, want := range cases {
+		require.Equal(t, want, localRedirectPath(input), input)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/replication"
+)
+
+const (
+	// defaultReplicaSyncInterval is how often changes are replicated when not triggered explicitly.
+	defaultReplicaSyncInterval = time.Minute
+
+	// defaultReplicaReconcileInterval is how often full lists of blobs are compared to pick up
+	// changes which were not made through the server.
+	defaultReplicaReconcileInterval = time.Hour
+
+	// replicaFinalSyncTimeout is the maximum time spent replicating remaining changes when stopping.
+	replicaFinalSyncTimeout = 30 * time.Second
+)
+
+type srvReplication struct {
+	triggerChan chan struct{}
+	closed      chan struct{}
+	cancelCtx   context.CancelFunc
+	wg          sync.WaitGroup
+	r           *replication.Replicator
+	dr          repo.DirectRepository
+}
+
+// trigger requests replication of pending changes as soon as possible.
+func (s *srvReplication) trigger() {
+	select {
+	case s.triggerChan <- struct{}{}:
+	default:
+	}
+}
+
+func (s *srvReplication) stop(ctx context.Context) {
+	// stop the goroutine and wait for it to replicate remaining changes, which may take forever
+	// while the replica is unreachable. Changes not replicated by then remain pending and are
+	// replicated later.
+	ctx, cancel := context.WithTimeout(ctx, replicaFinalSyncTimeout)
+	defer cancel()
+
+	stopCancel := context.AfterFunc(ctx, s.cancelCtx)
+	defer stopCancel()
+
+	close(s.closed)
+	s.wg.Wait()
+
+	s.cancelCtx()
+
+	log(ctx).Debug("replication manager stopped")
+}
+
+// maybeStartReplicationManager starts a background task which keeps the replica in sync
+// with the repository. Returns nil if replication is not configured.
+func maybeStartReplicationManager(ctx context.Context, rep repo.Repository, r *replication.Replicator, interval, reconcileInterval time.Duration) *srvReplication {
+	if r == nil {
+		return nil
+	}
+
+	dr, ok := rep.(repo.DirectRepository)
+	if !ok {
+		return nil
+	}
+
+	if interval <= 0 {
+		interval = defaultReplicaSyncInterval
+	}
+
+	if reconcileInterval <= 0 {
+		reconcileInterval = defaultReplicaReconcileInterval
+	}
+
+	if blobCfg, err := dr.FormatManager().BlobCfgBlob(ctx); err == nil {
+		r.SetRetention(blobCfg)
+	} else {
+		log(ctx).Errorf("unable to determine blob retention, replicated blobs will not be locked: %v", err)
+	}
+
+	rctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	m := &srvReplication{
+		triggerChan: make(chan struct{}, 1),
+		closed:      make(chan struct{}),
+		cancelCtx:   cancel,
+		r:           r,
+		dr:          dr,
+	}
+
+	log(ctx).Infof("replicating repository to %v", r.Replica().DisplayName())
+
+	m.wg.Add(1)
+
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// changes made while the server was not running or by other clients writing directly
+		// to the storage are only discovered by comparing full blob lists.
+		var lastReconciled time.Time
+
+		for {
+			if clock.Now().Sub(lastReconciled) >= reconcileInterval {
+				if err := r.Reconcile(rctx, dr.BlobReader()); err != nil {
+					log(rctx).Errorf("unable to reconcile replica: %v", err)
+				} else {
+					lastReconciled = clock.Now()
+				}
+			} else if err := r.Sync(rctx, dr.BlobReader()); err != nil {
+				log(rctx).Errorf("unable to replicate changes: %v", err)
+			}
+
+			select {
+			case <-m.triggerChan:
+			case <-ticker.C:
+			case <-m.closed:
+				if !lastReconciled.IsZero() {
+					if err := r.Sync(rctx, dr.BlobReader()); err != nil {
+						log(rctx).Errorf("unable to replicate changes: %v", err)
+					}
+				}
+
+				return
+			}
+		}
+	}()
+
+	return m
+}
+
+// triggerReplication requests replication of pending changes, if replication is enabled.
+func (s *Server) triggerReplication() {
+	s.replMutex.Lock()
+	defer s.replMutex.Unlock()
+
+	if s.repl != nil {
+		s.repl.trigger()
+	}
+}
+
+// setReplicationManager replaces the replication manager and stops the previous one.
+func (s *Server) setReplicationManager(ctx context.Context, m *srvReplication) {
+	s.replMutex.Lock()
+	old := s.repl
+	s.repl = m
+	s.replMutex.Unlock()
+
+	if old != nil {
+		old.stop(ctx)
+	}
+}
+
+// replicationStatus returns the status of replication, if enabled.
+func (s *Server) replicationStatus() (replication.Status, bool) {
+	if s.options.Replicator == nil {
+		return replication.Status{}, false
+	}
+
+	return s.options.Replicator.Status(), true
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/replication"
+)
+
+func TestServerReplication(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	require.Nil(t, maybeStartReplicationManager(ctx, env.RepositoryWriter, nil, time.Minute, time.Hour))
+
+	r := replication.New(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), replication.Options{})
+
+	rm := maybeStartReplicationManager(ctx, env.RepositoryWriter, r, time.Hour, time.Hour)
+	require.NotNil(t, rm)
+
+	// initial reconciliation copies all existing blobs.
+	require.Eventually(t, func() bool {
+		return !r.Status().LastReconcileTime.IsZero()
+	}, 10*time.Second, 10*time.Millisecond)
+
+	rm.trigger()
+	rm.stop(ctx)
+
+	dr, ok := env.RepositoryWriter.(repo.DirectRepository)
+	require.True(t, ok)
+
+	vr, err := r.Verify(ctx, dr.BlobReader(), true)
+	require.NoError(t, err)
+	require.True(t, vr.InSync(), "%+v", vr)
+	require.Empty(t, r.Status().LastSyncError)
+}
+
+func TestServerReplicationPeriodicReconcile(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	replicaData := blobtesting.DataMap{}
+	r := replication.New(blobtesting.NewMapStorage(replicaData, nil, nil), replication.Options{})
+
+	rm := maybeStartReplicationManager(ctx, env.RepositoryWriter, r, 10*time.Millisecond, 50*time.Millisecond)
+	require.NotNil(t, rm)
+
+	defer rm.stop(ctx)
+
+	dr, ok := env.RepositoryWriter.(repo.DirectRepository)
+	require.True(t, ok)
+
+	// blob written directly to the storage, bypassing the server, is picked up by periodic reconciliation.
+	require.NoError(t, env.RootStorage().PutBlob(ctx, "xdirect", gather.FromSlice([]byte("direct")), blob.PutOptions{}))
+
+	require.Eventually(t, func() bool {
+		vr, err := r.Verify(ctx, dr.BlobReader(), false)
+
+		return err == nil && vr.InSync()
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+// unreachableStorage simulates a replica which does not respond until the request is canceled.
+type unreachableStorage struct {
+	blob.Storage
+
+	called chan struct{}
+	once   sync.Once
+}
+
+func (s *unreachableStorage) PutBlob(ctx context.Context, _ blob.ID, _ blob.Bytes, _ blob.PutOptions) error {
+	s.once.Do(func() { close(s.called) })
+
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func TestServerReplicationStopWithUnreachableReplica(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	st := &unreachableStorage{Storage: blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), called: make(chan struct{})}
+	r := replication.New(st, replication.Options{})
+
+	rm := maybeStartReplicationManager(ctx, env.RepositoryWriter, r, time.Hour, time.Hour)
+	require.NotNil(t, rm)
+
+	<-st.called
+
+	stopCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	t0 := time.Now()
+
+	rm.stop(stopCtx)
+
+	require.Less(t, time.Since(t0), 5*time.Second)
+
+	// changes which were not replicated remain pending.
+	require.Positive(t, r.Status().PendingBlobs)
+}
@@ -17,6 +17,7 @@
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 	"github.com/kopia/kopia/snapshot/upload"
 )
 
@@ -73,6 +74,10 @@ type sourceManager struct {
 	lastAttemptedSnapshotTime fs.UTCTimestamp
 	// +checklocks:sourceMutex
 	isReadOnly bool
+	// +checklocks:sourceMutex
+	lastSnapshotFailed bool
+	// +checklocks:sourceMutex
+	snapshotFailureCount int64
 
 	progress *upload.CountingUploadProgress
 }
@@ -100,6 +105,30 @@ func (s *sourceManager) Status() *serverapi.SourceStatus {
 	return st
 }
 
+// sourceMetricsState captures the state of a source manager that is exposed as metrics.
+type sourceMetricsState struct {
+	status               string
+	lastSnapshot         *snapshot.Manifest
+	lastCompleteSnapshot *snapshot.Manifest
+	nextSnapshotTime     *time.Time
+	lastSnapshotFailed   bool
+	snapshotFailureCount int64
+}
+
+func (s *sourceManager) metricsState() sourceMetricsState {
+	s.sourceMutex.RLock()
+	defer s.sourceMutex.RUnlock()
+
+	return sourceMetricsState{
+		status:               s.state,
+		lastSnapshot:         s.lastSnapshot,
+		lastCompleteSnapshot: s.lastCompleteSnapshot,
+		nextSnapshotTime:     s.nextSnapshotTime,
+		lastSnapshotFailed:   s.lastSnapshotFailed,
+		snapshotFailureCount: s.snapshotFailureCount,
+	}
+}
+
 func (s *sourceManager) setStatus(stat string) {
 	s.sourceMutex.Lock()
 	defer s.sourceMutex.Unlock()
@@ -201,8 +230,10 @@ func (s *sourceManager) runLocal(ctx context.Context) {
 			if err := s.server.runSnapshotTask(ctx, s.src, s.snapshotInternal); err != nil {
 				log(ctx).Errorf("snapshot error: %v", err)
 
+				s.setLastSnapshotFailed(true)
 				s.backoffBeforeNextSnapshot()
 			} else {
+				s.setLastSnapshotFailed(false)
 				s.refreshStatus(ctx)
 			}
 
@@ -213,6 +244,16 @@ func (s *sourceManager) runLocal(ctx context.Context) {
 	}
 }
 
+func (s *sourceManager) setLastSnapshotFailed(failed bool) {
+	s.sourceMutex.Lock()
+	defer s.sourceMutex.Unlock()
+
+	s.lastSnapshotFailed = failed
+	if failed {
+		s.snapshotFailureCount++
+	}
+}
+
 func (s *sourceManager) backoffBeforeNextSnapshot() {
 	if _, ok := s.getNextSnapshotTime(); !ok {
 		return
@@ -399,7 +440,7 @@ func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Contro
 			return errors.Wrap(err, "unable to save snapshot")
 		}
 
-		if _, err := policy.ApplyRetentionPolicy(ctx, w, s.src, true); err != nil {
+		if _, err := policy.ApplyRetentionPolicy(ctx, w, s.src, true, snapshotfs.CalculateStorageStats); err != nil {
 			return errors.Wrap(err, "unable to apply retention policy")
 		}
 
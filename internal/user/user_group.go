@@ -0,0 +1,209 @@
+package user
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+// GroupManifestType is the type of the manifest used to represent user groups.
+const GroupManifestType = "usergroup"
+
+// GroupNameLabel is the manifest label identifying groups by name.
+const GroupNameLabel = "group"
+
+// ErrGroupNotFound is returned to indicate that a group was not found in the system.
+var ErrGroupNotFound = errors.New("group not found")
+
+// Group describes a named set of users.
+type Group struct {
+	ManifestID manifest.ID `json:"-"`
+
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// HasMember returns true if the provided username@hostname is a member of the group.
+func (g *Group) HasMember(usernameAtHostname string) bool {
+	return slices.Contains(g.Members, usernameAtHostname)
+}
+
+// AddMembers adds the provided users to the group, ignoring existing members.
+func (g *Group) AddMembers(members ...string) error {
+	for _, m := range members {
+		if err := ValidateUsername(m); err != nil {
+			return errors.Wrapf(err, "invalid member %q", m)
+		}
+
+		if !g.HasMember(m) {
+			g.Members = append(g.Members, m)
+		}
+	}
+
+	slices.Sort(g.Members)
+
+	return nil
+}
+
+// RemoveMembers removes the provided users from the group.
+func (g *Group) RemoveMembers(members ...string) {
+	g.Members = slices.DeleteFunc(g.Members, func(m string) bool {
+		return slices.Contains(members, m)
+	})
+}
+
+// validGroupNameRegexp matches group names consisting of lowercase letters, digits, dashes, underscores or period characters.
+var validGroupNameRegexp = regexp.MustCompile(`^[a-z0-9\-_.]+$`)
+
+// ValidateGroupName returns an error if the given group name is invalid.
+func ValidateGroupName(name string) error {
+	if name == "" {
+		return errors.New("group name is required")
+	}
+
+	if !validGroupNameRegexp.MatchString(name) {
+		return errors.New("group name must consist of lowercase letters, digits, '-', '_' or '.'")
+	}
+
+	return nil
+}
+
+// LoadGroupMap returns the map of all groups in the repository by name, using old map as a cache.
+func LoadGroupMap(ctx context.Context, rep repo.Repository, old map[string]*Group) (map[string]*Group, error) {
+	if rep == nil {
+		return nil, nil
+	}
+
+	entries, err := rep.FindManifests(ctx, map[string]string{manifest.TypeLabelKey: GroupManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing group manifests")
+	}
+
+	result := map[string]*Group{}
+
+	for _, m := range manifest.DedupeEntryMetadataByLabel(entries, GroupNameLabel) {
+		name := m.Labels[GroupNameLabel]
+
+		// same group info as before
+		if o := old[name]; o != nil && o.ManifestID == m.ID {
+			result[name] = o
+			continue
+		}
+
+		g := &Group{}
+		if _, err := rep.GetManifest(ctx, m.ID, g); err != nil {
+			return nil, errors.Wrapf(err, "error loading group manifest %v", name)
+		}
+
+		g.ManifestID = m.ID
+
+		result[name] = g
+	}
+
+	return result, nil
+}
+
+// ListGroups gets the list of all groups in the system.
+func ListGroups(ctx context.Context, rep repo.Repository) ([]*Group, error) {
+	groups, err := LoadGroupMap(ctx, rep, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.SortedFunc(maps.Values(groups), func(g1, g2 *Group) int {
+		return strings.Compare(g1.Name, g2.Name)
+	}), nil
+}
+
+// GroupsForUser returns sorted names of groups the provided username@hostname belongs to.
+func GroupsForUser(groups map[string]*Group, usernameAtHostname string) []string {
+	var result []string
+
+	for name, g := range groups {
+		if g.HasMember(usernameAtHostname) {
+			result = append(result, name)
+		}
+	}
+
+	slices.Sort(result)
+
+	return result
+}
+
+// GetGroup returns the group with a given name.
+// Returns ErrGroupNotFound when the group does not exist.
+func GetGroup(ctx context.Context, r repo.Repository, name string) (*Group, error) {
+	manifests, err := r.FindManifests(ctx, map[string]string{
+		manifest.TypeLabelKey: GroupManifestType,
+		GroupNameLabel:        name,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking for group")
+	}
+
+	if len(manifests) == 0 {
+		return nil, errors.Wrap(ErrGroupNotFound, name)
+	}
+
+	g := &Group{}
+	if _, err := r.GetManifest(ctx, manifest.PickLatestID(manifests), g); err != nil {
+		return nil, errors.Wrap(err, "error loading group")
+	}
+
+	g.ManifestID = manifest.PickLatestID(manifests)
+
+	return g, nil
+}
+
+// SetGroup creates or updates a group.
+func SetGroup(ctx context.Context, w repo.RepositoryWriter, g *Group) error {
+	if err := ValidateGroupName(g.Name); err != nil {
+		return err
+	}
+
+	id, err := w.ReplaceManifests(ctx, map[string]string{
+		manifest.TypeLabelKey: GroupManifestType,
+		GroupNameLabel:        g.Name,
+	}, g)
+	if err != nil {
+		return errors.Wrap(err, "error writing group")
+	}
+
+	g.ManifestID = id
+
+	return nil
+}
+
+// DeleteGroup removes group with a given name.
+func DeleteGroup(ctx context.Context, w repo.RepositoryWriter, name string) error {
+	if name == "" {
+		return errors.New("group name is required")
+	}
+
+	manifests, err := w.FindManifests(ctx, map[string]string{
+		manifest.TypeLabelKey: GroupManifestType,
+		GroupNameLabel:        name,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error looking for group")
+	}
+
+	if len(manifests) == 0 {
+		return errors.Wrap(ErrGroupNotFound, name)
+	}
+
+	for _, m := range manifests {
+		if err := w.DeleteManifest(ctx, m.ID); err != nil {
+			return errors.Wrapf(err, "error deleting group %v", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package user_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/user"
+)
+
+func TestGroups(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	_, err := user.GetGroup(ctx, env.RepositoryWriter, "engineering")
+	require.ErrorIs(t, err, user.ErrGroupNotFound)
+
+	g := &user.Group{Name: "engineering"}
+	require.NoError(t, g.AddMembers("bob@laptop2", "alice@laptop1", "bob@laptop2"))
+	require.Equal(t, []string{"alice@laptop1", "bob@laptop2"}, g.Members)
+	require.Error(t, g.AddMembers("not-a-user"))
+	require.NoError(t, user.SetGroup(ctx, env.RepositoryWriter, g))
+
+	require.Error(t, user.SetGroup(ctx, env.RepositoryWriter, &user.Group{Name: "Bad Name"}))
+	require.NoError(t, user.SetGroup(ctx, env.RepositoryWriter, &user.Group{Name: "support", Members: []string{"alice@laptop1"}}))
+
+	g, err = user.GetGroup(ctx, env.RepositoryWriter, "engineering")
+	require.NoError(t, err)
+	g.RemoveMembers("bob@laptop2")
+	require.NoError(t, user.SetGroup(ctx, env.RepositoryWriter, g))
+
+	groups, err := user.LoadGroupMap(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, []string{"engineering", "support"}, user.GroupsForUser(groups, "alice@laptop1"))
+	require.Empty(t, user.GroupsForUser(groups, "bob@laptop2"))
+
+	require.NoError(t, user.DeleteGroup(ctx, env.RepositoryWriter, "support"))
+	require.ErrorIs(t, user.DeleteGroup(ctx, env.RepositoryWriter, "support"), user.ErrGroupNotFound)
+
+	list, err := user.ListGroups(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, "engineering", list[0].Name)
+}
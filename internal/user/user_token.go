@@ -0,0 +1,275 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+// TokenManifestType is the type of the manifest used to represent API tokens.
+const TokenManifestType = "usertoken"
+
+// TokenIDLabel is the manifest label identifying API tokens by ID.
+const TokenIDLabel = "tokenid"
+
+// tokenPrefix is the prefix of all API tokens, which allows them to be distinguished from passwords.
+const tokenPrefix = "kopia_"
+
+const (
+	tokenIDLength     = 8
+	tokenSecretLength = 32
+)
+
+// Supported API token scopes.
+const (
+	ScopeAll           = "all"
+	ScopeSnapshotRead  = "snapshot:read"
+	ScopeSnapshotWrite = "snapshot:write"
+	ScopePolicyRead    = "policy:read"
+	ScopePolicyWrite   = "policy:write"
+	ScopeUI            = "ui"
+	ScopeServerControl = "server:control"
+)
+
+// ErrTokenNotFound is returned to indicate that an API token was not found in the system.
+var ErrTokenNotFound = errors.New("token not found")
+
+// SupportedTokenScopes returns the list of supported API token scopes.
+func SupportedTokenScopes() []string {
+	return []string{
+		ScopeAll,
+		ScopeSnapshotRead,
+		ScopeSnapshotWrite,
+		ScopePolicyRead,
+		ScopePolicyWrite,
+		ScopeUI,
+		ScopeServerControl,
+	}
+}
+
+// Token describes an API token which can be used instead of the password of a user.
+type Token struct {
+	ManifestID manifest.ID `json:"-"`
+
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	Description string    `json:"description,omitempty"`
+	Scopes      []string  `json:"scopes"`
+	SecretHash  []byte    `json:"secretHash"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	LastUsed    time.Time `json:"lastUsed"`
+}
+
+// NewToken creates a new API token for the given user and returns it along with the token string,
+// which is not stored anywhere and must be handed to the user.
+func NewToken(username, description string, scopes []string, createdAt time.Time, validity time.Duration) (*Token, string, error) {
+	if username == "" || strings.Contains(username, ":") {
+		return nil, "", errors.New("invalid username")
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", errors.New("at least one scope is required")
+	}
+
+	for _, s := range scopes {
+		if !slices.Contains(SupportedTokenScopes(), s) {
+			return nil, "", errors.Errorf("unsupported scope %q, must be one of: %v", s, strings.Join(SupportedTokenScopes(), ", "))
+		}
+	}
+
+	id, err := randomHex(tokenIDLength)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := randomHex(tokenSecretLength)
+	if err != nil {
+		return nil, "", err
+	}
+
+	t := &Token{
+		ID:          id,
+		Username:    username,
+		Description: description,
+		Scopes:      slices.Sorted(slices.Values(scopes)),
+		SecretHash:  hashTokenSecret(secret),
+		CreatedAt:   createdAt,
+	}
+
+	if validity > 0 {
+		t.ExpiresAt = createdAt.Add(validity)
+	}
+
+	return t, tokenPrefix + id + "_" + secret, nil
+}
+
+// IsToken determines whether the provided password looks like an API token.
+func IsToken(password string) bool {
+	_, _, ok := parseToken(password)
+	return ok
+}
+
+// TokenID returns the ID of the provided API token.
+func TokenID(token string) (string, bool) {
+	id, _, ok := parseToken(token)
+	return id, ok
+}
+
+func parseToken(token string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || len(id) != 2*tokenIDLength || len(secret) != 2*tokenSecretLength {
+		return "", "", false
+	}
+
+	return id, secret, true
+}
+
+// IsValid determines whether the provided token string is valid for the token at the given time.
+func (t *Token) IsValid(token string, now time.Time) bool {
+	id, secret, ok := parseToken(token)
+	if !ok || id != t.ID {
+		return false
+	}
+
+	if t.IsExpired(now) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(hashTokenSecret(secret), t.SecretHash) == 1
+}
+
+// IsExpired determines whether the token is expired at the given time.
+func (t *Token) IsExpired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+func hashTokenSecret(secret string) []byte {
+	h := sha256.Sum256([]byte(secret))
+	return h[:]
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "error generating random bytes")
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// LoadTokenMap returns the map of all API tokens in the repository by ID, using old map as a cache.
+func LoadTokenMap(ctx context.Context, rep repo.Repository, old map[string]*Token) (map[string]*Token, error) {
+	if rep == nil {
+		return nil, nil
+	}
+
+	entries, err := rep.FindManifests(ctx, map[string]string{manifest.TypeLabelKey: TokenManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing token manifests")
+	}
+
+	result := map[string]*Token{}
+
+	for _, m := range manifest.DedupeEntryMetadataByLabel(entries, TokenIDLabel) {
+		id := m.Labels[TokenIDLabel]
+
+		// same token info as before
+		if o := old[id]; o != nil && o.ManifestID == m.ID {
+			result[id] = o
+			continue
+		}
+
+		t := &Token{}
+		if _, err := rep.GetManifest(ctx, m.ID, t); err != nil {
+			return nil, errors.Wrapf(err, "error loading token manifest %v", id)
+		}
+
+		t.ManifestID = m.ID
+
+		result[id] = t
+	}
+
+	return result, nil
+}
+
+// ListTokens gets the list of API tokens of the provided user or of all users if username is empty.
+func ListTokens(ctx context.Context, rep repo.Repository, username string) ([]*Token, error) {
+	tokens, err := LoadTokenMap(ctx, rep, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := slices.DeleteFunc(slices.Collect(maps.Values(tokens)), func(t *Token) bool {
+		return username != "" && t.Username != username
+	})
+
+	slices.SortFunc(result, func(t1, t2 *Token) int {
+		if c := strings.Compare(t1.Username, t2.Username); c != 0 {
+			return c
+		}
+
+		return t1.CreatedAt.Compare(t2.CreatedAt)
+	})
+
+	return result, nil
+}
+
+// SetToken creates or updates an API token.
+func SetToken(ctx context.Context, w repo.RepositoryWriter, t *Token) error {
+	if t.ID == "" {
+		return errors.New("token ID is required")
+	}
+
+	id, err := w.ReplaceManifests(ctx, map[string]string{
+		manifest.TypeLabelKey:   TokenManifestType,
+		TokenIDLabel:            t.ID,
+		UsernameAtHostnameLabel: t.Username,
+	}, t)
+	if err != nil {
+		return errors.Wrap(err, "error writing token")
+	}
+
+	t.ManifestID = id
+
+	return nil
+}
+
+// DeleteToken revokes API token with a given ID.
+func DeleteToken(ctx context.Context, w repo.RepositoryWriter, id string) error {
+	manifests, err := w.FindManifests(ctx, map[string]string{
+		manifest.TypeLabelKey: TokenManifestType,
+		TokenIDLabel:          id,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error looking for token")
+	}
+
+	if len(manifests) == 0 {
+		return errors.Wrap(ErrTokenNotFound, id)
+	}
+
+	for _, m := range manifests {
+		if err := w.DeleteManifest(ctx, m.ID); err != nil {
+			return errors.Wrapf(err, "error deleting token %v", id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package user_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/user"
+)
+
+func TestTokens(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	now := clock.Now()
+
+	_, _, err := user.NewToken("alice@laptop", "", nil, now, 0)
+	require.Error(t, err)
+
+	_, _, err = user.NewToken("alice@laptop", "", []string{"snapshot:delete"}, now, 0)
+	require.Error(t, err)
+
+	tok, secret, err := user.NewToken("alice@laptop", "ci", []string{user.ScopeSnapshotWrite}, now, time.Hour)
+	require.NoError(t, err)
+	require.True(t, user.IsToken(secret))
+	require.False(t, user.IsToken("some-password"))
+	require.NotContains(t, string(tok.SecretHash), secret)
+
+	id, ok := user.TokenID(secret)
+	require.True(t, ok)
+	require.Equal(t, tok.ID, id)
+
+	require.True(t, tok.IsValid(secret, now))
+	require.False(t, tok.IsValid(secret, now.Add(time.Hour)))
+	require.False(t, tok.IsValid(secret[:len(secret)-1]+"x", now))
+	require.False(t, tok.IsValid(strings.ToUpper(secret), now))
+
+	tok2, _, err := user.NewToken("bob@laptop", "", []string{user.ScopeAll}, now, 0)
+	require.NoError(t, err)
+	require.False(t, tok2.IsExpired(now.Add(1000*time.Hour)))
+
+	require.NoError(t, user.SetToken(ctx, env.RepositoryWriter, tok))
+	require.NoError(t, user.SetToken(ctx, env.RepositoryWriter, tok2))
+
+	all, err := user.ListTokens(ctx, env.RepositoryWriter, "")
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	alice, err := user.ListTokens(ctx, env.RepositoryWriter, "alice@laptop")
+	require.NoError(t, err)
+	require.Len(t, alice, 1)
+	require.Equal(t, tok.SecretHash, alice[0].SecretHash)
+	require.Equal(t, []string{user.ScopeSnapshotWrite}, alice[0].Scopes)
+
+	require.NoError(t, user.DeleteToken(ctx, env.RepositoryWriter, tok.ID))
+	require.ErrorIs(t, user.DeleteToken(ctx, env.RepositoryWriter, tok.ID), user.ErrTokenNotFound)
+
+	m, err := user.LoadTokenMap(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.Len(t, m, 1)
+	require.NotNil(t, m[tok2.ID])
+}
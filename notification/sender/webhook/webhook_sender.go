@@ -4,12 +4,17 @@
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/notification/sender"
 )
 
@@ -17,7 +22,8 @@
 const ProviderType = "webhook"
 
 type webhookProvider struct {
-	opt Options
+	opt    Options
+	client *http.Client
 }
 
 func (p *webhookProvider) Send(ctx context.Context, msg *sender.Message) error {
@@ -46,7 +52,11 @@ func (p *webhookProvider) Send(ctx context.Context, msg *sender.Message) error {
 		req.Header.Set(k, v)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	if p.opt.SigningSecret != "" {
+		req.Header.Set(p.opt.SignatureHeader, Signature(p.opt.SigningSecret, clock.Now().Unix(), []byte(msg.Body)))
+	}
+
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return errors.Wrap(err, "error sending webhook notification")
 	}
@@ -60,8 +70,32 @@ func (p *webhookProvider) Send(ctx context.Context, msg *sender.Message) error {
 	return nil
 }
 
+// Signature computes the value of the signature header for the provided secret, timestamp and body.
+// The value has the form "t=<unix-timestamp>,v1=<hex-hmac>" where the HMAC-SHA256 is computed over
+// "<unix-timestamp>.<body>", which allows the receiver to reject replayed requests.
+func Signature(secret string, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+
+	return "t=" + ts + ",v1=" + hex.EncodeToString(h.Sum(nil))
+}
+
 func (p *webhookProvider) Summary() string {
-	return fmt.Sprintf("Webhook %v %v Format %q", p.opt.Method, p.opt.Endpoint, p.Format())
+	var extra string
+
+	if p.opt.SigningSecret != "" {
+		extra += " Signed"
+	}
+
+	if p.opt.ClientCertificate != "" {
+		extra += " mTLS"
+	}
+
+	return fmt.Sprintf("Webhook %v %v Format %q%v", p.opt.Method, p.opt.Endpoint, p.Format(), extra)
 }
 
 func (p *webhookProvider) Format() string {
@@ -74,8 +108,23 @@ func init() {
 			return nil, errors.Wrap(err, "invalid notification configuration")
 		}
 
+		tlsConfig, err := options.tlsConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid TLS configuration")
+		}
+
+		client := http.DefaultClient
+
+		if tlsConfig != nil {
+			t := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+			t.TLSClientConfig = tlsConfig
+
+			client = &http.Client{Transport: t}
+		}
+
 		return &webhookProvider{
-			opt: *options,
+			opt:    *options,
+			client: client,
 		}, nil
 	})
 }
@@ -2,6 +2,8 @@
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"net/url"
 
 	"github.com/pkg/errors"
@@ -9,12 +11,27 @@
 	"github.com/kopia/kopia/notification/sender"
 )
 
+// DefaultSignatureHeader is the name of the HTTP header that carries the request signature
+// when signing secret is configured and no explicit header name is provided.
+const DefaultSignatureHeader = "X-Kopia-Signature"
+
 // Options defines Webhook sender options.
 type Options struct {
 	Endpoint string `json:"endpoint"`
 	Method   string `json:"method"`
 	Format   string `json:"format"`
 	Headers  string `json:"headers"` // newline-separated list of headers (key: value)
+
+	// SigningSecret, when set, causes each request to be signed using HMAC-SHA256.
+	SigningSecret   string `json:"signingSecret,omitempty"`
+	SignatureHeader string `json:"signatureHeader,omitempty"` // defaults to DefaultSignatureHeader
+
+	// PEM-encoded client certificate and private key used for mutual TLS.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	ClientKey         string `json:"clientKey,omitempty"`
+
+	// PEM-encoded CA certificates used to verify the server certificate instead of system roots.
+	CACertificates string `json:"caCertificates,omitempty"`
 }
 
 // ApplyDefaultsAndValidate applies default values and validates the configuration.
@@ -40,15 +57,64 @@ func (o *Options) ApplyDefaultsAndValidate(_ context.Context) error {
 		o.Format = sender.FormatPlainText
 	}
 
+	if o.SigningSecret != "" && o.SignatureHeader == "" {
+		o.SignatureHeader = DefaultSignatureHeader
+	}
+
+	if _, err := o.tlsConfig(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// tlsConfig returns TLS configuration based on the client certificate and CA options or nil
+// if the defaults should be used.
+func (o *Options) tlsConfig() (*tls.Config, error) {
+	if o.ClientCertificate == "" && o.ClientKey == "" && o.CACertificates == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if o.ClientCertificate != "" || o.ClientKey != "" {
+		if o.ClientCertificate == "" || o.ClientKey == "" {
+			return nil, errors.Errorf("both client certificate and client key must be provided")
+		}
+
+		cert, err := tls.X509KeyPair([]byte(o.ClientCertificate), []byte(o.ClientKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid client certificate or key")
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if o.CACertificates != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(o.CACertificates)) {
+			return nil, errors.Errorf("invalid CA certificates")
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
 // MergeOptions updates the destination options with the source options.
 func MergeOptions(ctx context.Context, src Options, dst *Options, isUpdate bool) error {
 	copyOrMerge(&dst.Endpoint, src.Endpoint, isUpdate)
 	copyOrMerge(&dst.Method, src.Method, isUpdate)
 	copyOrMerge(&dst.Headers, src.Headers, isUpdate)
 	copyOrMerge(&dst.Format, src.Format, isUpdate)
+	copyOrMerge(&dst.SigningSecret, src.SigningSecret, isUpdate)
+	copyOrMerge(&dst.SignatureHeader, src.SignatureHeader, isUpdate)
+	copyOrMerge(&dst.ClientCertificate, src.ClientCertificate, isUpdate)
+	copyOrMerge(&dst.ClientKey, src.ClientKey, isUpdate)
+	copyOrMerge(&dst.CACertificates, src.CACertificates, isUpdate)
 
 	return dst.ApplyDefaultsAndValidate(ctx)
 }
@@ -3,13 +3,23 @@
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/notification/sender"
 	"github.com/kopia/kopia/notification/sender/webhook"
@@ -145,6 +155,178 @@ func TestWebhook_InvalidMethod(t *testing.T) {
 	}), "net/http: invalid method \"?\"")
 }
 
+func TestWebhook_Signed(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	var (
+		gotSignature string
+		gotBody      []byte
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get("X-My-Signature")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	p, err := sender.GetSender(ctx, "my-profile", "webhook", &webhook.Options{
+		Endpoint:        server.URL,
+		SigningSecret:   "secret",
+		SignatureHeader: "X-My-Signature",
+	})
+	require.NoError(t, err)
+	require.Contains(t, p.Summary(), "Signed")
+
+	before := clock.Now().Unix()
+
+	require.NoError(t, p.Send(ctx, &sender.Message{
+		Subject: "Test",
+		Body:    "signed body",
+	}))
+
+	require.Equal(t, "signed body", string(gotBody))
+
+	// the signature must match one computed for a timestamp taken during the call.
+	var matched bool
+
+	for ts := before; ts <= clock.Now().Unix(); ts++ {
+		if webhook.Signature("secret", ts, gotBody) == gotSignature {
+			matched = true
+		}
+	}
+
+	require.True(t, matched, "invalid signature %q", gotSignature)
+}
+
+func TestWebhook_DefaultSignatureHeader(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	var gotSignature string
+
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(webhook.DefaultSignatureHeader)
+	}))
+	defer server.Close()
+
+	p, err := sender.GetSender(ctx, "my-profile", "webhook", &webhook.Options{
+		Endpoint:      server.URL,
+		SigningSecret: "secret",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.Send(ctx, &sender.Message{Subject: "Test", Body: "body"}))
+	require.Regexp(t, "^t=[0-9]+,v1=[0-9a-f]{64}$", gotSignature)
+}
+
+func TestSignature(t *testing.T) {
+	require.Equal(t,
+		"t=1700000000,v1=47b1df0ab12338b2685470b0d2b37033add7c3b2bc8172f313e77413f1bb78c8",
+		webhook.Signature("secret", 1700000000, []byte("hello")))
+	require.NotEqual(t, webhook.Signature("a", 1, []byte("x")), webhook.Signature("b", 1, []byte("x")))
+	require.NotEqual(t, webhook.Signature("a", 1, []byte("x")), webhook.Signature("a", 2, []byte("x")))
+	require.NotEqual(t, webhook.Signature("a", 1, []byte("x")), webhook.Signature("a", 1, []byte("y")))
+}
+
+func TestWebhook_MutualTLS(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	clientCertPEM, clientKeyPEM, clientCert := generateClientCertificate(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	var gotPeer string
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotPeer = r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	server.StartTLS()
+	defer server.Close()
+
+	serverCAPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	p, err := sender.GetSender(ctx, "my-profile", "webhook", &webhook.Options{
+		Endpoint:          server.URL,
+		ClientCertificate: clientCertPEM,
+		ClientKey:         clientKeyPEM,
+		CACertificates:    serverCAPEM,
+	})
+	require.NoError(t, err)
+	require.Contains(t, p.Summary(), "mTLS")
+
+	require.NoError(t, p.Send(ctx, &sender.Message{Subject: "Test", Body: "body"}))
+	require.Equal(t, "webhook-client", gotPeer)
+
+	// without client certificate the handshake fails.
+	p2, err := sender.GetSender(ctx, "my-profile", "webhook", &webhook.Options{
+		Endpoint:       server.URL,
+		CACertificates: serverCAPEM,
+	})
+	require.NoError(t, err)
+	require.ErrorContains(t, p2.Send(ctx, &sender.Message{Subject: "Test", Body: "body"}), "error sending webhook notification")
+}
+
+func TestWebhook_InvalidTLSOptions(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	_, err := sender.GetSender(ctx, "my-profile", "webhook", &webhook.Options{
+		Endpoint:          "https://localhost:41123/",
+		ClientCertificate: "foo",
+	})
+	require.ErrorContains(t, err, "both client certificate and client key must be provided")
+
+	_, err = sender.GetSender(ctx, "my-profile", "webhook", &webhook.Options{
+		Endpoint:          "https://localhost:41123/",
+		ClientCertificate: "foo",
+		ClientKey:         "bar",
+	})
+	require.ErrorContains(t, err, "invalid client certificate or key")
+
+	_, err = sender.GetSender(ctx, "my-profile", "webhook", &webhook.Options{
+		Endpoint:       "https://localhost:41123/",
+		CACertificates: "foo",
+	})
+	require.ErrorContains(t, err, "invalid CA certificates")
+}
+
+func generateClientCertificate(t *testing.T) (certPEM, keyPEM string, cert *x509.Certificate) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "webhook-client"},
+		NotBefore:             clock.Now().Add(-time.Hour),
+		NotAfter:              clock.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, priv.Public(), priv)
+	require.NoError(t, err)
+
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}))
+
+	return certPEM, keyPEM, cert
+}
+
 func TestMergeOptions(t *testing.T) {
 	var dst webhook.Options
 
@@ -41,3 +41,8 @@ type Options struct {
 	// PointInTime specifies a view of the (versioned) store at that time
 	PointInTime *time.Time `json:"pointInTime,omitempty"`
 }
+
+// SetPointInTime implements blob.PointInTimeOptions.
+func (o *Options) SetPointInTime(t *time.Time) {
+	o.PointInTime = t
+}
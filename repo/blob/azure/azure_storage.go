@@ -126,6 +126,8 @@ func translateError(err error) error {
 			return blob.ErrBlobNotFound
 		case string(bloberror.InvalidRange):
 			return blob.ErrInvalidRange
+		case string(bloberror.BlobArchived), string(bloberror.BlobBeingRehydrated):
+			return blob.ErrBlobArchived
 		}
 	}
 
@@ -190,6 +192,55 @@ func (az *azStorage) ExtendBlobRetention(ctx context.Context, b blob.ID, opts bl
 	return nil
 }
 
+// GetRetention implements blob.RetentionReader.
+func (az *azStorage) GetRetention(ctx context.Context, b blob.ID) (blob.RetentionMode, time.Time, error) {
+	bc := az.service.ServiceClient().NewContainerClient(az.container).NewBlobClient(az.getObjectNameString(b))
+
+	fi, err := bc.GetProperties(ctx, nil)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(translateError(err), "Attributes")
+	}
+
+	if fi.ImmutabilityPolicyMode == nil || fi.ImmutabilityPolicyExpiresOn == nil {
+		return "", time.Time{}, nil
+	}
+
+	return blob.RetentionMode(*fi.ImmutabilityPolicyMode), *fi.ImmutabilityPolicyExpiresOn, nil
+}
+
+// RehydrateBlob implements blob.Rehydrator. Unlike in S3, rehydrated blobs are moved to the hot
+// access tier permanently and opts.Days is ignored.
+func (az *azStorage) RehydrateBlob(ctx context.Context, b blob.ID, opts blob.RehydrateOptions) (bool, error) {
+	bc := az.service.ServiceClient().NewContainerClient(az.container).NewBlobClient(az.getObjectNameString(b))
+
+	fi, err := bc.GetProperties(ctx, nil)
+	if err != nil {
+		return false, errors.Wrap(translateError(err), "Attributes")
+	}
+
+	if fi.ArchiveStatus != nil && *fi.ArchiveStatus != "" {
+		// rehydration is in progress.
+		return false, nil
+	}
+
+	if fi.AccessTier == nil || *fi.AccessTier != string(azblobblob.AccessTierArchive) {
+		return true, nil
+	}
+
+	priority := azblobblob.RehydratePriorityStandard
+	if opts.Priority != "" {
+		priority = azblobblob.RehydratePriority(opts.Priority)
+	}
+
+	if _, err := bc.SetTier(ctx, azblobblob.AccessTierHot, &azblobblob.SetTierOptions{
+		RehydratePriority: &priority,
+	}); err != nil {
+		return false, errors.Wrap(err, "unable to rehydrate blob")
+	}
+
+	return false, nil
+}
+
 func (az *azStorage) getObjectNameString(b blob.ID) string {
 	return az.Prefix + string(b)
 }
@@ -0,0 +1,78 @@
+package composite
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Route directs blobs with a given prefix to a storage.
+type Route struct {
+	Prefix  blob.ID             `json:"prefix"`
+	Storage blob.ConnectionInfo `json:"storage"`
+}
+
+// Options defines options for composite storage.
+type Options struct {
+	// Default is the storage of blobs which don't match any route.
+	Default blob.ConnectionInfo `json:"default"`
+
+	// Routes direct blobs to storages by prefix, the longest matching prefix wins.
+	Routes []Route `json:"routes,omitempty"`
+}
+
+// Validate checks the options for consistency.
+func (o *Options) Validate() error {
+	if o.Default.Type == "" {
+		return errors.New("default storage must be specified")
+	}
+
+	seen := map[blob.ID]bool{}
+
+	for _, r := range o.Routes {
+		if r.Prefix == "" {
+			return errors.New("route prefix must not be empty")
+		}
+
+		if seen[r.Prefix] {
+			return errors.Errorf("duplicate route for prefix %q", r.Prefix)
+		}
+
+		seen[r.Prefix] = true
+
+		if r.Storage.Type == "" {
+			return errors.Errorf("storage for prefix %q must be specified", r.Prefix)
+		}
+	}
+
+	return nil
+}
+
+// StorageIndex returns the index of the route whose storage holds the blob with a given ID
+// or -1 if the blob is held by the default storage.
+func (o *Options) StorageIndex(id blob.ID) int {
+	result := -1
+
+	for i, r := range o.Routes {
+		if !strings.HasPrefix(string(id), string(r.Prefix)) {
+			continue
+		}
+
+		if result < 0 || len(r.Prefix) > len(o.Routes[result].Prefix) {
+			result = i
+		}
+	}
+
+	return result
+}
+
+// StorageFor returns the connection info of the storage which holds the blob with a given ID.
+func (o *Options) StorageFor(id blob.ID) blob.ConnectionInfo {
+	if i := o.StorageIndex(id); i >= 0 {
+		return o.Routes[i].Storage
+	}
+
+	return o.Default
+}
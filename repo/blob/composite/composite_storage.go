@@ -0,0 +1,191 @@
+// Package composite implements Storage which routes blobs to different underlying storages
+// based on their prefixes, for example to keep metadata blobs on fast local storage
+// while pack blobs are stored remotely.
+package composite
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const compositeStorageType = "composite"
+
+type compositeStorage struct {
+	opt Options
+
+	// routes[i] holds the storage for opt.Routes[i].
+	routes []blob.Storage
+	def    blob.Storage
+}
+
+func (s *compositeStorage) storageFor(id blob.ID) blob.Storage {
+	if i := s.opt.StorageIndex(id); i >= 0 {
+		return s.routes[i]
+	}
+
+	return s.def
+}
+
+func (s *compositeStorage) all() []blob.Storage {
+	return append([]blob.Storage{s.def}, s.routes...)
+}
+
+func (s *compositeStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	// capacity is reported by the default storage, which typically holds the bulk of the data.
+	//nolint:wrapcheck
+	return s.def.GetCapacity(ctx)
+}
+
+func (s *compositeStorage) IsReadOnly() bool {
+	for _, st := range s.all() {
+		if st.IsReadOnly() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *compositeStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	//nolint:wrapcheck
+	return s.storageFor(id).GetBlob(ctx, id, offset, length, output)
+}
+
+func (s *compositeStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	//nolint:wrapcheck
+	return s.storageFor(id).GetMetadata(ctx, id)
+}
+
+func (s *compositeStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	//nolint:wrapcheck
+	return s.storageFor(id).PutBlob(ctx, id, data, opts)
+}
+
+func (s *compositeStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	//nolint:wrapcheck
+	return s.storageFor(id).DeleteBlob(ctx, id)
+}
+
+func (s *compositeStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
+	//nolint:wrapcheck
+	return s.storageFor(id).ExtendBlobRetention(ctx, id, opts)
+}
+
+// ListBlobs lists blobs from all storages which can hold blobs with the given prefix.
+// Each storage only reports blobs which are routed to it, so stray blobs left behind
+// after changing the routes are not returned.
+func (s *compositeStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	coveredByRoute := false
+
+	for i, r := range s.opt.Routes {
+		var listPrefix blob.ID
+
+		switch {
+		case strings.HasPrefix(string(prefix), string(r.Prefix)):
+			listPrefix = prefix
+			coveredByRoute = true
+
+		case strings.HasPrefix(string(r.Prefix), string(prefix)):
+			listPrefix = r.Prefix
+
+		default:
+			continue
+		}
+
+		if err := s.listRouted(ctx, s.routes[i], i, listPrefix, callback); err != nil {
+			return errors.Wrapf(err, "error listing blobs with prefix %q", r.Prefix)
+		}
+	}
+
+	if coveredByRoute {
+		return nil
+	}
+
+	return errors.Wrap(s.listRouted(ctx, s.def, -1, prefix, callback), "error listing default storage")
+}
+
+func (s *compositeStorage) listRouted(ctx context.Context, st blob.Storage, routeIndex int, prefix blob.ID, callback func(blob.Metadata) error) error {
+	//nolint:wrapcheck
+	return st.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		if s.opt.StorageIndex(bm.BlobID) != routeIndex {
+			return nil
+		}
+
+		return callback(bm)
+	})
+}
+
+func (s *compositeStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   compositeStorageType,
+		Config: &s.opt,
+	}
+}
+
+func (s *compositeStorage) DisplayName() string {
+	parts := []string{"default: " + s.def.DisplayName()}
+
+	for i, r := range s.opt.Routes {
+		parts = append(parts, string(r.Prefix)+": "+s.routes[i].DisplayName())
+	}
+
+	return "Composite: " + strings.Join(parts, ", ")
+}
+
+func (s *compositeStorage) Close(ctx context.Context) error {
+	var errs []error
+
+	for _, st := range s.all() {
+		errs = append(errs, st.Close(ctx))
+	}
+
+	return errors.Wrap(stderrors.Join(errs...), "error closing storage")
+}
+
+func (s *compositeStorage) FlushCaches(ctx context.Context) error {
+	var errs []error
+
+	for _, st := range s.all() {
+		errs = append(errs, st.FlushCaches(ctx))
+	}
+
+	return errors.Wrap(stderrors.Join(errs...), "error flushing caches")
+}
+
+// New creates new composite storage with specified options, opening all underlying storages.
+func New(ctx context.Context, opt *Options, isCreate bool) (blob.Storage, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &compositeStorage{opt: *opt}
+
+	def, err := blob.NewStorage(ctx, opt.Default, isCreate)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open default storage")
+	}
+
+	s.def = def
+
+	for _, r := range opt.Routes {
+		st, err := blob.NewStorage(ctx, r.Storage, isCreate)
+		if err != nil {
+			s.Close(ctx) //nolint:errcheck
+
+			return nil, errors.Wrapf(err, "unable to open storage for prefix %q", r.Prefix)
+		}
+
+		s.routes = append(s.routes, st)
+	}
+
+	return s, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(compositeStorageType, Options{}, New)
+}
@@ -0,0 +1,146 @@
+package composite_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/composite"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+)
+
+func filesystemConnectionInfo(path string) blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   "filesystem",
+		Config: &filesystem.Options{Path: path},
+	}
+}
+
+func TestCompositeStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	defaultDir := testutil.TempDirectory(t)
+	metadataDir := testutil.TempDirectory(t)
+
+	opt := &composite.Options{
+		Default: filesystemConnectionInfo(defaultDir),
+		Routes: []composite.Route{
+			{Prefix: "ab", Storage: filesystemConnectionInfo(metadataDir)},
+			{Prefix: "abg", Storage: filesystemConnectionInfo(defaultDir)},
+		},
+	}
+
+	st, err := composite.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+}
+
+func TestCompositeStorageRouting(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	defaultDir := testutil.TempDirectory(t)
+	metadataDir := testutil.TempDirectory(t)
+	indexDir := testutil.TempDirectory(t)
+
+	opt := &composite.Options{
+		Default: filesystemConnectionInfo(defaultDir),
+		Routes: []composite.Route{
+			{Prefix: "q", Storage: filesystemConnectionInfo(metadataDir)},
+			{Prefix: "x", Storage: filesystemConnectionInfo(metadataDir)},
+			{Prefix: "xn0", Storage: filesystemConnectionInfo(indexDir)},
+		},
+	}
+
+	st, err := composite.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	ids := []blob.ID{"p1234", "q1234", "xn0_1234", "xn1_1234", "kopia.repository"}
+	for _, id := range ids {
+		require.NoError(t, st.PutBlob(ctx, id, gather.FromSlice([]byte(id)), blob.PutOptions{}))
+	}
+
+	assertBlobs(t, defaultDir, "p1234", "kopia.repository")
+	assertBlobs(t, metadataDir, "q1234", "xn1_1234")
+	assertBlobs(t, indexDir, "xn0_1234")
+
+	all, err := blob.ListAllBlobs(ctx, st, "")
+	require.NoError(t, err)
+	require.ElementsMatch(t, ids, blobIDs(all))
+
+	xs, err := blob.ListAllBlobs(ctx, st, "x")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []blob.ID{"xn0_1234", "xn1_1234"}, blobIDs(xs))
+
+	xn0, err := blob.ListAllBlobs(ctx, st, "xn0")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []blob.ID{"xn0_1234"}, blobIDs(xn0))
+
+	require.Equal(t, 1, opt.StorageIndex("xn1_1234"))
+	require.Equal(t, 2, opt.StorageIndex("xn0_1234"))
+	require.Equal(t, -1, opt.StorageIndex("p1234"))
+}
+
+func TestCompositeStorageInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	dir := testutil.TempDirectory(t)
+
+	_, err := composite.New(ctx, &composite.Options{}, true)
+	require.ErrorContains(t, err, "default storage must be specified")
+
+	_, err = composite.New(ctx, &composite.Options{
+		Default: filesystemConnectionInfo(dir),
+		Routes:  []composite.Route{{Storage: filesystemConnectionInfo(dir)}},
+	}, true)
+	require.ErrorContains(t, err, "route prefix must not be empty")
+
+	_, err = composite.New(ctx, &composite.Options{
+		Default: filesystemConnectionInfo(dir),
+		Routes: []composite.Route{
+			{Prefix: "q", Storage: filesystemConnectionInfo(dir)},
+			{Prefix: "q", Storage: filesystemConnectionInfo(dir)},
+		},
+	}, true)
+	require.ErrorContains(t, err, "duplicate route")
+}
+
+func assertBlobs(t *testing.T, dir string, want ...blob.ID) {
+	t.Helper()
+
+	ctx := testlogging.Context(t)
+
+	st, err := filesystem.New(ctx, &filesystem.Options{Path: dir}, false)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	got, err := blob.ListAllBlobs(ctx, st, "")
+	require.NoError(t, err)
+	require.ElementsMatch(t, want, blobIDs(got))
+}
+
+func blobIDs(bms []blob.Metadata) []blob.ID {
+	var result []blob.ID
+
+	for _, bm := range bms {
+		result = append(result, bm.BlobID)
+	}
+
+	return result
+}
@@ -2,10 +2,18 @@
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// PointInTimeOptions is implemented by options of storage providers which support
+// a read-only point-in-time view of versioned storage.
+type PointInTimeOptions interface {
+	// SetPointInTime sets the time of the view, nil means the current state of the storage.
+	SetPointInTime(t *time.Time)
+}
+
 // ConnectionInfo represents JSON-serializable configuration of a blob storage.
 type ConnectionInfo struct {
 	Type   string
@@ -49,3 +57,27 @@ func (c ConnectionInfo) MarshalJSON() ([]byte, error) {
 		Data: c.Config,
 	})
 }
+
+// ConnectionInfoAtPointInTime returns a copy of the provided connection info for a read-only view of
+// the storage at a given point in time, or for the current state of the storage when t is nil.
+func ConnectionInfoAtPointInTime(ci ConnectionInfo, t *time.Time) (ConnectionInfo, error) {
+	b, err := json.Marshal(ci)
+	if err != nil {
+		return ConnectionInfo{}, errors.Wrap(err, "unable to marshal connection info")
+	}
+
+	var result ConnectionInfo
+
+	if err := json.Unmarshal(b, &result); err != nil {
+		return ConnectionInfo{}, errors.Wrap(err, "unable to unmarshal connection info")
+	}
+
+	pit, ok := result.Config.(PointInTimeOptions)
+	if !ok {
+		return ConnectionInfo{}, errors.Errorf("storage type '%v' does not support point-in-time views", ci.Type)
+	}
+
+	pit.SetPointInTime(t)
+
+	return result, nil
+}
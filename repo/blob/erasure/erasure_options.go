@@ -0,0 +1,64 @@
+package erasure
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const maxTotalShards = 255
+
+// Options defines options for erasure-coded storage.
+type Options struct {
+	// DataShards is the number of shards each blob is split into, any DataShards shards are
+	// sufficient to read the blob.
+	DataShards int `json:"dataShards"`
+
+	// ParityShards is the number of additional shards, which is also the number of storages
+	// which can be lost without losing data.
+	ParityShards int `json:"parityShards"`
+
+	// Storages holds shards, the i-th shard of each blob is stored in the i-th storage.
+	Storages []blob.ConnectionInfo `json:"storages"`
+
+	// WriteQuorum is the minimum number of shards which must be written for the write to succeed,
+	// defaults to all shards. Missing shards can be rebuilt later using Scrub().
+	WriteQuorum int `json:"writeQuorum,omitempty"`
+}
+
+// Validate checks the options for consistency.
+func (o *Options) Validate() error {
+	if o.DataShards < 1 {
+		return errors.New("number of data shards must be positive")
+	}
+
+	if o.ParityShards < 1 {
+		return errors.New("number of parity shards must be positive")
+	}
+
+	if o.totalShards() > maxTotalShards {
+		return errors.Errorf("total number of shards must not exceed %v", maxTotalShards)
+	}
+
+	if len(o.Storages) != o.totalShards() {
+		return errors.Errorf("expected %v storages (%v data + %v parity shards), got %v", o.totalShards(), o.DataShards, o.ParityShards, len(o.Storages))
+	}
+
+	if o.WriteQuorum != 0 && (o.WriteQuorum < o.DataShards || o.WriteQuorum > o.totalShards()) {
+		return errors.Errorf("write quorum must be between %v and %v", o.DataShards, o.totalShards())
+	}
+
+	return nil
+}
+
+func (o *Options) totalShards() int {
+	return o.DataShards + o.ParityShards
+}
+
+func (o *Options) writeQuorum() int {
+	if o.WriteQuorum == 0 {
+		return o.totalShards()
+	}
+
+	return o.WriteQuorum
+}
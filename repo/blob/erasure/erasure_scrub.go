@@ -0,0 +1,188 @@
+package erasure
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// ScrubOptions provides options for Scrub.
+type ScrubOptions struct {
+	// Verify causes all shards to be read and their checksums verified, otherwise only blobs
+	// with missing shards are read.
+	Verify bool
+
+	// DryRun only reports damaged shards without rebuilding them.
+	DryRun bool
+
+	Parallel int
+}
+
+// ScrubResult summarizes the result of Scrub.
+type ScrubResult struct {
+	CheckedBlobs   int       `json:"checkedBlobs"`
+	MissingShards  int       `json:"missingShards"`
+	CorruptShards  int       `json:"corruptShards"`
+	RepairedShards int       `json:"repairedShards"`
+	Unrecoverable  []blob.ID `json:"unrecoverable,omitempty"`
+
+	// UnavailableStorages holds indices of storages which could not be listed, whose shards
+	// were neither checked nor rebuilt.
+	UnavailableStorages []int `json:"unavailableStorages,omitempty"`
+}
+
+// Scrub finds missing and corrupted shards in erasure-coded storage with given options
+// and rebuilds them from the remaining shards.
+func Scrub(ctx context.Context, opt *Options, so ScrubOptions) (*ScrubResult, error) {
+	s, err := newErasureStorage(ctx, opt, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.Close(ctx) //nolint:errcheck
+
+	return s.scrub(ctx, so)
+}
+
+func (s *erasureStorage) scrub(ctx context.Context, so ScrubOptions) (*ScrubResult, error) {
+	// shards in storages which can't be listed are skipped.
+	listing, unavailable, err := s.listShards(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu     sync.Mutex
+		result = ScrubResult{UnavailableStorages: unavailable}
+	)
+
+	skip := map[int]bool{}
+	for _, i := range unavailable {
+		skip[i] = true
+	}
+
+	ch := make(chan blob.ID)
+	eg, ctx := errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		defer close(ch)
+
+		for id := range listing {
+			select {
+			case ch <- id:
+			case <-ctx.Done():
+				return ctx.Err() //nolint:wrapcheck
+			}
+		}
+
+		return nil
+	})
+
+	for range max(1, so.Parallel) {
+		eg.Go(func() error {
+			for id := range ch {
+				r, err := s.scrubBlob(ctx, id, listing[id], skip, so)
+				if err != nil {
+					return err
+				}
+
+				mu.Lock()
+				result.CheckedBlobs++
+				result.MissingShards += r.MissingShards
+				result.CorruptShards += r.CorruptShards
+				result.RepairedShards += r.RepairedShards
+				result.Unrecoverable = append(result.Unrecoverable, r.Unrecoverable...)
+				mu.Unlock()
+			}
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, errors.Wrap(err, "error scrubbing blobs")
+	}
+
+	return &result, nil
+}
+
+func (s *erasureStorage) scrubBlob(ctx context.Context, id blob.ID, sl *shardListing, skip map[int]bool, so ScrubOptions) (*ScrubResult, error) {
+	var result ScrubResult
+
+	if sl.count+len(skip) == len(s.storages) && !so.Verify {
+		return &result, nil
+	}
+
+	var present []int
+
+	for i, bm := range sl.shards {
+		if bm.BlobID != "" {
+			present = append(present, i)
+		}
+	}
+
+	results := make([]shardResult, len(s.storages))
+	s.readShards(ctx, id, present, results)
+
+	h, members := bestShardGroup(results)
+	if len(members) < s.opt.DataShards {
+		log(ctx).Errorf("unable to recover %v: only %v of %v required shards are valid", id, len(members), s.opt.DataShards)
+
+		result.Unrecoverable = append(result.Unrecoverable, id)
+
+		return &result, nil
+	}
+
+	valid := map[int]bool{}
+	for _, i := range members {
+		valid[i] = true
+	}
+
+	var damaged []int
+
+	for i := range s.storages {
+		switch {
+		case valid[i], skip[i]:
+			continue
+		case sl.shards[i].BlobID == "":
+			result.MissingShards++
+		default:
+			result.CorruptShards++
+		}
+
+		damaged = append(damaged, i)
+	}
+
+	if len(damaged) == 0 || so.DryRun {
+		return &result, nil
+	}
+
+	shards, err := s.reconstructShards(h, results, members, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to reconstruct %v", id)
+	}
+
+	data, err := joinShards(h, shards)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to reconstruct %v", id)
+	}
+
+	stored := storedShards(s.opt.DataShards, s.opt.ParityShards, data, shards)
+
+	for _, i := range damaged {
+		log(ctx).Infof("rebuilding shard %v of %v", i, id)
+
+		if err := s.storages[i].PutBlob(ctx, id, gather.FromSlice(stored[i]), blob.PutOptions{}); err != nil {
+			return nil, errors.Wrapf(err, "unable to write shard %v of %v", i, id)
+		}
+
+		result.RepairedShards++
+	}
+
+	return &result, nil
+}
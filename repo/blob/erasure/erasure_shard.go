@@ -0,0 +1,161 @@
+package erasure
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/klauspost/reedsolomon"
+	"github.com/pkg/errors"
+)
+
+// Each shard is stored as a header followed by the shard data:
+//
+//	magic         [4]byte
+//	data shards   uint8
+//	parity shards uint8
+//	shard index   uint8
+//	reserved      uint8
+//	blob length   uint64
+//	blob checksum uint32 - CRC32 of the entire blob, identifies the version of the blob
+//	checksum      uint32 - CRC32 of the header and the shard data
+//
+// Data shards are stored without the padding, so the total length of data shards is the length of the blob.
+const (
+	shardHeaderLength = 24
+	checksumOffset    = 20
+)
+
+var shardMagic = [4]byte{'K', 'E', 'C', '1'}
+
+type shardHeader struct {
+	dataShards   int
+	parityShards int
+	index        int
+	blobLength   int64
+	blobChecksum uint32
+}
+
+// shardSize returns the size of each (padded) shard of a blob of a given length.
+func shardSize(blobLength int64, dataShards int) int64 {
+	return max(1, (blobLength+int64(dataShards)-1)/int64(dataShards))
+}
+
+// shardDataLength returns the length of the stored data of a given shard.
+func (h shardHeader) shardDataLength() int64 {
+	ss := shardSize(h.blobLength, h.dataShards)
+
+	if h.index >= h.dataShards {
+		return ss
+	}
+
+	return min(ss, max(0, h.blobLength-int64(h.index)*ss))
+}
+
+func (h shardHeader) appendTo(b []byte) []byte {
+	b = append(b, shardMagic[:]...)
+	b = append(b, byte(h.dataShards), byte(h.parityShards), byte(h.index), 0)
+	b = binary.BigEndian.AppendUint64(b, uint64(h.blobLength)) //nolint:gosec
+	b = binary.BigEndian.AppendUint32(b, h.blobChecksum)
+
+	return b
+}
+
+func parseShardHeader(b []byte) (shardHeader, error) {
+	if len(b) < shardHeaderLength {
+		return shardHeader{}, errors.New("shard too short")
+	}
+
+	if [4]byte(b[0:4]) != shardMagic {
+		return shardHeader{}, errors.New("invalid shard magic")
+	}
+
+	h := shardHeader{
+		dataShards:   int(b[4]),
+		parityShards: int(b[5]),
+		index:        int(b[6]),
+		blobLength:   int64(binary.BigEndian.Uint64(b[8:16])), //nolint:gosec
+		blobChecksum: binary.BigEndian.Uint32(b[16:20]),
+	}
+
+	if h.blobLength < 0 || h.dataShards == 0 || h.index >= h.dataShards+h.parityShards {
+		return shardHeader{}, errors.New("invalid shard header")
+	}
+
+	return h, nil
+}
+
+// decodeShard validates the shard of a blob stored in a given storage and returns its header and data.
+func (s *erasureStorage) decodeShard(index int, b []byte) (shardHeader, []byte, error) {
+	h, err := parseShardHeader(b)
+	if err != nil {
+		return shardHeader{}, nil, err
+	}
+
+	if h.dataShards != s.opt.DataShards || h.parityShards != s.opt.ParityShards || h.index != index {
+		return shardHeader{}, nil, errors.Errorf("unexpected shard %v (%v+%v)", h.index, h.dataShards, h.parityShards)
+	}
+
+	if int64(len(b)) != shardHeaderLength+h.shardDataLength() {
+		return shardHeader{}, nil, errors.Errorf("invalid shard length %v", len(b))
+	}
+
+	checksum := crc32.ChecksumIEEE(b[0:checksumOffset])
+	checksum = crc32.Update(checksum, crc32.IEEETable, b[shardHeaderLength:])
+
+	if checksum != binary.BigEndian.Uint32(b[checksumOffset:shardHeaderLength]) {
+		return shardHeader{}, nil, errors.New("shard checksum mismatch")
+	}
+
+	return h, b[shardHeaderLength:], nil
+}
+
+// encodeShards splits the blob into data shards, computes parity shards and returns
+// the contents of all shards as stored.
+func encodeShards(enc reedsolomon.Encoder, dataShards, parityShards int, data []byte) ([][]byte, error) {
+	ss := shardSize(int64(len(data)), dataShards)
+
+	shards := make([][]byte, dataShards+parityShards)
+	for i := range shards {
+		shards[i] = make([]byte, ss)
+	}
+
+	for i := range dataShards {
+		start := min(int64(len(data)), int64(i)*ss)
+		copy(shards[i], data[start:min(int64(len(data)), start+ss)])
+	}
+
+	if err := enc.Encode(shards); err != nil {
+		return nil, errors.Wrap(err, "unable to compute parity")
+	}
+
+	return storedShards(dataShards, parityShards, data, shards), nil
+}
+
+// storedShards returns the contents of all shards as stored given the blob and its padded shards.
+func storedShards(dataShards, parityShards int, data []byte, shards [][]byte) [][]byte {
+	result := make([][]byte, len(shards))
+
+	for i, sh := range shards {
+		h := shardHeader{
+			dataShards:   dataShards,
+			parityShards: parityShards,
+			index:        i,
+			blobLength:   int64(len(data)),
+			blobChecksum: crc32.ChecksumIEEE(data),
+		}
+
+		b := make([]byte, 0, shardHeaderLength+len(sh))
+		b = h.appendTo(b)
+
+		checksum := crc32.ChecksumIEEE(b)
+
+		b = binary.BigEndian.AppendUint32(b, 0)
+		b = append(b, sh[:h.shardDataLength()]...)
+
+		binary.BigEndian.PutUint32(b[checksumOffset:], crc32.Update(checksum, crc32.IEEETable, b[shardHeaderLength:]))
+
+		result[i] = b
+	}
+
+	return result
+}
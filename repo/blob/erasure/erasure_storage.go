@@ -0,0 +1,698 @@
+// Package erasure implements Storage which splits each blob into data and parity shards
+// stored in independent storages, so that the blob can be read as long as the number of
+// lost storages does not exceed the number of parity shards.
+package erasure
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/reedsolomon"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("erasure")
+
+const erasureStorageType = "erasure"
+
+type erasureStorage struct {
+	opt Options
+
+	// storages[i] holds the i-th shard of each blob.
+	storages []blob.Storage
+	enc      reedsolomon.Encoder
+}
+
+// shardResult is the result of reading a single shard.
+type shardResult struct {
+	header shardHeader
+	data   []byte
+	err    error
+}
+
+// forEachShard invokes the provided function concurrently for the specified shards.
+func forEachShard(indices []int, f func(i int)) {
+	var wg sync.WaitGroup
+
+	for _, i := range indices {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			f(i)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func shardRange(from, to int) []int {
+	var result []int
+
+	for i := from; i < to; i++ {
+		result = append(result, i)
+	}
+
+	return result
+}
+
+// readShards reads and validates the specified shards of a blob into results.
+func (s *erasureStorage) readShards(ctx context.Context, id blob.ID, indices []int, results []shardResult) {
+	forEachShard(indices, func(i int) {
+		var tmp gather.WriteBuffer
+		defer tmp.Close()
+
+		if err := s.storages[i].GetBlob(ctx, id, 0, -1, &tmp); err != nil {
+			results[i] = shardResult{err: err}
+			return
+		}
+
+		h, data, err := s.decodeShard(i, tmp.ToByteSlice())
+		if err != nil {
+			log(ctx).Warnf("invalid shard %v of %v: %v", i, id, err)
+		}
+
+		results[i] = shardResult{header: h, data: data, err: err}
+	})
+}
+
+// bestShardGroup returns the shards of the most complete version of the blob among the results.
+func bestShardGroup(results []shardResult) (shardHeader, []int) {
+	var (
+		best    shardHeader
+		members []int
+	)
+
+	groups := map[shardHeader][]int{}
+
+	for i, r := range results {
+		// shards which were not read have empty header.
+		if r.err != nil || r.header.dataShards == 0 {
+			continue
+		}
+
+		key := r.header
+		key.index = 0
+
+		groups[key] = append(groups[key], i)
+
+		if len(groups[key]) > len(members) {
+			best = key
+			members = groups[key]
+		}
+	}
+
+	return best, members
+}
+
+// notFoundError returns ErrBlobNotFound if the blob has too few shards to exist, or a generic error otherwise.
+func (s *erasureStorage) notFoundError(id blob.ID, results []shardResult) error {
+	notFound := 0
+
+	var errs []error
+
+	for i, r := range results {
+		switch {
+		case errors.Is(r.err, blob.ErrBlobNotFound):
+			notFound++
+		case r.err != nil:
+			errs = append(errs, errors.Wrapf(r.err, "shard %v", i))
+		}
+	}
+
+	if notFound > s.opt.ParityShards {
+		return blob.ErrBlobNotFound
+	}
+
+	return errors.Wrapf(stderrors.Join(errs...), "insufficient shards of %v", id)
+}
+
+// reconstructShards returns the padded shards of the blob given the group of valid shards,
+// reconstructing the missing ones. When dataOnly is true, only data shards are reconstructed.
+func (s *erasureStorage) reconstructShards(h shardHeader, results []shardResult, members []int, dataOnly bool) ([][]byte, error) {
+	ss := shardSize(h.blobLength, h.dataShards)
+	shards := make([][]byte, s.opt.totalShards())
+
+	for _, i := range members {
+		sh := make([]byte, ss)
+		copy(sh, results[i].data)
+		shards[i] = sh
+	}
+
+	var err error
+
+	if dataOnly {
+		err = s.enc.ReconstructData(shards)
+	} else {
+		err = s.enc.Reconstruct(shards)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to reconstruct shards")
+	}
+
+	return shards, nil
+}
+
+// joinShards joins data shards into the blob and verifies its checksum.
+func joinShards(h shardHeader, shards [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, sh := range shards[0:h.dataShards] {
+		buf.Write(sh)
+	}
+
+	data := buf.Bytes()[0:h.blobLength]
+
+	if crc32.ChecksumIEEE(data) != h.blobChecksum {
+		return nil, errors.New("blob checksum mismatch after reconstruction")
+	}
+
+	return data, nil
+}
+
+// readFull reads the entire blob, reading parity shards only when some data shards can't be read.
+func (s *erasureStorage) readFull(ctx context.Context, id blob.ID) ([]byte, error) {
+	results := make([]shardResult, s.opt.totalShards())
+
+	s.readShards(ctx, id, shardRange(0, s.opt.DataShards), results)
+
+	h, members := bestShardGroup(results)
+	if len(members) < s.opt.DataShards {
+		log(ctx).Debugf("reading parity shards of %v", id)
+
+		s.readShards(ctx, id, shardRange(s.opt.DataShards, s.opt.totalShards()), results)
+
+		h, members = bestShardGroup(results)
+	}
+
+	if len(members) < s.opt.DataShards {
+		return nil, s.notFoundError(id, results)
+	}
+
+	shards, err := s.reconstructShards(h, results, members, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return joinShards(h, shards)
+}
+
+// readHeader reads the header of a given shard of a blob.
+func (s *erasureStorage) readHeader(ctx context.Context, id blob.ID, index int) (shardHeader, error) {
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	if err := s.storages[index].GetBlob(ctx, id, 0, shardHeaderLength, &tmp); err != nil {
+		return shardHeader{}, errors.Wrapf(err, "unable to read header of shard %v", index)
+	}
+
+	h, err := parseShardHeader(tmp.ToByteSlice())
+	if err != nil {
+		return shardHeader{}, err
+	}
+
+	if h.index != index {
+		return shardHeader{}, errors.Errorf("unexpected shard %v", h.index)
+	}
+
+	return h, nil
+}
+
+// readDataShardsHeader reads the headers of all data shards of a blob, which must belong
+// to the same version of the blob.
+func (s *erasureStorage) readDataShardsHeader(ctx context.Context, id blob.ID) (shardHeader, error) {
+	headers := make([]shardHeader, s.opt.DataShards)
+	errs := make([]error, s.opt.DataShards)
+
+	forEachShard(shardRange(0, s.opt.DataShards), func(i int) {
+		headers[i], errs[i] = s.readHeader(ctx, id, i)
+		headers[i].index = 0
+	})
+
+	if err := stderrors.Join(errs...); err != nil {
+		return shardHeader{}, err
+	}
+
+	for i, h := range headers {
+		if h != headers[0] {
+			return shardHeader{}, errors.Errorf("data shard %v belongs to a different version of the blob", i)
+		}
+	}
+
+	return headers[0], nil
+}
+
+// readRange reads the range of the blob from the data shards containing it, verifying their checksums
+// and that all data shards belong to the same version of the blob.
+func (s *erasureStorage) readRange(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	h, err := s.readDataShardsHeader(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if offset+length > h.blobLength {
+		return blob.ErrInvalidRange
+	}
+
+	if length == 0 {
+		return nil
+	}
+
+	ss := shardSize(h.blobLength, h.dataShards)
+	first := int(offset / ss)
+	last := int((offset + length - 1) / ss)
+	results := make([]shardResult, s.opt.totalShards())
+
+	s.readShards(ctx, id, shardRange(first, last+1), results)
+
+	for i := first; i <= last; i++ {
+		if results[i].err != nil {
+			return errors.Wrapf(results[i].err, "unable to read data shard %v", i)
+		}
+
+		// headers read above can't be verified on their own.
+		sh := results[i].header
+		sh.index = 0
+
+		if sh != h {
+			return errors.Errorf("data shard %v belongs to a different version of the blob", i)
+		}
+	}
+
+	for i := first; i <= last; i++ {
+		start := max(offset, int64(i)*ss) - int64(i)*ss
+		end := min(offset+length, int64(i+1)*ss) - int64(i)*ss
+
+		if _, err := output.Write(results[i].data[start:end]); err != nil {
+			return errors.Wrap(err, "error writing output")
+		}
+	}
+
+	return nil
+}
+
+func (s *erasureStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	if offset < 0 {
+		return blob.ErrInvalidRange
+	}
+
+	output.Reset()
+
+	if length >= 0 {
+		err := s.readRange(ctx, id, offset, length, output)
+		// damaged or mismatched shards are handled by reconstruction.
+		if err == nil || err == blob.ErrInvalidRange { //nolint:errorlint
+			return err
+		}
+
+		log(ctx).Debugf("unable to read range of %v from data shards, reconstructing: %v", id, err)
+
+		output.Reset()
+	}
+
+	data, err := s.readFull(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if length < 0 {
+		_, err = output.Write(data)
+
+		return errors.Wrap(err, "error writing output")
+	}
+
+	if offset+length > int64(len(data)) {
+		return blob.ErrInvalidRange
+	}
+
+	_, err = output.Write(data[offset : offset+length])
+
+	return errors.Wrap(err, "error writing output")
+}
+
+func (s *erasureStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	results := make([]shardResult, s.opt.totalShards())
+
+	for i, st := range s.storages {
+		bm, err := st.GetMetadata(ctx, id)
+		if err != nil {
+			results[i].err = err
+			continue
+		}
+
+		h, err := s.readHeader(ctx, id, i)
+		if err != nil {
+			results[i].err = err
+			continue
+		}
+
+		return blob.Metadata{
+			BlobID:    id,
+			Length:    h.blobLength,
+			Timestamp: bm.Timestamp,
+		}, nil
+	}
+
+	return blob.Metadata{}, s.notFoundError(id, results)
+}
+
+func (s *erasureStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	var buf bytes.Buffer
+
+	if _, err := data.WriteTo(&buf); err != nil {
+		return errors.Wrap(err, "error reading blob")
+	}
+
+	shards, err := encodeShards(s.enc, s.opt.DataShards, s.opt.ParityShards, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(shards))
+	modTimes := make([]time.Time, len(shards))
+
+	forEachShard(shardRange(0, len(shards)), func(i int) {
+		o := opts
+		o.GetModTime = &modTimes[i]
+
+		errs[i] = s.storages[i].PutBlob(ctx, id, gather.FromSlice(shards[i]), o)
+	})
+
+	written := 0
+
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if written == 0 && opts.GetModTime != nil {
+				*opts.GetModTime = modTimes[i]
+			}
+
+			written++
+
+		case errors.Is(err, blob.ErrSetTimeUnsupported),
+			errors.Is(err, blob.ErrBlobAlreadyExists),
+			errors.Is(err, blob.ErrUnsupportedPutBlobOption):
+			return err
+		}
+	}
+
+	if written < s.opt.writeQuorum() {
+		return errors.Wrapf(stderrors.Join(errs...), "unable to write %v shards of %v, only %v written", s.opt.writeQuorum(), id, written)
+	}
+
+	if written < len(shards) {
+		log(ctx).Warnf("only %v of %v shards of %v written: %v", written, len(shards), id, stderrors.Join(errs...))
+	}
+
+	return nil
+}
+
+func (s *erasureStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	errs := make([]error, len(s.storages))
+
+	forEachShard(shardRange(0, len(s.storages)), func(i int) {
+		if err := s.storages[i].DeleteBlob(ctx, id); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+			errs[i] = errors.Wrapf(err, "shard %v", i)
+		}
+	})
+
+	return errors.Wrapf(stderrors.Join(errs...), "error deleting %v", id)
+}
+
+func (s *erasureStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
+	errs := make([]error, len(s.storages))
+
+	forEachShard(shardRange(0, len(s.storages)), func(i int) {
+		if err := s.storages[i].ExtendBlobRetention(ctx, id, opts); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+			errs[i] = errors.Wrapf(err, "shard %v", i)
+		}
+	})
+
+	return errors.Wrapf(stderrors.Join(errs...), "error extending retention of %v", id)
+}
+
+// shardListing is the result of listing shards of a blob in all storages.
+type shardListing struct {
+	// metadata of shards by index, zero BlobID for missing shards.
+	shards []blob.Metadata
+	count  int
+}
+
+// listShards lists shards in all storages, tolerating up to ParityShards storages which can't be listed.
+// Returns the listing and the indices of storages which could not be listed.
+func (s *erasureStorage) listShards(ctx context.Context, prefix blob.ID) (map[blob.ID]*shardListing, []int, error) {
+	var mu sync.Mutex
+
+	result := map[blob.ID]*shardListing{}
+	errs := make([]error, len(s.storages))
+
+	forEachShard(shardRange(0, len(s.storages)), func(i int) {
+		errs[i] = s.storages[i].ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			sl := result[bm.BlobID]
+			if sl == nil {
+				sl = &shardListing{shards: make([]blob.Metadata, len(s.storages))}
+				result[bm.BlobID] = sl
+			}
+
+			sl.shards[i] = bm
+			sl.count++
+
+			return nil
+		})
+	})
+
+	var failed []int
+
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, i)
+
+			log(ctx).Warnf("unable to list shards in storage %v: %v", i, err)
+		}
+	}
+
+	if len(failed) > s.opt.ParityShards {
+		return nil, nil, errors.Wrap(stderrors.Join(errs...), "unable to list shards")
+	}
+
+	return result, failed, nil
+}
+
+// ListBlobs lists blobs which have enough shards to be read.
+func (s *erasureStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	listing, _, err := s.listShards(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for id, sl := range listing {
+		if sl.count < s.opt.DataShards {
+			log(ctx).Debugf("ignoring %v with only %v shards", id, sl.count)
+			continue
+		}
+
+		bm, err := s.listedMetadata(ctx, id, sl)
+		if err != nil {
+			return err
+		}
+
+		if err := callback(bm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listedMetadata returns the metadata of a blob given its shards, computing the length of the blob
+// from the lengths of data shards when all of them are present.
+func (s *erasureStorage) listedMetadata(ctx context.Context, id blob.ID, sl *shardListing) (blob.Metadata, error) {
+	result := blob.Metadata{BlobID: id}
+	firstPresent := -1
+
+	for i, bm := range sl.shards {
+		if bm.BlobID == "" {
+			continue
+		}
+
+		if firstPresent < 0 {
+			firstPresent = i
+			result.Timestamp = bm.Timestamp
+		}
+
+		if i < s.opt.DataShards {
+			result.Length += bm.Length - shardHeaderLength
+		}
+	}
+
+	if s.allDataShardsListed(sl) {
+		return result, nil
+	}
+
+	h, err := s.readHeader(ctx, id, firstPresent)
+	if err != nil {
+		return blob.Metadata{}, errors.Wrapf(err, "unable to determine length of %v", id)
+	}
+
+	result.Length = h.blobLength
+
+	return result, nil
+}
+
+func (s *erasureStorage) allDataShardsListed(sl *shardListing) bool {
+	for _, bm := range sl.shards[0:s.opt.DataShards] {
+		if bm.BlobID == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *erasureStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	var result blob.Capacity
+
+	for i, st := range s.storages {
+		c, err := st.GetCapacity(ctx)
+		if err != nil {
+			return blob.Capacity{}, errors.Wrapf(err, "unable to get capacity of storage %v", i)
+		}
+
+		// the usable capacity is determined by the smallest storage.
+		if i == 0 || c.SizeB < result.SizeB {
+			result.SizeB = c.SizeB
+		}
+
+		if i == 0 || c.FreeB < result.FreeB {
+			result.FreeB = c.FreeB
+		}
+	}
+
+	result.SizeB *= uint64(s.opt.DataShards) //nolint:gosec
+	result.FreeB *= uint64(s.opt.DataShards) //nolint:gosec
+
+	return result, nil
+}
+
+func (s *erasureStorage) IsReadOnly() bool {
+	for _, st := range s.storages {
+		if st.IsReadOnly() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *erasureStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   erasureStorageType,
+		Config: &s.opt,
+	}
+}
+
+func (s *erasureStorage) DisplayName() string {
+	var names []string
+
+	for _, st := range s.storages {
+		names = append(names, st.DisplayName())
+	}
+
+	return fmt.Sprintf("Erasure-coded (%v+%v): %v", s.opt.DataShards, s.opt.ParityShards, strings.Join(names, ", "))
+}
+
+func (s *erasureStorage) Close(ctx context.Context) error {
+	var errs []error
+
+	for _, st := range s.storages {
+		errs = append(errs, st.Close(ctx))
+	}
+
+	return errors.Wrap(stderrors.Join(errs...), "error closing storage")
+}
+
+func (s *erasureStorage) FlushCaches(ctx context.Context) error {
+	var errs []error
+
+	for _, st := range s.storages {
+		errs = append(errs, st.FlushCaches(ctx))
+	}
+
+	return errors.Wrap(stderrors.Join(errs...), "error flushing caches")
+}
+
+func newErasureStorage(ctx context.Context, opt *Options, isCreate bool) (*erasureStorage, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+
+	enc, err := reedsolomon.New(opt.DataShards, opt.ParityShards)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to initialize Reed-Solomon encoder")
+	}
+
+	s := &erasureStorage{opt: *opt, enc: enc}
+	s.storages = make([]blob.Storage, len(opt.Storages))
+	errs := make([]error, len(opt.Storages))
+
+	forEachShard(shardRange(0, len(opt.Storages)), func(i int) {
+		s.storages[i], errs[i] = blob.NewStorage(ctx, opt.Storages[i], isCreate)
+	})
+
+	var unavailable []error
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		err = errors.Wrapf(err, "unable to open storage %v", i)
+		unavailable = append(unavailable, err)
+
+		s.storages[i] = unavailableStorage{err}
+	}
+
+	// all storages must be available when creating the storage, otherwise up to
+	// the number of parity shards can be missing.
+	if len(unavailable) > 0 && (isCreate || len(unavailable) > opt.ParityShards) {
+		s.Close(ctx) //nolint:errcheck
+
+		return nil, stderrors.Join(unavailable...)
+	}
+
+	for _, err := range unavailable {
+		log(ctx).Warnf("%v, continuing without it", err)
+	}
+
+	return s, nil
+}
+
+// New creates new erasure-coded storage with specified options, opening all underlying storages,
+// of which up to the number of parity shards may be unavailable.
+func New(ctx context.Context, opt *Options, isCreate bool) (blob.Storage, error) {
+	s, err := newErasureStorage(ctx, opt, isCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func init() {
+	blob.AddSupportedStorage(erasureStorageType, Options{}, New)
+}
@@ -0,0 +1,406 @@
+package erasure_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/erasure"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+)
+
+const (
+	testDataShards   = 3
+	testParityShards = 2
+)
+
+func newTestOptions(t *testing.T) (*erasure.Options, []blob.Storage) {
+	t.Helper()
+
+	ctx := testlogging.Context(t)
+
+	opt := &erasure.Options{
+		DataShards:   testDataShards,
+		ParityShards: testParityShards,
+	}
+
+	var shards []blob.Storage
+
+	for range testDataShards + testParityShards {
+		fso := &filesystem.Options{Path: testutil.TempDirectory(t)}
+
+		st, err := filesystem.New(ctx, fso, true)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { st.Close(ctx) })
+
+		opt.Storages = append(opt.Storages, blob.ConnectionInfo{Type: "filesystem", Config: fso})
+		shards = append(shards, st)
+	}
+
+	return opt, shards
+}
+
+func TestErasureStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	opt, _ := newTestOptions(t)
+
+	st, err := erasure.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+}
+
+func TestErasureStorageDegraded(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	opt, shards := newTestOptions(t)
+
+	st, err := erasure.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	data := make([]byte, 10000)
+	rand.Read(data)
+
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice(data), blob.PutOptions{}))
+
+	// lose the first data shard and corrupt a parity shard.
+	require.NoError(t, shards[0].DeleteBlob(ctx, "blob1"))
+	corruptShard(ctx, t, shards[3], "blob1")
+
+	blobtesting.AssertGetBlob(ctx, t, st, "blob1", data)
+	blobtesting.AssertListResults(ctx, t, st, "", "blob1")
+
+	bm, err := st.GetMetadata(ctx, "blob1")
+	require.NoError(t, err)
+	require.EqualValues(t, len(data), bm.Length)
+
+	all, err := blob.ListAllBlobs(ctx, st, "")
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	require.EqualValues(t, len(data), all[0].Length)
+
+	// corrupting one more shard exceeds the number of parity shards.
+	corruptShard(ctx, t, shards[1], "blob1")
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.Error(t, st.GetBlob(ctx, "blob1", 0, -1, &tmp))
+
+	// blobs with too few shards are not found.
+	require.NoError(t, st.PutBlob(ctx, "blob2", gather.FromSlice(data), blob.PutOptions{}))
+
+	for _, sh := range shards[0:3] {
+		require.NoError(t, sh.DeleteBlob(ctx, "blob2"))
+	}
+
+	require.ErrorIs(t, st.GetBlob(ctx, "blob2", 0, -1, &tmp), blob.ErrBlobNotFound)
+	blobtesting.AssertListResults(ctx, t, st, "blob2")
+}
+
+func TestErasureStorageScrub(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	opt, shards := newTestOptions(t)
+
+	st, err := erasure.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	data := make([]byte, 5000)
+	rand.Read(data)
+
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice(data), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "blob2", gather.FromSlice(data[0:7]), blob.PutOptions{}))
+
+	require.NoError(t, shards[1].DeleteBlob(ctx, "blob1"))
+	corruptShard(ctx, t, shards[4], "blob1")
+
+	// a single shard left behind, for example by an interrupted deletion.
+	require.NoError(t, shards[4].PutBlob(ctx, "blob3-leftover", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+	// without verification only blobs with missing shards are read.
+	result, err := erasure.Scrub(ctx, opt, erasure.ScrubOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, &erasure.ScrubResult{
+		CheckedBlobs:  3,
+		MissingShards: 1,
+		CorruptShards: 1,
+		Unrecoverable: []blob.ID{"blob3-leftover"},
+	}, result)
+
+	result, err = erasure.Scrub(ctx, opt, erasure.ScrubOptions{Verify: true, Parallel: 2})
+	require.NoError(t, err)
+	require.Equal(t, 2, result.RepairedShards)
+
+	result, err = erasure.Scrub(ctx, opt, erasure.ScrubOptions{Verify: true})
+	require.NoError(t, err)
+	require.Zero(t, result.MissingShards)
+	require.Zero(t, result.CorruptShards)
+
+	// any 3 shards are now sufficient to read the blob.
+	for _, sh := range shards[0:2] {
+		require.NoError(t, sh.DeleteBlob(ctx, "blob1"))
+	}
+
+	blobtesting.AssertGetBlob(ctx, t, st, "blob1", data)
+}
+
+func TestErasureStorageInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	opt, _ := newTestOptions(t)
+
+	_, err := erasure.New(ctx, &erasure.Options{DataShards: 3, ParityShards: 2, Storages: opt.Storages[0:4]}, true)
+	require.ErrorContains(t, err, "expected 5 storages")
+
+	_, err = erasure.New(ctx, &erasure.Options{DataShards: 3, Storages: opt.Storages[0:3]}, true)
+	require.ErrorContains(t, err, "parity shards must be positive")
+
+	_, err = erasure.New(ctx, &erasure.Options{DataShards: 3, ParityShards: 2, Storages: opt.Storages, WriteQuorum: 2}, true)
+	require.ErrorContains(t, err, "write quorum must be between 3 and 5")
+}
+
+// corruptShard flips a bit in the data of the shard.
+func corruptShard(ctx context.Context, t *testing.T, st blob.Storage, id blob.ID) {
+	t.Helper()
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, id, 0, -1, &tmp))
+
+	b := bytes.Clone(tmp.ToByteSlice())
+	b[len(b)-1] ^= 1
+
+	require.NoError(t, st.PutBlob(ctx, id, gather.FromSlice(b), blob.PutOptions{}))
+}
+
+func TestErasureStorageUnavailableStorages(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	opt, shards := newTestOptions(t)
+
+	st, err := erasure.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	data := make([]byte, 10000)
+	rand.Read(data)
+
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice(data), blob.PutOptions{}))
+	require.NoError(t, st.PutBlob(ctx, "blob2", gather.FromSlice(data[0:8]), blob.PutOptions{}))
+	require.NoError(t, st.Close(ctx))
+
+	// a shard missing in an available storage.
+	require.NoError(t, shards[3].DeleteBlob(ctx, "blob1"))
+
+	degraded := *opt
+	degraded.Storages = append([]blob.ConnectionInfo(nil), opt.Storages...)
+	degraded.Storages[1] = unopenableStorage(t)
+
+	st, err = erasure.New(ctx, &degraded, false)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	blobtesting.AssertGetBlob(ctx, t, st, "blob1", data)
+	blobtesting.AssertGetBlob(ctx, t, st, "blob2", data[0:8])
+	blobtesting.AssertListResults(ctx, t, st, "", "blob1", "blob2")
+
+	// shards in the unavailable storage are neither counted as missing nor rebuilt.
+	result, err := erasure.Scrub(ctx, &degraded, erasure.ScrubOptions{Verify: true})
+	require.NoError(t, err)
+	require.Equal(t, &erasure.ScrubResult{
+		CheckedBlobs:        2,
+		MissingShards:       1,
+		RepairedShards:      1,
+		UnavailableStorages: []int{1},
+	}, result)
+
+	// the storage can't be created unless all storages are available.
+	_, err = erasure.New(ctx, &degraded, true)
+	require.ErrorContains(t, err, "unable to open storage 1")
+
+	// more unavailable storages than parity shards.
+	degraded.Storages[2] = unopenableStorage(t)
+	degraded.Storages[4] = unopenableStorage(t)
+
+	_, err = erasure.New(ctx, &degraded, false)
+	require.ErrorContains(t, err, "unable to open storage 1")
+	require.ErrorContains(t, err, "unable to open storage 4")
+}
+
+func TestErasureStorageFailingStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	opt, _ := newTestOptions(t)
+
+	st, err := erasure.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	data := make([]byte, 10000)
+	rand.Read(data)
+
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice(data), blob.PutOptions{}))
+	require.NoError(t, st.Close(ctx))
+
+	failing := withFailingStorages(opt, 0)
+
+	st, err = erasure.New(ctx, failing, false)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	blobtesting.AssertGetBlob(ctx, t, st, "blob1", data)
+	blobtesting.AssertListResults(ctx, t, st, "", "blob1")
+
+	result, err := erasure.Scrub(ctx, failing, erasure.ScrubOptions{Verify: true})
+	require.NoError(t, err)
+	require.Equal(t, []int{0}, result.UnavailableStorages)
+	require.Zero(t, result.MissingShards)
+
+	// more failing storages than parity shards.
+	failing = withFailingStorages(opt, 0, 1, 2)
+
+	st2, err := erasure.New(ctx, failing, false)
+	require.NoError(t, err)
+
+	defer st2.Close(ctx)
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.ErrorIs(t, st2.GetBlob(ctx, "blob1", 0, -1, &tmp), errStorageFailure)
+	require.ErrorIs(t, st2.ListBlobs(ctx, "", func(blob.Metadata) error { return nil }), errStorageFailure)
+
+	_, err = erasure.Scrub(ctx, failing, erasure.ScrubOptions{})
+	require.ErrorIs(t, err, errStorageFailure)
+}
+
+func TestErasureStorageRangeReadVerifiesShards(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	opt, shards := newTestOptions(t)
+
+	st, err := erasure.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	data := make([]byte, 10000)
+	rand.Read(data)
+
+	// the last byte of the first data shard is data[3333].
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice(data), blob.PutOptions{}))
+	corruptShard(ctx, t, shards[0], "blob1")
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, "blob1", 3330, 10, &tmp))
+	require.Equal(t, data[3330:3340], tmp.ToByteSlice())
+
+	// a valid shard of the previous version of the blob is not used.
+	var oldShard gather.WriteBuffer
+	defer oldShard.Close()
+
+	require.NoError(t, st.PutBlob(ctx, "blob2", gather.FromSlice(data), blob.PutOptions{}))
+	require.NoError(t, shards[0].GetBlob(ctx, "blob2", 0, -1, &oldShard))
+
+	data2 := make([]byte, len(data))
+	rand.Read(data2)
+
+	require.NoError(t, st.PutBlob(ctx, "blob2", gather.FromSlice(data2), blob.PutOptions{}))
+	require.NoError(t, shards[0].PutBlob(ctx, "blob2", oldShard.Bytes(), blob.PutOptions{}))
+
+	require.NoError(t, st.GetBlob(ctx, "blob2", 100, 200, &tmp))
+	require.Equal(t, data2[100:300], tmp.ToByteSlice())
+}
+
+// unopenableStorage returns connection info of a storage which can't be opened.
+func unopenableStorage(t *testing.T) blob.ConnectionInfo {
+	t.Helper()
+
+	f := filepath.Join(testutil.TempDirectory(t), "file")
+	require.NoError(t, os.WriteFile(f, nil, 0o600))
+
+	return blob.ConnectionInfo{Type: "filesystem", Config: &filesystem.Options{Path: filepath.Join(f, "storage")}}
+}
+
+const failingStorageType = "erasure-test-failing"
+
+var errStorageFailure = errors.New("storage failure")
+
+// failingStorage opens the filesystem storage but fails all operations on blobs.
+type failingStorage struct {
+	blob.Storage
+}
+
+func (failingStorage) GetBlob(context.Context, blob.ID, int64, int64, blob.OutputBuffer) error {
+	return errStorageFailure
+}
+
+func (failingStorage) GetMetadata(context.Context, blob.ID) (blob.Metadata, error) {
+	return blob.Metadata{}, errStorageFailure
+}
+
+func (failingStorage) ListBlobs(context.Context, blob.ID, func(blob.Metadata) error) error {
+	return errStorageFailure
+}
+
+func (failingStorage) PutBlob(context.Context, blob.ID, blob.Bytes, blob.PutOptions) error {
+	return errStorageFailure
+}
+
+func (failingStorage) DeleteBlob(context.Context, blob.ID) error {
+	return errStorageFailure
+}
+
+func init() {
+	blob.AddSupportedStorage(failingStorageType, filesystem.Options{}, func(ctx context.Context, o *filesystem.Options, isCreate bool) (blob.Storage, error) {
+		st, err := filesystem.New(ctx, o, isCreate)
+		if err != nil {
+			return nil, err
+		}
+
+		return failingStorage{st}, nil
+	})
+}
+
+// withFailingStorages returns a copy of the options, in which the specified storages fail.
+func withFailingStorages(opt *erasure.Options, indices ...int) *erasure.Options {
+	result := *opt
+	result.Storages = append([]blob.ConnectionInfo(nil), opt.Storages...)
+
+	for _, i := range indices {
+		result.Storages[i] = blob.ConnectionInfo{Type: failingStorageType, Config: opt.Storages[i].Config}
+	}
+
+	return &result
+}
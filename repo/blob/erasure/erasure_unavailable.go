@@ -0,0 +1,61 @@
+package erasure
+
+import (
+	"context"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// unavailableStorage stands in for a storage which could not be opened, failing all operations
+// so that its shards are treated as missing.
+type unavailableStorage struct {
+	err error
+}
+
+func (s unavailableStorage) GetBlob(context.Context, blob.ID, int64, int64, blob.OutputBuffer) error {
+	return s.err
+}
+
+func (s unavailableStorage) GetMetadata(context.Context, blob.ID) (blob.Metadata, error) {
+	return blob.Metadata{}, s.err
+}
+
+func (s unavailableStorage) ListBlobs(context.Context, blob.ID, func(blob.Metadata) error) error {
+	return s.err
+}
+
+func (s unavailableStorage) PutBlob(context.Context, blob.ID, blob.Bytes, blob.PutOptions) error {
+	return s.err
+}
+
+func (s unavailableStorage) DeleteBlob(context.Context, blob.ID) error {
+	return s.err
+}
+
+func (s unavailableStorage) ExtendBlobRetention(context.Context, blob.ID, blob.ExtendOptions) error {
+	return s.err
+}
+
+func (s unavailableStorage) GetCapacity(context.Context) (blob.Capacity, error) {
+	return blob.Capacity{}, s.err
+}
+
+func (s unavailableStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{}
+}
+
+func (s unavailableStorage) DisplayName() string {
+	return "unavailable"
+}
+
+func (s unavailableStorage) IsReadOnly() bool {
+	return false
+}
+
+func (s unavailableStorage) Close(context.Context) error {
+	return nil
+}
+
+func (s unavailableStorage) FlushCaches(context.Context) error {
+	return nil
+}
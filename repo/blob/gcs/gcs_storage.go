@@ -196,6 +196,20 @@ func (gcs *gcsStorage) ExtendBlobRetention(ctx context.Context, b blob.ID, opts
 	return nil
 }
 
+// GetRetention implements blob.RetentionReader.
+func (gcs *gcsStorage) GetRetention(ctx context.Context, b blob.ID) (blob.RetentionMode, time.Time, error) {
+	attrs, err := gcs.bucket.Object(gcs.getObjectNameString(b)).Attrs(ctx)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(translateError(err), "Attrs")
+	}
+
+	if attrs.Retention == nil {
+		return "", time.Time{}, nil
+	}
+
+	return blob.RetentionMode(attrs.Retention.Mode), attrs.Retention.RetainUntil, nil
+}
+
 func (gcs *gcsStorage) getObjectNameString(blobID blob.ID) string {
 	return gcs.Prefix + string(blobID)
 }
@@ -6,15 +6,11 @@
 	"errors"
 	"sync/atomic"
 
-	"go.opentelemetry.io/otel"
-
 	"github.com/kopia/kopia/internal/timetrack"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/logging"
 )
 
-var tracer = otel.Tracer("BlobStorage")
-
 type loggingStorage struct {
 	concurrency    atomic.Int32
 	maxConcurrency atomic.Int32
@@ -40,9 +36,6 @@ func (s *loggingStorage) endConcurrency() {
 }
 
 func (s *loggingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
-	ctx, span := tracer.Start(ctx, "GetBlob")
-	defer span.End()
-
 	s.beginConcurrency()
 	defer s.endConcurrency()
 
@@ -64,9 +57,6 @@ func (s *loggingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length
 }
 
 func (s *loggingStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
-	ctx, span := tracer.Start(ctx, "GetCapacity")
-	defer span.End()
-
 	timer := timetrack.StartTimer()
 	c, err := s.base.GetCapacity(ctx)
 	dt := timer.Elapsed()
@@ -86,10 +76,12 @@ func (s *loggingStorage) IsReadOnly() bool {
 	return s.base.IsReadOnly()
 }
 
-func (s *loggingStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
-	ctx, span := tracer.Start(ctx, "GetMetadata")
-	defer span.End()
+// Unwrap implements blob.Unwrapper.
+func (s *loggingStorage) Unwrap() blob.Storage {
+	return s.base
+}
 
+func (s *loggingStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
 	s.beginConcurrency()
 	defer s.endConcurrency()
 
@@ -109,9 +101,6 @@ func (s *loggingStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Meta
 }
 
 func (s *loggingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
-	ctx, span := tracer.Start(ctx, "PutBlob")
-	defer span.End()
-
 	s.beginConcurrency()
 	defer s.endConcurrency()
 
@@ -131,9 +120,6 @@ func (s *loggingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Byte
 }
 
 func (s *loggingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
-	ctx, span := tracer.Start(ctx, "DeleteBlob")
-	defer span.End()
-
 	s.beginConcurrency()
 	defer s.endConcurrency()
 
@@ -151,9 +137,6 @@ func (s *loggingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
 }
 
 func (s *loggingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
-	ctx, span := tracer.Start(ctx, "ListBlobs")
-	defer span.End()
-
 	s.beginConcurrency()
 	defer s.endConcurrency()
 
@@ -177,9 +160,6 @@ func (s *loggingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback
 }
 
 func (s *loggingStorage) Close(ctx context.Context) error {
-	ctx, span := tracer.Start(ctx, "Close")
-	defer span.End()
-
 	timer := timetrack.StartTimer()
 	err := s.base.Close(ctx)
 	dt := timer.Elapsed()
@@ -216,9 +196,6 @@ func (s *loggingStorage) FlushCaches(ctx context.Context) error {
 }
 
 func (s *loggingStorage) ExtendBlobRetention(ctx context.Context, b blob.ID, opts blob.ExtendOptions) error {
-	ctx, span := tracer.Start(ctx, "ExtendBlobRetention")
-	defer span.End()
-
 	s.beginConcurrency()
 	defer s.endConcurrency()
 
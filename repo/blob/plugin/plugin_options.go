@@ -0,0 +1,27 @@
+package plugin
+
+import (
+	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/repo/jsonencoding"
+)
+
+// Options defines options for storage provided by an external plugin.
+type Options struct {
+	// Name of the plugin, the plugin executable is named 'kopia-storage-<name>'.
+	Name string `json:"name"`
+
+	// Executable is the path to the plugin executable, when not specified the executable
+	// is looked up in the directories named by the PATH environment variable.
+	Executable string `json:"executable,omitempty"`
+
+	// Config is passed to the plugin when it starts.
+	Config map[string]string `json:"config,omitempty"`
+
+	// SecretConfig is merged into Config when passed to the plugin, it is not displayed to the user.
+	SecretConfig map[string]string `json:"secretConfig,omitempty" kopia:"sensitive"`
+
+	// StartupTimeout is the time to wait for the plugin to respond to the initial request.
+	StartupTimeout jsonencoding.Duration `json:"startupTimeout,omitempty"`
+
+	throttling.Limits
+}
@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// ProtocolVersion is the version of the plugin protocol.
+//
+// Kopia starts the plugin executable without arguments and exchanges messages with it over its
+// standard input and output. Each message is a JSON object on a single line, followed by
+// 'dataLength' bytes of raw data when the message carries blob contents. Anything the plugin
+// writes to standard error is logged by kopia.
+//
+// Each request has an 'id' and 'op', and the plugin must send the response with the same 'id'.
+// Requests may be sent before previous ones are answered, the plugin may process them
+// concurrently and respond in any order. Responses to 'list' requests are split into multiple
+// messages with 'more' set to true in all but the last one.
+//
+// Operations and their request fields:
+//
+//	init        - version, config, create; the first request, the response returns 'version'
+//	              and optionally 'displayName'
+//	get         - blobID, offset, length (-1 for the entire blob); the response carries the data
+//	getMetadata - blobID; the response returns 'blob'
+//	put         - blobID, setModTime, doNotRecreate; the request carries the data, the response
+//	              optionally returns 'blob' with the timestamp of the blob
+//	delete      - blobID
+//	list        - prefix; the responses return 'blobs'
+//	capacity    - the response returns 'capacity'
+//	close       - the plugin should respond and exit
+//
+// Failures are reported in 'error' with an optional 'errorCode': not-found, invalid-range,
+// already-exists, set-time-unsupported, invalid-credentials, unsupported or archived. Other
+// failures are considered transient and the requests are retried.
+const ProtocolVersion = 1
+
+// Operations of the plugin protocol.
+const (
+	OpInit        = "init"
+	OpGet         = "get"
+	OpGetMetadata = "getMetadata"
+	OpPut         = "put"
+	OpDelete      = "delete"
+	OpList        = "list"
+	OpCapacity    = "capacity"
+	OpClose       = "close"
+)
+
+// Error codes of the plugin protocol.
+const (
+	ErrorCodeNotFound           = "not-found"
+	ErrorCodeInvalidRange       = "invalid-range"
+	ErrorCodeAlreadyExists      = "already-exists"
+	ErrorCodeSetTimeUnsupported = "set-time-unsupported"
+	ErrorCodeInvalidCredentials = "invalid-credentials"
+	ErrorCodeUnsupported        = "unsupported"
+	ErrorCodeArchived           = "archived"
+)
+
+// Request is a request sent to the plugin.
+type Request struct {
+	ID            uint64            `json:"id"`
+	Op            string            `json:"op"`
+	Version       int               `json:"version,omitempty"`
+	Config        map[string]string `json:"config,omitempty"`
+	Create        bool              `json:"create,omitempty"`
+	BlobID        blob.ID           `json:"blobID,omitempty"`
+	Prefix        blob.ID           `json:"prefix,omitempty"`
+	Offset        int64             `json:"offset,omitempty"`
+	Length        int64             `json:"length,omitempty"`
+	SetModTime    *time.Time        `json:"setModTime,omitempty"`
+	DoNotRecreate bool              `json:"doNotRecreate,omitempty"`
+	DataLength    int               `json:"dataLength,omitempty"`
+}
+
+// Response is a response sent by the plugin.
+type Response struct {
+	ID          uint64          `json:"id"`
+	Error       string          `json:"error,omitempty"`
+	ErrorCode   string          `json:"errorCode,omitempty"`
+	More        bool            `json:"more,omitempty"`
+	Version     int             `json:"version,omitempty"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Blob        *blob.Metadata  `json:"blob,omitempty"`
+	Blobs       []blob.Metadata `json:"blobs,omitempty"`
+	Capacity    *blob.Capacity  `json:"capacity,omitempty"`
+	DataLength  int             `json:"dataLength,omitempty"`
+}
+
+// message is implemented by Request and Response.
+type message interface {
+	dataLength() int
+}
+
+func (r *Request) dataLength() int { return r.DataLength }
+
+func (r *Response) dataLength() int { return r.DataLength }
+
+var errorCodes = map[string]error{
+	ErrorCodeNotFound:           blob.ErrBlobNotFound,
+	ErrorCodeInvalidRange:       blob.ErrInvalidRange,
+	ErrorCodeAlreadyExists:      blob.ErrBlobAlreadyExists,
+	ErrorCodeSetTimeUnsupported: blob.ErrSetTimeUnsupported,
+	ErrorCodeInvalidCredentials: blob.ErrInvalidCredentials,
+	ErrorCodeUnsupported:        blob.ErrNotAVolume,
+	ErrorCodeArchived:           blob.ErrBlobArchived,
+}
+
+// responseError returns the error reported in the response.
+func responseError(resp *Response) error {
+	if resp.Error == "" && resp.ErrorCode == "" {
+		return nil
+	}
+
+	if err := errorCodes[resp.ErrorCode]; err != nil {
+		return errors.Wrap(err, resp.Error)
+	}
+
+	return errors.Errorf("plugin error: %v", resp.Error)
+}
+
+// setResponseError sets the error and the corresponding error code in the response.
+func setResponseError(resp *Response, err error) {
+	resp.Error = err.Error()
+
+	for code, e := range errorCodes {
+		if errors.Is(err, e) {
+			resp.ErrorCode = code
+		}
+	}
+}
+
+// writeMessage writes the JSON-encoded message followed by the data.
+func writeMessage(w io.Writer, msg any, data []byte) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal message")
+	}
+
+	b = append(b, '\n')
+
+	if _, err := w.Write(b); err != nil {
+		return errors.Wrap(err, "unable to write message")
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrap(err, "unable to write message data")
+	}
+
+	return nil
+}
+
+// readMessage reads the JSON-encoded message and returns the data which follows it.
+func readMessage(r *bufio.Reader, msg message) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read message")
+	}
+
+	if err := json.Unmarshal(line, msg); err != nil {
+		return nil, errors.Wrap(err, "invalid message")
+	}
+
+	n := msg.dataLength()
+	if n < 0 {
+		return nil, errors.New("invalid data length")
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errors.Wrap(err, "unable to read message data")
+	}
+
+	return data, nil
+}
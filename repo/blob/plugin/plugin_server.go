@@ -0,0 +1,209 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// listBatchSize is the maximum number of blobs returned in a single response to 'list' request.
+const listBatchSize = 1000
+
+// StorageFactory creates the storage served by the plugin given the configuration passed by kopia.
+type StorageFactory func(ctx context.Context, config map[string]string, isCreate bool) (blob.Storage, error)
+
+// Serve implements the plugin side of the protocol, serving requests read from r using the
+// storage returned by the factory and writing responses to w. It can be used to implement plugins
+// in Go by calling it with os.Stdin and os.Stdout from the main function of the plugin.
+func Serve(ctx context.Context, r io.Reader, w io.Writer, factory StorageFactory) error {
+	srv := &server{w: w}
+
+	return srv.run(ctx, bufio.NewReader(r), factory)
+}
+
+type server struct {
+	writeMu sync.Mutex
+	w       io.Writer
+
+	st blob.Storage
+}
+
+func (s *server) respond(resp *Response, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	resp.DataLength = len(data)
+
+	return writeMessage(s.w, resp, data)
+}
+
+func (s *server) run(ctx context.Context, r *bufio.Reader, factory StorageFactory) error {
+	var wg sync.WaitGroup
+
+	defer func() {
+		wg.Wait()
+
+		if s.st != nil {
+			s.st.Close(ctx) //nolint:errcheck
+		}
+	}()
+
+	for {
+		var req Request
+
+		data, err := readMessage(r, &req)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case req.Op == OpInit:
+			if err := s.init(ctx, &req, factory); err != nil {
+				return err
+			}
+
+		case s.st == nil:
+			if err := s.respond(&Response{ID: req.ID, Error: "plugin not initialized"}, nil); err != nil {
+				return err
+			}
+
+		case req.Op == OpClose:
+			wg.Wait()
+
+			return s.respond(&Response{ID: req.ID}, nil)
+
+		default:
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if err := s.handle(ctx, &req, data); err != nil {
+					log(ctx).Errorf("error sending response: %v", err)
+				}
+			}()
+		}
+	}
+}
+
+func (s *server) init(ctx context.Context, req *Request, factory StorageFactory) error {
+	resp := &Response{ID: req.ID, Version: ProtocolVersion}
+
+	if s.st != nil {
+		resp.Error = "plugin already initialized"
+
+		return s.respond(resp, nil)
+	}
+
+	st, err := factory(ctx, req.Config, req.Create)
+	if err != nil {
+		setResponseError(resp, err)
+	} else {
+		s.st = st
+		resp.DisplayName = st.DisplayName()
+	}
+
+	return s.respond(resp, nil)
+}
+
+// handle processes a single request and sends the responses.
+func (s *server) handle(ctx context.Context, req *Request, data []byte) error {
+	resp := &Response{ID: req.ID}
+
+	var (
+		out []byte
+		err error
+	)
+
+	switch req.Op {
+	case OpGet:
+		var tmp gather.WriteBuffer
+		defer tmp.Close()
+
+		if err = s.st.GetBlob(ctx, req.BlobID, req.Offset, req.Length, &tmp); err == nil {
+			out = tmp.ToByteSlice()
+		}
+
+	case OpGetMetadata:
+		var bm blob.Metadata
+
+		if bm, err = s.st.GetMetadata(ctx, req.BlobID); err == nil {
+			resp.Blob = &bm
+		}
+
+	case OpPut:
+		opts := blob.PutOptions{DoNotRecreate: req.DoNotRecreate}
+		bm := blob.Metadata{BlobID: req.BlobID, Length: int64(len(data))}
+
+		if req.SetModTime != nil {
+			opts.SetModTime = *req.SetModTime
+		}
+
+		opts.GetModTime = &bm.Timestamp
+
+		if err = s.st.PutBlob(ctx, req.BlobID, gather.FromSlice(data), opts); err == nil {
+			resp.Blob = &bm
+		}
+
+	case OpDelete:
+		err = s.st.DeleteBlob(ctx, req.BlobID)
+
+	case OpList:
+		return s.list(ctx, req)
+
+	case OpCapacity:
+		var c blob.Capacity
+
+		if c, err = s.st.GetCapacity(ctx); err == nil {
+			resp.Capacity = &c
+		}
+
+	default:
+		err = errors.Errorf("unsupported operation %q", req.Op)
+	}
+
+	if err != nil {
+		setResponseError(resp, err)
+	}
+
+	return s.respond(resp, out)
+}
+
+// list sends the blobs in batches.
+func (s *server) list(ctx context.Context, req *Request) error {
+	var batch []blob.Metadata
+
+	err := s.st.ListBlobs(ctx, req.Prefix, func(bm blob.Metadata) error {
+		batch = append(batch, bm)
+
+		if len(batch) < listBatchSize {
+			return nil
+		}
+
+		if err := s.respond(&Response{ID: req.ID, Blobs: batch, More: true}, nil); err != nil {
+			return err
+		}
+
+		batch = nil
+
+		return nil
+	})
+
+	resp := &Response{ID: req.ID, Blobs: batch}
+	if err != nil {
+		resp.Blobs = nil
+		setResponseError(resp, err)
+	}
+
+	return s.respond(resp, nil)
+}
@@ -0,0 +1,561 @@
+// Package plugin implements Storage provided by an external plugin executable, which
+// communicates with kopia using a simple protocol over its standard input and output.
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/osexec"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/retrying"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("plugin")
+
+const (
+	pluginStorageType = "plugin"
+
+	// ExecutablePrefix is the prefix of names of plugin executables.
+	ExecutablePrefix = "kopia-storage-"
+
+	defaultStartupTimeout = 30 * time.Second
+	closeTimeout          = 10 * time.Second
+)
+
+type pluginStorage struct {
+	Options
+	blob.DefaultProviderImplementation
+
+	exe         string
+	displayName string
+
+	procMu sync.Mutex
+	// +checklocks:procMu
+	proc *pluginProcess
+	// +checklocks:procMu
+	closed bool
+}
+
+// pluginProcess is a running instance of the plugin executable.
+type pluginProcess struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*pendingRequest
+	readErr error // set when the plugin output can no longer be read
+	exited  chan struct{}
+}
+
+func newPluginProcess() *pluginProcess {
+	return &pluginProcess{
+		pending: map[uint64]*pendingRequest{},
+		exited:  make(chan struct{}),
+	}
+}
+
+type pluginResponse struct {
+	resp Response
+	data []byte
+}
+
+// pendingRequest represents the request waiting for responses from the plugin.
+type pendingRequest struct {
+	responses chan pluginResponse
+	abandoned chan struct{} // closed when the caller no longer waits for responses
+}
+
+// readResponses dispatches responses from the plugin to pending requests until the output is closed.
+func (s *pluginProcess) readResponses(stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+
+	for {
+		var resp Response
+
+		data, err := readMessage(r, &resp)
+		if err != nil {
+			s.mu.Lock()
+			s.readErr = errors.Wrap(err, "plugin exited")
+
+			for _, p := range s.pending {
+				close(p.responses)
+			}
+
+			s.pending = map[uint64]*pendingRequest{}
+			s.mu.Unlock()
+
+			return
+		}
+
+		s.mu.Lock()
+		p := s.pending[resp.ID]
+		s.mu.Unlock()
+
+		if p == nil {
+			continue
+		}
+
+		select {
+		case p.responses <- pluginResponse{resp, data}:
+		case <-p.abandoned:
+		}
+	}
+}
+
+// failure returns the error which caused the plugin to stop responding, nil if it's running.
+func (s *pluginProcess) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readErr
+}
+
+// process returns the plugin process, restarting the plugin if it has exited.
+func (s *pluginStorage) process(ctx context.Context) (*pluginProcess, error) {
+	s.procMu.Lock()
+	defer s.procMu.Unlock()
+
+	err := s.proc.failure()
+	if err == nil || s.closed {
+		return s.proc, nil
+	}
+
+	log(ctx).Warnf("plugin %v stopped (%v), restarting", s.Name, err)
+
+	// the plugin may still be running if its output was invalid.
+	s.proc.kill()
+
+	p, _, err := s.startProcess(ctx, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to restart plugin %v", s.Name)
+	}
+
+	s.proc = p
+
+	return p, nil
+}
+
+// roundTrip sends the request to the plugin, restarting it first if it has exited.
+func (s *pluginStorage) roundTrip(ctx context.Context, req Request, data []byte, handle func(resp *Response, data []byte) error) error {
+	p, err := s.process(ctx)
+	if err != nil {
+		return err
+	}
+
+	return p.roundTrip(ctx, req, data, handle)
+}
+
+// roundTrip sends the request and invokes the handler for each response until the last one.
+func (s *pluginProcess) roundTrip(ctx context.Context, req Request, data []byte, handle func(resp *Response, data []byte) error) error {
+	p := &pendingRequest{
+		responses: make(chan pluginResponse),
+		abandoned: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	if s.readErr != nil {
+		s.mu.Unlock()
+		return s.readErr
+	}
+
+	s.nextID++
+	req.ID = s.nextID
+	s.pending[req.ID] = p
+	s.mu.Unlock()
+
+	defer func() {
+		close(p.abandoned)
+
+		s.mu.Lock()
+		delete(s.pending, req.ID)
+		s.mu.Unlock()
+	}()
+
+	req.DataLength = len(data)
+
+	s.writeMu.Lock()
+	err := writeMessage(s.stdin, req, data)
+	s.writeMu.Unlock()
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to send %v request to plugin", req.Op)
+	}
+
+	for {
+		select {
+		case r, ok := <-p.responses:
+			if !ok {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+
+				return s.readErr
+			}
+
+			if err := responseError(&r.resp); err != nil {
+				return err
+			}
+
+			if handle != nil {
+				if err := handle(&r.resp, r.data); err != nil {
+					return err
+				}
+			}
+
+			if !r.resp.More {
+				return nil
+			}
+
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "%v request canceled", req.Op)
+		}
+	}
+}
+
+func (s *pluginStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	if offset < 0 {
+		return blob.ErrInvalidRange
+	}
+
+	output.Reset()
+
+	if err := s.roundTrip(ctx, Request{Op: OpGet, BlobID: id, Offset: offset, Length: length}, nil, func(_ *Response, data []byte) error {
+		_, err := output.Write(data)
+
+		return errors.Wrap(err, "error writing output")
+	}); err != nil {
+		return err
+	}
+
+	//nolint:wrapcheck
+	return blob.EnsureLengthExactly(output.Length(), length)
+}
+
+func (s *pluginStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	var result blob.Metadata
+
+	if err := s.roundTrip(ctx, Request{Op: OpGetMetadata, BlobID: id}, nil, func(resp *Response, _ []byte) error {
+		if resp.Blob == nil {
+			return errors.New("plugin did not return blob metadata")
+		}
+
+		result = *resp.Blob
+		result.BlobID = id
+
+		return nil
+	}); err != nil {
+		return blob.Metadata{}, err
+	}
+
+	return result, nil
+}
+
+func (s *pluginStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if opts.HasRetentionOptions() {
+		return errors.Wrap(blob.ErrUnsupportedPutBlobOption, "blob-retention")
+	}
+
+	req := Request{Op: OpPut, BlobID: id, DoNotRecreate: opts.DoNotRecreate}
+
+	if !opts.SetModTime.IsZero() {
+		req.SetModTime = &opts.SetModTime
+	}
+
+	var buf bytes.Buffer
+
+	buf.Grow(data.Length())
+
+	if _, err := data.WriteTo(&buf); err != nil {
+		return errors.Wrap(err, "error reading blob")
+	}
+
+	var timestamp time.Time
+
+	if err := s.roundTrip(ctx, req, buf.Bytes(), func(resp *Response, _ []byte) error {
+		if resp.Blob != nil {
+			timestamp = resp.Blob.Timestamp
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if opts.GetModTime != nil {
+		if timestamp.IsZero() {
+			bm, err := s.GetMetadata(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			timestamp = bm.Timestamp
+		}
+
+		*opts.GetModTime = timestamp
+	}
+
+	return nil
+}
+
+func (s *pluginStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	err := s.roundTrip(ctx, Request{Op: OpDelete, BlobID: id}, nil, nil)
+	if errors.Is(err, blob.ErrBlobNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *pluginStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	return s.roundTrip(ctx, Request{Op: OpList, Prefix: prefix}, nil, func(resp *Response, _ []byte) error {
+		for _, bm := range resp.Blobs {
+			if err := callback(bm); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *pluginStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	var result blob.Capacity
+
+	if err := s.roundTrip(ctx, Request{Op: OpCapacity}, nil, func(resp *Response, _ []byte) error {
+		if resp.Capacity == nil {
+			return blob.ErrNotAVolume
+		}
+
+		result = *resp.Capacity
+
+		return nil
+	}); err != nil {
+		return blob.Capacity{}, err
+	}
+
+	return result, nil
+}
+
+func (s *pluginStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   pluginStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *pluginStorage) DisplayName() string {
+	if s.displayName != "" {
+		return "Plugin " + s.Name + ": " + s.displayName
+	}
+
+	return "Plugin " + s.Name
+}
+
+func (s *pluginStorage) Close(ctx context.Context) error {
+	s.procMu.Lock()
+	s.closed = true
+	p := s.proc
+	s.procMu.Unlock()
+
+	p.close(ctx)
+
+	return nil
+}
+
+// kill kills the current plugin process and waits for it to exit.
+func (s *pluginStorage) kill() {
+	s.procMu.Lock()
+	defer s.procMu.Unlock()
+
+	s.proc.kill()
+}
+
+// close asks the plugin to exit, killing it if it doesn't exit in time.
+func (s *pluginProcess) close(ctx context.Context) {
+	closeCtx, cancel := context.WithTimeout(ctx, closeTimeout)
+	defer cancel()
+
+	if err := s.roundTrip(closeCtx, Request{Op: OpClose}, nil, nil); err != nil {
+		log(ctx).Debugf("error closing plugin: %v", err)
+	}
+
+	s.stdin.Close() //nolint:errcheck
+
+	select {
+	case <-s.exited:
+	case <-closeCtx.Done():
+		log(ctx).Debugf("killing plugin")
+		s.kill()
+	}
+}
+
+// kill kills the plugin process and waits for it to exit.
+func (s *pluginProcess) kill() {
+	s.cmd.Process.Kill() //nolint:errcheck
+	<-s.exited
+}
+
+func executablePath(opt *Options) (string, error) {
+	if opt.Executable != "" {
+		return opt.Executable, nil
+	}
+
+	if opt.Name == "" {
+		return "", errors.New("plugin name must be specified")
+	}
+
+	p, err := exec.LookPath(ExecutablePrefix + opt.Name)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to find plugin %q", opt.Name)
+	}
+
+	return p, nil
+}
+
+func (s *pluginProcess) start(ctx context.Context, name, exe string) error {
+	s.cmd = exec.Command(exe) //nolint:gosec
+
+	// the plugin is stopped by closing its input.
+	osexec.DisableInterruptSignal(s.cmd)
+
+	var err error
+
+	if s.stdin, err = s.cmd.StdinPipe(); err != nil {
+		return errors.Wrap(err, "unable to create plugin input")
+	}
+
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrap(err, "unable to create plugin output")
+	}
+
+	stderr, err := s.cmd.StderrPipe()
+	if err != nil {
+		return errors.Wrap(err, "unable to create plugin error output")
+	}
+
+	if err := s.cmd.Start(); err != nil {
+		return errors.Wrapf(err, "unable to start plugin %v", exe)
+	}
+
+	log(ctx).Debugf("started plugin %v", exe)
+
+	outputDone := make(chan struct{})
+
+	go func() {
+		defer close(outputDone)
+
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			log(ctx).Debugf("[%v] %v", name, sc.Text())
+		}
+	}()
+
+	go func() {
+		s.readResponses(stdout)
+		<-outputDone
+		s.cmd.Wait() //nolint:errcheck
+		close(s.exited)
+	}()
+
+	return nil
+}
+
+// init initializes the plugin process and returns the display name of its storage.
+func (s *pluginStorage) init(ctx context.Context, p *pluginProcess, isCreate bool) (string, error) {
+	timeout := defaultStartupTimeout
+	if s.StartupTimeout.Duration != 0 {
+		timeout = s.StartupTimeout.Duration
+	}
+
+	initCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	config := maps.Clone(s.Config)
+	if config == nil {
+		config = map[string]string{}
+	}
+
+	maps.Copy(config, s.SecretConfig)
+
+	var displayName string
+
+	if err := p.roundTrip(initCtx, Request{Op: OpInit, Version: ProtocolVersion, Config: config, Create: isCreate}, nil, func(resp *Response, _ []byte) error {
+		if resp.Version != ProtocolVersion {
+			return errors.Errorf("unsupported plugin protocol version %v, expected %v", resp.Version, ProtocolVersion)
+		}
+
+		displayName = resp.DisplayName
+
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	return displayName, nil
+}
+
+// startProcess starts and initializes a new plugin process.
+func (s *pluginStorage) startProcess(ctx context.Context, isCreate bool) (*pluginProcess, string, error) {
+	p := newPluginProcess()
+
+	if err := p.start(ctx, s.Name, s.exe); err != nil {
+		return nil, "", err
+	}
+
+	displayName, err := s.init(ctx, p, isCreate)
+	if err != nil {
+		p.kill()
+
+		return nil, "", errors.Wrapf(err, "unable to initialize plugin %v", s.Name)
+	}
+
+	return p, displayName, nil
+}
+
+func newPluginStorage(ctx context.Context, opt *Options, isCreate bool) (*pluginStorage, error) {
+	exe, err := executablePath(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &pluginStorage{
+		Options: *opt,
+		exe:     exe,
+	}
+
+	p, displayName, err := s.startProcess(ctx, isCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	s.proc = p
+	s.displayName = displayName
+
+	return s, nil
+}
+
+// New creates new storage backed by an external plugin with specified options.
+func New(ctx context.Context, opt *Options, isCreate bool) (blob.Storage, error) {
+	s, err := newPluginStorage(ctx, opt, isCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	return retrying.NewWrapper(s), nil
+}
+
+func init() {
+	blob.AddSupportedStorage(pluginStorageType, Options{}, New)
+}
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+)
+
+// testPluginEnv is set when the test binary is started as a plugin.
+const testPluginEnv = "KOPIA_TEST_STORAGE_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testPluginEnv) != "" {
+		if err := Serve(context.Background(), os.Stdin, os.Stdout, func(ctx context.Context, config map[string]string, isCreate bool) (blob.Storage, error) {
+			return filesystem.New(ctx, &filesystem.Options{Path: config["path"]}, isCreate)
+		}); err != nil {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	os.Setenv(testPluginEnv, "1")
+
+	testutil.MyTestMain(m)
+}
+
+func TestPluginStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	// errors returned by the filesystem storage for invalid ranges are not retried there, use
+	// the storage without retrying wrapper to avoid waiting for retries.
+	st, err := newPluginStorage(ctx, &Options{
+		Name:       "test",
+		Executable: os.Args[0],
+		Config:     map[string]string{"path": testutil.TempDirectory(t)},
+	}, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+	require.Contains(t, st.DisplayName(), "Plugin test: Filesystem")
+}
+
+func TestPluginStorageDiscovery(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin discovery is not tested on Windows")
+	}
+
+	ctx := testlogging.Context(t)
+	binDir := testutil.TempDirectory(t)
+
+	require.NoError(t, os.Symlink(os.Args[0], filepath.Join(binDir, ExecutablePrefix+"test")))
+	t.Setenv("PATH", binDir)
+
+	st, err := New(ctx, &Options{
+		Name:   "test",
+		Config: map[string]string{"path": testutil.TempDirectory(t)},
+	}, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice([]byte{1, 2, 3, 4}), blob.PutOptions{}))
+	blobtesting.AssertListResults(ctx, t, st, "", "blob1")
+
+	_, err = New(ctx, &Options{Name: "no-such-plugin"}, true)
+	require.ErrorContains(t, err, `unable to find plugin "no-such-plugin"`)
+}
+
+func TestPluginStorageSecretConfig(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	st, err := New(ctx, &Options{
+		Name:         "test",
+		Executable:   os.Args[0],
+		SecretConfig: map[string]string{"path": testutil.TempDirectory(t)},
+	}, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	blobtesting.AssertListResults(ctx, t, st, "", "blob1")
+}
+
+func TestPluginStorageCrash(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	dir := testutil.TempDirectory(t)
+
+	s, err := newPluginStorage(ctx, &Options{
+		Name:       "test",
+		Executable: os.Args[0],
+		Config:     map[string]string{"path": dir},
+	}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, s.PutBlob(ctx, "blob1", gather.FromSlice([]byte{1, 2, 3, 4}), blob.PutOptions{}))
+
+	// the plugin is restarted on the next request.
+	s.kill()
+
+	blobtesting.AssertGetBlob(ctx, t, s, "blob1", []byte{1, 2, 3, 4})
+
+	// the plugin can't be initialized after the storage disappears, which is retried on the next request.
+	s.kill()
+	require.NoError(t, os.Rename(dir, dir+".moved"))
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.ErrorContains(t, s.GetBlob(ctx, "blob1", 0, -1, &tmp), "unable to restart plugin test")
+
+	require.NoError(t, os.Rename(dir+".moved", dir))
+	blobtesting.AssertGetBlob(ctx, t, s, "blob1", []byte{1, 2, 3, 4})
+
+	require.NoError(t, s.Close(ctx))
+
+	// no restarts after the storage is closed.
+	require.ErrorContains(t, s.GetBlob(ctx, "blob1", 0, -1, &tmp), "plugin exited")
+}
@@ -5,6 +5,7 @@
 	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -82,3 +83,38 @@ func TestConnectionInfo(t *testing.T) {
 		require.Error(t, json.NewDecoder(bytes.NewReader([]byte(tc))).Decode(&ci))
 	}
 }
+
+type myPITConfig struct {
+	PointInTime *time.Time `json:"pointInTime,omitempty"`
+}
+
+func (c *myPITConfig) SetPointInTime(t *time.Time) {
+	c.PointInTime = t
+}
+
+func TestConnectionInfoAtPointInTime(t *testing.T) {
+	blob.AddSupportedStorage("mystorage3", myConfig{}, func(c context.Context, mc *myConfig, isCreate bool) (blob.Storage, error) {
+		return &myStorage{cfg: mc}, nil
+	})
+
+	blob.AddSupportedStorage("mypitstorage", myPITConfig{}, func(c context.Context, mc *myPITConfig, isCreate bool) (blob.Storage, error) {
+		return nil, nil
+	})
+
+	_, err := blob.ConnectionInfoAtPointInTime(blob.ConnectionInfo{Type: "mystorage3", Config: &myConfig{}}, nil)
+	require.ErrorContains(t, err, "does not support point-in-time views")
+
+	pit := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	orig := &myPITConfig{}
+
+	ci, err := blob.ConnectionInfoAtPointInTime(blob.ConnectionInfo{Type: "mypitstorage", Config: orig}, &pit)
+	require.NoError(t, err)
+	require.Equal(t, &pit, ci.Config.(*myPITConfig).PointInTime)
+
+	// the original connection info is not modified.
+	require.Nil(t, orig.PointInTime)
+
+	ci, err = blob.ConnectionInfoAtPointInTime(ci, nil)
+	require.NoError(t, err)
+	require.Nil(t, ci.Config.(*myPITConfig).PointInTime)
+}
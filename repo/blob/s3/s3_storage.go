@@ -84,6 +84,9 @@ func (s *s3Storage) getBlobWithVersion(ctx context.Context, b blob.ID, version s
 	return blob.EnsureLengthExactly(output.Length(), length)
 }
 
+// defaultRehydrateDays is the number of days restored copies of archived objects remain available.
+const defaultRehydrateDays = 7
+
 func isInvalidCredentials(err error) bool {
 	return err != nil && strings.Contains(err.Error(), blob.InvalidCredentialsErrStr)
 }
@@ -96,6 +99,10 @@ func translateError(err error) error {
 	}
 
 	if errors.As(err, &me) {
+		if me.Code == "InvalidObjectState" {
+			return blob.ErrBlobArchived
+		}
+
 		switch me.StatusCode {
 		case http.StatusOK:
 			return nil
@@ -246,6 +253,67 @@ func (s *s3Storage) ExtendBlobRetention(ctx context.Context, b blob.ID, opts blo
 	return nil
 }
 
+// GetRetention implements blob.RetentionReader.
+func (s *s3Storage) GetRetention(ctx context.Context, b blob.ID) (blob.RetentionMode, time.Time, error) {
+	mode, retainUntilDate, err := s.cli.GetObjectRetention(ctx, s.BucketName, s.getObjectNameString(b), "")
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+			return "", time.Time{}, nil
+		}
+
+		return "", time.Time{}, errors.Wrap(translateError(err), "unable to get retention")
+	}
+
+	if mode == nil || retainUntilDate == nil {
+		return "", time.Time{}, nil
+	}
+
+	return blob.RetentionMode(*mode), *retainUntilDate, nil
+}
+
+// RehydrateBlob implements blob.Rehydrator.
+func (s *s3Storage) RehydrateBlob(ctx context.Context, b blob.ID, opts blob.RehydrateOptions) (bool, error) {
+	oi, err := s.cli.StatObject(ctx, s.BucketName, s.getObjectNameString(b), minio.StatObjectOptions{})
+	if err != nil {
+		return false, errors.Wrap(translateError(err), "StatObject")
+	}
+
+	if !isArchiveStorageClass(oi.StorageClass) {
+		return true, nil
+	}
+
+	if oi.Restore != nil {
+		// restore has already been requested, the temporary copy is readable once it completes.
+		return !oi.Restore.OngoingRestore, nil
+	}
+
+	req := minio.RestoreRequest{}
+
+	days := opts.Days
+	if days == 0 {
+		days = defaultRehydrateDays
+	}
+
+	req.SetDays(days)
+
+	tier := minio.TierStandard
+	if opts.Priority != "" {
+		tier = minio.TierType(opts.Priority)
+	}
+
+	req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: tier})
+
+	if err := s.cli.RestoreObject(ctx, s.BucketName, s.getObjectNameString(b), "", req); err != nil {
+		if minio.ToErrorResponse(err).Code == "RestoreAlreadyInProgress" {
+			return false, nil
+		}
+
+		return false, errors.Wrap(err, "unable to request restore")
+	}
+
+	return false, nil
+}
+
 func (s *s3Storage) getObjectNameString(b blob.ID) string {
 	return s.Prefix + string(b)
 }
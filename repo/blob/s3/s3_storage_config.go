@@ -24,9 +24,28 @@ type StorageConfig struct {
 	BlobOptions []PrefixAndStorageClass `json:"blobOptions,omitempty"`
 }
 
+// packBlobPrefix is the prefix of pack blobs with file contents, which are the only blobs
+// that may be stored in archive storage classes. Index and metadata blobs must remain readable at all times.
+const packBlobPrefix = "p"
+
 // Load loads the StorageConfig from the provided reader.
 func (p *StorageConfig) Load(r io.Reader) error {
-	return errors.Wrap(json.NewDecoder(r).Decode(p), "error parsing JSON")
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return errors.Wrap(err, "error parsing JSON")
+	}
+
+	return p.Validate()
+}
+
+// Validate validates the storage configuration.
+func (p *StorageConfig) Validate() error {
+	for _, o := range p.BlobOptions {
+		if isArchiveStorageClass(o.StorageClass) && !strings.HasPrefix(string(o.Prefix), packBlobPrefix) {
+			return errors.Errorf("storage class %v can only be used for blobs with prefix %q, not %q", o.StorageClass, packBlobPrefix, o.Prefix)
+		}
+	}
+
+	return nil
 }
 
 // Save saves the parameters to the provided writer.
@@ -43,3 +62,8 @@ func (p *StorageConfig) getStorageClassForBlobID(id blob.ID) string {
 
 	return ""
 }
+
+// isArchiveStorageClass returns true for storage classes of objects which must be restored before reading.
+func isArchiveStorageClass(storageClass string) bool {
+	return storageClass == "GLACIER" || storageClass == "DEEP_ARCHIVE"
+}
@@ -0,0 +1,21 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageConfigArchiveClasses(t *testing.T) {
+	var sc StorageConfig
+
+	require.NoError(t, sc.Load(strings.NewReader(`{"blobOptions":[{"prefix":"p","storageClass":"DEEP_ARCHIVE"},{"prefix":"q","storageClass":"STANDARD_IA"}]}`)))
+	require.Equal(t, "DEEP_ARCHIVE", sc.getStorageClassForBlobID("p1234"))
+	require.Equal(t, "STANDARD_IA", sc.getStorageClassForBlobID("q1234"))
+	require.Empty(t, sc.getStorageClassForBlobID("xn0_1234"))
+
+	// index and metadata blobs must remain readable.
+	require.ErrorContains(t, sc.Load(strings.NewReader(`{"blobOptions":[{"prefix":"q","storageClass":"GLACIER"}]}`)), `storage class GLACIER can only be used for blobs with prefix "p"`)
+	require.ErrorContains(t, sc.Load(strings.NewReader(`{"blobOptions":[{"prefix":"","storageClass":"DEEP_ARCHIVE"}]}`)), "storage class DEEP_ARCHIVE")
+}
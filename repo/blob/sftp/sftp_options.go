@@ -3,11 +3,15 @@
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/kopia/kopia/repo/blob/sharded"
 	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/repo/jsonencoding"
 )
 
+const defaultKeepaliveInterval = 30 * time.Second
+
 // Options defines options for sftp-backed storage.
 type Options struct {
 	Path string `json:"path"`
@@ -22,10 +26,25 @@ type Options struct {
 	KnownHostsFile string `json:"knownHostsFile,omitempty"`
 	KnownHostsData string `json:"knownHostsData,omitempty"`
 
+	// OpenSSH certificate of the private key, presented to servers trusting its certificate authority.
+	CertificateFile string `json:"certificateFile,omitempty"`
+	CertificateData string `json:"certificateData,omitempty"`
+
+	// UseAgent enables authentication with keys and certificates held by the SSH agent listening
+	// on SSH_AUTH_SOCK.
+	UseAgent bool `json:"useAgent,omitempty"`
+
 	ExternalSSH  bool   `json:"externalSSH"`
 	SSHCommand   string `json:"sshCommand,omitempty"` // default "ssh"
 	SSHArguments string `json:"sshArguments,omitempty"`
 
+	// MaxConnections is the maximum number of SSH connections used in parallel (default 1).
+	MaxConnections int `json:"maxConnections,omitempty"`
+
+	// KeepaliveInterval is the interval of keepalive messages, connections which do not respond
+	// within that time are re-established (default 30s).
+	KeepaliveInterval jsonencoding.Duration `json:"keepaliveInterval,omitempty"`
+
 	sharded.Options
 	throttling.Limits
 }
@@ -39,3 +58,19 @@ func (sftpo *Options) knownHostsFile() string {
 
 	return sftpo.KnownHostsFile
 }
+
+func (sftpo *Options) maxConnections() int {
+	if sftpo.MaxConnections <= 0 {
+		return 1
+	}
+
+	return sftpo.MaxConnections
+}
+
+func (sftpo *Options) keepaliveInterval() time.Duration {
+	if sftpo.KeepaliveInterval.Duration <= 0 {
+		return defaultKeepaliveInterval
+	}
+
+	return sftpo.KeepaliveInterval.Duration
+}
@@ -0,0 +1,405 @@
+package sftp_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	pkgsftp "github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/sftp"
+	"github.com/kopia/kopia/repo/jsonencoding"
+)
+
+// testSSHServer is an in-process SSH server providing the SFTP subsystem.
+type testSSHServer struct {
+	host           string
+	port           int
+	knownHostsFile string
+
+	// connections with index below this value do not respond to keepalives.
+	unresponsiveBelow atomic.Int32
+
+	connCount atomic.Int32
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (s *testSSHServer) serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	idx := s.connCount.Add(1)
+
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+
+	go func() {
+		for req := range reqs {
+			if idx <= s.unresponsiveBelow.Load() {
+				continue
+			}
+
+			if req.WantReply {
+				req.Reply(false, nil) //nolint:errcheck
+			}
+		}
+	}()
+
+	for nc := range chans {
+		ch, chreqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			for req := range chreqs {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil) //nolint:errcheck
+
+				if ok {
+					go func() {
+						defer ch.Close() //nolint:errcheck
+
+						if srv, err := pkgsftp.NewServer(ch); err == nil {
+							srv.Serve() //nolint:errcheck
+						}
+					}()
+				}
+			}
+		}()
+	}
+}
+
+// dropConnections closes all established connections on the server side.
+func (s *testSSHServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.conns {
+		c.Close() //nolint:errcheck
+	}
+
+	s.conns = nil
+}
+
+func startTestSSHServer(t *testing.T, config *ssh.ServerConfig) *testSSHServer {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+
+	config.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	host, portStr, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	s := &testSSHServer{
+		host:           host,
+		port:           port,
+		knownHostsFile: filepath.Join(testutil.TempDirectory(t), "known_hosts"),
+	}
+
+	require.NoError(t, os.WriteFile(s.knownHostsFile, []byte(knownhosts.Line([]string{knownhosts.Normalize(l.Addr().String())}, hostSigner.PublicKey())+"\n"), 0o600))
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serveConn(conn, config)
+		}
+	}()
+
+	t.Cleanup(func() {
+		l.Close()
+		s.dropConnections()
+	})
+
+	return s
+}
+
+func (s *testSSHServer) options(t *testing.T) sftp.Options {
+	t.Helper()
+
+	return sftp.Options{
+		Path:           testutil.TempDirectory(t),
+		Host:           s.host,
+		Port:           s.port,
+		Username:       "user",
+		KnownHostsFile: s.knownHostsFile,
+	}
+}
+
+func generateUserKey(t *testing.T) (ed25519.PrivateKey, string) {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	pb, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+
+	return key, string(pem.EncodeToMemory(pb))
+}
+
+func publicKeyAuth(allowed ...ssh.PublicKey) *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, k := range allowed {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return &ssh.Permissions{}, nil
+				}
+			}
+
+			return nil, errors.New("key not allowed")
+		},
+	}
+}
+
+func putAndVerifyBlob(t *testing.T, st blob.Storage) {
+	t.Helper()
+
+	ctx := testlogging.Context(t)
+
+	require.NoError(t, st.PutBlob(ctx, "blob1", gather.FromSlice([]byte{1, 2, 3, 4}), blob.PutOptions{}))
+	blobtesting.AssertGetBlob(ctx, t, st, "blob1", []byte{1, 2, 3, 4})
+}
+
+func TestSFTPStorageInProcessServer(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	key, keyData := generateUserKey(t)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	srv := startTestSSHServer(t, publicKeyAuth(signer.PublicKey()))
+
+	opt := srv.options(t)
+	opt.KeyData = keyData
+
+	st, err := sftp.New(ctx, &opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+}
+
+func TestSFTPStorageCertificateAuth(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	caSigner, err := ssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+
+	key, keyData := generateUserKey(t)
+	userSigner, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	cert := &ssh.Certificate{
+		Key:             userSigner.PublicKey(),
+		CertType:        ssh.UserCert,
+		KeyId:           "test",
+		ValidPrincipals: []string{"user"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, caSigner))
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), caSigner.PublicKey().Marshal())
+		},
+	}
+
+	// the server only accepts keys certified by the authority.
+	srv := startTestSSHServer(t, &ssh.ServerConfig{PublicKeyCallback: checker.Authenticate})
+
+	opt := srv.options(t)
+	opt.KeyData = keyData
+
+	_, err = sftp.New(ctx, &opt, true)
+	require.ErrorContains(t, err, "unable to authenticate")
+
+	certFile := filepath.Join(testutil.TempDirectory(t), "id_ed25519-cert.pub")
+	require.NoError(t, os.WriteFile(certFile, ssh.MarshalAuthorizedKey(cert), 0o600))
+
+	opt.CertificateFile = certFile
+
+	st, err := sftp.New(ctx, &opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	putAndVerifyBlob(t, st)
+
+	// certificate of another key.
+	_, otherKeyData := generateUserKey(t)
+	opt.KeyData = otherKeyData
+
+	_, err = sftp.New(ctx, &opt, true)
+	require.ErrorContains(t, err, "certificate does not match private key")
+}
+
+//nolint:paralleltest
+func TestSFTPStorageAgentAuth(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	key, _ := generateUserKey(t)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	srv := startTestSSHServer(t, publicKeyAuth(signer.PublicKey()))
+
+	opt := srv.options(t)
+	opt.UseAgent = true
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	_, err = sftp.New(ctx, &opt, true)
+	require.ErrorContains(t, err, "SSH_AUTH_SOCK is not set")
+
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: key}))
+
+	sock := filepath.Join(testutil.TempDirectory(t), "agent.sock")
+
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go agent.ServeAgent(keyring, conn) //nolint:errcheck
+		}
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	st, err := sftp.New(ctx, &opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	putAndVerifyBlob(t, st)
+}
+
+func TestSFTPStorageConnectionPool(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	key, keyData := generateUserKey(t)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	srv := startTestSSHServer(t, publicKeyAuth(signer.PublicKey()))
+
+	opt := srv.options(t)
+	opt.KeyData = keyData
+	opt.MaxConnections = 3
+
+	st, err := sftp.New(ctx, &opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	var eg errgroup.Group
+
+	for i := range 20 {
+		eg.Go(func() error {
+			return st.PutBlob(ctx, blob.ID("blob"+strconv.Itoa(i)), gather.FromSlice(bytes.Repeat([]byte{byte(i)}, 10000)), blob.PutOptions{})
+		})
+	}
+
+	require.NoError(t, eg.Wait())
+
+	// concurrent operations are spread across multiple connections.
+	require.Greater(t, srv.connCount.Load(), int32(1))
+	require.LessOrEqual(t, srv.connCount.Load(), int32(opt.MaxConnections))
+
+	// connections are re-established after failure.
+	srv.dropConnections()
+
+	blobtesting.AssertGetBlob(ctx, t, st, "blob5", bytes.Repeat([]byte{5}, 10000))
+}
+
+func TestSFTPStorageKeepalive(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	key, keyData := generateUserKey(t)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	srv := startTestSSHServer(t, publicKeyAuth(signer.PublicKey()))
+
+	// the first connection stops responding to keepalives.
+	srv.unresponsiveBelow.Store(1)
+
+	opt := srv.options(t)
+	opt.KeyData = keyData
+	opt.KeepaliveInterval = jsonencoding.Duration{Duration: 100 * time.Millisecond}
+
+	st, err := sftp.New(ctx, &opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	putAndVerifyBlob(t, st)
+
+	require.Eventually(t, func() bool {
+		_, err := st.GetMetadata(ctx, "blob1")
+
+		return err == nil && srv.connCount.Load() == 2
+	}, 10*time.Second, 100*time.Millisecond)
+}
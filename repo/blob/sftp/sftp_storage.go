@@ -11,10 +11,13 @@
 	"os/exec"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/crypto/ssh/knownhosts"
 
 	"github.com/kopia/kopia/internal/connection"
@@ -386,63 +389,191 @@ func getHostKeyCallback(opt *Options) (ssh.HostKeyCallback, error) {
 	return knownhosts.New(opt.knownHostsFile())
 }
 
-// getSigner parses and returns a signer for the user-entered private key.
-func getSigner(opt *Options) (ssh.Signer, error) {
+// getSigners parses and returns signers for the user-entered private key and its certificate.
+func getSigners(opt *Options) ([]ssh.Signer, error) {
 	if opt.Keyfile == "" && opt.KeyData == "" {
 		return nil, errors.New("must specify the location of the ssh server private key or the key data")
 	}
 
-	var privateKeyData []byte
+	privateKeyData, err := readDataOrFile(opt.KeyData, opt.Keyfile, "key file")
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading private key file")
+	}
 
-	if opt.KeyData != "" {
-		privateKeyData = []byte(opt.KeyData)
-	} else {
-		var err error
+	key, err := ssh.ParsePrivateKey(privateKeyData)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing private key")
+	}
 
-		if f := opt.Keyfile; !ospath.IsAbs(f) {
-			return nil, errors.New("key file path must be absolute")
-		}
+	if opt.CertificateFile == "" && opt.CertificateData == "" {
+		return []ssh.Signer{key}, nil
+	}
 
-		privateKeyData, err = os.ReadFile(opt.Keyfile)
-		if err != nil {
-			return nil, errors.Wrap(err, "error reading private key file")
-		}
+	certData, err := readDataOrFile(opt.CertificateData, opt.CertificateFile, "certificate file")
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading certificate file")
 	}
 
-	key, err := ssh.ParsePrivateKey(privateKeyData)
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(certData)
 	if err != nil {
-		return nil, errors.Wrap(err, "error parsing private key")
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("certificate file does not contain a certificate")
+	}
+
+	certSigner, err := ssh.NewCertSigner(cert, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "certificate does not match private key")
 	}
 
-	return key, nil
+	// offer the certificate first, servers not trusting its authority may still accept the key.
+	return []ssh.Signer{certSigner, key}, nil
 }
 
-func createSSHConfig(ctx context.Context, opt *Options) (*ssh.ClientConfig, error) {
+// readDataOrFile returns the provided data or the contents of the provided file if the data is empty.
+func readDataOrFile(data, fileName, desc string) ([]byte, error) {
+	if data != "" {
+		return []byte(data), nil
+	}
+
+	if !ospath.IsAbs(fileName) {
+		return nil, errors.Errorf("%v path must be absolute", desc)
+	}
+
+	//nolint:wrapcheck
+	return os.ReadFile(fileName) //nolint:gosec
+}
+
+// connectToAgent connects to the SSH agent listening on SSH_AUTH_SOCK.
+func connectToAgent() (agent.ExtendedAgent, io.Closer, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to connect to SSH agent")
+	}
+
+	return agent.NewClient(conn), conn, nil
+}
+
+// createSSHConfig returns the SSH client configuration and the function releasing resources
+// needed to establish the connection.
+func createSSHConfig(ctx context.Context, opt *Options) (*ssh.ClientConfig, func(), error) {
 	log(ctx).Debug("using internal SSH client")
 
 	hostKeyCallback, err := getHostKeyCallback(opt)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to getHostKey: %s", opt.Host)
+		return nil, nil, errors.Wrapf(err, "unable to getHostKey: %s", opt.Host)
 	}
 
-	var auth []ssh.AuthMethod
+	var (
+		auth    []ssh.AuthMethod
+		signers []ssh.Signer
+		cleanup = func() {}
+	)
 
 	if opt.Password != "" {
 		auth = append(auth, ssh.Password(opt.Password))
 	} else {
-		signer, err := getSigner(opt)
-		if err != nil {
-			return nil, errors.Wrapf(err, "unable to getSigner")
+		if opt.Keyfile != "" || opt.KeyData != "" || !opt.UseAgent {
+			signers, err = getSigners(opt)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "unable to getSigner")
+			}
 		}
 
-		auth = append(auth, ssh.PublicKeys(signer))
+		var agentClient agent.ExtendedAgent
+
+		if opt.UseAgent {
+			var closer io.Closer
+
+			agentClient, closer, err = connectToAgent()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			cleanup = func() { closer.Close() } //nolint:errcheck
+		}
+
+		// the client tries each authentication method once, so all keys must be provided by a single method.
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			if agentClient == nil {
+				return signers, nil
+			}
+
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to get keys from SSH agent")
+			}
+
+			return append(append([]ssh.Signer(nil), signers...), agentSigners...), nil
+		}))
 	}
 
 	return &ssh.ClientConfig{
 		User:            opt.Username,
 		Auth:            auth,
 		HostKeyCallback: hostKeyCallback,
-	}, nil
+	}, cleanup, nil
+}
+
+// startKeepalives periodically sends keepalive requests on the provided connection and closes it
+// when the server does not respond in time, causing it to be re-established.
+// It returns the function stopping the keepalives.
+func startKeepalives(ctx context.Context, conn ssh.Conn, interval time.Duration) func() {
+	done := make(chan struct{})
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-t.C:
+			}
+
+			replied := make(chan error, 1)
+
+			go func() {
+				_, _, err := conn.SendRequest("keepalive@openssh.com", true, nil)
+				replied <- err
+			}()
+
+			select {
+			case <-done:
+				return
+
+			case err := <-replied:
+				if err == nil {
+					continue
+				}
+
+				log(ctx).Debugf("keepalive failed: %v", err)
+
+			case <-time.After(interval):
+				log(ctx).Debug("keepalive timed out")
+			}
+
+			conn.Close() //nolint:errcheck
+
+			return
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
 }
 
 func getSFTPClientExternal(ctx context.Context, opt *Options) (*sftpConnection, error) {
@@ -452,6 +583,9 @@ func getSFTPClientExternal(ctx context.Context, opt *Options) (*sftpConnection,
 		cmdArgs = append(cmdArgs, strings.Split(opt.SSHArguments, " ")...)
 	}
 
+	// ssh uses the first value of each option, so this can be overridden in SSHArguments.
+	cmdArgs = append(cmdArgs, "-o", fmt.Sprintf("ServerAliveInterval=%d", int(opt.keepaliveInterval().Seconds())))
+
 	cmdArgs = append(
 		cmdArgs,
 		opt.Username+"@"+opt.Host,
@@ -513,11 +647,13 @@ func getSFTPClient(ctx context.Context, opt *Options) (*sftpConnection, error) {
 		return getSFTPClientExternal(ctx, opt)
 	}
 
-	config, err := createSSHConfig(ctx, opt)
+	config, cleanup, err := createSSHConfig(ctx, opt)
 	if err != nil {
 		return nil, err
 	}
 
+	defer cleanup()
+
 	addr := fmt.Sprintf("%s:%d", opt.Host, opt.Port)
 
 	conn, err := ssh.Dial("tcp", addr, config)
@@ -525,19 +661,28 @@ func getSFTPClient(ctx context.Context, opt *Options) (*sftpConnection, error) {
 		return nil, errors.Wrapf(err, "unable to dial [%s]: %#v", addr, config)
 	}
 
+	stopKeepalives := startKeepalives(context.WithoutCancel(ctx), conn, opt.keepaliveInterval())
+
 	c, err := sftp.NewClient(conn,
 		sftp.MaxPacket(packetSize),
 		sftp.UseConcurrentWrites(true),
 		sftp.UseConcurrentReads(true),
 	)
 	if err != nil {
+		stopKeepalives()
 		conn.Close() //nolint:errcheck
+
 		return nil, errors.Wrapf(err, "unable to create sftp client")
 	}
 
 	return &sftpConnection{
 		currentClient: c,
-		closeFunc:     conn.Close,
+		closeFunc: func() error {
+			stopKeepalives()
+
+			//nolint:wrapcheck
+			return conn.Close()
+		},
 	}, nil
 }
 
@@ -551,7 +696,7 @@ func New(ctx context.Context, opts *Options, isCreate bool) (blob.Storage, error
 		Storage: sharded.New(impl, opts.Path, opts.Options, isCreate),
 	}
 
-	impl.rec = connection.NewReconnector(impl)
+	impl.rec = connection.NewReconnectorPool(impl, opts.maxConnections())
 
 	conn, err := impl.rec.GetOrOpenConnection(ctx)
 	if err != nil {
@@ -0,0 +1,28 @@
+package smb
+
+import (
+	"github.com/kopia/kopia/repo/blob/sharded"
+	"github.com/kopia/kopia/repo/blob/throttling"
+)
+
+// Options defines options for SMB-backed storage.
+type Options struct {
+	Host string `json:"host"`
+	Port int    `json:"port,omitempty"` // default 445
+
+	// Share is the name of the SMB share.
+	Share string `json:"share"`
+
+	// Path is the path to the repository relative to the root of the share.
+	Path string `json:"path,omitempty"`
+
+	// NTLM credentials, if NTLMHash is specified, Password is ignored.
+	Username    string `json:"username"`
+	Password    string `json:"password,omitempty"    kopia:"sensitive"`
+	NTLMHash    string `json:"ntlmHash,omitempty"    kopia:"sensitive"` // hex-encoded NT hash of the password
+	Domain      string `json:"domain,omitempty"`
+	Workstation string `json:"workstation,omitempty"`
+
+	sharded.Options
+	throttling.Limits
+}
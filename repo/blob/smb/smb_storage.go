@@ -0,0 +1,600 @@
+// Package smb implements blob storage provider for SMB2/SMB3 (CIFS) shares.
+package smb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/hirochachacha/go-smb2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/connection"
+	"github.com/kopia/kopia/internal/dirutil"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/retrying"
+	"github.com/kopia/kopia/repo/blob/sharded"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("smb")
+
+const (
+	smbStorageType          = "smb"
+	defaultPort             = 445
+	tempFileRandomSuffixLen = 8
+
+	// suffix of the file holding previous contents of a file while it is being replaced.
+	replacedFileSuffix = ".replaced"
+
+	maxReplaceAttempts = 3
+)
+
+// smbStorage implements blob.Storage on top of SMB share.
+type smbStorage struct {
+	sharded.Storage
+	blob.DefaultProviderImplementation
+}
+
+type smbImpl struct {
+	Options
+
+	rec *connection.Reconnector
+}
+
+type smbConnection struct {
+	conn    net.Conn
+	session *smb2.Session
+	share   *smb2.Share
+}
+
+func (c *smbConnection) String() string {
+	return "SMB Connection"
+}
+
+func (c *smbConnection) Close() error {
+	if err := c.share.Umount(); err != nil {
+		log(context.Background()).Debugf("error unmounting SMB share: %v", err)
+	}
+
+	if err := c.session.Logoff(); err != nil {
+		log(context.Background()).Debugf("error logging off SMB session: %v", err)
+	}
+
+	if err := c.conn.Close(); err != nil {
+		return errors.Wrap(err, "error closing SMB connection")
+	}
+
+	return nil
+}
+
+func (s *smbImpl) NewConnection(ctx context.Context) (connection.Connection, error) {
+	return getSMBConnection(ctx, &s.Options)
+}
+
+func (s *smbImpl) IsConnectionClosedError(err error) bool {
+	var operr *net.OpError
+
+	if errors.As(err, &operr) {
+		if operr.Op == "dial" {
+			return true
+		}
+	}
+
+	var terr *smb2.TransportError
+
+	if errors.As(err, &terr) {
+		return true
+	}
+
+	return errors.Is(err, io.EOF)
+}
+
+func (s *smbStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	//nolint:forcetypeassert
+	impl := s.Impl.(*smbImpl)
+
+	return connection.UsingConnection(ctx, impl.rec, "GetCapacity", func(conn connection.Connection) (blob.Capacity, error) {
+		fi, err := shareFromConnection(conn).Statfs(impl.Path)
+		if err != nil {
+			return blob.Capacity{}, errors.Wrap(err, "GetCapacity")
+		}
+
+		return blob.Capacity{
+			SizeB: fi.BlockSize() * fi.TotalBlockCount(),
+			FreeB: fi.BlockSize() * fi.AvailableBlockCount(),
+		}, nil
+	})
+}
+
+func (s *smbImpl) GetBlobFromPath(ctx context.Context, dirPath, fullPath string, offset, length int64, output blob.OutputBuffer) error {
+	_ = dirPath
+
+	//nolint:wrapcheck
+	return s.rec.UsingConnectionNoResult(ctx, "GetBlobFromPath", func(conn connection.Connection) error {
+		f, err := withReplacedFallback(fullPath, shareFromConnection(conn).Open)
+		if errors.Is(err, os.ErrNotExist) {
+			return blob.ErrBlobNotFound
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "unrecognized error when opening SMB file %v", fullPath)
+		}
+
+		defer f.Close() //nolint:errcheck
+
+		if length < 0 {
+			// read entire blob
+			output.Reset()
+
+			//nolint:wrapcheck
+			return iocopy.JustCopy(output, f)
+		}
+
+		// partial read, seek to the provided offset and read given number of bytes.
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			return errors.Wrapf(blob.ErrInvalidRange, "seek error: %v", err)
+		}
+
+		if err := iocopy.JustCopy(output, io.LimitReader(f, length)); err != nil {
+			if errors.Is(err, io.EOF) {
+				return blob.ErrInvalidRange
+			}
+
+			return errors.Wrap(err, "read error")
+		}
+
+		//nolint:wrapcheck
+		return blob.EnsureLengthExactly(output.Length(), length)
+	})
+}
+
+func (s *smbImpl) GetMetadataFromPath(ctx context.Context, dirPath, fullPath string) (blob.Metadata, error) {
+	_ = dirPath
+
+	return connection.UsingConnection(ctx, s.rec, "GetMetadataFromPath", func(conn connection.Connection) (blob.Metadata, error) {
+		fi, err := withReplacedFallback(fullPath, shareFromConnection(conn).Stat)
+		if errors.Is(err, os.ErrNotExist) {
+			return blob.Metadata{}, blob.ErrBlobNotFound
+		}
+
+		if err != nil {
+			return blob.Metadata{}, errors.Wrapf(err, "unrecognized error when calling stat() on SMB file %v", fullPath)
+		}
+
+		return blob.Metadata{
+			Length:    fi.Size(),
+			Timestamp: fi.ModTime(),
+		}, nil
+	})
+}
+
+func (s *smbImpl) PutBlobInPath(ctx context.Context, dirPath, fullPath string, data blob.Bytes, opts blob.PutOptions) error {
+	_ = dirPath
+
+	switch {
+	case opts.HasRetentionOptions():
+		return errors.Wrap(blob.ErrUnsupportedPutBlobOption, "blob-retention")
+	case opts.DoNotRecreate:
+		return errors.Wrap(blob.ErrUnsupportedPutBlobOption, "do-not-recreate")
+	}
+
+	// each SMB write is a round-trip to the server, so we copy the data
+	// to a contiguous temporary buffer first to write it in large chunks.
+	contig := gather.NewWriteBufferMaxContiguous()
+	defer contig.Close()
+
+	if _, err := data.WriteTo(contig); err != nil {
+		return errors.Wrap(err, "can't write to contiguous buffer")
+	}
+
+	//nolint:wrapcheck
+	return s.rec.UsingConnectionNoResult(ctx, "PutBlobInPath", func(conn connection.Connection) error {
+		share := shareFromConnection(conn)
+
+		randSuffix := make([]byte, tempFileRandomSuffixLen)
+		if _, err := rand.Read(randSuffix); err != nil {
+			return errors.Wrap(err, "can't get random bytes")
+		}
+
+		tempFile := fmt.Sprintf("%s.tmp.%x", fullPath, randSuffix)
+
+		f, err := s.createTempFileAndDir(share, tempFile)
+		if err != nil {
+			return errors.Wrap(err, "cannot create temporary file")
+		}
+
+		if _, err = contig.Bytes().WriteTo(f); err != nil {
+			f.Close() //nolint:errcheck
+			s.removeTempFile(ctx, share, tempFile)
+
+			return errors.Wrap(err, "can't write temporary file")
+		}
+
+		if err = f.Close(); err != nil {
+			s.removeTempFile(ctx, share, tempFile)
+
+			return errors.Wrap(err, "can't close temporary file")
+		}
+
+		if err = renameReplacing(share, tempFile, fullPath); err != nil {
+			s.removeTempFile(ctx, share, tempFile)
+
+			return errors.Wrap(err, "unexpected error renaming file on SMB")
+		}
+
+		if t := opts.SetModTime; !t.IsZero() {
+			if chtimesErr := share.Chtimes(fullPath, t, t); chtimesErr != nil {
+				return errors.Wrap(chtimesErr, "can't change file times")
+			}
+		}
+
+		if t := opts.GetModTime; t != nil {
+			fi, err := share.Stat(fullPath)
+			if err != nil {
+				return errors.Wrap(err, "can't get mod time")
+			}
+
+			*t = fi.ModTime()
+		}
+
+		return nil
+	})
+}
+
+// fileRenamer is the subset of share operations used to replace files.
+type fileRenamer interface {
+	Rename(oldPath, newPath string) error
+	Remove(name string) error
+}
+
+// renameReplacing renames the file, replacing the target if it exists.
+//
+// SMB client only supports renames which fail if the target exists, so the existing
+// target is first moved aside to a backup file, which is removed once the new file is
+// in place. Until then, and if the process crashes in between, readers and listings
+// fall back to the backup file, so the target never appears to be missing.
+func renameReplacing(share fileRenamer, oldPath, newPath string) error {
+	backupPath := newPath + replacedFileSuffix
+
+	var (
+		err        error
+		movedAside bool
+	)
+
+	for range maxReplaceAttempts {
+		err = share.Rename(oldPath, newPath)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+
+		movedAside = true
+
+		if err = moveAside(share, newPath, backupPath); err != nil {
+			return err
+		}
+
+		err = share.Rename(oldPath, newPath)
+		if err == nil {
+			break
+		}
+
+		// restore the previous contents, unless another writer has replaced the target in the meantime.
+		if rerr := share.Rename(backupPath, newPath); rerr != nil && !errors.Is(rerr, os.ErrExist) && !errors.Is(rerr, os.ErrNotExist) {
+			return errors.Wrapf(rerr, "unable to restore %v after failed replacement: %v", newPath, err)
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+
+	if err != nil || !movedAside {
+		//nolint:wrapcheck
+		return err
+	}
+
+	// the target exists now, so the backup is no longer needed.
+	if err := share.Remove(backupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "unable to remove previous contents")
+	}
+
+	return nil
+}
+
+// moveAside renames the existing file to the backup path. A backup left behind by an interrupted
+// replacement is stale when the file itself exists and is overwritten.
+func moveAside(share fileRenamer, p, backupPath string) error {
+	err := share.Rename(p, backupPath)
+	if errors.Is(err, os.ErrExist) {
+		if err := share.Remove(backupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrap(err, "unable to remove stale backup")
+		}
+
+		err = share.Rename(p, backupPath)
+	}
+
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		// file removed or moved aside concurrently by another writer.
+		return nil
+	}
+
+	return errors.Wrap(err, "unable to move existing file aside")
+}
+
+// withReplacedFallback invokes the function for the provided path and if the file does not exist,
+// for the backup holding its previous contents while it is being replaced.
+func withReplacedFallback[T any](p string, f func(p string) (T, error)) (T, error) {
+	v, err := f(p)
+	if !errors.Is(err, os.ErrNotExist) {
+		return v, err
+	}
+
+	if bv, berr := f(p + replacedFileSuffix); berr == nil {
+		return bv, nil
+	}
+
+	return v, err
+}
+
+// replacedFileInfo presents a backup file under the name of the file being replaced.
+type replacedFileInfo struct {
+	os.FileInfo
+
+	name string
+}
+
+func (fi replacedFileInfo) Name() string {
+	return fi.name
+}
+
+// withReplacedEntries returns directory entries where backups of files being replaced
+// are listed under their original names if the files themselves are missing.
+func withReplacedEntries(entries []os.FileInfo) []os.FileInfo {
+	names := map[string]bool{}
+
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+
+	var result []os.FileInfo
+
+	for _, e := range entries {
+		orig, ok := strings.CutSuffix(e.Name(), replacedFileSuffix)
+		if !ok {
+			result = append(result, e)
+			continue
+		}
+
+		if !names[orig] {
+			result = append(result, replacedFileInfo{e, orig})
+		}
+	}
+
+	return result
+}
+
+func (s *smbImpl) removeTempFile(ctx context.Context, share *smb2.Share, tempFile string) {
+	if err := share.Remove(tempFile); err != nil {
+		log(ctx).Warnf("can't remove temp file: %v", err)
+	}
+}
+
+type osInterface struct {
+	share *smb2.Share
+}
+
+func (osInterface) IsExist(err error) bool {
+	return errors.Is(err, os.ErrExist)
+}
+
+func (osInterface) IsNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
+
+func (osInterface) IsPathSeparator(c byte) bool {
+	return c == '/'
+}
+
+func (osi osInterface) Mkdir(name string, perm os.FileMode) error {
+	//nolint:wrapcheck
+	return osi.share.Mkdir(name, perm)
+}
+
+func (s *smbImpl) createTempFileAndDir(share *smb2.Share, tempFile string) (*smb2.File, error) {
+	const (
+		flags = os.O_CREATE | os.O_WRONLY | os.O_EXCL
+		perm  = 0o600
+	)
+
+	f, err := share.OpenFile(tempFile, flags, perm)
+	if errors.Is(err, os.ErrNotExist) {
+		parentDir := path.Dir(tempFile)
+		if err = dirutil.MkSubdirAll(osInterface{share}, s.Path, parentDir, 0o700); err != nil {
+			return nil, errors.Wrap(err, "cannot create directory")
+		}
+
+		//nolint:wrapcheck
+		return share.OpenFile(tempFile, flags, perm)
+	}
+
+	return f, errors.Wrapf(err, "unrecognized error when creating temp file on SMB: %v", tempFile)
+}
+
+func (s *smbImpl) DeleteBlobInPath(ctx context.Context, dirPath, fullPath string) error {
+	_ = dirPath
+
+	//nolint:wrapcheck
+	return s.rec.UsingConnectionNoResult(ctx, "DeleteBlobInPath", func(conn connection.Connection) error {
+		// remove the backup first, so that it can't take the place of the deleted file.
+		if err := shareFromConnection(conn).Remove(fullPath + replacedFileSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "error deleting SMB file %v", fullPath+replacedFileSuffix)
+		}
+
+		err := shareFromConnection(conn).Remove(fullPath)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return errors.Wrapf(err, "error deleting SMB file %v", fullPath)
+	})
+}
+
+func (s *smbImpl) ReadDir(ctx context.Context, dirname string) ([]os.FileInfo, error) {
+	return connection.UsingConnection(ctx, s.rec, "ReadDir", func(conn connection.Connection) ([]os.FileInfo, error) {
+		entries, err := shareFromConnection(conn).ReadDir(dirname)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return withReplacedEntries(entries), nil
+	})
+}
+
+func (s *smbStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   smbStorageType,
+		Config: &s.Impl.(*smbImpl).Options, //nolint:forcetypeassert
+	}
+}
+
+func (s *smbStorage) DisplayName() string {
+	o := s.Impl.(*smbImpl).Options //nolint:forcetypeassert
+	return fmt.Sprintf("SMB \\\\%v\\%v", o.Host, o.Share)
+}
+
+func (s *smbStorage) Close(ctx context.Context) error {
+	s.Impl.(*smbImpl).rec.CloseActiveConnection(ctx) //nolint:forcetypeassert
+	return nil
+}
+
+// getInitiator returns the NTLM initiator for the provided credentials.
+// Kerberos is not supported, since go-smb2 does not allow initiators other than NTLM
+// to be implemented outside of the library.
+func getInitiator(opt *Options) (*smb2.NTLMInitiator, error) {
+	if opt.Username == "" {
+		return nil, errors.New("username must be specified")
+	}
+
+	ini := &smb2.NTLMInitiator{
+		User:        opt.Username,
+		Domain:      opt.Domain,
+		Workstation: opt.Workstation,
+	}
+
+	if opt.NTLMHash != "" {
+		h, err := hex.DecodeString(opt.NTLMHash)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid NTLM hash")
+		}
+
+		ini.Hash = h
+	} else {
+		ini.Password = opt.Password
+	}
+
+	return ini, nil
+}
+
+func getSMBConnection(ctx context.Context, opt *Options) (*smbConnection, error) {
+	ini, err := getInitiator(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	port := opt.Port
+	if port == 0 {
+		port = defaultPort
+	}
+
+	addr := net.JoinHostPort(opt.Host, strconv.Itoa(port))
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to dial [%s]", addr)
+	}
+
+	sd := &smb2.Dialer{Initiator: ini}
+
+	session, err := sd.DialContext(ctx, conn)
+	if err != nil {
+		conn.Close() //nolint:errcheck
+		return nil, errors.Wrapf(err, "unable to establish SMB session with [%s]", addr)
+	}
+
+	share, err := session.Mount(opt.Share)
+	if err != nil {
+		session.Logoff() //nolint:errcheck
+		conn.Close()     //nolint:errcheck
+
+		return nil, errors.Wrapf(err, "unable to mount SMB share %q", opt.Share)
+	}
+
+	return &smbConnection{
+		conn:    conn,
+		session: session,
+		share:   share,
+	}, nil
+}
+
+// New creates new SMB-backed storage in a specified share.
+func New(ctx context.Context, opts *Options, isCreate bool) (blob.Storage, error) {
+	if opts.Host == "" {
+		return nil, errors.New("host must be specified")
+	}
+
+	if opts.Share == "" {
+		return nil, errors.New("share must be specified")
+	}
+
+	impl := &smbImpl{
+		Options: *opts,
+	}
+
+	// paths are relative to the root of the share.
+	impl.Path = strings.Trim(strings.ReplaceAll(impl.Path, "\\", "/"), "/")
+
+	r := &smbStorage{
+		Storage: sharded.New(impl, impl.Path, opts.Options, isCreate),
+	}
+
+	impl.rec = connection.NewReconnector(impl)
+
+	conn, err := impl.rec.GetOrOpenConnection(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open SMB storage")
+	}
+
+	if impl.Path != "" {
+		if _, err := shareFromConnection(conn).Stat(impl.Path); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, errors.Wrapf(err, "path doesn't exist: %s", impl.Path)
+			}
+
+			if err = shareFromConnection(conn).MkdirAll(impl.Path, 0o700); err != nil {
+				return nil, errors.Wrap(err, "cannot create path")
+			}
+		}
+	}
+
+	return retrying.NewWrapper(r), nil
+}
+
+func shareFromConnection(conn connection.Connection) *smb2.Share {
+	return conn.(*smbConnection).share //nolint:forcetypeassert
+}
+
+func init() {
+	blob.AddSupportedStorage(smbStorageType, Options{}, New)
+}
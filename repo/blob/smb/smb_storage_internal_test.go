@@ -0,0 +1,160 @@
+package smb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// localRenamer emulates SMB semantics using local files: renames fail if the target exists.
+type localRenamer struct {
+	failRename func(oldPath, newPath string) error
+}
+
+func (r *localRenamer) Rename(oldPath, newPath string) error {
+	if r.failRename != nil {
+		if err := r.failRename(oldPath, newPath); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Lstat(newPath); err == nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+
+	return os.Rename(oldPath, newPath)
+}
+
+func (r *localRenamer) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func writeFile(t *testing.T, p, contents string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(p, []byte(contents), 0o600))
+}
+
+func readFile(t *testing.T, p string) string {
+	t.Helper()
+
+	b, err := withReplacedFallback(p, os.ReadFile)
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+func listNames(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var infos []os.FileInfo
+
+	for _, e := range entries {
+		fi, err := e.Info()
+		require.NoError(t, err)
+
+		infos = append(infos, fi)
+	}
+
+	var names []string
+
+	for _, fi := range withReplacedEntries(infos) {
+		names = append(names, fi.Name())
+	}
+
+	return names
+}
+
+func TestRenameReplacing(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "kopia.repository.f")
+	temp := filepath.Join(dir, "kopia.repository.f.tmp.1")
+
+	r := &localRenamer{}
+
+	// new file.
+	writeFile(t, temp, "v1")
+	require.NoError(t, renameReplacing(r, temp, target))
+	require.Equal(t, "v1", readFile(t, target))
+
+	// existing file is replaced and the backup removed.
+	writeFile(t, temp, "v2")
+	require.NoError(t, renameReplacing(r, temp, target))
+	require.Equal(t, "v2", readFile(t, target))
+	require.Equal(t, []string{"kopia.repository.f"}, listNames(t, dir))
+}
+
+func TestRenameReplacing_FailureRestoresPreviousContents(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "kopia.repository.f")
+	temp := filepath.Join(dir, "kopia.repository.f.tmp.1")
+
+	writeFile(t, target, "v1")
+	writeFile(t, temp, "v2")
+
+	someErr := errors.New("some error")
+	attempts := 0
+
+	r := &localRenamer{
+		failRename: func(oldPath, _ string) error {
+			if oldPath != temp {
+				return nil
+			}
+
+			// fail after the existing file has been moved aside.
+			if attempts++; attempts == 2 {
+				return someErr
+			}
+
+			return nil
+		},
+	}
+
+	require.ErrorIs(t, renameReplacing(r, temp, target), someErr)
+	require.Equal(t, "v1", readFile(t, target))
+	require.Equal(t, []string{"kopia.repository.f", "kopia.repository.f.tmp.1"}, listNames(t, dir))
+}
+
+func TestRenameReplacing_InterruptedReplacement(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "kopia.repository.f")
+	temp := filepath.Join(dir, "kopia.repository.f.tmp.1")
+
+	// crash after moving the existing file aside, before the new file was renamed.
+	writeFile(t, target+replacedFileSuffix, "v1")
+
+	// readers and listings see the previous contents.
+	require.Equal(t, "v1", readFile(t, target))
+	require.Equal(t, []string{"kopia.repository.f"}, listNames(t, dir))
+
+	fi, err := withReplacedFallback(target, os.Stat)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, fi.Size())
+
+	_, err = withReplacedFallback(filepath.Join(dir, "other.f"), os.Stat)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// the next replacement recovers.
+	writeFile(t, temp, "v2")
+	require.NoError(t, renameReplacing(&localRenamer{}, temp, target))
+	require.Equal(t, "v2", readFile(t, target))
+	require.Equal(t, []string{"kopia.repository.f"}, listNames(t, dir))
+
+	// stale backup next to the existing file is ignored and removed by the next replacement.
+	writeFile(t, target+replacedFileSuffix, "v1")
+	require.Equal(t, "v2", readFile(t, target))
+	require.Equal(t, []string{"kopia.repository.f"}, listNames(t, dir))
+
+	writeFile(t, temp, "v3")
+	require.NoError(t, renameReplacing(&localRenamer{}, temp, target))
+	require.Equal(t, "v3", readFile(t, target))
+
+	_, err = os.Stat(target + replacedFileSuffix)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
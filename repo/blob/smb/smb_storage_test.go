@@ -0,0 +1,157 @@
+package smb_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/providervalidation"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/smb"
+)
+
+const (
+	dockerImage  = "dperson/samba"
+	dialTimeout  = 30 * time.Second
+	smbShare     = "kopia"
+	smbUsername  = "kopia"
+	smbPassword  = "kopia-password"
+	smbWrongPass = "wrong-password"
+
+	// NT hash (MD4 of UTF-16LE) of smbPassword.
+	smbPasswordNTLMHash = "0199bb1a30676d17b0f38274ec98f59a"
+)
+
+func startDockerSambaServerOrSkip(t *testing.T) (host string, port int) {
+	t.Helper()
+
+	// see https://github.com/dperson/samba for instructions
+	shortContainerID := testutil.RunContainerAndKillOnCloseOrSkip(t,
+		"run", "--rm", "-p", "0:445", "-d", dockerImage,
+		"-u", smbUsername+";"+smbPassword,
+		"-s", smbShare+";/share;no;no;no;"+smbUsername,
+		"-p")
+	smbEndpoint := testutil.GetContainerMappedPortAddress(t, shortContainerID, "445")
+
+	h, p, err := net.SplitHostPort(smbEndpoint)
+	require.NoError(t, err)
+
+	port, err = strconv.Atoi(p)
+	require.NoError(t, err)
+
+	// wait for SMB server to come up and accept the credentials.
+	deadline := clock.Now().Add(dialTimeout)
+	for clock.Now().Before(deadline) {
+		t.Logf("waiting for SMB server to come up on '%v'...", smbEndpoint)
+
+		ctx := testlogging.Context(t)
+
+		st, err := smb.New(ctx, &smb.Options{
+			Host:     h,
+			Port:     port,
+			Share:    smbShare,
+			Username: smbUsername,
+			Password: smbPassword,
+		}, true)
+		if err != nil {
+			t.Logf("err: %v", err)
+			time.Sleep(time.Second)
+
+			continue
+		}
+
+		st.Close(ctx)
+
+		return h, port
+	}
+
+	t.Skipf("SMB server did not start!")
+
+	return "", 0
+}
+
+func TestSMBStorageValid(t *testing.T) {
+	t.Parallel()
+
+	testutil.SkipTestOnCIUnlessLinuxAMD64(t)
+
+	host, port := startDockerSambaServerOrSkip(t)
+
+	cases := map[string]smb.Options{
+		"Password": {Password: smbPassword},
+		"NTLMHash": {Password: smbWrongPass, NTLMHash: smbPasswordNTLMHash},
+	}
+
+	for name, creds := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := testlogging.Context(t)
+
+			// use context that gets canceled after opening storage to ensure it's not used beyond New().
+			newctx, cancel := context.WithCancel(ctx)
+
+			st, err := smb.New(newctx, &smb.Options{
+				Host:     host,
+				Port:     port,
+				Share:    smbShare,
+				Path:     "repo-" + name + "/nested",
+				Username: smbUsername,
+				Password: creds.Password,
+				NTLMHash: creds.NTLMHash,
+			}, true)
+			require.NoError(t, err)
+
+			cancel()
+
+			defer st.Close(ctx)
+
+			blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+			blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+			require.NoError(t, providervalidation.ValidateProvider(ctx, st, blobtesting.TestValidationOptions))
+
+			c, err := st.GetCapacity(ctx)
+			require.NoError(t, err)
+			require.NotZero(t, c.SizeB)
+		})
+	}
+}
+
+func TestSMBStorageInvalidCredentials(t *testing.T) {
+	t.Parallel()
+
+	testutil.SkipTestOnCIUnlessLinuxAMD64(t)
+
+	host, port := startDockerSambaServerOrSkip(t)
+	ctx := testlogging.Context(t)
+
+	_, err := smb.New(ctx, &smb.Options{
+		Host:     host,
+		Port:     port,
+		Share:    smbShare,
+		Username: smbUsername,
+		Password: smbWrongPass,
+	}, true)
+	require.Error(t, err)
+}
+
+func TestSMBStorageInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	_, err := smb.New(ctx, &smb.Options{Share: smbShare, Username: smbUsername}, true)
+	require.ErrorContains(t, err, "host must be specified")
+
+	_, err = smb.New(ctx, &smb.Options{Host: "localhost", Username: smbUsername}, true)
+	require.ErrorContains(t, err, "share must be specified")
+
+	_, err = smb.New(ctx, &smb.Options{Host: "localhost", Share: smbShare, Username: smbUsername, NTLMHash: "not-hex"}, true)
+	require.ErrorContains(t, err, "invalid NTLM hash")
+}
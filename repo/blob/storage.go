@@ -45,6 +45,10 @@
 // function on a storage implementation that does not have the intended functionality.
 var ErrUnsupportedObjectLock = errors.New("object locking unsupported")
 
+// ErrBlobArchived is returned when reading a blob stored in an archive tier, which must be
+// rehydrated before it can be read.
+var ErrBlobArchived = errors.New("BLOB is archived and must be rehydrated before reading")
+
 // Bytes encapsulates a sequence of bytes, possibly stored in a non-contiguous buffers,
 // which can be written sequentially or treated as a io.Reader.
 type Bytes interface {
@@ -222,6 +226,58 @@ type Storage interface {
 	IsReadOnly() bool
 }
 
+// RetentionReader is implemented by storage providers which can report retention (object lock)
+// settings of individual blobs.
+type RetentionReader interface {
+	// GetRetention returns the retention mode and the time until which the blob is retained,
+	// or an empty mode and zero time if the blob is not locked.
+	GetRetention(ctx context.Context, blobID ID) (RetentionMode, time.Time, error)
+}
+
+// Unwrapper is implemented by storage wrappers, which gives access to optional interfaces,
+// such as RetentionReader or Rehydrator, implemented by the wrapped storage.
+type Unwrapper interface {
+	// Unwrap returns the wrapped storage.
+	Unwrap() Storage
+}
+
+// As returns the first storage in the chain of wrappers starting at st, which implements T.
+func As[T any](st Storage) (T, bool) {
+	for st != nil {
+		if v, ok := st.(T); ok {
+			return v, true
+		}
+
+		u, ok := st.(Unwrapper)
+		if !ok {
+			break
+		}
+
+		st = u.Unwrap()
+	}
+
+	var zero T
+
+	return zero, false
+}
+
+// RehydrateOptions represents options for rehydrating archived blobs.
+type RehydrateOptions struct {
+	// Days is the number of days the rehydrated copy remains readable, for providers which
+	// keep the archived blob and create a temporary copy.
+	Days int
+
+	// Priority is the provider-specific rehydration priority, empty means the default.
+	Priority string
+}
+
+// Rehydrator is implemented by storage providers which can store blobs in archive tiers.
+type Rehydrator interface {
+	// RehydrateBlob requests an archived blob to be made readable and returns true if the blob
+	// can be read now. It is safe to call repeatedly while the rehydration is in progress.
+	RehydrateBlob(ctx context.Context, blobID ID, opts RehydrateOptions) (bool, error)
+}
+
 // ID is a string that represents blob identifier.
 type ID string
 
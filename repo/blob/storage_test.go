@@ -12,6 +12,8 @@
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/retrying"
+	"github.com/kopia/kopia/repo/blob/tracing"
 )
 
 func TestListAllBlobs(t *testing.T) {
@@ -202,3 +204,18 @@ func TestPutBlobAndGetMetadata(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, fixedTime, bm.Timestamp)
 }
+
+func TestAs(t *testing.T) {
+	st := blobtesting.NewVersionedMapStorage(nil)
+	wrapped := tracing.NewWrapper(retrying.NewWrapper(st))
+
+	rr, ok := blob.As[blob.RetentionReader](wrapped)
+	require.True(t, ok)
+	require.Equal(t, st, rr)
+
+	_, ok = blob.As[blob.Rehydrator](wrapped)
+	require.False(t, ok)
+
+	_, ok = blob.As[blob.RetentionReader](blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+	require.False(t, ok)
+}
@@ -80,6 +80,11 @@ func (s *blobMetrics) IsReadOnly() bool {
 	return s.base.IsReadOnly()
 }
 
+// Unwrap implements blob.Unwrapper.
+func (s *blobMetrics) Unwrap() blob.Storage {
+	return s.base
+}
+
 func (s *blobMetrics) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
 	timer := timetrack.StartTimer()
 	result, err := s.base.GetMetadata(ctx, id)
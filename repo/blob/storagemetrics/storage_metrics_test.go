@@ -286,3 +286,44 @@ func requireCounterValue(t *testing.T, snap metrics.Snapshot, key string, want i
 	require.True(t, ok)
 	require.Equal(t, want, v)
 }
+
+func TestStorageMetrics_Usage(t *testing.T) {
+	ctx := testlogging.Context(t)
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	mr := metrics.NewRegistry()
+	ms := storagemetrics.NewWrapper(st, mr)
+
+	require.NoError(t, ms.PutBlob(ctx, "someBlob", gather.FromSlice([]byte{1, 2, 3, 4}), blob.PutOptions{}))
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, ms.GetBlob(ctx, "someBlob", 0, -1, &tmp))
+	require.NoError(t, ms.GetBlob(ctx, "someBlob", 1, 2, &tmp))
+
+	_, err := ms.GetMetadata(ctx, "someBlob")
+	require.NoError(t, err)
+
+	require.NoError(t, ms.ListBlobs(ctx, "", func(blob.Metadata) error { return nil }))
+	require.NoError(t, ms.DeleteBlob(ctx, "someBlob"))
+
+	u := storagemetrics.UsageFromSnapshot(mr.Snapshot(false))
+	require.Equal(t, map[string]int64{
+		storagemetrics.RequestGetBlob:     2,
+		storagemetrics.RequestGetMetadata: 1,
+		storagemetrics.RequestPutBlob:     1,
+		storagemetrics.RequestDeleteBlob:  1,
+		storagemetrics.RequestListBlobs:   1,
+	}, u.Requests)
+	require.EqualValues(t, 1, u.ListedItems)
+	require.EqualValues(t, 6, u.DownloadedBytes)
+	require.EqualValues(t, 4, u.UploadedBytes)
+
+	var total storagemetrics.Usage
+
+	total.Add(u)
+	total.Add(u)
+	require.EqualValues(t, 4, total.Requests[storagemetrics.RequestGetBlob])
+	require.EqualValues(t, 8, total.UploadedBytes)
+}
@@ -0,0 +1,68 @@
+package storagemetrics
+
+import (
+	"time"
+
+	"github.com/kopia/kopia/internal/metrics"
+)
+
+// Names of storage requests counted in Usage.
+const (
+	RequestGetBlob     = "GetBlob"
+	RequestGetMetadata = "GetMetadata"
+	RequestPutBlob     = "PutBlob"
+	RequestDeleteBlob  = "DeleteBlob"
+	RequestListBlobs   = "ListBlobs"
+)
+
+// Usage summarizes usage of the storage, typically billed by cloud storage providers.
+type Usage struct {
+	Since           time.Time        `json:"since"`
+	Requests        map[string]int64 `json:"requests"`
+	ListedItems     int64            `json:"listedItems"`
+	DownloadedBytes int64            `json:"downloadedBytes"`
+	UploadedBytes   int64            `json:"uploadedBytes"`
+}
+
+// Add adds the provided usage to the receiver.
+func (u *Usage) Add(other Usage) {
+	if u.Since.IsZero() || (!other.Since.IsZero() && other.Since.Before(u.Since)) {
+		u.Since = other.Since
+	}
+
+	if u.Requests == nil {
+		u.Requests = map[string]int64{}
+	}
+
+	for k, v := range other.Requests {
+		u.Requests[k] += v
+	}
+
+	u.ListedItems += other.ListedItems
+	u.DownloadedBytes += other.DownloadedBytes
+	u.UploadedBytes += other.UploadedBytes
+}
+
+// UsageFromSnapshot returns storage usage recorded in the metrics snapshot by the wrapper returned by NewWrapper.
+func UsageFromSnapshot(s metrics.Snapshot) Usage {
+	requestCount := func(method string) int64 {
+		if d := s.DurationDistributions["blob_storage_latency[method:"+method+"]"]; d != nil {
+			return d.Count
+		}
+
+		return 0
+	}
+
+	return Usage{
+		Requests: map[string]int64{
+			RequestGetBlob:     requestCount("GetBlob-partial") + requestCount("GetBlob-full"),
+			RequestGetMetadata: requestCount("GetMetadata"),
+			RequestPutBlob:     requestCount("PutBlob"),
+			RequestDeleteBlob:  requestCount("DeleteBlob"),
+			RequestListBlobs:   requestCount("ListBlobs"),
+		},
+		ListedItems:     s.Counters["blob_list_items"],
+		DownloadedBytes: s.Counters["blob_download_partial_blob_bytes"] + s.Counters["blob_download_full_blob_bytes"],
+		UploadedBytes:   s.Counters["blob_upload_bytes"],
+	}
+}
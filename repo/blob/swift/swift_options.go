@@ -0,0 +1,43 @@
+package swift
+
+import "github.com/kopia/kopia/repo/blob/throttling"
+
+// Options defines options for OpenStack Swift-based storage.
+type Options struct {
+	// Container is the name of the container where data is stored.
+	Container string `json:"container"`
+
+	// Prefix specifies additional string to prepend to all objects.
+	Prefix string `json:"prefix,omitempty"`
+
+	// AuthURL is the URL of the Keystone v3 identity service, such as https://keystone:5000/v3.
+	AuthURL string `json:"authURL"`
+
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"   kopia:"sensitive"`
+	UserDomain string `json:"userDomain,omitempty"`
+
+	// Application credentials are used instead of username and password when specified.
+	ApplicationCredentialID     string `json:"applicationCredentialID,omitempty"`
+	ApplicationCredentialSecret string `json:"applicationCredentialSecret,omitempty" kopia:"sensitive"`
+
+	ProjectName   string `json:"projectName,omitempty"`
+	ProjectID     string `json:"projectID,omitempty"`
+	ProjectDomain string `json:"projectDomain,omitempty"`
+
+	// Region selects the Swift endpoint from the service catalog, the first one is used if empty.
+	Region string `json:"region,omitempty"`
+
+	// EndpointType selects the interface of the Swift endpoint: public (default), internal or admin.
+	EndpointType string `json:"endpointType,omitempty"`
+
+	// SegmentSize is the maximum size of a single object, larger blobs are stored as
+	// static large objects with segments of this size in SegmentContainer.
+	SegmentSize int64 `json:"segmentSize,omitempty"`
+
+	// SegmentContainer is the name of the container where segments of large objects are stored,
+	// defaults to Container with "_segments" suffix.
+	SegmentContainer string `json:"segmentContainer,omitempty"`
+
+	throttling.Limits
+}
@@ -0,0 +1,501 @@
+// Package swift implements Storage based on an OpenStack Swift container.
+package swift
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/retrying"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("swift")
+
+const (
+	swiftStorageType = "swift"
+
+	// DefaultSegmentSize is the default maximum size of a single object, Swift rejects
+	// objects larger than 5 GiB by default.
+	DefaultSegmentSize = 1 << 30
+
+	segmentContainerSuffix = "_segments"
+	segmentRandomLen       = 8
+	contentType            = "application/octet-stream"
+	maxIdleConnsPerHost    = 512
+)
+
+type swiftStorage struct {
+	Options
+	blob.DefaultProviderImplementation
+
+	transport http.RoundTripper
+
+	authMu sync.Mutex
+	// +checklocks:authMu
+	storageURL string
+	// +checklocks:authMu
+	authToken string
+	// +checklocks:authMu
+	authExpires time.Time
+}
+
+// contextTransport binds requests issued by the swift library, which is not context-aware,
+// to the context of the storage operation.
+//
+// TODO: switch to github.com/ncw/swift/v2, which accepts a context on every call, and remove
+// contextTransport along with per-operation connections.
+type contextTransport struct {
+	ctx    context.Context //nolint:containedctx
+	cancel context.CancelFunc
+	base   http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx)) //nolint:wrapcheck
+}
+
+// CancelRequest is invoked by the swift library when a request times out.
+func (t *contextTransport) CancelRequest(_ *http.Request) {
+	t.cancel()
+}
+
+// CloseIdleConnections is invoked by the swift library when authenticating.
+func (t *contextTransport) CloseIdleConnections() {
+	if tr, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// connection returns a connection whose requests are bound to the provided context, which
+// must be released by calling the returned function. Authentication tokens are shared
+// between connections.
+func (s *swiftStorage) connection(ctx context.Context) (*swift.Connection, func(), error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c := newConnection(&s.Options)
+	c.Transport = &contextTransport{ctx, cancel, s.transport}
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+
+	c.StorageUrl, c.AuthToken, c.Expires = s.storageURL, s.authToken, s.authExpires
+
+	if !c.Authenticated() {
+		if err := c.Authenticate(); err != nil {
+			cancel()
+
+			return nil, nil, errors.Wrap(translateError(err), "unable to authenticate")
+		}
+
+		s.storageURL, s.authToken, s.authExpires = c.StorageUrl, c.AuthToken, c.Expires
+	}
+
+	return c, func() {
+		cancel()
+
+		// the connection re-authenticates when the token gets rejected, keep the new one.
+		s.authMu.Lock()
+		defer s.authMu.Unlock()
+
+		if c.Authenticated() {
+			s.storageURL, s.authToken, s.authExpires = c.StorageUrl, c.AuthToken, c.Expires
+		}
+	}, nil
+}
+
+func (s *swiftStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	if offset < 0 {
+		return blob.ErrInvalidRange
+	}
+
+	output.Reset()
+
+	c, done, err := s.connection(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer done()
+
+	objectName := s.getObjectNameString(id)
+
+	if length == 0 {
+		// zero-length reads only verify that the object exists.
+		_, _, err := c.Object(s.Container, objectName)
+
+		return translateError(err)
+	}
+
+	h := swift.Headers{}
+
+	if length > 0 {
+		h["Range"] = fmt.Sprintf("bytes=%v-%v", offset, offset+length-1)
+	}
+
+	f, _, err := c.ObjectOpen(s.Container, objectName, false, h)
+	if err != nil {
+		return translateError(err)
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	if err := iocopy.JustCopy(output, f); err != nil {
+		return translateError(err)
+	}
+
+	//nolint:wrapcheck
+	return blob.EnsureLengthExactly(output.Length(), length)
+}
+
+func (s *swiftStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	c, done, err := s.connection(ctx)
+	if err != nil {
+		return blob.Metadata{}, err
+	}
+
+	defer done()
+
+	info, _, err := c.Object(s.Container, s.getObjectNameString(id))
+	if err != nil {
+		return blob.Metadata{}, translateError(err)
+	}
+
+	return blob.Metadata{
+		BlobID:    id,
+		Length:    info.Bytes,
+		Timestamp: info.LastModified,
+	}, nil
+}
+
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var se *swift.Error
+	if errors.As(err, &se) {
+		switch se.StatusCode {
+		case http.StatusNotFound:
+			return blob.ErrBlobNotFound
+
+		case http.StatusRequestedRangeNotSatisfiable:
+			return blob.ErrInvalidRange
+
+		case http.StatusUnauthorized:
+			return blob.ErrInvalidCredentials
+		}
+	}
+
+	return err
+}
+
+func (s *swiftStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	switch {
+	case opts.HasRetentionOptions():
+		return errors.Wrap(blob.ErrUnsupportedPutBlobOption, "blob-retention")
+	case opts.DoNotRecreate:
+		return errors.Wrap(blob.ErrUnsupportedPutBlobOption, "do-not-recreate")
+	}
+
+	if !opts.SetModTime.IsZero() {
+		return blob.ErrSetTimeUnsupported
+	}
+
+	c, done, err := s.connection(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer done()
+
+	objectName := s.getObjectNameString(id)
+
+	// segments of the large object being replaced are no longer referenced after the upload.
+	oldSegmentContainer, oldSegments, err := c.LargeObjectGetSegments(s.Container, objectName)
+	if err != nil && !errors.Is(err, swift.NotLargeObject) && !errors.Is(err, swift.ObjectNotFound) {
+		return errors.Wrap(translateError(err), "unable to determine existing segments")
+	}
+
+	if int64(data.Length()) > s.segmentSize() {
+		err = s.putLargeObject(ctx, c, objectName, data)
+	} else {
+		r := data.Reader()
+		defer r.Close() //nolint:errcheck
+
+		_, err = c.ObjectPut(s.Container, objectName, r, false, "", contentType, swift.Headers{
+			"Content-Length": strconv.Itoa(data.Length()),
+		})
+	}
+
+	if err != nil {
+		return translateError(err)
+	}
+
+	var oldSegmentNames []string
+
+	for _, o := range oldSegments {
+		oldSegmentNames = append(oldSegmentNames, o.Name)
+	}
+
+	s.deleteSegments(ctx, c, oldSegmentContainer, oldSegmentNames)
+
+	if opts.GetModTime != nil {
+		bm, err := s.GetMetadata(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		*opts.GetModTime = bm.Timestamp
+	}
+
+	return nil
+}
+
+// sloSegment is an entry in the manifest of a static large object.
+type sloSegment struct {
+	Path string `json:"path"`
+	Etag string `json:"etag"`
+	Size int64  `json:"size_bytes"`
+}
+
+// putLargeObject uploads the data as segments and then writes the static large object manifest
+// which makes them available as a single object.
+func (s *swiftStorage) putLargeObject(ctx context.Context, c *swift.Connection, objectName string, data blob.Bytes) error {
+	segmentContainer := s.segmentContainer()
+
+	if err := c.ContainerCreate(segmentContainer, nil); err != nil {
+		return errors.Wrap(err, "unable to create segment container")
+	}
+
+	randSuffix := make([]byte, segmentRandomLen)
+	if _, err := rand.Read(randSuffix); err != nil {
+		return errors.Wrap(err, "can't get random bytes")
+	}
+
+	segmentPrefix := objectName + "/" + hex.EncodeToString(randSuffix)
+
+	r := data.Reader()
+	defer r.Close() //nolint:errcheck
+
+	var (
+		manifest     []sloSegment
+		segmentNames []string
+	)
+
+	for remaining := int64(data.Length()); remaining > 0; {
+		size := min(remaining, s.segmentSize())
+		segmentName := fmt.Sprintf("%v/%08d", segmentPrefix, len(manifest))
+
+		h, err := c.ObjectPut(segmentContainer, segmentName, io.LimitReader(r, size), false, "", contentType, swift.Headers{
+			"Content-Length": strconv.FormatInt(size, 10),
+		})
+		if err != nil {
+			s.deleteSegments(ctx, c, segmentContainer, segmentNames)
+			return errors.Wrapf(err, "unable to upload segment %v", segmentName)
+		}
+
+		manifest = append(manifest, sloSegment{
+			Path: segmentContainer + "/" + segmentName,
+			Etag: h["Etag"],
+			Size: size,
+		})
+		segmentNames = append(segmentNames, segmentName)
+
+		remaining -= size
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal manifest")
+	}
+
+	if _, _, err := c.Call(c.StorageUrl, swift.RequestOpts{
+		Container:  s.Container,
+		ObjectName: objectName,
+		Operation:  http.MethodPut,
+		Parameters: url.Values{"multipart-manifest": []string{"put"}},
+		Headers: swift.Headers{
+			"Content-Length": strconv.Itoa(len(body)),
+			"Content-Type":   contentType,
+		},
+		Body:       bytes.NewReader(body),
+		NoResponse: true,
+	}); err != nil {
+		s.deleteSegments(ctx, c, segmentContainer, segmentNames)
+		return errors.Wrap(err, "unable to write large object manifest")
+	}
+
+	return nil
+}
+
+func (s *swiftStorage) deleteSegments(ctx context.Context, c *swift.Connection, segmentContainer string, names []string) {
+	for _, name := range names {
+		if err := c.ObjectDelete(segmentContainer, name); err != nil {
+			log(ctx).Debugf("unable to delete segment %v: %v", name, err)
+		}
+	}
+}
+
+func (s *swiftStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	c, done, err := s.connection(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer done()
+
+	// removes segments of large objects as well.
+	err = translateError(c.LargeObjectDelete(s.Container, s.getObjectNameString(id)))
+	if errors.Is(err, blob.ErrBlobNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *swiftStorage) getObjectNameString(id blob.ID) string {
+	return s.Prefix + string(id)
+}
+
+func (s *swiftStorage) segmentSize() int64 {
+	if s.SegmentSize > 0 {
+		return s.SegmentSize
+	}
+
+	return DefaultSegmentSize
+}
+
+func (s *swiftStorage) segmentContainer() string {
+	if s.SegmentContainer != "" {
+		return s.SegmentContainer
+	}
+
+	return s.Container + segmentContainerSuffix
+}
+
+func (s *swiftStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	c, done, err := s.connection(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer done()
+
+	opts := &swift.ObjectsOpts{
+		Prefix: s.getObjectNameString(prefix),
+	}
+
+	err = c.ObjectsWalk(s.Container, opts, func(opts *swift.ObjectsOpts) (interface{}, error) {
+		objects, err := c.Objects(s.Container, opts)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		for _, o := range objects {
+			if err := callback(blob.Metadata{
+				BlobID:    blob.ID(o.Name[len(s.Prefix):]),
+				Length:    o.Bytes,
+				Timestamp: o.LastModified,
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		return objects, nil
+	})
+
+	return translateError(err)
+}
+
+func (s *swiftStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{
+		Type:   swiftStorageType,
+		Config: &s.Options,
+	}
+}
+
+func (s *swiftStorage) DisplayName() string {
+	return fmt.Sprintf("Swift: %v", s.Container)
+}
+
+func (s *swiftStorage) String() string {
+	return fmt.Sprintf("swift://%s/%s", s.Container, s.Prefix)
+}
+
+func newConnection(opt *Options) *swift.Connection {
+	return &swift.Connection{
+		AuthVersion:                 3, //nolint:mnd
+		AuthUrl:                     opt.AuthURL,
+		UserName:                    opt.Username,
+		ApiKey:                      opt.Password,
+		Domain:                      opt.UserDomain,
+		ApplicationCredentialId:     opt.ApplicationCredentialID,
+		ApplicationCredentialSecret: opt.ApplicationCredentialSecret,
+		Tenant:                      opt.ProjectName,
+		TenantId:                    opt.ProjectID,
+		TenantDomain:                opt.ProjectDomain,
+		Region:                      opt.Region,
+		EndpointType:                swift.EndpointType(opt.EndpointType),
+	}
+}
+
+func newTransport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+
+	return t
+}
+
+// New creates new Swift-backed storage with specified options.
+func New(ctx context.Context, opt *Options, isCreate bool) (blob.Storage, error) {
+	if opt.Container == "" {
+		return nil, errors.New("container name must be specified")
+	}
+
+	if opt.AuthURL == "" {
+		return nil, errors.New("auth URL must be specified")
+	}
+
+	s := &swiftStorage{
+		Options:   *opt,
+		transport: newTransport(),
+	}
+
+	c, done, err := s.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer done()
+
+	if _, _, err := c.Container(opt.Container); err != nil {
+		if !errors.Is(err, swift.ContainerNotFound) || !isCreate {
+			return nil, errors.Wrapf(err, "cannot open container %q", opt.Container)
+		}
+
+		if err := c.ContainerCreate(opt.Container, nil); err != nil {
+			return nil, errors.Wrapf(err, "unable to create container %q", opt.Container)
+		}
+	}
+
+	return retrying.NewWrapper(s), nil
+}
+
+func init() {
+	blob.AddSupportedStorage(swiftStorageType, Options{}, New)
+}
@@ -0,0 +1,331 @@
+package swift_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/swift"
+	"github.com/ncw/swift/swifttest"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/providervalidation"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	kopiaswift "github.com/kopia/kopia/repo/blob/swift"
+)
+
+const (
+	testUsername = "kopia-user"
+	testPassword = "kopia-password"
+	testProject  = "kopia-project"
+	testRegion   = "RegionOne"
+)
+
+// startKeystoneAndSwift starts in-memory Swift server and a minimal Keystone v3 identity service
+// in front of it, which issues tokens for the Swift server.
+func startKeystoneAndSwift(t *testing.T) (authURL string, srv *swifttest.SwiftServer) {
+	t.Helper()
+
+	srv, err := swifttest.NewSwiftServer("localhost:0")
+	require.NoError(t, err)
+
+	t.Cleanup(srv.Close)
+
+	proxy := startRangeCheckingProxy(t, srv)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Auth struct {
+				Identity struct {
+					Password struct {
+						User struct {
+							Name     string `json:"name"`
+							Password string `json:"password"`
+						} `json:"user"`
+					} `json:"password"`
+				} `json:"identity"`
+				Scope struct {
+					Project struct {
+						Name string `json:"name"`
+					} `json:"project"`
+				} `json:"scope"`
+			} `json:"auth"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user := req.Auth.Identity.Password.User
+		if user.Name != testUsername || user.Password != testPassword || req.Auth.Scope.Project.Name != testProject {
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		// obtain the token from the Swift server using its legacy authentication.
+		v1 := &swift.Connection{
+			AuthUrl:  srv.AuthURL,
+			UserName: swifttest.TEST_ACCOUNT,
+			ApiKey:   swifttest.TEST_ACCOUNT,
+		}
+
+		if err := v1.Authenticate(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := map[string]any{
+			"token": map[string]any{
+				"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+				"catalog": []any{
+					map[string]any{
+						"type": "object-store",
+						"endpoints": []any{
+							map[string]any{"region": testRegion, "interface": "public", "url": proxy.URL + "/v1/AUTH_" + swifttest.TEST_ACCOUNT},
+						},
+					},
+				},
+			},
+		}
+
+		w.Header().Set("X-Subject-Token", v1.AuthToken)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	ks := httptest.NewServer(mux)
+	t.Cleanup(ks.Close)
+
+	return ks.URL + "/v3", srv
+}
+
+var rangeRegexp = regexp.MustCompile(`^bytes=(\d+)-(\d+)$`)
+
+// startRangeCheckingProxy starts a proxy in front of the Swift server, which rejects
+// unsatisfiable ranges and replaces the metadata of overwritten objects like Swift does,
+// unlike the in-memory server.
+func startRangeCheckingProxy(t *testing.T, srv *swifttest.SwiftServer) *httptest.Server {
+	t.Helper()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	rp := httputil.NewSingleHostReverseProxy(u)
+
+	p := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// object paths are /v1/<account>/<container>/<object>
+		isObject := strings.Count(r.URL.Path, "/") >= 4
+
+		if r.Method == http.MethodPut && isObject && r.URL.Query().Get("multipart-manifest") != "put" {
+			// the in-memory server keeps the large object flag of the overwritten object.
+			del, err := http.NewRequestWithContext(r.Context(), http.MethodDelete, srv.URL+r.URL.Path, http.NoBody)
+			require.NoError(t, err)
+
+			del.Header.Set("X-Auth-Token", r.Header.Get("X-Auth-Token"))
+
+			resp, err := http.DefaultClient.Do(del)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+
+		if m := rangeRegexp.FindStringSubmatch(r.Header.Get("Range")); m != nil && r.Method == http.MethodGet {
+			head, err := http.NewRequestWithContext(r.Context(), http.MethodHead, srv.URL+r.URL.Path, http.NoBody)
+			require.NoError(t, err)
+
+			head.Header = r.Header.Clone()
+			head.Header.Del("Range")
+
+			resp, err := http.DefaultClient.Do(head)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			start, _ := strconv.ParseInt(m[1], 10, 64)
+			end, _ := strconv.ParseInt(m[2], 10, 64)
+
+			if resp.StatusCode == http.StatusOK && (start >= resp.ContentLength || end >= resp.ContentLength) {
+				http.Error(w, "Requested Range Not Satisfiable", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+		}
+
+		rp.ServeHTTP(w, r)
+	}))
+
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func testOptions(authURL string) *kopiaswift.Options {
+	return &kopiaswift.Options{
+		Container:   "kopia",
+		AuthURL:     authURL,
+		Username:    testUsername,
+		Password:    testPassword,
+		UserDomain:  "Default",
+		ProjectName: testProject,
+		Region:      testRegion,
+	}
+}
+
+func TestSwiftStorage(t *testing.T) {
+	t.Parallel()
+
+	authURL, _ := startKeystoneAndSwift(t)
+	ctx := testlogging.Context(t)
+
+	opt := testOptions(authURL)
+	opt.Prefix = "some/prefix/"
+
+	// use context that gets canceled after opening storage to ensure it's not used beyond New().
+	newctx, cancel := context.WithCancel(ctx)
+	st, err := kopiaswift.New(newctx, opt, true)
+
+	cancel()
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+	require.NoError(t, providervalidation.ValidateProvider(ctx, st, blobtesting.TestValidationOptions))
+}
+
+func TestSwiftStorageLargeObjects(t *testing.T) {
+	t.Parallel()
+
+	authURL, srv := startKeystoneAndSwift(t)
+	ctx := testlogging.Context(t)
+
+	opt := testOptions(authURL)
+	opt.SegmentSize = 1000
+
+	st, err := kopiaswift.New(ctx, opt, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	data := make([]byte, 2500)
+	rand.Read(data)
+
+	require.NoError(t, st.PutBlob(ctx, "large", gather.FromSlice(data), blob.PutOptions{}))
+
+	bm, err := st.GetMetadata(ctx, "large")
+	require.NoError(t, err)
+	require.EqualValues(t, len(data), bm.Length)
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, "large", 0, -1, &tmp))
+	require.Equal(t, data, tmp.ToByteSlice())
+
+	require.NoError(t, st.GetBlob(ctx, "large", 900, 200, &tmp))
+	require.Equal(t, data[900:1100], tmp.ToByteSlice())
+
+	segments := listSegments(t, srv, opt.Container+"_segments")
+	require.Len(t, segments, 3)
+
+	for _, s := range segments {
+		require.True(t, strings.HasPrefix(s, "large/"), s)
+	}
+
+	// overwriting the large object replaces its segments.
+	require.NoError(t, st.PutBlob(ctx, "large", gather.FromSlice(data[:2000]), blob.PutOptions{}))
+	require.NoError(t, st.GetBlob(ctx, "large", 0, -1, &tmp))
+	require.Equal(t, data[:2000], tmp.ToByteSlice())
+
+	newSegments := listSegments(t, srv, opt.Container+"_segments")
+	require.Len(t, newSegments, 2)
+
+	for _, s := range newSegments {
+		require.NotContains(t, segments, s)
+	}
+
+	// overwriting with a small object removes all segments.
+	require.NoError(t, st.PutBlob(ctx, "large", gather.FromSlice(data[:10]), blob.PutOptions{}))
+	require.NoError(t, st.GetBlob(ctx, "large", 0, -1, &tmp))
+	require.Equal(t, data[:10], tmp.ToByteSlice())
+	require.Empty(t, listSegments(t, srv, opt.Container+"_segments"))
+
+	require.NoError(t, st.PutBlob(ctx, "large", gather.FromSlice(data), blob.PutOptions{}))
+	require.NoError(t, st.DeleteBlob(ctx, "large"))
+	require.ErrorIs(t, st.GetBlob(ctx, "large", 0, -1, &tmp), blob.ErrBlobNotFound)
+	require.Empty(t, listSegments(t, srv, opt.Container+"_segments"))
+}
+
+func TestSwiftStorageHonorsContext(t *testing.T) {
+	t.Parallel()
+
+	authURL, _ := startKeystoneAndSwift(t)
+	ctx := testlogging.Context(t)
+
+	st, err := kopiaswift.New(ctx, testOptions(authURL), true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = st.GetMetadata(canceledCtx, "some-blob")
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = st.GetMetadata(ctx, "some-blob")
+	require.ErrorIs(t, err, blob.ErrBlobNotFound)
+}
+
+func TestSwiftStorageInvalidCredentials(t *testing.T) {
+	t.Parallel()
+
+	authURL, _ := startKeystoneAndSwift(t)
+	ctx := testlogging.Context(t)
+
+	opt := testOptions(authURL)
+	opt.Password = "wrong-password"
+
+	_, err := kopiaswift.New(ctx, opt, true)
+	require.ErrorIs(t, err, blob.ErrInvalidCredentials)
+}
+
+func TestSwiftStorageContainerMustExist(t *testing.T) {
+	t.Parallel()
+
+	authURL, _ := startKeystoneAndSwift(t)
+	ctx := testlogging.Context(t)
+
+	_, err := kopiaswift.New(ctx, testOptions(authURL), false)
+	require.ErrorContains(t, err, "cannot open container")
+}
+
+func listSegments(t *testing.T, srv *swifttest.SwiftServer, container string) []string {
+	t.Helper()
+
+	c := &swift.Connection{
+		AuthUrl:  srv.AuthURL,
+		UserName: swifttest.TEST_ACCOUNT,
+		ApiKey:   swifttest.TEST_ACCOUNT,
+	}
+
+	require.NoError(t, c.Authenticate())
+
+	names, err := c.ObjectNamesAll(container, nil)
+	require.NoError(t, err)
+
+	return names
+}
@@ -0,0 +1,186 @@
+// Package tracing implements wrapper around Storage that emits OpenTelemetry spans for all activity.
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+var tracer = otel.Tracer("kopia/blob")
+
+// Span attribute keys emitted by the wrapper.
+const (
+	AttrBlobID       = attribute.Key("kopia.blob.id")
+	AttrBlobPrefix   = attribute.Key("kopia.blob.prefix")
+	AttrBlobOffset   = attribute.Key("kopia.blob.offset")
+	AttrBlobLength   = attribute.Key("kopia.blob.length")
+	AttrBytes        = attribute.Key("kopia.blob.bytes")
+	AttrResultCount  = attribute.Key("kopia.blob.result_count")
+	AttrStorageType  = attribute.Key("kopia.storage.type")
+	AttrBlobNotFound = attribute.Key("kopia.blob.not_found")
+)
+
+type tracingStorage struct {
+	base        blob.Storage
+	storageType string
+}
+
+func (s *tracingStorage) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "BlobStorage."+name, //nolint:spancheck
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, AttrStorageType.String(s.storageType))...))
+}
+
+func endSpan(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, blob.ErrBlobNotFound):
+		// not found is an expected condition, not an error.
+		span.SetAttributes(AttrBlobNotFound.Bool(true))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+func (s *tracingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	ctx, span := s.start(ctx, "GetBlob", AttrBlobID.String(string(id)), AttrBlobOffset.Int64(offset), AttrBlobLength.Int64(length))
+
+	err := s.base.GetBlob(ctx, id, offset, length, output)
+
+	span.SetAttributes(AttrBytes.Int(output.Length()))
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *tracingStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	ctx, span := s.start(ctx, "GetCapacity")
+
+	c, err := s.base.GetCapacity(ctx)
+
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return c, err
+}
+
+func (s *tracingStorage) IsReadOnly() bool {
+	return s.base.IsReadOnly()
+}
+
+// Unwrap implements blob.Unwrapper.
+func (s *tracingStorage) Unwrap() blob.Storage {
+	return s.base
+}
+
+func (s *tracingStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	ctx, span := s.start(ctx, "GetMetadata", AttrBlobID.String(string(id)))
+
+	result, err := s.base.GetMetadata(ctx, id)
+
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return result, err
+}
+
+func (s *tracingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	ctx, span := s.start(ctx, "PutBlob", AttrBlobID.String(string(id)), AttrBytes.Int(data.Length()))
+
+	err := s.base.PutBlob(ctx, id, data, opts)
+
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *tracingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	ctx, span := s.start(ctx, "DeleteBlob", AttrBlobID.String(string(id)))
+
+	err := s.base.DeleteBlob(ctx, id)
+
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *tracingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	ctx, span := s.start(ctx, "ListBlobs", AttrBlobPrefix.String(string(prefix)))
+
+	var (
+		cnt        int
+		totalBytes int64
+	)
+
+	err := s.base.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		cnt++
+		totalBytes += bm.Length
+
+		return callback(bm)
+	})
+
+	span.SetAttributes(AttrResultCount.Int(cnt), AttrBytes.Int64(totalBytes))
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *tracingStorage) Close(ctx context.Context) error {
+	ctx, span := s.start(ctx, "Close")
+
+	err := s.base.Close(ctx)
+
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *tracingStorage) ConnectionInfo() blob.ConnectionInfo {
+	return s.base.ConnectionInfo()
+}
+
+func (s *tracingStorage) DisplayName() string {
+	return s.base.DisplayName()
+}
+
+func (s *tracingStorage) FlushCaches(ctx context.Context) error {
+	ctx, span := s.start(ctx, "FlushCaches")
+
+	err := s.base.FlushCaches(ctx)
+
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *tracingStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, opts blob.ExtendOptions) error {
+	ctx, span := s.start(ctx, "ExtendBlobRetention", AttrBlobID.String(string(id)))
+
+	err := s.base.ExtendBlobRetention(ctx, id, opts)
+
+	endSpan(span, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+// NewWrapper returns a Storage wrapper that emits OpenTelemetry spans for all storage operations.
+func NewWrapper(wrapped blob.Storage) blob.Storage {
+	return &tracingStorage{base: wrapped, storageType: wrapped.ConnectionInfo().Type}
+}
@@ -0,0 +1,72 @@
+package tracing_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/tracing"
+)
+
+func TestTracingStorage(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	underlying := blobtesting.NewMapStorage(blobtesting.DataMap{}, map[blob.ID]time.Time{}, nil)
+	st := tracing.NewWrapper(underlying)
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+
+	require.Equal(t, underlying.ConnectionInfo().Type, st.ConnectionInfo().Type)
+}
+
+func TestTracingStorage_Spans(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	st := tracing.NewWrapper(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+
+	require.NoError(t, st.PutBlob(ctx, "abcd", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	require.NoError(t, st.GetBlob(ctx, "abcd", 0, -1, &tmp))
+	require.ErrorIs(t, st.GetBlob(ctx, "no-such-blob", 0, -1, &tmp), blob.ErrBlobNotFound)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+
+	attrs := func(i int) map[string]any {
+		m := map[string]any{}
+		for _, kv := range spans[i].Attributes {
+			m[string(kv.Key)] = kv.Value.AsInterface()
+		}
+
+		return m
+	}
+
+	require.Equal(t, "BlobStorage.PutBlob", spans[0].Name)
+	require.Equal(t, "abcd", attrs(0)["kopia.blob.id"])
+	require.EqualValues(t, 3, attrs(0)["kopia.blob.bytes"])
+
+	require.Equal(t, "BlobStorage.GetBlob", spans[1].Name)
+	require.EqualValues(t, 3, attrs(1)["kopia.blob.bytes"])
+
+	require.Equal(t, "BlobStorage.GetBlob", spans[2].Name)
+	require.Equal(t, true, attrs(2)["kopia.blob.not_found"])
+}
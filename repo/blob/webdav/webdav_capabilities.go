@@ -0,0 +1,363 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const nextcloudFilesPathSegment = "/remote.php/dav/files/"
+
+const quotaPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:quota-available-bytes/>
+    <d:quota-used-bytes/>
+  </d:prop>
+</d:propfind>`
+
+// serverCapabilities describes optional features of the WebDAV server, detected when connecting.
+type serverCapabilities struct {
+	davClasses     []string
+	chunkedUploads bool
+	quota          bool
+
+	// depthInfinity is set when the server is WebDAV class 1 compliant, which requires support
+	// for PROPFIND with "Depth: infinity", although servers may still reject or truncate such requests.
+	depthInfinity bool
+}
+
+// davClient issues WebDAV requests not supported by gowebdav.Client.
+type davClient struct {
+	client   *http.Client
+	username string
+	password string
+}
+
+func (c *davClient) do(ctx context.Context, method, u string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create request")
+	}
+
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	// Since we're handling encrypted data, there's no point compressing it server-side.
+	req.Header.Set("Accept-Encoding", "identity")
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%v %v", method, u)
+	}
+
+	return resp, nil
+}
+
+// doAndDiscard issues a request and returns an error unless the server responds with one of the expected status codes.
+func (c *davClient) doAndDiscard(ctx context.Context, method, u string, body io.Reader, headers map[string]string, expectedStatus ...int) error {
+	resp, err := c.do(ctx, method, u, body, headers)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+
+	for _, s := range expectedStatus {
+		if resp.StatusCode == s {
+			return nil
+		}
+	}
+
+	return &httpStatusError{method: method, url: u, statusCode: resp.StatusCode}
+}
+
+// httpStatusError is returned when the server responds with an unexpected HTTP status.
+type httpStatusError struct {
+	method     string
+	url        string
+	statusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return e.method + " " + e.url + ": " + strconv.Itoa(e.statusCode) + " " + http.StatusText(e.statusCode)
+}
+
+// listPropfindBody requests properties needed to list blobs.
+const listPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:">
+  <d:prop>
+    <d:getcontentlength/>
+    <d:getlastmodified/>
+    <d:resourcetype/>
+  </d:prop>
+</d:propfind>`
+
+type multiStatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+// davResponse is a single response element of a PROPFIND multi-status response.
+type davResponse struct {
+	Href      string `xml:"DAV: href"`
+	Propstats []struct {
+		Status string  `xml:"DAV: status"`
+		Prop   davProp `xml:"DAV: prop"`
+	} `xml:"DAV: propstat"`
+}
+
+type davProp struct {
+	QuotaAvailableBytes string `xml:"DAV: quota-available-bytes"`
+	QuotaUsedBytes      string `xml:"DAV: quota-used-bytes"`
+	ContentLength       string `xml:"DAV: getcontentlength"`
+	LastModified        string `xml:"DAV: getlastmodified"`
+	ResourceType        struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+}
+
+// props returns the properties the server has successfully returned.
+func (r *davResponse) props() []davProp {
+	var result []davProp
+
+	for _, ps := range r.Propstats {
+		if strings.Contains(ps.Status, " 200 ") {
+			result = append(result, ps.Prop)
+		}
+	}
+
+	return result
+}
+
+// path returns the unescaped path of the resource, the server may return either a path or a full URL.
+func (r *davResponse) path() string {
+	u, err := url.Parse(strings.TrimSpace(r.Href))
+	if err != nil {
+		return ""
+	}
+
+	return u.Path
+}
+
+func (r *davResponse) isCollection() bool {
+	for _, p := range r.props() {
+		if p.ResourceType.Collection != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *davResponse) contentLength() int64 {
+	for _, p := range r.props() {
+		if v, err := strconv.ParseInt(strings.TrimSpace(p.ContentLength), 10, 64); err == nil {
+			return v
+		}
+	}
+
+	return 0
+}
+
+func (r *davResponse) modTime() time.Time {
+	for _, p := range r.props() {
+		if t, err := http.ParseTime(strings.TrimSpace(p.LastModified)); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// propfind issues a PROPFIND request with the provided depth and invokes the callback for each
+// response element as it is received, without buffering the entire multi-status response.
+func (c *davClient) propfind(ctx context.Context, u, depth, body string, callback func(r *davResponse) error) error {
+	resp, err := c.do(ctx, "PROPFIND", u, strings.NewReader(body), map[string]string{
+		"Depth":        depth,
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+
+		return &httpStatusError{method: "PROPFIND", url: u, statusCode: resp.StatusCode}
+	}
+
+	dec := xml.NewDecoder(resp.Body)
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "unable to parse PROPFIND response")
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name != (xml.Name{Space: "DAV:", Local: "response"}) {
+			continue
+		}
+
+		var r davResponse
+
+		if err := dec.DecodeElement(&r, &se); err != nil {
+			return errors.Wrap(err, "unable to parse PROPFIND response")
+		}
+
+		if err := callback(&r); err != nil {
+			return err
+		}
+	}
+}
+
+// getQuota returns the number of available and used bytes as reported by RFC 4331 properties of the root collection.
+func (c *davClient) getQuota(ctx context.Context, rootURL string) (avail, used int64, err error) {
+	resp, err := c.do(ctx, "PROPFIND", rootURL, strings.NewReader(quotaPropfindBody), map[string]string{
+		"Depth":        "0",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return 0, 0, &httpStatusError{method: "PROPFIND", url: rootURL, statusCode: resp.StatusCode}
+	}
+
+	var ms multiStatus
+
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return 0, 0, errors.Wrap(err, "unable to parse PROPFIND response")
+	}
+
+	for _, r := range ms.Responses {
+		for _, p := range r.props() {
+			avail, aerr := strconv.ParseInt(strings.TrimSpace(p.QuotaAvailableBytes), 10, 64)
+			used, uerr := strconv.ParseInt(strings.TrimSpace(p.QuotaUsedBytes), 10, 64)
+
+			// Nextcloud and ownCloud report negative values when the quota is unknown or unlimited.
+			if aerr == nil && uerr == nil && avail >= 0 && used >= 0 {
+				return avail, used, nil
+			}
+		}
+	}
+
+	return 0, 0, blob.ErrNotAVolume
+}
+
+// detectCapabilities probes the server for optional features.
+func (c *davClient) detectCapabilities(ctx context.Context, opts *Options) serverCapabilities {
+	var caps serverCapabilities
+
+	if resp, err := c.do(ctx, http.MethodOptions, opts.rootURL(), nil, nil); err != nil {
+		log(ctx).Debugf("OPTIONS request failed: %v", err)
+	} else {
+		resp.Body.Close() //nolint:errcheck
+
+		for _, v := range strings.Split(resp.Header.Get("DAV"), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				caps.davClasses = append(caps.davClasses, v)
+			}
+		}
+
+		caps.depthInfinity = slices.Contains(caps.davClasses, "1")
+	}
+
+	if _, _, err := c.getQuota(ctx, opts.rootURL()); err == nil {
+		caps.quota = true
+	} else {
+		log(ctx).Debugf("quota is not available: %v", err)
+	}
+
+	if u := opts.uploadsURL(); u != "" && opts.chunkSize() > 0 {
+		if err := c.doAndDiscard(ctx, "PROPFIND", u, nil, map[string]string{"Depth": "0"}, http.StatusMultiStatus); err == nil {
+			caps.chunkedUploads = true
+		} else {
+			log(ctx).Debugf("chunked uploads are not available: %v", err)
+		}
+	}
+
+	log(ctx).Debugw("detected WebDAV server capabilities",
+		"url", opts.URL,
+		"dav", caps.davClasses,
+		"chunkedUploads", caps.chunkedUploads,
+		"depthInfinity", caps.depthInfinity,
+		"quota", caps.quota)
+
+	return caps
+}
+
+// uploadsURL returns the URL of the collection used for chunked uploads or an empty string
+// if the server is not known to support them.
+func (o *Options) uploadsURL() string {
+	if o.UploadsURL != "" {
+		return strings.TrimSuffix(o.UploadsURL, "/")
+	}
+
+	// https://host/remote.php/dav/files/<user>/... => https://host/remote.php/dav/uploads/<user>
+	p := strings.Index(o.URL, nextcloudFilesPathSegment)
+	if p < 0 {
+		return ""
+	}
+
+	user, _, _ := strings.Cut(o.URL[p+len(nextcloudFilesPathSegment):], "/")
+	if user == "" {
+		return ""
+	}
+
+	return o.URL[0:p] + "/remote.php/dav/uploads/" + user
+}
+
+// rootURL returns the URL of the root collection.
+func (o *Options) rootURL() string {
+	return strings.TrimSuffix(o.URL, "/") + "/"
+}
+
+// urlForPath returns the full URL of the provided storage path.
+func (o *Options) urlForPath(p string) string {
+	return strings.TrimSuffix(o.URL, "/") + (&url.URL{Path: "/" + strings.TrimPrefix(p, "/")}).EscapedPath()
+}
+
+func (d *davStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	impl := d.Impl.(*davStorageImpl) //nolint:forcetypeassert
+
+	if !impl.caps.quota {
+		return blob.Capacity{}, blob.ErrNotAVolume
+	}
+
+	avail, used, err := impl.dav.getQuota(ctx, impl.rootURL())
+	if err != nil {
+		return blob.Capacity{}, errors.Wrap(err, "GetCapacity")
+	}
+
+	return blob.Capacity{
+		SizeB: uint64(avail + used), //nolint:gosec
+		FreeB: uint64(avail),        //nolint:gosec
+	}, nil
+}
@@ -0,0 +1,515 @@
+package webdav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/sharded"
+)
+
+const (
+	testFilesPrefix   = "/remote.php/dav/files/user"
+	testUploadsPrefix = "/remote.php/dav/uploads/user"
+)
+
+// fakeNextcloudServer simulates Nextcloud chunked uploads and quota reporting on top of webdav.Handler.
+type fakeNextcloudServer struct {
+	filesDir   string
+	uploadsDir string
+
+	quotaAvailable int64
+	quotaUsed      int64
+
+	chunkPuts       atomic.Int32
+	assembledFiles  atomic.Int32
+	failedChunkPuts atomic.Int32 // number of chunk uploads to fail with 503
+	rejectedChunk   atomic.Int32 // number of the chunk to reject once with 403
+
+	depthInfinity         depthInfinityMode
+	propfindRequests      atomic.Int32
+	depthInfinityRequests atomic.Int32
+}
+
+// depthInfinityMode determines how the fake server handles PROPFIND requests with "Depth: infinity".
+type depthInfinityMode int
+
+const (
+	depthInfinitySupported depthInfinityMode = iota
+	depthInfinityRejected                    // rejected with 403, like Apache mod_dav by default
+	depthInfinityTruncated                   // treated as depth 1, like sabre/dav by default
+)
+
+func (s *fakeNextcloudServer) serveFiles(files http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PROPFIND" && r.Header.Get("Depth") == "0" && strings.TrimSuffix(r.URL.Path, "/") == testFilesPrefix {
+			body, _ := io.ReadAll(r.Body)
+
+			if bytes.Contains(body, []byte("quota-available-bytes")) {
+				w.WriteHeader(http.StatusMultiStatus)
+				fmt.Fprintf(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:"><d:response><d:href>%v/</d:href><d:propstat><d:prop>
+<d:quota-available-bytes>%v</d:quota-available-bytes><d:quota-used-bytes>%v</d:quota-used-bytes>
+</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response></d:multistatus>`, testFilesPrefix, s.quotaAvailable, s.quotaUsed)
+
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if r.Method == "PROPFIND" {
+			s.propfindRequests.Add(1)
+
+			if r.Header.Get("Depth") == "infinity" {
+				s.depthInfinityRequests.Add(1)
+
+				switch s.depthInfinity {
+				case depthInfinityRejected:
+					http.Error(w, "propfind-finite-depth", http.StatusForbidden)
+					return
+
+				case depthInfinityTruncated:
+					r.Header.Set("Depth", "1")
+
+				default:
+				}
+			}
+		}
+
+		files.ServeHTTP(w, r)
+	}
+}
+
+//nolint:gocyclo
+func (s *fakeNextcloudServer) serveUploads(w http.ResponseWriter, r *http.Request) {
+	rel := strings.Trim(strings.TrimPrefix(r.URL.Path, testUploadsPrefix), "/")
+	uploadID, chunkName, _ := strings.Cut(rel, "/")
+	uploadDir := filepath.Join(s.uploadsDir, uploadID)
+
+	switch {
+	case r.Method == "PROPFIND" && rel == "":
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:"><d:response><d:href>%v/</d:href></d:response></d:multistatus>`, testUploadsPrefix)
+
+	case r.Method == "PROPFIND" && chunkName == "":
+		entries, err := os.ReadDir(uploadDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:"><d:response><d:href>%v/%v/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, testUploadsPrefix, uploadID)
+
+		for _, e := range entries {
+			fi, _ := e.Info()
+			fmt.Fprintf(w, `<d:response><d:href>%v/%v/%v</d:href><d:propstat><d:prop><d:getcontentlength>%v</d:getcontentlength><d:resourcetype/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, testUploadsPrefix, uploadID, e.Name(), fi.Size())
+		}
+
+		fmt.Fprint(w, `</d:multistatus>`)
+
+	case r.Method == "MKCOL" && chunkName == "":
+		if r.Header.Get("Destination") == "" {
+			http.Error(w, "missing destination", http.StatusBadRequest)
+			return
+		}
+
+		if err := os.Mkdir(uploadDir, 0o700); err != nil {
+			http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPut && chunkName != "":
+		if s.failedChunkPuts.Add(-1) >= 0 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+
+		if n, _ := strconv.Atoi(chunkName); n != 0 && s.rejectedChunk.CompareAndSwap(int32(n), 0) { //nolint:gosec
+			http.Error(w, "rejected", http.StatusForbidden)
+			return
+		}
+
+		data, _ := io.ReadAll(r.Body)
+		if err := os.WriteFile(filepath.Join(uploadDir, chunkName), data, 0o600); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		s.chunkPuts.Add(1)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == "MOVE" && chunkName == ".file":
+		code, err := s.assemble(uploadDir, r.Header.Get("Destination"), r.Header.Get("OC-Total-Length"))
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		os.RemoveAll(uploadDir)
+		s.assembledFiles.Add(1)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodDelete && chunkName == "":
+		os.RemoveAll(uploadDir)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeNextcloudServer) assemble(uploadDir, destination, totalLength string) (int, error) {
+	u, err := url.Parse(destination)
+	if err != nil || !strings.HasPrefix(u.Path, testFilesPrefix+"/") {
+		return http.StatusBadRequest, errors.Errorf("invalid destination %q", destination)
+	}
+
+	entries, err := os.ReadDir(uploadDir)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, _ := strconv.Atoi(entries[i].Name())
+		b, _ := strconv.Atoi(entries[j].Name())
+
+		return a < b
+	})
+
+	var buf bytes.Buffer
+
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(uploadDir, e.Name()))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		buf.Write(data)
+	}
+
+	if strconv.Itoa(buf.Len()) != totalLength {
+		return http.StatusBadRequest, errors.Errorf("invalid length %v, expected %v", buf.Len(), totalLength)
+	}
+
+	target := filepath.Join(s.filesDir, filepath.FromSlash(strings.TrimPrefix(u.Path, testFilesPrefix)))
+	if err := os.WriteFile(target, buf.Bytes(), 0o600); err != nil {
+		return http.StatusConflict, err
+	}
+
+	return http.StatusCreated, nil
+}
+
+func startFakeNextcloudServer(t *testing.T) (*fakeNextcloudServer, *httptest.Server) {
+	t.Helper()
+
+	s := &fakeNextcloudServer{
+		filesDir:       testutil.TempDirectory(t),
+		uploadsDir:     testutil.TempDirectory(t),
+		quotaAvailable: 3000,
+		quotaUsed:      1000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(testFilesPrefix+"/", basicAuth(s.serveFiles(&webdav.Handler{
+		Prefix:     testFilesPrefix,
+		FileSystem: webdav.Dir(s.filesDir),
+		LockSystem: webdav.NewMemLS(),
+	})))
+	mux.HandleFunc(testUploadsPrefix+"/", basicAuth(http.HandlerFunc(s.serveUploads)))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return s, server
+}
+
+func TestWebDAVStorageChunkedUploads(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	srv, server := startFakeNextcloudServer(t)
+
+	st, err := New(ctx, &Options{
+		URL:       server.URL + testFilesPrefix + "/",
+		Username:  "user",
+		Password:  "password",
+		ChunkSize: 1000,
+		Options: sharded.Options{
+			DirectoryShards: []int{1, 2},
+		},
+	}, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	data := bytes.Repeat([]byte{1, 2, 3}, 1500)
+
+	// the first chunk upload fails once and is retried.
+	srv.failedChunkPuts.Store(1)
+
+	require.NoError(t, st.PutBlob(ctx, "abcdef1234", gather.FromSlice(data), blob.PutOptions{}))
+	blobtesting.AssertGetBlob(ctx, t, st, "abcdef1234", data)
+
+	require.EqualValues(t, 5, srv.chunkPuts.Load())
+	require.EqualValues(t, 1, srv.assembledFiles.Load())
+
+	// small blobs are uploaded in a single request.
+	require.NoError(t, st.PutBlob(ctx, "abcdef5678", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.EqualValues(t, 1, srv.assembledFiles.Load())
+
+	// no temporary files are left behind.
+	entries, err := os.ReadDir(srv.uploadsDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, st.DeleteBlob(ctx, "abcdef1234"))
+	require.NoError(t, st.DeleteBlob(ctx, "abcdef5678"))
+
+	blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+	blobtesting.AssertConnectionInfoRoundTrips(ctx, t, st)
+}
+
+func TestWebDAVStorageChunkedUploadsResume(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	srv, server := startFakeNextcloudServer(t)
+
+	st, err := New(ctx, &Options{
+		URL:       server.URL + testFilesPrefix,
+		Username:  "user",
+		Password:  "password",
+		ChunkSize: 1000,
+	}, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	data := bytes.Repeat([]byte{1, 2, 3}, 1500)
+
+	// the third chunk fails with an error which is not retried by the chunk upload loop,
+	// so the entire upload is retried and resumes from the third chunk.
+	srv.rejectedChunk.Store(3)
+
+	require.NoError(t, st.PutBlob(ctx, "abcdef1234", gather.FromSlice(data), blob.PutOptions{}))
+	blobtesting.AssertGetBlob(ctx, t, st, "abcdef1234", data)
+
+	require.EqualValues(t, 5, srv.chunkPuts.Load())
+	require.EqualValues(t, 1, srv.assembledFiles.Load())
+
+	// different contents of the same blob are uploaded separately.
+	srv.rejectedChunk.Store(4)
+
+	data2 := bytes.Repeat([]byte{4, 5, 6}, 1500)
+
+	require.NoError(t, st.PutBlob(ctx, "abcdef1234", gather.FromSlice(data2), blob.PutOptions{}))
+	blobtesting.AssertGetBlob(ctx, t, st, "abcdef1234", data2)
+
+	require.EqualValues(t, 10, srv.chunkPuts.Load())
+	require.EqualValues(t, 2, srv.assembledFiles.Load())
+
+	entries, err := os.ReadDir(srv.uploadsDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestWebDAVStorageChunkedUploadsDisabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	srv, server := startFakeNextcloudServer(t)
+
+	st, err := New(ctx, &Options{
+		URL:       server.URL + testFilesPrefix,
+		Username:  "user",
+		Password:  "password",
+		ChunkSize: -1,
+	}, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	data := bytes.Repeat([]byte{1, 2, 3}, 5000000)
+
+	require.NoError(t, st.PutBlob(ctx, "abcdef1234", gather.FromSlice(data), blob.PutOptions{}))
+	blobtesting.AssertGetBlob(ctx, t, st, "abcdef1234", data)
+	require.EqualValues(t, 0, srv.chunkPuts.Load())
+}
+
+func TestWebDAVStorageCapacity(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	_, server := startFakeNextcloudServer(t)
+
+	st, err := New(ctx, &Options{
+		URL:      server.URL + testFilesPrefix,
+		Username: "user",
+		Password: "password",
+	}, true)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	c, err := st.GetCapacity(ctx)
+	require.NoError(t, err)
+	require.Equal(t, blob.Capacity{SizeB: 4000, FreeB: 3000}, c)
+
+	// plain WebDAV server without RFC 4331 support.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", basicAuth(&webdav.Handler{
+		FileSystem: webdav.Dir(testutil.TempDirectory(t)),
+		LockSystem: webdav.NewMemLS(),
+	}))
+
+	plain := httptest.NewServer(mux)
+	defer plain.Close()
+
+	st2, err := New(ctx, &Options{
+		URL:      plain.URL,
+		Username: "user",
+		Password: "password",
+	}, true)
+	require.NoError(t, err)
+
+	defer st2.Close(ctx)
+
+	_, err = st2.GetCapacity(ctx)
+	require.ErrorIs(t, err, blob.ErrNotAVolume)
+}
+
+func TestWebDAVUploadsURL(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		opt  Options
+		want string
+	}{
+		{Options{URL: "https://cloud.example.com/remote.php/dav/files/alice/kopia"}, "https://cloud.example.com/remote.php/dav/uploads/alice"},
+		{Options{URL: "https://cloud.example.com/nc/remote.php/dav/files/bob/"}, "https://cloud.example.com/nc/remote.php/dav/uploads/bob"},
+		{Options{URL: "https://cloud.example.com/remote.php/dav/files/"}, ""},
+		{Options{URL: "https://dav.example.com/kopia"}, ""},
+		{Options{URL: "https://dav.example.com/kopia", UploadsURL: "https://dav.example.com/uploads/"}, "https://dav.example.com/uploads"},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.want, tc.opt.uploadsURL(), tc.opt.URL)
+	}
+}
+
+func TestWebDAVStorageListing(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		mode depthInfinityMode
+
+		// number of PROPFIND requests needed to list all blobs
+		wantPropfinds int32
+	}{
+		{"Supported", depthInfinitySupported, 4},
+		{"Rejected", depthInfinityRejected, 10},
+		{"Truncated", depthInfinityTruncated, 9},
+	}
+
+	// blob IDs shorter than 20 characters are not sharded.
+	blobIDs := []blob.ID{
+		"abcdef1234000000000000",
+		"abcdef5678000000000000",
+		"abd0000000000000000000",
+		"bcdef00000000000000000",
+		"bcx0000000000000000000",
+		"cdef000000000000000000",
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := testlogging.Context(t)
+			srv, server := startFakeNextcloudServer(t)
+			srv.depthInfinity = tc.mode
+
+			st, err := New(ctx, &Options{
+				URL:      server.URL + testFilesPrefix,
+				Username: "user",
+				Password: "password",
+				Options: sharded.Options{
+					DirectoryShards: []int{1, 2},
+				},
+			}, true)
+			require.NoError(t, err)
+
+			defer st.Close(ctx)
+
+			for _, id := range blobIDs {
+				require.NoError(t, st.PutBlob(ctx, id, gather.FromSlice([]byte(id)), blob.PutOptions{}))
+			}
+
+			srv.propfindRequests.Store(0)
+			srv.depthInfinityRequests.Store(0)
+
+			for _, prefix := range []blob.ID{"", "a", "abc", "abcdef5", "bc", "x"} {
+				var want []blob.ID
+
+				for _, id := range blobIDs {
+					if strings.HasPrefix(string(id), string(prefix)) {
+						want = append(want, id)
+					}
+				}
+
+				got, err := blob.ListAllBlobs(ctx, st, prefix)
+				require.NoError(t, err)
+
+				var gotIDs []blob.ID
+
+				for _, bm := range got {
+					require.Equal(t, len(bm.BlobID), int(bm.Length), bm.BlobID)
+					require.False(t, bm.Timestamp.IsZero(), bm.BlobID)
+
+					gotIDs = append(gotIDs, bm.BlobID)
+				}
+
+				require.ElementsMatch(t, want, gotIDs, "prefix %q", prefix)
+
+				if prefix == "" {
+					require.Equal(t, tc.wantPropfinds, srv.propfindRequests.Load())
+				}
+			}
+
+			if tc.mode != depthInfinitySupported {
+				// the server is only asked once.
+				require.EqualValues(t, 1, srv.depthInfinityRequests.Load())
+			}
+
+			for _, id := range blobIDs {
+				require.NoError(t, st.DeleteBlob(ctx, id))
+			}
+
+			blobtesting.VerifyStorage(ctx, t, st, blob.PutOptions{})
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/retry"
+)
+
+const (
+	// defaultChunkSize is the default size of chunks used for chunked uploads.
+	defaultChunkSize = 10 << 20
+
+	uploadIDLength = 16
+)
+
+// putBlobChunked uploads the provided data to filePath using Nextcloud-style chunked uploads
+// (https://docs.nextcloud.com/server/latest/developer_manual/client_apis/WebDAV/chunking.html).
+//
+// Chunks are uploaded into a temporary collection and retried individually, so that transient
+// failures only require re-sending a single chunk. The name of the collection is derived from
+// the destination and the contents, so when the upload fails, uploading the same blob again
+// resumes it, skipping chunks which have already been uploaded. The server assembles the file
+// when the '.file' pseudo-entry is moved to its destination, which replaces the target atomically.
+func (d *davStorageImpl) putBlobChunked(ctx context.Context, dirPath, filePath string, b []byte) error {
+	chunkSize := d.Options.chunkSize()
+	uploadDir := d.Options.uploadsURL() + "/" + uploadID(filePath, chunkSize, b)
+	destination := d.Options.urlForPath(filePath)
+
+	headers := map[string]string{
+		"Destination":     destination,
+		"OC-Total-Length": strconv.Itoa(len(b)),
+	}
+
+	uploaded, err := d.createOrResumeUpload(ctx, uploadDir, headers)
+	if err != nil {
+		return err
+	}
+
+	for chunkNumber, offset := 1, int64(0); offset < int64(len(b)); chunkNumber, offset = chunkNumber+1, offset+chunkSize {
+		chunk := b[offset:min(offset+chunkSize, int64(len(b)))]
+		chunkName := fmt.Sprintf("%05d", chunkNumber)
+
+		if length, ok := uploaded[chunkName]; ok && length == int64(len(chunk)) {
+			continue
+		}
+
+		// chunks uploaded so far are kept, so that the upload can be resumed.
+		if err := retry.WithExponentialBackoffNoValue(ctx, "UploadChunk", func() error {
+			return d.dav.doAndDiscard(ctx, http.MethodPut, uploadDir+"/"+chunkName, bytes.NewReader(chunk), headers, http.StatusCreated, http.StatusNoContent, http.StatusOK)
+		}, isRetriableHTTPError); err != nil {
+			return errors.Wrapf(err, "unable to upload chunk %v", chunkNumber)
+		}
+	}
+
+	if err := d.assembleChunks(ctx, uploadDir, dirPath, headers); err != nil {
+		// the chunks may be damaged, start over next time.
+		if !isRetriableHTTPError(err) {
+			if derr := d.dav.doAndDiscard(ctx, http.MethodDelete, uploadDir, nil, nil, http.StatusNoContent, http.StatusOK); derr != nil {
+				log(ctx).Debugf("unable to remove upload directory %v: %v", uploadDir, derr)
+			}
+		}
+
+		return errors.Wrap(err, "unable to assemble chunks")
+	}
+
+	return nil
+}
+
+// uploadID returns the name of the upload collection for the provided blob, which is the same
+// for all uploads of the same contents to the same path.
+func uploadID(filePath string, chunkSize int64, b []byte) string {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%v\x00%v\x00", filePath, chunkSize)
+	h.Write(b)
+
+	return "kopia-" + hex.EncodeToString(h.Sum(nil)[0:uploadIDLength])
+}
+
+// createOrResumeUpload creates the upload collection or returns the lengths of chunks already
+// uploaded to it by previous attempts.
+func (d *davStorageImpl) createOrResumeUpload(ctx context.Context, uploadDir string, headers map[string]string) (map[string]int64, error) {
+	exists := false
+
+	if err := retry.WithExponentialBackoffNoValue(ctx, "CreateUploadDir", func() error {
+		err := d.dav.doAndDiscard(ctx, "MKCOL", uploadDir, nil, headers, http.StatusCreated)
+
+		// MKCOL fails with 405 Method Not Allowed when the collection exists.
+		var hse *httpStatusError
+		if errors.As(err, &hse) && hse.statusCode == http.StatusMethodNotAllowed {
+			exists = true
+			return nil
+		}
+
+		return err
+	}, isRetriableHTTPError); err != nil {
+		return nil, errors.Wrap(err, "unable to create upload directory")
+	}
+
+	uploaded := map[string]int64{}
+
+	if !exists {
+		return uploaded, nil
+	}
+
+	if err := d.dav.propfind(ctx, uploadDir+"/", "1", listPropfindBody, func(r *davResponse) error {
+		if !r.isCollection() {
+			name := path.Base(r.path())
+			uploaded[name] = r.contentLength()
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "unable to list uploaded chunks")
+	}
+
+	log(ctx).Debugf("resuming upload %v with %v chunks", uploadDir, len(uploaded))
+
+	return uploaded, nil
+}
+
+func (d *davStorageImpl) assembleChunks(ctx context.Context, uploadDir, dirPath string, headers map[string]string) error {
+	return retry.WithExponentialBackoffNoValue(ctx, "AssembleChunks", func() error {
+		mkdirAttempted := false
+
+		for {
+			err := d.dav.doAndDiscard(ctx, "MOVE", uploadDir+"/.file", nil, headers, http.StatusCreated, http.StatusNoContent)
+			if err == nil {
+				return nil
+			}
+
+			// The server responds with 409 Conflict when the destination directory does not exist.
+			var hse *httpStatusError
+			if errors.As(err, &hse) && hse.statusCode == http.StatusConflict && !mkdirAttempted && dirPath != "" {
+				mkdirAttempted = true
+
+				if mkdirErr := d.cli.MkdirAll(dirPath, defaultDirPerm); mkdirErr == nil {
+					continue
+				}
+			}
+
+			return err
+		}
+	}, isRetriableHTTPError)
+}
+
+func isRetriableHTTPError(err error) bool {
+	var hse *httpStatusError
+
+	switch {
+	case err == nil:
+		return false
+
+	case errors.As(err, &hse):
+		switch hse.statusCode {
+		case http.StatusLocked, http.StatusConflict, http.StatusTooManyRequests:
+			return true
+
+		default:
+			return hse.statusCode >= http.StatusInternalServerError
+		}
+
+	default:
+		return true
+	}
+}
@@ -0,0 +1,172 @@
+package webdav
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/sharded"
+)
+
+// ListBlobs implements blob.Storage.
+//
+// When the server supports PROPFIND with "Depth: infinity", each top-level shard directory is
+// listed using a single request instead of one request per directory. Servers which reject such
+// requests or silently list fewer levels than requested are detected and listed one level
+// at a time, same as other sharded storage providers.
+func (d *davStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	impl := d.Impl.(*davStorageImpl) //nolint:forcetypeassert
+
+	if !impl.caps.depthInfinity || impl.depthInfinityUnsupported.Load() {
+		//nolint:wrapcheck
+		return d.Storage.ListBlobs(ctx, prefix, callback)
+	}
+
+	return impl.listDir(ctx, d.RootPath, prefix, callback)
+}
+
+// listDir reports blobs in the provided directory and its subdirectories.
+func (d *davStorageImpl) listDir(ctx context.Context, dir string, prefix blob.ID, callback func(blob.Metadata) error) error {
+	// the root directory is always listed one level at a time, since listing it with "Depth: infinity"
+	// would return the entire repository in a single response.
+	if dir != "" && !d.depthInfinityUnsupported.Load() {
+		err := d.listDirDepthInfinity(ctx, dir, prefix, callback)
+		if !errors.Is(err, errDepthInfinityRejected) {
+			return err
+		}
+	}
+
+	entries, err := d.ReadDir(ctx, dir)
+	if err != nil {
+		return errors.Wrap(err, "error reading directory")
+	}
+
+	for _, e := range entries {
+		p := path.Join(dir, e.Name())
+
+		if e.IsDir() {
+			if !dirMatchesPrefix(p, prefix) {
+				continue
+			}
+
+			if err := d.listDir(ctx, p, prefix, callback); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if id, ok := blobIDFromPath(p, prefix); ok {
+			if err := callback(blob.Metadata{BlobID: id, Length: e.Size(), Timestamp: e.ModTime()}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var errDepthInfinityRejected = errors.New("depth infinity rejected")
+
+// listDirDepthInfinity lists the provided directory using a single PROPFIND request with "Depth: infinity".
+func (d *davStorageImpl) listDirDepthInfinity(ctx context.Context, dir string, prefix blob.ID, callback func(blob.Metadata) error) error {
+	rootPath := d.rootPath()
+
+	var (
+		collections   []string
+		hasChildren   = map[string]bool{}
+		deepestLevel  int
+		dirComponents = strings.Count(dir, "/") + 1
+	)
+
+	err := d.dav.propfind(ctx, d.urlForPath(dir)+"/", "infinity", listPropfindBody, func(r *davResponse) error {
+		rel, ok := strings.CutPrefix(strings.TrimSuffix(r.path(), "/"), rootPath+"/")
+		if !ok || rel == dir || !strings.HasPrefix(rel, dir+"/") {
+			return nil
+		}
+
+		hasChildren[path.Dir(rel)] = true
+		deepestLevel = max(deepestLevel, strings.Count(rel, "/")+1-dirComponents)
+
+		if r.isCollection() {
+			collections = append(collections, rel)
+			return nil
+		}
+
+		if id, ok := blobIDFromPath(rel, prefix); ok {
+			return callback(blob.Metadata{BlobID: id, Length: r.contentLength(), Timestamp: r.modTime()})
+		}
+
+		return nil
+	})
+
+	var hse *httpStatusError
+	if errors.As(err, &hse) {
+		switch hse.statusCode {
+		case http.StatusBadRequest, http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			log(ctx).Debugf("server rejected Depth: infinity listing, listing one level at a time: %v", err)
+			d.depthInfinityUnsupported.Store(true)
+
+			return errDepthInfinityRejected
+		}
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "error listing directory")
+	}
+
+	if len(collections) > 0 && deepestLevel == 1 {
+		// sabre/dav (used by Nextcloud and ownCloud) treats infinity as depth 1 unless configured otherwise.
+		log(ctx).Debugf("server truncated Depth: infinity listing of %v, listing one level at a time", dir)
+		d.depthInfinityUnsupported.Store(true)
+	}
+
+	// collections without entries in the response are either empty or have been truncated.
+	for _, c := range collections {
+		if hasChildren[c] || !dirMatchesPrefix(c, prefix) {
+			continue
+		}
+
+		if err := d.listDir(ctx, c, prefix, callback); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rootPath returns the unescaped URL path of the root collection without the trailing slash.
+func (d *davStorageImpl) rootPath() string {
+	u, err := url.Parse(d.Options.URL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// dirMatchesPrefix determines whether the directory may contain blobs with the provided prefix.
+func dirMatchesPrefix(dir string, prefix blob.ID) bool {
+	dirPrefix := strings.ReplaceAll(dir, "/", "")
+
+	if len(prefix) > len(dirPrefix) {
+		return strings.HasPrefix(string(prefix), dirPrefix)
+	}
+
+	return strings.HasPrefix(dirPrefix, string(prefix))
+}
+
+// blobIDFromPath returns the ID of the blob stored at the provided sharded path.
+func blobIDFromPath(p string, prefix blob.ID) (blob.ID, bool) {
+	name, ok := strings.CutSuffix(strings.ReplaceAll(p, "/", ""), sharded.CompleteBlobSuffix)
+	if !ok || !strings.HasPrefix(name, string(prefix)) {
+		return "", false
+	}
+
+	return blob.ID(name), true
+}
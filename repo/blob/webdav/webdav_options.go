@@ -13,6 +13,22 @@ type Options struct {
 	TrustedServerCertificateFingerprint string `json:"trustedServerCertificateFingerprint,omitempty"`
 	AtomicWrites                        bool   `json:"atomicWrites"`
 
+	// ChunkSize is the size of chunks in which blobs are uploaded to servers supporting Nextcloud-style
+	// chunked uploads, 0 uses the default and negative value disables chunked uploads.
+	ChunkSize int64 `json:"chunkSize,omitempty"`
+
+	// UploadsURL is the URL of the collection used for chunked uploads, by default it is derived
+	// from the URL of files on Nextcloud and ownCloud servers.
+	UploadsURL string `json:"uploadsURL,omitempty"`
+
 	sharded.Options
 	throttling.Limits
 }
+
+func (o *Options) chunkSize() int64 {
+	if o.ChunkSize == 0 {
+		return defaultChunkSize
+	}
+
+	return o.ChunkSize
+}
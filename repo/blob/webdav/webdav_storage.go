@@ -11,6 +11,7 @@
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 	"github.com/studio-b12/gowebdav"
@@ -21,8 +22,11 @@
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/blob/retrying"
 	"github.com/kopia/kopia/repo/blob/sharded"
+	"github.com/kopia/kopia/repo/logging"
 )
 
+var log = logging.Module("webdav")
+
 const (
 	davStorageType = "webdav"
 
@@ -42,7 +46,12 @@ type davStorage struct {
 type davStorageImpl struct {
 	Options
 
-	cli *gowebdav.Client
+	cli  *gowebdav.Client
+	dav  *davClient
+	caps serverCapabilities
+
+	// set when the server turns out not to honor "Depth: infinity" listings.
+	depthInfinityUnsupported atomic.Bool
 }
 
 func (d *davStorageImpl) GetBlobFromPath(_ context.Context, dirPath, path string, offset, length int64, output blob.OutputBuffer) error {
@@ -164,6 +173,14 @@ func (d *davStorageImpl) PutBlobInPath(ctx context.Context, dirPath, filePath st
 
 	b := buf.Bytes()
 
+	if d.caps.chunkedUploads && int64(len(b)) > d.Options.chunkSize() {
+		if err := d.putBlobChunked(ctx, dirPath, filePath, b); err != nil {
+			return err
+		}
+
+		return d.getModTimeAfterPut(ctx, dirPath, filePath, opts)
+	}
+
 	if err := retry.WithExponentialBackoffNoValue(ctx, "WriteTemporaryFileAndCreateParentDirs", func() error {
 		mkdirAttempted := false
 
@@ -198,6 +215,10 @@ func (d *davStorageImpl) PutBlobInPath(ctx context.Context, dirPath, filePath st
 		return err
 	}
 
+	return d.getModTimeAfterPut(ctx, dirPath, filePath, opts)
+}
+
+func (d *davStorageImpl) getModTimeAfterPut(ctx context.Context, dirPath, filePath string, opts blob.PutOptions) error {
 	if opts.GetModTime != nil {
 		bm, err := d.GetMetadataFromPath(ctx, dirPath, filePath)
 		if err != nil {
@@ -258,20 +279,31 @@ func isRetriable(err error) bool {
 }
 
 // New creates new WebDAV-backed storage in a specified URL.
-func New(_ context.Context, opts *Options, isCreate bool) (blob.Storage, error) {
+func New(ctx context.Context, opts *Options, isCreate bool) (blob.Storage, error) {
 	cli := gowebdav.NewClient(opts.URL, opts.Username, opts.Password)
 
 	// Since we're handling encrypted data, there's no point compressing it server-side.
 	cli.SetHeader("Accept-Encoding", "identity")
 
+	dav := &davClient{
+		client:   &http.Client{},
+		username: opts.Username,
+		password: opts.Password,
+	}
+
 	if opts.TrustedServerCertificateFingerprint != "" {
-		cli.SetTransport(tlsutil.TransportTrustingSingleCertificate(opts.TrustedServerCertificateFingerprint))
+		t := tlsutil.TransportTrustingSingleCertificate(opts.TrustedServerCertificateFingerprint)
+
+		cli.SetTransport(t)
+		dav.client.Transport = t
 	}
 
 	s := retrying.NewWrapper(&davStorage{
 		Storage: sharded.New(&davStorageImpl{
 			Options: *opts,
 			cli:     cli,
+			dav:     dav,
+			caps:    dav.detectCapabilities(ctx, opts),
 		}, "", opts.Options, isCreate),
 	})
 
@@ -75,6 +75,16 @@ func setupCachingOptionsWithDefaults(ctx context.Context, configPath string, lc
 	lc.Caching.MinContentSweepAge = opt.MinContentSweepAge
 	lc.Caching.MinMetadataSweepAge = opt.MinMetadataSweepAge
 	lc.Caching.MinIndexSweepAge = opt.MinIndexSweepAge
+	lc.Caching.SharedCacheDirectory = opt.SharedCacheDirectory
+
+	if opt.SharedCacheDirectory != "" {
+		d, err := filepath.Abs(opt.SharedCacheDirectory)
+		if err != nil {
+			return errors.Wrap(err, "unable to determine absolute shared cache path")
+		}
+
+		lc.Caching.SharedCacheDirectory = d
+	}
 
 	log(ctx).Debugf("Creating cache directory '%v' with max size %v", lc.Caching.CacheDirectory, lc.Caching.ContentCacheSizeBytes)
 
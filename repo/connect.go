@@ -102,6 +102,12 @@ func Disconnect(ctx context.Context, configFile string) error {
 		log(ctx).Error("unable to remove maintenance lock file", maintenanceLock)
 	}
 
+	for _, f := range []string{storageUsageFile(configFile), storageUsageFile(configFile) + ".lock"} {
+		if err := os.RemoveAll(f); err != nil {
+			log(ctx).Error("unable to remove storage usage file", f)
+		}
+	}
+
 	//nolint:wrapcheck
 	return os.Remove(configFile)
 }
@@ -117,3 +123,15 @@ func SetClientOptions(_ context.Context, configFile string, cliOpt ClientOptions
 
 	return lc.writeToFile(configFile)
 }
+
+// SetReplica updates the replica storage stored in the provided configuration file, nil removes it.
+func SetReplica(_ context.Context, configFile string, ci *blob.ConnectionInfo) error {
+	lc, err := LoadConfigFromFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	lc.Replica = ci
+
+	return lc.writeToFile(configFile)
+}
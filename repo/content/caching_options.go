@@ -3,6 +3,8 @@
 import (
 	"path/filepath"
 	"time"
+
+	"github.com/kopia/kopia/internal/cache"
 )
 
 // DurationSeconds represents the duration in seconds.
@@ -28,7 +30,9 @@ type CachingOptions struct {
 	MinMetadataSweepAge         DurationSeconds `json:"minMetadataSweepAge,omitempty"`
 	MinContentSweepAge          DurationSeconds `json:"minContentSweepAge,omitempty"`
 	MinIndexSweepAge            DurationSeconds `json:"minIndexSweepAge,omitempty"`
+	SharedCacheDirectory        string          `json:"sharedCacheDirectory,omitempty"`
 	HMACSecret                  []byte          `json:"-"`
+	RepositoryUniqueID          []byte          `json:"-"`
 }
 
 // EffectiveMetadataCacheSizeBytes returns the effective metadata cache size.
@@ -64,3 +68,13 @@ func (c *CachingOptions) CacheSubdirOrEmpty(subdir string) string {
 
 	return filepath.Join(c.CacheDirectory, subdir)
 }
+
+// SharedCacheDirectoryOrEmpty returns path to the directory of the repository in the shared cache
+// or empty string if the shared cache is disabled.
+func (c *CachingOptions) SharedCacheDirectoryOrEmpty() string {
+	if c == nil || c.SharedCacheDirectory == "" || len(c.RepositoryUniqueID) == 0 {
+		return ""
+	}
+
+	return cache.SharedDirectoryForRepository(c.SharedCacheDirectory, c.RepositoryUniqueID)
+}
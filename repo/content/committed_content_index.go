@@ -9,6 +9,8 @@
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/kopia/kopia/internal/clock"
@@ -309,6 +311,9 @@ func (c *committedContentIndex) fetchIndexBlobs(ctx context.Context, isPermissiv
 		return nil
 	}
 
+	ctx, span := tracer.Start(ctx, "FetchIndexBlobs", trace.WithAttributes(attribute.Int("missingIndexBlobs", len(ch))))
+	defer span.End()
+
 	c.log.Debugf("Downloading %v new index blobs...", len(indexBlobs))
 
 	eg, ctx := errgroup.WithContext(ctx)
@@ -8,6 +8,7 @@
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/kopia/kopia/internal/cache"
@@ -202,6 +203,9 @@ func (sm *SharedManager) attemptReadPackFileLocalIndex(ctx context.Context, pack
 
 // +checklocks:sm.indexesLock
 func (sm *SharedManager) loadPackIndexesLocked(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "LoadPackIndexes")
+	defer span.End()
+
 	nextSleepTime := 100 * time.Millisecond //nolint:mnd
 
 	for i := range indexLoadAttempts {
@@ -231,11 +235,21 @@ func (sm *SharedManager) loadPackIndexesLocked(ctx context.Context) error {
 			return errors.Wrap(err, "error listing index blobs")
 		}
 
-		var indexBlobIDs []blob.ID
+		var (
+			indexBlobIDs    []blob.ID
+			totalIndexBytes int64
+		)
+
 		for _, b := range indexBlobs {
 			indexBlobIDs = append(indexBlobIDs, b.BlobID)
+			totalIndexBytes += b.Length
 		}
 
+		span.SetAttributes(
+			attribute.Int("attempt", i),
+			attribute.Int("indexBlobs", len(indexBlobIDs)),
+			attribute.Int64("indexBytes", totalIndexBytes))
+
 		err = sm.committedContents.fetchIndexBlobs(ctx, sm.permissiveCacheLoading, indexBlobIDs)
 		if err == nil {
 			err = sm.committedContents.use(ctx, indexBlobIDs, ignoreDeletedBefore)
@@ -446,21 +460,23 @@ func indexBlobCacheSweepSettings(caching *CachingOptions) cache.SweepSettings {
 
 func (sm *SharedManager) setupCachesAndIndexManagers(ctx context.Context, caching *CachingOptions, mr *metrics.Registry) error {
 	dataCache, err := cache.NewContentCache(ctx, sm.st, cache.Options{
-		BaseCacheDirectory: caching.CacheDirectory,
-		CacheSubDir:        "contents",
-		HMACSecret:         caching.HMACSecret,
-		Sweep:              contentCacheSweepSettings(caching),
+		BaseCacheDirectory:   caching.CacheDirectory,
+		CacheSubDir:          "contents",
+		SharedCacheDirectory: caching.SharedCacheDirectoryOrEmpty(),
+		HMACSecret:           caching.HMACSecret,
+		Sweep:                contentCacheSweepSettings(caching),
 	}, mr)
 	if err != nil {
 		return errors.Wrap(err, "unable to initialize content cache")
 	}
 
 	metadataCache, err := cache.NewContentCache(ctx, sm.st, cache.Options{
-		BaseCacheDirectory: caching.CacheDirectory,
-		CacheSubDir:        "metadata",
-		HMACSecret:         caching.HMACSecret,
-		FetchFullBlobs:     true,
-		Sweep:              metadataCacheSizeSweepSettings(caching),
+		BaseCacheDirectory:   caching.CacheDirectory,
+		CacheSubDir:          "metadata",
+		SharedCacheDirectory: caching.SharedCacheDirectoryOrEmpty(),
+		HMACSecret:           caching.HMACSecret,
+		FetchFullBlobs:       true,
+		Sweep:                metadataCacheSizeSweepSettings(caching),
 	}, mr)
 	if err != nil {
 		return errors.Wrap(err, "unable to initialize metadata cache")
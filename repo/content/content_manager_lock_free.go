@@ -184,7 +184,7 @@ func getPackedContentIV(output []byte, contentID ID) []byte {
 }
 
 func (sm *SharedManager) writePackFileNotLocked(ctx context.Context, packFile blob.ID, data gather.Bytes, onUpload func(int64)) error {
-	ctx, span := tracer.Start(ctx, "WritePackFile_"+strings.ToUpper(string(packFile[0:1])), trace.WithAttributes(attribute.String("packFile", string(packFile))))
+	ctx, span := tracer.Start(ctx, "WritePackFile_"+strings.ToUpper(string(packFile[0:1])), trace.WithAttributes(attribute.String("packFile", string(packFile)), attribute.Int("bytes", data.Length())))
 	defer span.End()
 
 	sm.Stats.wroteContent(data.Length())
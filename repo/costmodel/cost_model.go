@@ -0,0 +1,146 @@
+// Package costmodel estimates the cost of storing and accessing the repository in cloud storage.
+package costmodel
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/storagemetrics"
+)
+
+// bytesPerGB is the unit of storage and egress billed by cloud providers (GiB).
+const bytesPerGB = 1 << 30
+
+const requestPriceUnit = 1000
+
+// Model describes the pricing of the storage provider used by the repository.
+type Model struct {
+	Currency       string         `json:"currency"`
+	StorageClasses []StorageClass `json:"storageClasses"`
+	RequestPrices  RequestPrices  `json:"requestPrices"`
+	EgressPerGB    float64        `json:"egressPerGB"`
+}
+
+// StorageClass specifies the monthly price of storing blobs with the provided prefix.
+// An empty prefix applies to all blobs not matched by a longer prefix.
+type StorageClass struct {
+	Prefix          blob.ID `json:"prefix"`
+	Name            string  `json:"name,omitempty"`
+	PricePerGBMonth float64 `json:"pricePerGBMonth"`
+}
+
+// RequestPrices specifies prices of storage requests per 1000 requests.
+type RequestPrices struct {
+	Get    float64 `json:"get"`
+	Put    float64 `json:"put"`
+	List   float64 `json:"list"`
+	Delete float64 `json:"delete"`
+}
+
+// Validate validates the model.
+func (m *Model) Validate() error {
+	seen := map[blob.ID]bool{}
+
+	for _, sc := range m.StorageClasses {
+		if seen[sc.Prefix] {
+			return errors.Errorf("duplicate storage class for prefix %q", sc.Prefix)
+		}
+
+		seen[sc.Prefix] = true
+
+		if sc.PricePerGBMonth < 0 {
+			return errors.Errorf("invalid price of storage class for prefix %q", sc.Prefix)
+		}
+	}
+
+	rp := m.RequestPrices
+	if rp.Get < 0 || rp.Put < 0 || rp.List < 0 || rp.Delete < 0 {
+		return errors.New("invalid request price")
+	}
+
+	if m.EgressPerGB < 0 {
+		return errors.New("invalid egress price")
+	}
+
+	return nil
+}
+
+// SetStorageClass adds or replaces the storage class for its prefix.
+func (m *Model) SetStorageClass(sc StorageClass) {
+	for i := range m.StorageClasses {
+		if m.StorageClasses[i].Prefix == sc.Prefix {
+			m.StorageClasses[i] = sc
+			return
+		}
+	}
+
+	m.StorageClasses = append(m.StorageClasses, sc)
+
+	sort.Slice(m.StorageClasses, func(i, j int) bool {
+		return m.StorageClasses[i].Prefix < m.StorageClasses[j].Prefix
+	})
+}
+
+// StorageClassFor returns the storage class with the longest prefix matching the provided blob ID.
+func (m *Model) StorageClassFor(id blob.ID) StorageClass {
+	var (
+		result StorageClass
+		found  bool
+	)
+
+	for _, sc := range m.StorageClasses {
+		if !strings.HasPrefix(string(id), string(sc.Prefix)) {
+			continue
+		}
+
+		if !found || len(sc.Prefix) > len(result.Prefix) {
+			result = sc
+			found = true
+		}
+	}
+
+	return result
+}
+
+// MonthlyStorageCost returns the monthly cost of storing the provided number of bytes in blobs
+// with the provided ID or prefix.
+func (m *Model) MonthlyStorageCost(id blob.ID, bytes int64) float64 {
+	return float64(bytes) / bytesPerGB * m.StorageClassFor(id).PricePerGBMonth
+}
+
+// UsageCost is the cost of storage usage.
+type UsageCost struct {
+	Requests map[string]float64 `json:"requests"`
+	Egress   float64            `json:"egress"`
+	Total    float64            `json:"total"`
+}
+
+// UsageCost returns the cost of the provided storage usage.
+func (m *Model) UsageCost(u storagemetrics.Usage) UsageCost {
+	pricePerRequest := map[string]float64{
+		storagemetrics.RequestGetBlob:     m.RequestPrices.Get,
+		storagemetrics.RequestGetMetadata: m.RequestPrices.Get,
+		storagemetrics.RequestPutBlob:     m.RequestPrices.Put,
+		storagemetrics.RequestDeleteBlob:  m.RequestPrices.Delete,
+		storagemetrics.RequestListBlobs:   m.RequestPrices.List,
+	}
+
+	result := UsageCost{
+		Requests: map[string]float64{},
+		Egress:   float64(u.DownloadedBytes) / bytesPerGB * m.EgressPerGB,
+	}
+
+	result.Total = result.Egress
+
+	for req, cnt := range u.Requests {
+		c := float64(cnt) / requestPriceUnit * pricePerRequest[req]
+
+		result.Requests[req] = c
+		result.Total += c
+	}
+
+	return result
+}
@@ -0,0 +1,56 @@
+package costmodel
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+//nolint:gochecknoglobals
+var manifestLabels = map[string]string{
+	"type": "costmodel",
+}
+
+// GetModel returns the cost model configured in the repository or the default model
+// for the storage type of the repository if it has not been configured.
+func GetModel(ctx context.Context, rep repo.Repository) (*Model, error) {
+	md, err := rep.FindManifests(ctx, manifestLabels)
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking for cost model manifest")
+	}
+
+	if len(md) == 0 {
+		var storageType string
+
+		if dr, ok := rep.(repo.DirectRepository); ok {
+			storageType = dr.BlobReader().ConnectionInfo().Type
+		}
+
+		m := DefaultModel(storageType)
+
+		return &m, nil
+	}
+
+	m := &Model{}
+	if _, err := rep.GetManifest(ctx, manifest.PickLatestID(md), m); err != nil {
+		return nil, errors.Wrap(err, "error loading manifest")
+	}
+
+	return m, nil
+}
+
+// SetModel sets the cost model of the repository.
+func SetModel(ctx context.Context, rep repo.RepositoryWriter, m *Model) error {
+	if err := m.Validate(); err != nil {
+		return errors.Wrap(err, "invalid cost model")
+	}
+
+	if _, err := rep.ReplaceManifests(ctx, manifestLabels, m); err != nil {
+		return errors.Wrap(err, "put manifest")
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package costmodel_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/storagemetrics"
+	"github.com/kopia/kopia/repo/costmodel"
+)
+
+func TestStorageClassFor(t *testing.T) {
+	m := &costmodel.Model{}
+
+	require.Equal(t, costmodel.StorageClass{}, m.StorageClassFor("p123"))
+
+	m.SetStorageClass(costmodel.StorageClass{Name: "default", PricePerGBMonth: 1})
+	m.SetStorageClass(costmodel.StorageClass{Prefix: "p", Name: "cold", PricePerGBMonth: 0.5})
+	m.SetStorageClass(costmodel.StorageClass{Prefix: "pa", Name: "colder", PricePerGBMonth: 0.25})
+
+	require.Equal(t, "default", m.StorageClassFor("q123").Name)
+	require.Equal(t, "cold", m.StorageClassFor("p123").Name)
+	require.Equal(t, "colder", m.StorageClassFor("pa123").Name)
+
+	// replace existing class.
+	m.SetStorageClass(costmodel.StorageClass{Prefix: "p", Name: "warm", PricePerGBMonth: 2})
+	require.Len(t, m.StorageClasses, 3)
+	require.Equal(t, "warm", m.StorageClassFor("p123").Name)
+
+	require.InDelta(t, 3.0, m.MonthlyStorageCost("p123", 3<<29), 1e-9)
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, (&costmodel.Model{}).Validate())
+
+	for _, m := range costmodel.Presets {
+		require.NoError(t, m.Validate())
+	}
+
+	require.Error(t, (&costmodel.Model{StorageClasses: []costmodel.StorageClass{{Prefix: "p"}, {Prefix: "p"}}}).Validate())
+	require.Error(t, (&costmodel.Model{StorageClasses: []costmodel.StorageClass{{PricePerGBMonth: -1}}}).Validate())
+	require.Error(t, (&costmodel.Model{RequestPrices: costmodel.RequestPrices{List: -1}}).Validate())
+	require.Error(t, (&costmodel.Model{EgressPerGB: -1}).Validate())
+}
+
+func TestDefaultModel(t *testing.T) {
+	require.Empty(t, costmodel.DefaultModel("filesystem").StorageClasses)
+
+	m := costmodel.DefaultModel("s3")
+	m.StorageClasses[0].PricePerGBMonth = 123
+
+	require.NotEqual(t, m.StorageClasses, costmodel.DefaultModel("s3").StorageClasses)
+}
+
+func TestUsageCost(t *testing.T) {
+	m := &costmodel.Model{
+		RequestPrices: costmodel.RequestPrices{Get: 1, Put: 2, List: 3, Delete: 4},
+		EgressPerGB:   10,
+	}
+
+	c := m.UsageCost(storagemetrics.Usage{
+		Requests: map[string]int64{
+			storagemetrics.RequestGetBlob:     1000,
+			storagemetrics.RequestGetMetadata: 500,
+			storagemetrics.RequestPutBlob:     2000,
+			storagemetrics.RequestListBlobs:   0,
+			storagemetrics.RequestDeleteBlob:  1000,
+		},
+		DownloadedBytes: 1 << 29,
+	})
+
+	require.InDelta(t, 1.0, c.Requests[storagemetrics.RequestGetBlob], 1e-9)
+	require.InDelta(t, 0.5, c.Requests[storagemetrics.RequestGetMetadata], 1e-9)
+	require.InDelta(t, 4.0, c.Requests[storagemetrics.RequestPutBlob], 1e-9)
+	require.InDelta(t, 4.0, c.Requests[storagemetrics.RequestDeleteBlob], 1e-9)
+	require.InDelta(t, 5.0, c.Egress, 1e-9)
+	require.InDelta(t, 14.5, c.Total, 1e-9)
+}
+
+func TestStorageCostByPrefix(t *testing.T) {
+	ctx := testlogging.Context(t)
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	for id, length := range map[blob.ID]int{
+		"kopia.repository": 10,
+		"kopia.blobcfg":    20,
+		"p1":               1 << 20,
+		"p2":               1 << 20,
+		"pa1":              1 << 20,
+		"q1":               100,
+	} {
+		require.NoError(t, st.PutBlob(ctx, id, gather.FromSlice(make([]byte, length)), blob.PutOptions{}))
+	}
+
+	m := &costmodel.Model{}
+	m.SetStorageClass(costmodel.StorageClass{Name: "standard", PricePerGBMonth: 1024})
+	m.SetStorageClass(costmodel.StorageClass{Prefix: "pa", Name: "archive", PricePerGBMonth: 512})
+
+	result, err := costmodel.StorageCostByPrefix(ctx, st, m)
+	require.NoError(t, err)
+	require.Len(t, result, 3)
+
+	require.Equal(t, blob.ID("kopia."), result[0].Prefix)
+	require.Equal(t, 2, result[0].BlobCount)
+	require.EqualValues(t, 30, result[0].TotalBytes)
+
+	require.Equal(t, blob.ID("p"), result[1].Prefix)
+	require.Equal(t, "(multiple)", result[1].StorageClass)
+	require.Equal(t, 3, result[1].BlobCount)
+	require.InDelta(t, 2.5, result[1].MonthlyCost, 1e-9)
+
+	require.Equal(t, blob.ID("q"), result[2].Prefix)
+	require.Equal(t, "standard", result[2].StorageClass)
+}
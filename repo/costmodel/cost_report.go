@@ -0,0 +1,78 @@
+package costmodel
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// formatBlobPrefix is the common prefix of blobs describing the repository format.
+const formatBlobPrefix = "kopia."
+
+// PrefixCost is the monthly cost of storing blobs with a common prefix.
+type PrefixCost struct {
+	Prefix       blob.ID `json:"prefix"`
+	StorageClass string  `json:"storageClass,omitempty"`
+	BlobCount    int     `json:"blobCount"`
+	TotalBytes   int64   `json:"totalBytes"`
+	MonthlyCost  float64 `json:"monthlyCost"`
+}
+
+// reportPrefix returns the prefix under which the blob is reported, which is the first
+// character of the blob ID for all blobs except those describing the repository format.
+func reportPrefix(id blob.ID) blob.ID {
+	if strings.HasPrefix(string(id), formatBlobPrefix) {
+		return formatBlobPrefix
+	}
+
+	return id[0:1]
+}
+
+// StorageCostByPrefix lists blobs in the storage and returns the monthly cost of storing them,
+// grouped by blob prefix.
+func StorageCostByPrefix(ctx context.Context, br blob.Reader, m *Model) ([]*PrefixCost, error) {
+	byPrefix := map[blob.ID]*PrefixCost{}
+
+	if err := br.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		if bm.BlobID == "" {
+			return nil
+		}
+
+		prefix := reportPrefix(bm.BlobID)
+		sc := m.StorageClassFor(bm.BlobID)
+
+		pc := byPrefix[prefix]
+		if pc == nil {
+			pc = &PrefixCost{Prefix: prefix, StorageClass: sc.Name}
+			byPrefix[prefix] = pc
+		}
+
+		if pc.StorageClass != sc.Name {
+			pc.StorageClass = "(multiple)"
+		}
+
+		pc.BlobCount++
+		pc.TotalBytes += bm.Length
+		pc.MonthlyCost += m.MonthlyStorageCost(bm.BlobID, bm.Length)
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing blobs")
+	}
+
+	var result []*PrefixCost
+
+	for _, pc := range byPrefix {
+		result = append(result, pc)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Prefix < result[j].Prefix
+	})
+
+	return result, nil
+}
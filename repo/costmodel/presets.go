@@ -0,0 +1,47 @@
+package costmodel
+
+// Presets are approximate list prices in USD of standard storage classes of popular cloud storage
+// providers in their primary regions, keyed by storage type. Actual prices vary by region, storage
+// class, volume and over time, so they should be adjusted to match the provider's price list.
+//
+//nolint:gochecknoglobals,mnd
+var Presets = map[string]Model{
+	"s3": {
+		Currency:       "USD",
+		StorageClasses: []StorageClass{{Name: "STANDARD", PricePerGBMonth: 0.023}},
+		RequestPrices:  RequestPrices{Get: 0.0004, Put: 0.005, List: 0.005},
+		EgressPerGB:    0.09,
+	},
+	"gcs": {
+		Currency:       "USD",
+		StorageClasses: []StorageClass{{Name: "STANDARD", PricePerGBMonth: 0.02}},
+		RequestPrices:  RequestPrices{Get: 0.0004, Put: 0.005, List: 0.005},
+		EgressPerGB:    0.12,
+	},
+	"azureBlob": {
+		Currency:       "USD",
+		StorageClasses: []StorageClass{{Name: "Hot", PricePerGBMonth: 0.018}},
+		RequestPrices:  RequestPrices{Get: 0.0004, Put: 0.005, List: 0.005},
+		EgressPerGB:    0.087,
+	},
+	"b2": {
+		Currency:       "USD",
+		StorageClasses: []StorageClass{{Name: "B2", PricePerGBMonth: 0.006}},
+		RequestPrices:  RequestPrices{Get: 0.0004, List: 0.004},
+		EgressPerGB:    0.01,
+	},
+}
+
+// DefaultModel returns the cost model for the provided storage type, which has no cost
+// if there is no preset for it.
+func DefaultModel(storageType string) Model {
+	p, ok := Presets[storageType]
+	if !ok {
+		return Model{Currency: "USD"}
+	}
+
+	// do not share storage classes with the preset.
+	p.StorageClasses = append([]StorageClass(nil), p.StorageClasses...)
+
+	return p
+}
@@ -98,6 +98,9 @@ type LocalConfig struct {
 
 	Caching *content.CachingOptions `json:"caching,omitempty"`
 
+	// Replica is the optional storage kept in sync with the repository storage by the repository server.
+	Replica *blob.ConnectionInfo `json:"replica,omitempty"`
+
 	ClientOptions
 }
 
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"github.com/kopia/kopia/internal/audit"
 	"github.com/kopia/kopia/internal/epoch"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/content/indexblob"
@@ -16,7 +17,7 @@ func GetLockingStoragePrefixes() []string {
 	}
 
 	prefixes = append(prefixes, indexblob.V0IndexBlobPrefix, epoch.EpochManagerIndexUberPrefix, format.KopiaRepositoryBlobID,
-		format.KopiaBlobCfgBlobID)
+		format.KopiaBlobCfgBlobID, string(audit.BlobPrefix))
 
 	return prefixes
 }
@@ -0,0 +1,212 @@
+package maintenance
+
+import (
+	"cmp"
+	"context"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/format"
+)
+
+// BlobRetentionStatusOptions provides options for reporting blob retention.
+type BlobRetentionStatusOptions struct {
+	Parallel int
+
+	// Repair applies the retention configured in the repository to blobs which are not locked.
+	Repair bool
+}
+
+// PrefixRetentionStatus summarizes retention of blobs with a common prefix.
+type PrefixRetentionStatus struct {
+	Prefix              blob.ID                    `json:"prefix"`
+	Blobs               int                        `json:"blobs"`
+	Modes               map[blob.RetentionMode]int `json:"modes,omitempty"`
+	EarliestRetainUntil time.Time                  `json:"earliestRetainUntil"`
+	LatestRetainUntil   time.Time                  `json:"latestRetainUntil"`
+
+	// blobs without a lock or with an expired lock.
+	Unlocked []blob.ID `json:"unlocked,omitempty"`
+
+	// blobs which were locked by repair.
+	Repaired int `json:"repaired,omitempty"`
+}
+
+func (s *PrefixRetentionStatus) add(bm blob.Metadata, mode blob.RetentionMode, retainUntil time.Time, locked bool) {
+	s.Blobs++
+
+	if !locked {
+		s.Unlocked = append(s.Unlocked, bm.BlobID)
+		return
+	}
+
+	if s.Modes == nil {
+		s.Modes = map[blob.RetentionMode]int{}
+	}
+
+	s.Modes[mode]++
+
+	if s.EarliestRetainUntil.IsZero() || retainUntil.Before(s.EarliestRetainUntil) {
+		s.EarliestRetainUntil = retainUntil
+	}
+
+	if retainUntil.After(s.LatestRetainUntil) {
+		s.LatestRetainUntil = retainUntil
+	}
+}
+
+// BlobRetentionStatus describes retention of blobs which are locked by the repository.
+type BlobRetentionStatus struct {
+	RetentionMode   blob.RetentionMode       `json:"retentionMode,omitempty"`
+	RetentionPeriod time.Duration            `json:"retentionPeriod,omitempty"`
+	Prefixes        []*PrefixRetentionStatus `json:"prefixes"`
+}
+
+// UnlockedBlobs returns the number of blobs which are not locked.
+func (s *BlobRetentionStatus) UnlockedBlobs() int {
+	var total int
+
+	for _, ps := range s.Prefixes {
+		total += len(ps.Unlocked)
+	}
+
+	return total
+}
+
+// GetBlobRetentionStatus reports retention of all blobs in the storage which are locked by the repository
+// and optionally locks blobs which are missing locks. The storage or one of the storages wrapped by it
+// must implement blob.RetentionReader.
+func GetBlobRetentionStatus(ctx context.Context, st blob.Storage, blobCfg format.BlobStorageConfiguration, opt BlobRetentionStatusOptions) (*BlobRetentionStatus, error) {
+	const retentionQueueSize = 100
+
+	rr, ok := blob.As[blob.RetentionReader](st)
+	if !ok {
+		return nil, errors.Errorf("storage type '%v' does not report blob retention", st.ConnectionInfo().Type)
+	}
+
+	if opt.Repair && !blobCfg.IsRetentionEnabled() {
+		return nil, errors.New("object lock retention is not enabled in the repository")
+	}
+
+	if opt.Parallel == 0 {
+		opt.Parallel = runtime.NumCPU() * parallelBlobRetainCPUMultiplier
+	}
+
+	result := &BlobRetentionStatus{
+		RetentionMode:   blobCfg.RetentionMode,
+		RetentionPeriod: blobCfg.RetentionPeriod,
+	}
+
+	type prefixBlob struct {
+		bm blob.Metadata
+		ps *PrefixRetentionStatus
+	}
+
+	var (
+		mu        sync.Mutex
+		failedCnt int
+	)
+
+	now := clock.Now()
+	blobs := make(chan prefixBlob, retentionQueueSize)
+
+	extendOpts := blob.ExtendOptions{
+		RetentionMode:   blobCfg.RetentionMode,
+		RetentionPeriod: blobCfg.RetentionPeriod,
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	var listers sync.WaitGroup
+
+	for _, pfx := range repo.GetLockingStoragePrefixes() {
+		ps := &PrefixRetentionStatus{Prefix: blob.ID(pfx)}
+		result.Prefixes = append(result.Prefixes, ps)
+
+		listers.Add(1)
+
+		eg.Go(func() error {
+			defer listers.Done()
+
+			return errors.Wrapf(st.ListBlobs(ctx, ps.Prefix, func(bm blob.Metadata) error {
+				select {
+				case blobs <- prefixBlob{bm, ps}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}), "error listing blobs with prefix %v", ps.Prefix)
+		})
+	}
+
+	go func() {
+		listers.Wait()
+		close(blobs)
+	}()
+
+	for range opt.Parallel {
+		eg.Go(func() error {
+			for b := range blobs {
+				mode, retainUntil, err := rr.GetRetention(ctx, b.bm.BlobID)
+				if err != nil {
+					return errors.Wrapf(err, "unable to get retention of %v", b.bm.BlobID)
+				}
+
+				locked := mode != "" && retainUntil.After(now)
+				repaired := false
+
+				if !locked && opt.Repair {
+					if err := st.ExtendBlobRetention(ctx, b.bm.BlobID, extendOpts); err != nil {
+						log(ctx).Errorf("Failed to lock blob %v: %v", b.bm.BlobID, err)
+
+						mu.Lock()
+						failedCnt++
+						mu.Unlock()
+					} else {
+						if mode, retainUntil, err = rr.GetRetention(ctx, b.bm.BlobID); err != nil {
+							return errors.Wrapf(err, "unable to get retention of %v", b.bm.BlobID)
+						}
+
+						locked = mode != "" && retainUntil.After(now)
+						repaired = locked
+					}
+				}
+
+				mu.Lock()
+				b.ps.add(b.bm, mode, retainUntil, locked)
+
+				if repaired {
+					b.ps.Repaired++
+				}
+				mu.Unlock()
+			}
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	for _, ps := range result.Prefixes {
+		slices.SortFunc(ps.Unlocked, func(a, b blob.ID) int {
+			return cmp.Compare(a, b)
+		})
+	}
+
+	if failedCnt > 0 {
+		return result, errors.Errorf("failed to lock %v blobs", failedCnt)
+	}
+
+	return result, nil
+}
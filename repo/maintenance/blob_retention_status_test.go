@@ -0,0 +1,113 @@
+package maintenance_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/retrying"
+	"github.com/kopia/kopia/repo/encryption"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/maintenance"
+	"github.com/kopia/kopia/repo/object"
+)
+
+const retentionTestStorageType = "retention-status-test"
+
+// retentionTestStorages holds storages opened by name using blob.NewStorage.
+var retentionTestStorages sync.Map
+
+type retentionTestOptions struct {
+	Name string `json:"name"`
+}
+
+func init() {
+	// like real providers, the storage is wrapped in retrying.NewWrapper.
+	blob.AddSupportedStorage(retentionTestStorageType, retentionTestOptions{}, func(_ context.Context, o *retentionTestOptions, _ bool) (blob.Storage, error) {
+		st, _ := retentionTestStorages.Load(o.Name)
+
+		return retrying.NewWrapper(st.(blob.Storage)), nil //nolint:forcetypeassert
+	})
+}
+
+func (s *formatSpecificTestSuite) TestBlobRetentionStatus(t *testing.T) {
+	blobCfg := format.BlobStorageConfiguration{
+		RetentionMode:   blob.Governance,
+		RetentionPeriod: 24 * time.Hour,
+	}
+
+	ta := faketime.NewClockTimeWithOffset(0)
+
+	ctx, env := repotesting.NewEnvironment(t, s.formatVersion, repotesting.Options{
+		OpenOptions: func(o *repo.Options) {
+			o.TimeNowFunc = ta.NowFunc()
+		},
+		NewRepositoryOptions: func(nro *repo.NewRepositoryOptions) {
+			nro.BlockFormat.Encryption = encryption.DefaultAlgorithm
+			nro.BlockFormat.MasterKey = testMasterKey
+			nro.BlockFormat.Hash = blockFormatHash
+			nro.BlockFormat.HMACSecret = testHMACSecret
+			nro.RetentionMode = blobCfg.RetentionMode
+			nro.RetentionPeriod = blobCfg.RetentionPeriod
+		},
+	})
+
+	w := env.RepositoryWriter.NewObjectWriter(ctx, object.WriterOptions{})
+	io.WriteString(w, "hello world!")
+	w.Result()
+	w.Close()
+
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	// a pack blob written without a lock.
+	st := testutil.EnsureType[blobtesting.RetentionStorage](t, env.RootStorage())
+	require.NoError(t, st.PutBlob(ctx, "pdeadbeef", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+	// open the storage the way the CLI does.
+	retentionTestStorages.Store(t.Name(), st)
+
+	opened, err := blob.NewStorage(ctx, blob.ConnectionInfo{Type: retentionTestStorageType, Config: &retentionTestOptions{Name: t.Name()}}, false)
+	require.NoError(t, err)
+
+	status, err := maintenance.GetBlobRetentionStatus(ctx, opened, blobCfg, maintenance.BlobRetentionStatusOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, status.UnlockedBlobs())
+
+	packs := status.Prefixes[0]
+	require.Equal(t, blob.ID("p"), packs.Prefix)
+	require.Equal(t, []blob.ID{"pdeadbeef"}, packs.Unlocked)
+	require.Equal(t, packs.Blobs-1, packs.Modes[blob.Governance])
+	require.WithinDuration(t, ta.NowFunc()().Add(blobCfg.RetentionPeriod), packs.LatestRetainUntil, time.Minute)
+
+	_, err = maintenance.GetBlobRetentionStatus(ctx, st, format.BlobStorageConfiguration{}, maintenance.BlobRetentionStatusOptions{Repair: true})
+	require.ErrorContains(t, err, "object lock retention is not enabled in the repository")
+
+	status, err = maintenance.GetBlobRetentionStatus(ctx, opened, blobCfg, maintenance.BlobRetentionStatusOptions{Repair: true})
+	require.NoError(t, err)
+	require.Equal(t, 0, status.UnlockedBlobs())
+	require.Equal(t, 1, status.Prefixes[0].Repaired)
+
+	mode, retainUntil, err := st.GetRetention(ctx, "pdeadbeef")
+	require.NoError(t, err)
+	require.Equal(t, blob.Governance, mode)
+	require.WithinDuration(t, ta.NowFunc()().Add(blobCfg.RetentionPeriod), retainUntil, time.Minute)
+
+	status, err = maintenance.GetBlobRetentionStatus(ctx, st, blobCfg, maintenance.BlobRetentionStatusOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 0, status.UnlockedBlobs())
+	require.Equal(t, 0, status.Prefixes[0].Repaired)
+
+	_, err = maintenance.GetBlobRetentionStatus(ctx, retrying.NewWrapper(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)), blobCfg, maintenance.BlobRetentionStatusOptions{})
+	require.ErrorContains(t, err, "does not report blob retention")
+}
@@ -3,10 +3,12 @@
 import (
 	"context"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/audit"
 	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
@@ -47,11 +49,20 @@ func CleanupLogs(ctx context.Context, rep repo.DirectRepositoryWriter, opt LogRe
 		opt.TimeFunc = clock.Now
 	}
 
-	allLogBlobs, err := blob.ListAllBlobs(ctx, rep.BlobStorage(), "_")
+	allBlobs, err := blob.ListAllBlobs(ctx, rep.BlobStorage(), "_")
 	if err != nil {
 		return nil, errors.Wrap(err, "error listing logs")
 	}
 
+	// audit trail is not subject to log retention.
+	var allLogBlobs []blob.Metadata
+
+	for _, bm := range allBlobs {
+		if !strings.HasPrefix(string(bm.BlobID), string(audit.BlobPrefix)) {
+			allLogBlobs = append(allLogBlobs, bm)
+		}
+	}
+
 	// sort by time so that most recent are first
 	sort.Slice(allLogBlobs, func(i, j int) bool {
 		return allLogBlobs[i].Timestamp.After(allLogBlobs[j].Timestamp)
@@ -38,6 +38,7 @@
 // Task IDs.
 const (
 	TaskSnapshotGarbageCollection    = "snapshot-gc"
+	TaskCleanupExpiredACLs           = "cleanup-expired-acls"
 	TaskDeleteOrphanedBlobsQuick     = "quick-delete-blobs"
 	TaskDeleteOrphanedBlobsFull      = "full-delete-blobs"
 	TaskRewriteContentsQuick         = "quick-rewrite-contents"
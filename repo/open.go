@@ -12,6 +12,7 @@
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/audit"
 	"github.com/kopia/kopia/internal/cache"
 	"github.com/kopia/kopia/internal/cacheprot"
 	"github.com/kopia/kopia/internal/crypto"
@@ -25,6 +26,7 @@
 	"github.com/kopia/kopia/repo/blob/readonly"
 	"github.com/kopia/kopia/repo/blob/storagemetrics"
 	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/repo/blob/tracing"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/format"
 	"github.com/kopia/kopia/repo/logging"
@@ -66,12 +68,13 @@
 
 // Options provides configuration parameters for connection to a repository.
 type Options struct {
-	TraceStorage        bool                       // Logs all storage access using provided Printf-style function
-	TimeNowFunc         func() time.Time           // Time provider
-	DisableInternalLog  bool                       // Disable internal log
-	UpgradeOwnerID      string                     // Owner-ID of any upgrade in progress, when this is not set the access may be restricted
-	DoNotWaitForUpgrade bool                       // Disable the exponential forever backoff on an upgrade lock.
-	BeforeFlush         []RepositoryWriterCallback // list of callbacks to invoke before every flush
+	TraceStorage        bool                               // Logs all storage access using provided Printf-style function
+	TimeNowFunc         func() time.Time                   // Time provider
+	DisableInternalLog  bool                               // Disable internal log
+	UpgradeOwnerID      string                             // Owner-ID of any upgrade in progress, when this is not set the access may be restricted
+	DoNotWaitForUpgrade bool                               // Disable the exponential forever backoff on an upgrade lock.
+	BeforeFlush         []RepositoryWriterCallback         // list of callbacks to invoke before every flush
+	WrapStorage         func(st blob.Storage) blob.Storage // optional wrapper of the underlying storage, used to observe blob changes
 
 	OnFatalError func(err error) // function to invoke when repository encounters a fatal error, usually invokes os.Exit
 
@@ -203,7 +206,15 @@ func(ctx context.Context) error {
 		beforeFlush:      options.BeforeFlush,
 	}
 
-	return openGRPCAPIRepository(ctx, si, password, par)
+	rep, err := openGRPCAPIRepository(ctx, si, password, par)
+	if err != nil {
+		// release the content cache when the server rejects the connection.
+		closer.Close(ctx) //nolint:errcheck
+
+		return nil, err
+	}
+
+	return rep, nil
 }
 
 // openDirect opens the repository that directly manipulates blob storage..
@@ -225,6 +236,10 @@ func openDirect(ctx context.Context, configFile string, lc *LocalConfig, passwor
 		st = readonly.NewWrapper(st)
 	}
 
+	if options.WrapStorage != nil {
+		st = options.WrapStorage(st)
+	}
+
 	cliOpts := lc.ApplyDefaults(ctx, "Repository in "+st.DisplayName())
 
 	r, err := openWithConfig(ctx, st, cliOpts, password, options, lc.Caching, configFile)
@@ -248,7 +263,7 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 	}
 
 	mr := metrics.NewRegistry()
-	st = storagemetrics.NewWrapper(st, mr)
+	st = tracing.NewWrapper(storagemetrics.NewWrapper(st, mr))
 
 	fmgr, ferr := format.NewManager(ctx, st, cacheOpts.CacheDirectory, cliOpts.FormatBlobCacheDuration, password, cmOpts.TimeNow)
 	if ferr != nil {
@@ -265,6 +280,8 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 		return nil, ferr
 	}
 
+	cacheOpts.RepositoryUniqueID = fmgr.UniqueID()
+
 	limits := throttlingLimitsFromConnectionInfo(ctx, st.ConnectionInfo())
 	if cliOpts.Throttling != nil {
 		limits = *cliOpts.Throttling
@@ -345,9 +362,23 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 		return nil, errors.Wrap(ferr, "unable to open manifests")
 	}
 
+	openTime := cmOpts.TimeNow()
+
 	closer := newRefCountedCloser(
 		scm.CloseShared,
 		dw.Wait,
+		func(ctx context.Context) error {
+			if configFile == "" {
+				return nil
+			}
+
+			// failure to record storage usage is not fatal.
+			if err := recordStorageUsage(ctx, configFile, mr, openTime); err != nil {
+				log(ctx).Debugf("unable to record storage usage: %v", err)
+			}
+
+			return nil
+		},
 		mr.Close,
 		st.Close,
 	)
@@ -358,6 +389,7 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 		blobs: st,
 		mmgr:  manifests,
 		sm:    scm,
+		audit: &audit.Recorder{},
 		immutableDirectRepositoryParameters: immutableDirectRepositoryParameters{
 			cachingOptions:   *cacheOpts,
 			fmgr:             fmgr,
@@ -0,0 +1,161 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/atomicfile"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Pending changes are persisted in the state file, so that changes recorded but not yet replicated
+// survive restarts and crashes. Each recorded change is appended to the file as a JSON line and
+// the file is rewritten with the remaining changes after each sync.
+
+const journalFilePerm = 0o600
+
+// journalEntry is a single pending change persisted in the state file.
+type journalEntry struct {
+	BlobID  blob.ID   `json:"id"`
+	Deleted bool      `json:"deleted,omitempty"`
+	Length  int64     `json:"length,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+func (e *journalEntry) change() change {
+	return change{deleted: e.Deleted, length: e.Length, time: e.Time}
+}
+
+// loadJournalLocked merges pending changes persisted in the state file by previous runs
+// with the changes recorded in memory. It is only done once.
+//
+// +checklocks:r.mu
+func (r *Replicator) loadJournalLocked(ctx context.Context) {
+	if r.opt.StateFile == "" || r.journalLoaded {
+		return
+	}
+
+	r.journalLoaded = true
+
+	data, err := os.ReadFile(r.opt.StateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log(ctx).Errorf("unable to read replication state file: %v", err)
+		}
+
+		return
+	}
+
+	persisted := map[blob.ID]change{}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var e journalEntry
+
+		// the last line may be truncated if the process crashed while appending it.
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.BlobID == "" {
+			continue
+		}
+
+		c := e.change()
+		if old, ok := persisted[e.BlobID]; ok && old.time.Before(c.time) {
+			c.time = old.time
+		}
+
+		persisted[e.BlobID] = c
+	}
+
+	// changes recorded in memory are more recent than the persisted ones.
+	for id, c := range r.pending {
+		if old, ok := persisted[id]; ok && old.time.Before(c.time) {
+			c.time = old.time
+		}
+
+		persisted[id] = c
+	}
+
+	log(ctx).Debugf("loaded %v pending changes from %v", len(persisted), r.opt.StateFile)
+
+	r.pending = persisted
+}
+
+// appendJournalLocked persists the provided change in the state file.
+//
+// +checklocks:r.mu
+func (r *Replicator) appendJournalLocked(ctx context.Context, id blob.ID, c change) {
+	if r.opt.StateFile == "" {
+		return
+	}
+
+	line, err := json.Marshal(&journalEntry{id, c.deleted, c.length, c.time})
+	if err != nil {
+		log(ctx).Errorf("unable to serialize pending change: %v", err)
+		return
+	}
+
+	if r.journal == nil {
+		f, err := os.OpenFile(r.opt.StateFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, journalFilePerm) //nolint:gosec
+		if err != nil {
+			log(ctx).Errorf("unable to open replication state file: %v", err)
+			return
+		}
+
+		r.journal = f
+	}
+
+	if _, err := r.journal.Write(append(line, '\n')); err != nil {
+		log(ctx).Errorf("unable to persist pending change of %v: %v", id, err)
+	}
+}
+
+// rewriteJournalLocked replaces the contents of the state file with the current pending changes,
+// which drops changes that have been replicated.
+//
+// +checklocks:r.mu
+func (r *Replicator) rewriteJournalLocked(ctx context.Context) {
+	if r.opt.StateFile == "" || !r.journalLoaded {
+		return
+	}
+
+	r.closeJournalLocked()
+
+	var buf bytes.Buffer
+
+	for id, c := range r.pending {
+		line, err := json.Marshal(&journalEntry{id, c.deleted, c.length, c.time})
+		if err != nil {
+			log(ctx).Errorf("unable to serialize pending change: %v", err)
+			return
+		}
+
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if err := atomicfile.Write(r.opt.StateFile, &buf); err != nil {
+		log(ctx).Errorf("unable to write replication state file: %v", errors.Wrap(err, r.opt.StateFile))
+	}
+}
+
+// +checklocks:r.mu
+func (r *Replicator) closeJournalLocked() {
+	if r.journal != nil {
+		r.journal.Close() //nolint:errcheck
+		r.journal = nil
+	}
+}
+
+// Close releases resources held by the replicator and closes the replica storage.
+func (r *Replicator) Close(ctx context.Context) error {
+	r.mu.Lock()
+	r.closeJournalLocked()
+	r.mu.Unlock()
+
+	return errors.Wrap(r.dst.Close(ctx), "error closing replica storage")
+}
@@ -0,0 +1,567 @@
+// Package replication keeps a replica of repository blobs in another storage up-to-date.
+//
+// Changes made to the repository storage are recorded by the storage wrapper returned
+// from Replicator.WrapStorage and copied to the replica incrementally by Sync.
+// Blobs are copied in an order that keeps the replica a consistent repository at all
+// times: pack blobs are copied before the index blobs that reference them and the format
+// blobs are copied last, while deletions happen in the reverse order.
+//
+// Changes made by other clients directly to the storage are not observed by the wrapper
+// and are picked up by Reconcile, which compares complete lists of blobs.
+package replication
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/epoch"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/content/indexblob"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("kopia/replication")
+
+const defaultParallelism = 4
+
+// blob classes, in the order in which new blobs are copied to the replica.
+const (
+	classData   = iota // pack blobs
+	classOther         // session markers, logs, etc.
+	classIndex         // index blobs referencing pack blobs
+	classFormat        // repository format and configuration blobs
+)
+
+//nolint:gochecknoglobals
+var (
+	copyOrder   = []int{classData, classOther, classIndex, classFormat}
+	deleteOrder = []int{classIndex, classOther, classData, classFormat}
+)
+
+// Options provides replication options.
+type Options struct {
+	Parallelism int    // number of blobs copied in parallel
+	Verify      bool   // verify the length of each blob after copying it, contents are only compared by Verify
+	StateFile   string // optional local file where pending changes are persisted across restarts
+}
+
+// Status describes the state of replication.
+type Status struct {
+	PendingBlobs        int       `json:"pendingBlobs"`
+	PendingBytes        int64     `json:"pendingBytes"`
+	OldestPendingChange time.Time `json:"oldestPendingChange,omitempty"`
+
+	LastSyncTime      time.Time `json:"lastSync,omitempty"`
+	LastSyncError     string    `json:"lastSyncError,omitempty"`
+	LastReconcileTime time.Time `json:"lastReconcile,omitempty"`
+
+	CopiedBlobs          int64 `json:"copiedBlobs"`
+	CopiedBytes          int64 `json:"copiedBytes"`
+	DeletedBlobs         int64 `json:"deletedBlobs"`
+	VerificationFailures int64 `json:"verificationFailures"`
+}
+
+// Lag returns how long the oldest change not yet copied to the replica has been waiting.
+func (s Status) Lag(now time.Time) time.Duration {
+	if s.OldestPendingChange.IsZero() {
+		return 0
+	}
+
+	return now.Sub(s.OldestPendingChange)
+}
+
+// VerifyResult describes differences between the source and the replica.
+type VerifyResult struct {
+	Checked    int       `json:"checked"`
+	Missing    []blob.ID `json:"missing"`    // present in source, absent in replica
+	Mismatched []blob.ID `json:"mismatched"` // different length or contents
+	Extra      []blob.ID `json:"extra"`      // present in replica, absent in source
+}
+
+// InSync returns true if the replica has no differences.
+func (r *VerifyResult) InSync() bool {
+	return len(r.Missing)+len(r.Mismatched)+len(r.Extra) == 0
+}
+
+type change struct {
+	deleted bool
+	length  int64
+	time    time.Time // time of the oldest change not copied to the replica
+}
+
+// Replicator copies changes made to the repository storage to the replica.
+type Replicator struct {
+	dst blob.Storage
+	opt Options
+
+	// serializes Sync and Reconcile.
+	syncMutex sync.Mutex
+
+	mu sync.Mutex
+	// +checklocks:mu
+	pending map[blob.ID]change
+	// +checklocks:mu
+	status Status
+	// +checklocks:mu
+	journal *os.File
+	// +checklocks:mu
+	journalLoaded bool
+	// +checklocks:mu
+	retention format.BlobStorageConfiguration
+}
+
+// New creates a Replicator which copies blobs to the provided replica storage.
+func New(dst blob.Storage, opt Options) *Replicator {
+	if opt.Parallelism <= 0 {
+		opt.Parallelism = defaultParallelism
+	}
+
+	return &Replicator{
+		dst:     dst,
+		opt:     opt,
+		pending: map[blob.ID]change{},
+	}
+}
+
+// Replica returns the replica storage.
+func (r *Replicator) Replica() blob.Storage {
+	return r.dst
+}
+
+// SetRetention sets the object lock retention applied to replicated blobs, which should match
+// the blob storage configuration of the repository. Like in the repository, retention is only
+// applied to blobs with prefixes returned by repo.GetLockingStoragePrefixes().
+func (r *Replicator) SetRetention(blobCfg format.BlobStorageConfiguration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retention = blobCfg
+}
+
+// putOptions returns the options used to write the provided blob to the replica.
+func (r *Replicator) putOptions(id blob.ID) blob.PutOptions {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.retention.IsRetentionEnabled() {
+		return blob.PutOptions{}
+	}
+
+	for _, prefix := range repo.GetLockingStoragePrefixes() {
+		if strings.HasPrefix(string(id), prefix) {
+			return blob.PutOptions{
+				RetentionMode:   r.retention.RetentionMode,
+				RetentionPeriod: r.retention.RetentionPeriod,
+			}
+		}
+	}
+
+	return blob.PutOptions{}
+}
+
+// Status returns the current status of the replication.
+func (r *Replicator) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.status
+	s.PendingBlobs = len(r.pending)
+	s.PendingBytes = 0
+	s.OldestPendingChange = time.Time{}
+
+	for _, c := range r.pending {
+		if !c.deleted {
+			s.PendingBytes += c.length
+		}
+
+		if s.OldestPendingChange.IsZero() || c.time.Before(s.OldestPendingChange) {
+			s.OldestPendingChange = c.time
+		}
+	}
+
+	return s
+}
+
+func (r *Replicator) recordChange(ctx context.Context, id blob.ID, c change) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.recordChangeLocked(id, c)
+	r.appendJournalLocked(ctx, id, c)
+}
+
+// +checklocks:r.mu
+func (r *Replicator) recordChangeLocked(id blob.ID, c change) {
+	if old, ok := r.pending[id]; ok && old.time.Before(c.time) {
+		// keep the time of the oldest change for accurate lag reporting.
+		c.time = old.time
+	}
+
+	r.pending[id] = c
+}
+
+// takePending returns all pending changes and clears them.
+func (r *Replicator) takePending() map[blob.ID]change {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.pending
+	r.pending = map[blob.ID]change{}
+
+	return p
+}
+
+// restorePending puts back changes that could not be replicated, unless the blob has been changed again since.
+func (r *Replicator) restorePending(changes map[blob.ID]change) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, c := range changes {
+		if newer, ok := r.pending[id]; ok {
+			newer.time = c.time
+			r.pending[id] = newer
+
+			continue
+		}
+
+		r.pending[id] = c
+	}
+}
+
+// Sync copies all pending changes to the replica.
+func (r *Replicator) Sync(ctx context.Context, src blob.Reader) error {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+
+	return r.syncLocked(ctx, src)
+}
+
+func (r *Replicator) syncLocked(ctx context.Context, src blob.Reader) error {
+	r.mu.Lock()
+	r.loadJournalLocked(ctx)
+	r.mu.Unlock()
+
+	changes := r.takePending()
+
+	err := r.replicateChanges(ctx, src, changes)
+
+	// whatever remains in changes has not been replicated.
+	r.restorePending(changes)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rewriteJournalLocked(ctx)
+
+	r.status.LastSyncTime = clock.Now()
+	r.status.LastSyncError = ""
+
+	if err != nil {
+		r.status.LastSyncError = err.Error()
+	}
+
+	return err
+}
+
+// replicateChanges replicates the provided changes, removing successfully replicated ones from the map.
+func (r *Replicator) replicateChanges(ctx context.Context, src blob.Reader, changes map[blob.ID]change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	log(ctx).Debugf("replicating %v changes to %v", len(changes), r.dst.DisplayName())
+
+	for _, class := range copyOrder {
+		// stop at the first class that failed, so that the replica never has blobs that reference missing ones.
+		if err := r.runParallel(ctx, changes, class, false, func(ctx context.Context, id blob.ID) error {
+			return r.copyBlob(ctx, src, id)
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, class := range deleteOrder {
+		if err := r.runParallel(ctx, changes, class, true, r.deleteBlob); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Replicator) runParallel(ctx context.Context, changes map[blob.ID]change, class int, deleted bool, f func(ctx context.Context, id blob.ID) error) error {
+	var ids []blob.ID
+
+	for id, c := range changes {
+		if c.deleted == deleted && blobClass(id) == class {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.Sort(ids)
+
+	var doneMutex sync.Mutex
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(r.opt.Parallelism)
+
+	for _, id := range ids {
+		eg.Go(func() error {
+			if err := f(ctx, id); err != nil {
+				return err
+			}
+
+			doneMutex.Lock()
+			delete(changes, id)
+			doneMutex.Unlock()
+
+			return nil
+		})
+	}
+
+	return errors.Wrap(eg.Wait(), "replication error")
+}
+
+func (r *Replicator) copyBlob(ctx context.Context, src blob.Reader, id blob.ID) error {
+	var data gather.WriteBuffer
+	defer data.Close()
+
+	if err := src.GetBlob(ctx, id, 0, -1, &data); err != nil {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			// blob has been deleted in the meantime.
+			return r.deleteBlob(ctx, id)
+		}
+
+		return errors.Wrapf(err, "error reading blob %v", id)
+	}
+
+	if err := r.dst.PutBlob(ctx, id, data.Bytes(), r.putOptions(id)); err != nil {
+		return errors.Wrapf(err, "error writing blob %v to replica", id)
+	}
+
+	if r.opt.Verify {
+		md, err := r.dst.GetMetadata(ctx, id)
+		if err == nil && md.Length != int64(data.Length()) {
+			err = errors.Errorf("unexpected length %v, want %v", md.Length, data.Length())
+		}
+
+		if err != nil {
+			r.mu.Lock()
+			r.status.VerificationFailures++
+			r.mu.Unlock()
+
+			return errors.Wrapf(err, "verification of replicated blob %v failed", id)
+		}
+	}
+
+	r.mu.Lock()
+	r.status.CopiedBlobs++
+	r.status.CopiedBytes += int64(data.Length())
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Replicator) deleteBlob(ctx context.Context, id blob.ID) error {
+	if err := r.dst.DeleteBlob(ctx, id); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+		return errors.Wrapf(err, "error deleting blob %v from replica", id)
+	}
+
+	r.mu.Lock()
+	r.status.DeletedBlobs++
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Reconcile compares the full list of blobs in the source and the replica, schedules
+// replication of all differences and replicates them. This is needed when the replica
+// is first set up and to pick up changes made while the changes were not being recorded.
+func (r *Replicator) Reconcile(ctx context.Context, src blob.Reader) error {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+
+	dstBlobs, err := listBlobs(ctx, r.dst)
+	if err != nil {
+		return errors.Wrap(err, "error listing replica blobs")
+	}
+
+	srcBlobs, err := listBlobs(ctx, src)
+	if err != nil {
+		return errors.Wrap(err, "error listing source blobs")
+	}
+
+	now := clock.Now()
+
+	r.mu.Lock()
+
+	for id, sm := range srcBlobs {
+		if dm, ok := dstBlobs[id]; !ok || dm.Length != sm.Length {
+			r.recordChangeLocked(id, change{length: sm.Length, time: now})
+		}
+	}
+
+	for id := range dstBlobs {
+		if _, ok := srcBlobs[id]; !ok {
+			r.recordChangeLocked(id, change{deleted: true, time: now})
+		}
+	}
+
+	r.status.LastReconcileTime = now
+
+	r.mu.Unlock()
+
+	return r.syncLocked(ctx, src)
+}
+
+// Verify compares blobs in the source and the replica. When full is true, the contents
+// of all blobs are compared, otherwise only their lengths.
+func (r *Replicator) Verify(ctx context.Context, src blob.Reader, full bool) (*VerifyResult, error) {
+	dstBlobs, err := listBlobs(ctx, r.dst)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing replica blobs")
+	}
+
+	srcBlobs, err := listBlobs(ctx, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing source blobs")
+	}
+
+	result := &VerifyResult{}
+
+	var (
+		mu           sync.Mutex
+		compareBlobs []blob.ID
+	)
+
+	for id, sm := range srcBlobs {
+		result.Checked++
+
+		dm, ok := dstBlobs[id]
+
+		switch {
+		case !ok:
+			result.Missing = append(result.Missing, id)
+		case dm.Length != sm.Length:
+			result.Mismatched = append(result.Mismatched, id)
+		case full:
+			compareBlobs = append(compareBlobs, id)
+		}
+	}
+
+	for id := range dstBlobs {
+		if _, ok := srcBlobs[id]; !ok {
+			result.Extra = append(result.Extra, id)
+		}
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(r.opt.Parallelism)
+
+	for _, id := range compareBlobs {
+		eg.Go(func() error {
+			same, err := sameContents(ctx, src, r.dst, id)
+			if err != nil {
+				return err
+			}
+
+			if !same {
+				mu.Lock()
+				result.Mismatched = append(result.Mismatched, id)
+				mu.Unlock()
+			}
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, errors.Wrap(err, "error comparing blobs")
+	}
+
+	slices.Sort(result.Missing)
+	slices.Sort(result.Mismatched)
+	slices.Sort(result.Extra)
+
+	return result, nil
+}
+
+func sameContents(ctx context.Context, src, dst blob.Reader, id blob.ID) (bool, error) {
+	h1, err := blobHash(ctx, src, id)
+	if err != nil {
+		return false, errors.Wrap(err, "source")
+	}
+
+	h2, err := blobHash(ctx, dst, id)
+	if err != nil {
+		return false, errors.Wrap(err, "replica")
+	}
+
+	return h1 == h2, nil
+}
+
+func blobHash(ctx context.Context, r blob.Reader, id blob.ID) ([sha256.Size]byte, error) {
+	var data gather.WriteBuffer
+	defer data.Close()
+
+	if err := r.GetBlob(ctx, id, 0, -1, &data); err != nil {
+		return [sha256.Size]byte{}, errors.Wrapf(err, "error reading blob %v", id)
+	}
+
+	h := sha256.New()
+	data.Bytes().WriteTo(h) //nolint:errcheck
+
+	var result [sha256.Size]byte
+
+	copy(result[:], h.Sum(nil))
+
+	return result, nil
+}
+
+func listBlobs(ctx context.Context, st blob.Lister) (map[blob.ID]blob.Metadata, error) {
+	result := map[blob.ID]blob.Metadata{}
+
+	if err := st.ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		result[bm.BlobID] = bm
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing blobs")
+	}
+
+	return result, nil
+}
+
+func blobClass(id blob.ID) int {
+	s := string(id)
+
+	switch {
+	case strings.HasPrefix(s, "kopia."):
+		return classFormat
+
+	case strings.HasPrefix(s, string(content.PackBlobIDPrefixRegular)),
+		strings.HasPrefix(s, string(content.PackBlobIDPrefixSpecial)):
+		return classData
+
+	case strings.HasPrefix(s, epoch.EpochManagerIndexUberPrefix),
+		strings.HasPrefix(s, indexblob.V0IndexBlobPrefix),
+		strings.HasPrefix(s, indexblob.V0CompactionLogBlobPrefix),
+		strings.HasPrefix(s, indexblob.V0CleanupBlobPrefix):
+		return classIndex
+
+	default:
+		return classOther
+	}
+}
@@ -0,0 +1,290 @@
+package replication_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/replication"
+)
+
+// recordingStorage records the order of mutations applied to the replica.
+type recordingStorage struct {
+	blob.Storage
+
+	mu  sync.Mutex
+	ops []string
+}
+
+func (s *recordingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	s.record("put", id)
+
+	return s.Storage.PutBlob(ctx, id, data, opts)
+}
+
+func (s *recordingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	s.record("delete", id)
+
+	return s.Storage.DeleteBlob(ctx, id)
+}
+
+func (s *recordingStorage) record(op string, id blob.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ops = append(s.ops, op+":"+string(id))
+}
+
+func (s *recordingStorage) takeOps() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := s.ops
+	s.ops = nil
+
+	return res
+}
+
+func putBlob(ctx context.Context, t *testing.T, st blob.Storage, id blob.ID, data string) {
+	t.Helper()
+
+	require.NoError(t, st.PutBlob(ctx, id, gather.FromSlice([]byte(data)), blob.PutOptions{}))
+}
+
+func TestReplicator_CopiesInConsistentOrder(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	srcData := blobtesting.DataMap{}
+	dstData := blobtesting.DataMap{}
+
+	dst := &recordingStorage{Storage: blobtesting.NewMapStorage(dstData, nil, nil)}
+	r := replication.New(dst, replication.Options{Parallelism: 1, Verify: true})
+	src := r.WrapStorage(blobtesting.NewMapStorage(srcData, nil, nil))
+
+	putBlob(ctx, t, src, "kopia.repository", "format")
+	putBlob(ctx, t, src, "xn0_abcd", "index")
+	putBlob(ctx, t, src, "s1234", "session")
+	putBlob(ctx, t, src, "p1234", "pack1")
+	putBlob(ctx, t, src, "q1234", "pack2")
+
+	st := r.Status()
+	require.Equal(t, 5, st.PendingBlobs)
+	require.EqualValues(t, 28, st.PendingBytes)
+	require.False(t, st.OldestPendingChange.IsZero())
+
+	require.NoError(t, r.Sync(ctx, src))
+
+	require.Equal(t, []string{
+		"put:p1234",
+		"put:q1234",
+		"put:s1234",
+		"put:xn0_abcd",
+		"put:kopia.repository",
+	}, dst.takeOps())
+
+	require.Equal(t, srcData, dstData)
+
+	st = r.Status()
+	require.Equal(t, 0, st.PendingBlobs)
+	require.EqualValues(t, 5, st.CopiedBlobs)
+	require.EqualValues(t, 28, st.CopiedBytes)
+	require.Empty(t, st.LastSyncError)
+
+	// nothing to do.
+	require.NoError(t, r.Sync(ctx, src))
+	require.Empty(t, dst.takeOps())
+
+	// deletions of index blobs are replicated before pack blobs they reference.
+	putBlob(ctx, t, src, "xn1_abcd", "index2")
+	require.NoError(t, src.DeleteBlob(ctx, "p1234"))
+	require.NoError(t, src.DeleteBlob(ctx, "xn0_abcd"))
+
+	require.NoError(t, r.Sync(ctx, src))
+	require.Equal(t, []string{
+		"put:xn1_abcd",
+		"delete:xn0_abcd",
+		"delete:p1234",
+	}, dst.takeOps())
+	require.Equal(t, srcData, dstData)
+	require.EqualValues(t, 2, r.Status().DeletedBlobs)
+
+	// blobs put and deleted before replication are not copied.
+	putBlob(ctx, t, src, "p5678", "short-lived")
+	require.NoError(t, src.DeleteBlob(ctx, "p5678"))
+	require.NoError(t, r.Sync(ctx, src))
+	require.Equal(t, []string{"delete:p5678"}, dst.takeOps())
+	require.Equal(t, srcData, dstData)
+}
+
+func TestReplicator_FailureKeepsReplicaConsistent(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	srcData := blobtesting.DataMap{}
+	dstData := blobtesting.DataMap{}
+
+	fs := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(dstData, nil, nil))
+	r := replication.New(fs, replication.Options{Parallelism: 1})
+	src := r.WrapStorage(blobtesting.NewMapStorage(srcData, nil, nil))
+
+	putBlob(ctx, t, src, "p1", "pack1")
+	putBlob(ctx, t, src, "p2", "pack2")
+	putBlob(ctx, t, src, "xn0_1", "index")
+
+	someErr := errors.New("some error")
+
+	fs.AddFault(blobtesting.MethodPutBlob).ErrorInstead(someErr)
+
+	require.ErrorIs(t, r.Sync(ctx, src), someErr)
+
+	// index must not be replicated when any pack blob failed.
+	require.NotContains(t, dstData, blob.ID("xn0_1"))
+
+	st := r.Status()
+	require.NotEmpty(t, st.LastSyncError)
+	require.GreaterOrEqual(t, st.PendingBlobs, 2)
+
+	// changes made since the failure are retained.
+	putBlob(ctx, t, src, "p3", "pack3")
+
+	require.NoError(t, r.Sync(ctx, src))
+	require.Equal(t, srcData, dstData)
+	require.Empty(t, r.Status().LastSyncError)
+	require.Equal(t, 0, r.Status().PendingBlobs)
+}
+
+func TestReplicator_PendingChangesArePersisted(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	srcData := blobtesting.DataMap{}
+	dstData := blobtesting.DataMap{}
+	stateFile := filepath.Join(t.TempDir(), "pending")
+
+	srcStorage := blobtesting.NewMapStorage(srcData, nil, nil)
+	dst := &recordingStorage{Storage: blobtesting.NewMapStorage(dstData, nil, nil)}
+
+	r1 := replication.New(dst, replication.Options{StateFile: stateFile})
+	src := r1.WrapStorage(srcStorage)
+
+	putBlob(ctx, t, src, "p1", "pack1")
+	putBlob(ctx, t, src, "xn0_1", "index")
+
+	// simulate crash before the changes have been replicated.
+	require.NoError(t, r1.Close(ctx))
+
+	r2 := replication.New(dst, replication.Options{Parallelism: 1, StateFile: stateFile})
+	src = r2.WrapStorage(srcStorage)
+
+	require.NoError(t, src.DeleteBlob(ctx, "p1"))
+	putBlob(ctx, t, src, "p2", "pack2")
+
+	require.NoError(t, r2.Sync(ctx, src))
+	require.Equal(t, []string{"put:p2", "put:xn0_1", "delete:p1"}, dst.takeOps())
+	require.Equal(t, srcData, dstData)
+
+	require.NoError(t, r2.Close(ctx))
+
+	// replicated changes are removed from the state file.
+	r3 := replication.New(dst, replication.Options{StateFile: stateFile})
+	require.NoError(t, r3.Sync(ctx, srcStorage))
+	require.Empty(t, dst.takeOps())
+
+	require.NoError(t, r3.Close(ctx))
+}
+
+func TestReplicator_ReconcileAndVerify(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	srcData := blobtesting.DataMap{}
+	dstData := blobtesting.DataMap{}
+
+	src := blobtesting.NewMapStorage(srcData, nil, nil)
+	dst := blobtesting.NewMapStorage(dstData, nil, nil)
+
+	putBlob(ctx, t, src, "p1", "pack1")
+	putBlob(ctx, t, src, "p2", "pack2")
+	putBlob(ctx, t, src, "xn0_1", "index")
+	putBlob(ctx, t, dst, "p1", "pack1")
+	putBlob(ctx, t, dst, "p2", "PACK2")
+	putBlob(ctx, t, dst, "p9", "stale")
+
+	r := replication.New(dst, replication.Options{})
+
+	vr, err := r.Verify(ctx, src, false)
+	require.NoError(t, err)
+	require.False(t, vr.InSync())
+	require.Equal(t, 3, vr.Checked)
+	require.Equal(t, []blob.ID{"xn0_1"}, vr.Missing)
+	require.Empty(t, vr.Mismatched)
+	require.Equal(t, []blob.ID{"p9"}, vr.Extra)
+
+	vr, err = r.Verify(ctx, src, true)
+	require.NoError(t, err)
+	require.Equal(t, []blob.ID{"p2"}, vr.Mismatched)
+
+	require.NoError(t, r.Reconcile(ctx, src))
+	require.False(t, r.Status().LastReconcileTime.IsZero())
+
+	vr, err = r.Verify(ctx, src, false)
+	require.NoError(t, err)
+	require.True(t, vr.InSync())
+
+	// contents of blobs with identical lengths are only compared by full verification.
+	vr, err = r.Verify(ctx, src, true)
+	require.NoError(t, err)
+	require.Equal(t, []blob.ID{"p2"}, vr.Mismatched)
+}
+
+func TestReplicator_VerificationFailure(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	fs := blobtesting.NewFaultyStorage(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+	r := replication.New(fs, replication.Options{Verify: true})
+	src := r.WrapStorage(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+
+	putBlob(ctx, t, src, "p1", "pack1")
+
+	fs.AddFault(blobtesting.MethodGetMetadata).Repeat(10).ErrorInstead(blob.ErrBlobNotFound)
+
+	require.ErrorContains(t, r.Sync(ctx, src), "verification of replicated blob p1 failed")
+	require.EqualValues(t, 1, r.Status().VerificationFailures)
+	require.Equal(t, 1, r.Status().PendingBlobs)
+}
+
+func TestReplicator_Retention(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	dst := blobtesting.NewVersionedMapStorage(nil)
+	r := replication.New(dst, replication.Options{})
+	src := r.WrapStorage(blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+
+	r.SetRetention(format.BlobStorageConfiguration{
+		RetentionMode:   blob.Governance,
+		RetentionPeriod: 24 * time.Hour,
+	})
+
+	putBlob(ctx, t, src, "p1", "pack1")
+	putBlob(ctx, t, src, "xn0_1", "index")
+	putBlob(ctx, t, src, "s1", "session")
+
+	require.NoError(t, r.Sync(ctx, src))
+
+	for id, want := range map[blob.ID]blob.RetentionMode{
+		"p1":    blob.Governance,
+		"xn0_1": blob.Governance,
+		"s1":    "", // like in the repository, session blobs are not locked.
+	} {
+		mode, _, err := dst.GetRetention(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, want, mode, id)
+	}
+}
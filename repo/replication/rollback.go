@@ -0,0 +1,107 @@
+package replication
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/format"
+)
+
+// RollbackPlan describes changes which restore the storage to its state at a point in time.
+type RollbackPlan struct {
+	Time time.Time `json:"time"`
+
+	// blobs which are missing or have been modified since the point in time.
+	Restore []blob.Metadata `json:"restore"`
+
+	// blobs which have been created since the point in time.
+	Delete []blob.Metadata `json:"delete"`
+}
+
+// RestoreBytes returns the total length of blobs to be restored.
+func (p *RollbackPlan) RestoreBytes() int64 {
+	var total int64
+
+	for _, bm := range p.Restore {
+		total += bm.Length
+	}
+
+	return total
+}
+
+// IsEmpty returns true if the storage is already in the state at the point in time.
+func (p *RollbackPlan) IsEmpty() bool {
+	return len(p.Restore) == 0 && len(p.Delete) == 0
+}
+
+// PlanRollback compares the current state of the storage with its point-in-time view at a given time.
+func PlanRollback(ctx context.Context, st blob.Reader, pit blob.Reader, t time.Time) (*RollbackPlan, error) {
+	current, err := listBlobs(ctx, st)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing current blobs")
+	}
+
+	past, err := listBlobs(ctx, pit)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing blobs at point in time")
+	}
+
+	if _, ok := past[format.KopiaRepositoryBlobID]; !ok {
+		return nil, errors.Errorf("repository did not exist at %v", t)
+	}
+
+	plan := &RollbackPlan{Time: t}
+
+	for id, pm := range past {
+		// blobs with the same length may have been overwritten since the point in time.
+		if cm, ok := current[id]; !ok || cm.Length != pm.Length || cm.Timestamp.After(t) {
+			plan.Restore = append(plan.Restore, pm)
+		}
+	}
+
+	for id, cm := range current {
+		if _, ok := past[id]; !ok {
+			plan.Delete = append(plan.Delete, cm)
+		}
+	}
+
+	byID := func(a, b blob.Metadata) int {
+		return cmp.Compare(a.BlobID, b.BlobID)
+	}
+
+	slices.SortFunc(plan.Restore, byID)
+	slices.SortFunc(plan.Delete, byID)
+
+	return plan, nil
+}
+
+// Rollback applies the plan to the storage, reading restored blobs from its point-in-time view.
+// Like replication, pack blobs are restored before the index blobs which reference them and the
+// format blobs are restored last, so the repository remains consistent if the rollback is interrupted
+// and the rollback can be safely retried.
+func Rollback(ctx context.Context, st blob.Storage, pit blob.Reader, plan *RollbackPlan, opt Options) (Status, error) {
+	r := New(st, opt)
+	now := clock.Now()
+
+	r.mu.Lock()
+
+	for _, bm := range plan.Restore {
+		r.recordChangeLocked(bm.BlobID, change{length: bm.Length, time: now})
+	}
+
+	for _, bm := range plan.Delete {
+		r.recordChangeLocked(bm.BlobID, change{deleted: true, time: now})
+	}
+
+	r.mu.Unlock()
+
+	err := r.Sync(ctx, pit)
+
+	return r.Status(), errors.Wrap(err, "rollback error")
+}
@@ -0,0 +1,82 @@
+package replication_test
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/replication"
+)
+
+func TestRollback(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	ft := faketime.NewClockTimeWithOffset(0)
+
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	rec := &recordingStorage{Storage: blobtesting.NewMapStorage(data, keyTime, ft.NowFunc())}
+
+	putBlob(ctx, t, rec, "kopia.repository", "format1")
+	putBlob(ctx, t, rec, "xn0_abcd", "index1")
+	putBlob(ctx, t, rec, "p1234", "pack1")
+
+	ft.Advance(time.Hour)
+
+	// point-in-time view of the storage.
+	pointInTime := ft.NowFunc()()
+	pit := blobtesting.NewMapStorage(maps.Clone(data), maps.Clone(keyTime), ft.NowFunc())
+
+	ft.Advance(time.Hour)
+
+	// format blob overwritten with the same length, pack deleted, new blobs created.
+	putBlob(ctx, t, rec, "kopia.repository", "format2")
+	require.NoError(t, rec.DeleteBlob(ctx, "p1234"))
+	putBlob(ctx, t, rec, "xn0_efgh", "index2")
+	putBlob(ctx, t, rec, "q5678", "pack2")
+	rec.takeOps()
+
+	emptyPIT := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	_, err := replication.PlanRollback(ctx, rec, emptyPIT, pointInTime)
+	require.ErrorContains(t, err, "repository did not exist")
+
+	plan, err := replication.PlanRollback(ctx, rec, pit, pointInTime)
+	require.NoError(t, err)
+	require.Equal(t, []blob.ID{"kopia.repository", "p1234"}, blobIDs(plan.Restore))
+	require.Equal(t, []blob.ID{"q5678", "xn0_efgh"}, blobIDs(plan.Delete))
+	require.Equal(t, int64(len("format1")+len("pack1")), plan.RestoreBytes())
+
+	st, err := replication.Rollback(ctx, rec, pit, plan, replication.Options{Parallelism: 1, Verify: true})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, st.CopiedBlobs)
+	require.EqualValues(t, 2, st.DeletedBlobs)
+
+	// packs are restored before format blobs, new indexes are deleted before new packs.
+	require.Equal(t, []string{
+		"put:p1234",
+		"put:kopia.repository",
+		"delete:xn0_efgh",
+		"delete:q5678",
+	}, rec.takeOps())
+
+	require.Equal(t, []byte("format1"), data["kopia.repository"])
+	require.Equal(t, []byte("pack1"), data["p1234"])
+	require.NotContains(t, data, blob.ID("q5678"))
+	require.NotContains(t, data, blob.ID("xn0_efgh"))
+}
+
+func blobIDs(bms []blob.Metadata) []blob.ID {
+	var result []blob.ID
+
+	for _, bm := range bms {
+		result = append(result, bm.BlobID)
+	}
+
+	return result
+}
@@ -0,0 +1,44 @@
+package replication
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// trackingStorage records all successful blob mutations as pending changes of the replicator.
+type trackingStorage struct {
+	blob.Storage
+
+	r *Replicator
+}
+
+func (s *trackingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if err := s.Storage.PutBlob(ctx, id, data, opts); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	s.r.recordChange(ctx, id, change{length: int64(data.Length()), time: clock.Now()})
+
+	return nil
+}
+
+func (s *trackingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	err := s.Storage.DeleteBlob(ctx, id)
+	if err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+		return err //nolint:wrapcheck
+	}
+
+	s.r.recordChange(ctx, id, change{deleted: true, time: clock.Now()})
+
+	return err //nolint:wrapcheck
+}
+
+// WrapStorage returns a wrapper around the repository storage that records
+// all changes made through it, so that they can be replicated by Sync.
+func (r *Replicator) WrapStorage(st blob.Storage) blob.Storage {
+	return &trackingStorage{Storage: st, r: r}
+}
@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync/atomic"
 	"time"
@@ -9,6 +10,7 @@
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel"
 
+	"github.com/kopia/kopia/internal/audit"
 	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/crypto"
 	"github.com/kopia/kopia/internal/grpcapi"
@@ -134,6 +136,7 @@ type directRepository struct {
 	omgr  *object.Manager
 	mmgr  *manifest.Manager
 	sm    *content.SharedManager
+	audit *audit.Recorder
 
 	afterFlush []RepositoryWriterCallback
 }
@@ -226,8 +229,27 @@ func (r *directRepository) GetManifest(ctx context.Context, id manifest.ID, data
 
 // PutManifest saves the given manifest payload with a set of labels.
 func (r *directRepository) PutManifest(ctx context.Context, labels map[string]string, payload any) (manifest.ID, error) {
-	//nolint:wrapcheck
-	return r.mmgr.Put(ctx, labels, payload)
+	id, err := r.mmgr.Put(ctx, labels, payload)
+	if err != nil {
+		//nolint:wrapcheck
+		return "", err
+	}
+
+	var after string
+
+	if b, merr := json.Marshal(payload); merr == nil {
+		after = audit.Digest(b)
+	}
+
+	r.recordAudit(ctx, audit.Record{
+		Operation:    audit.OperationPut,
+		ManifestType: labels[manifest.TypeLabelKey],
+		ManifestID:   string(id),
+		Labels:       labels,
+		AfterDigest:  after,
+	})
+
+	return id, nil
 }
 
 // ReplaceManifests saves the given manifest payload with a set of labels and replaces any previous manifests with the same labels.
@@ -243,8 +265,43 @@ func (r *directRepository) FindManifests(ctx context.Context, labels map[string]
 
 // DeleteManifest deletes the manifest with a given ID.
 func (r *directRepository) DeleteManifest(ctx context.Context, id manifest.ID) error {
-	//nolint:wrapcheck
-	return r.mmgr.Delete(ctx, id)
+	var before json.RawMessage
+
+	md, getErr := r.mmgr.Get(ctx, id, &before)
+
+	if err := r.mmgr.Delete(ctx, id); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	// deleting a manifest that does not exist is a no-op and is not audited.
+	if getErr == nil {
+		r.recordAudit(ctx, audit.Record{
+			Operation:    audit.OperationDelete,
+			ManifestType: md.Labels[manifest.TypeLabelKey],
+			ManifestID:   string(id),
+			Labels:       md.Labels,
+			BeforeDigest: audit.Digest(before),
+		})
+	}
+
+	return nil
+}
+
+// recordAudit adds the provided record to the audit trail, which is written on Flush.
+func (r *directRepository) recordAudit(ctx context.Context, rec audit.Record) {
+	if r.audit == nil {
+		return
+	}
+
+	rec.Time = r.Time()
+
+	rec.Actor = audit.ActorFromContext(ctx)
+	if rec.Actor == "" {
+		rec.Actor = r.cliOpts.UsernameAtHost()
+	}
+
+	r.audit.Add(rec)
 }
 
 // PrefetchContents brings the requested objects into the cache.
@@ -314,6 +371,7 @@ func (r *directRepository) NewDirectWriter(ctx context.Context, opt WriteSession
 		omgr:                                omgr,
 		mmgr:                                mmgr,
 		sm:                                  r.sm,
+		audit:                               &audit.Recorder{},
 	}
 
 	w.addRef()
@@ -335,6 +393,12 @@ func (r *directRepository) Flush(ctx context.Context) error {
 		return errors.Wrap(err, "error flushing contents")
 	}
 
+	if r.audit != nil {
+		if err := r.audit.Flush(ctx, r.blobs, r.fmgr, r.Time()); err != nil {
+			return errors.Wrap(err, "error flushing audit records")
+		}
+	}
+
 	if err := invokeCallbacks(ctx, r, r.afterFlush); err != nil {
 		return errors.Wrap(err, "after flush")
 	}
@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/atomicfile"
+	"github.com/kopia/kopia/internal/metrics"
+	"github.com/kopia/kopia/repo/blob/storagemetrics"
+)
+
+const (
+	storageUsageLockRetryDelay = 10 * time.Millisecond
+	storageUsageLockTimeout    = 10 * time.Second
+)
+
+func storageUsageFile(configFile string) string {
+	return configFile + ".usage"
+}
+
+// LoadStorageUsage returns the storage usage accumulated by repositories opened using the provided
+// configuration file.
+func LoadStorageUsage(configFile string) (storagemetrics.Usage, error) {
+	var u storagemetrics.Usage
+
+	b, err := os.ReadFile(storageUsageFile(configFile)) //nolint:gosec
+	if err != nil {
+		if os.IsNotExist(err) {
+			return u, nil
+		}
+
+		return u, errors.Wrap(err, "error reading storage usage")
+	}
+
+	if err := json.Unmarshal(b, &u); err != nil {
+		return u, errors.Wrap(err, "invalid storage usage file")
+	}
+
+	return u, nil
+}
+
+// ResetStorageUsage discards the storage usage accumulated for the provided configuration file.
+func ResetStorageUsage(configFile string) error {
+	if err := os.Remove(storageUsageFile(configFile)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "error removing storage usage")
+	}
+
+	return nil
+}
+
+// recordStorageUsage adds storage usage recorded in the metrics registry to the usage file
+// of the provided configuration file.
+func recordStorageUsage(ctx context.Context, configFile string, mr *metrics.Registry, since time.Time) error {
+	u := storagemetrics.UsageFromSnapshot(mr.Snapshot(false))
+	u.Since = since
+
+	l := flock.New(storageUsageFile(configFile) + ".lock")
+
+	lockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storageUsageLockTimeout)
+	defer cancel()
+
+	ok, err := l.TryLockContext(lockCtx, storageUsageLockRetryDelay)
+	if err != nil || !ok {
+		return errors.Wrap(err, "error locking storage usage")
+	}
+
+	defer l.Unlock() //nolint:errcheck
+
+	total, err := LoadStorageUsage(configFile)
+	if err != nil {
+		log(ctx).Debugf("discarding storage usage: %v", err)
+
+		total = storagemetrics.Usage{}
+	}
+
+	total.Add(u)
+
+	var buf bytes.Buffer
+
+	if err := json.NewEncoder(&buf).Encode(total); err != nil {
+		return errors.Wrap(err, "error encoding storage usage")
+	}
+
+	return errors.Wrap(atomicfile.Write(storageUsageFile(configFile), &buf), "error writing storage usage")
+}
@@ -12,7 +12,9 @@
 )
 
 // ApplyRetentionPolicy applies retention policy to a given source by deleting expired snapshots.
-func ApplyRetentionPolicy(ctx context.Context, rep repo.RepositoryWriter, sourceInfo snapshot.SourceInfo, reallyDelete bool) ([]manifest.ID, error) {
+// The provided function is used to estimate storage used by snapshots when the policy specifies
+// maximum total size, typically snapshotfs.CalculateStorageStats.
+func ApplyRetentionPolicy(ctx context.Context, rep repo.RepositoryWriter, sourceInfo snapshot.SourceInfo, reallyDelete bool, storageStats StorageStatsFunc) ([]manifest.ID, error) {
 	// it is desired to not allow snapshots to be deleted by repository clients,
 	// while still maintain the ability to apply snapshot retention policies server-side.
 	if remote, ok := rep.(repo.RemoteRetentionPolicy); ok {
@@ -30,7 +32,7 @@ func ApplyRetentionPolicy(ctx context.Context, rep repo.RepositoryWriter, source
 		return nil, errors.Wrap(err, "error listing snapshots")
 	}
 
-	toDelete, err := getExpiredSnapshots(ctx, rep, snapshots)
+	toDelete, err := getExpiredSnapshots(ctx, rep, snapshots, storageStats)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to compute snapshots to delete")
 	}
@@ -46,11 +48,11 @@ func ApplyRetentionPolicy(ctx context.Context, rep repo.RepositoryWriter, source
 	return toDelete, nil
 }
 
-func getExpiredSnapshots(ctx context.Context, rep repo.Repository, snapshots []*snapshot.Manifest) ([]manifest.ID, error) {
+func getExpiredSnapshots(ctx context.Context, rep repo.Repository, snapshots []*snapshot.Manifest, storageStats StorageStatsFunc) ([]manifest.ID, error) {
 	var toDelete []manifest.ID
 
 	for _, snapshotGroup := range snapshot.GroupBySource(snapshots) {
-		td, err := getExpiredSnapshotsForSource(ctx, rep, snapshotGroup)
+		td, err := getExpiredSnapshotsForSource(ctx, rep, snapshotGroup, storageStats)
 		if err != nil {
 			return nil, err
 		}
@@ -61,7 +63,7 @@ func getExpiredSnapshots(ctx context.Context, rep repo.Repository, snapshots []*
 	return toDelete, nil
 }
 
-func getExpiredSnapshotsForSource(ctx context.Context, rep repo.Repository, snapshots []*snapshot.Manifest) ([]manifest.ID, error) {
+func getExpiredSnapshotsForSource(ctx context.Context, rep repo.Repository, snapshots []*snapshot.Manifest, storageStats StorageStatsFunc) ([]manifest.ID, error) {
 	src := snapshots[0].Source
 
 	pol, _, _, err := GetEffectivePolicy(ctx, rep, src)
@@ -71,6 +73,12 @@ func getExpiredSnapshotsForSource(ctx context.Context, rep repo.Repository, snap
 
 	pol.RetentionPolicy.ComputeRetentionReasons(snapshots)
 
+	if maxSize := pol.RetentionPolicy.MaxTotalSize.OrDefault(0); maxSize > 0 {
+		if err := applyMaxTotalSize(ctx, rep, snapshots, maxSize, storageStats); err != nil {
+			return nil, err
+		}
+	}
+
 	var toDelete []manifest.ID
 
 	for _, s := range snapshots {
@@ -84,3 +92,63 @@ func getExpiredSnapshotsForSource(ctx context.Context, rep repo.Repository, snap
 
 	return toDelete, nil
 }
+
+// StorageStatsFunc computes storage statistics of the provided snapshots of a single source,
+// invoking the callback for each snapshot with StorageStats populated.
+type StorageStatsFunc func(ctx context.Context, rep repo.Repository, manifests []*snapshot.Manifest, callback func(m *snapshot.Manifest) error) error
+
+var errStorageLimitReached = errors.New("storage limit reached")
+
+// applyMaxTotalSize removes retention reasons from the oldest non-pinned snapshots until
+// the estimated amount of unique data referenced by the remaining snapshots does not exceed maxSize.
+// Pinned snapshots and the most recent complete snapshot are always retained.
+func applyMaxTotalSize(ctx context.Context, rep repo.Repository, snapshots []*snapshot.Manifest, maxSize int64, storageStats StorageStatsFunc) error {
+	if storageStats == nil {
+		return errors.New("storage statistics are not available, unable to apply maximum total size")
+	}
+
+	var pinned, unpinned []*snapshot.Manifest
+
+	for _, s := range snapshot.SortByTime(snapshots, true) {
+		switch {
+		case len(s.Pins) > 0:
+			pinned = append(pinned, s)
+		case s.IncompleteReason == "" && len(s.RetentionReasons) > 0:
+			unpinned = append(unpinned, s)
+		}
+	}
+
+	if len(unpinned) <= 1 {
+		return nil
+	}
+
+	// data referenced by pinned snapshots can't be released, so it is accounted for first,
+	// followed by snapshots from the most recent to the oldest.
+	ordered := append(append([]*snapshot.Manifest{}, pinned...), unpinned...)
+	mandatory := len(pinned) + 1
+
+	keep := len(ordered)
+	processed := 0
+
+	err := storageStats(ctx, rep, ordered, func(m *snapshot.Manifest) error {
+		processed++
+
+		if processed > mandatory && m.StorageStats.RunningTotal.PackedContentBytes > maxSize {
+			keep = processed - 1
+			return errStorageLimitReached
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStorageLimitReached) {
+		return errors.Wrap(err, "error computing storage statistics")
+	}
+
+	for _, s := range ordered[keep:] {
+		log(ctx).Debugf("  total size limit of %v exceeded, not retaining %v", maxSize, s.StartTime.ToTime())
+
+		s.RetentionReasons = []string{}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package policy_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+func TestApplyRetentionPolicyMaxTotalSize(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	src := snapshot.SourceInfo{
+		Host:     env.Repository.ClientOptions().Hostname,
+		UserName: env.Repository.ClientOptions().Username,
+		Path:     "/dummy",
+	}
+
+	const fileSize = 100 << 10
+
+	sourceRoot := mockfs.NewDirectory()
+	u := upload.NewUploader(env.RepositoryWriter)
+
+	var manifests []*snapshot.Manifest
+
+	// each snapshot adds ~100KB of new unique data
+	for _, name := range []string{"f1", "f2", "f3", "f4"} {
+		data := make([]byte, fileSize)
+		rand.Read(data)
+
+		sourceRoot.AddFile(name, data, 0o644)
+
+		man, err := u.Upload(ctx, sourceRoot, nil, src)
+		require.NoError(t, err)
+
+		// remove the file, so that only the latest snapshot references it.
+		sourceRoot.Remove(name)
+
+		_, err = snapshot.SaveSnapshot(ctx, env.RepositoryWriter, man)
+		require.NoError(t, err)
+
+		manifests = append(manifests, man)
+	}
+
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	maxSize := policy.OptionalInt64(250 << 10)
+
+	require.NoError(t, policy.SetPolicy(ctx, env.RepositoryWriter, src, &policy.Policy{
+		RetentionPolicy: policy.RetentionPolicy{
+			MaxTotalSize: &maxSize,
+		},
+	}))
+
+	// two most recent snapshots fit within the limit.
+	toDelete, err := policy.ApplyRetentionPolicy(ctx, env.RepositoryWriter, src, false, snapshotfs.CalculateStorageStats)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []manifest.ID{manifests[0].ID, manifests[1].ID}, toDelete)
+
+	// pinned snapshot is retained and its data counts towards the limit.
+	manifests[0].Pins = []string{"keep"}
+	require.NoError(t, snapshot.UpdateSnapshot(ctx, env.RepositoryWriter, manifests[0]))
+
+	toDelete, err = policy.ApplyRetentionPolicy(ctx, env.RepositoryWriter, src, true, snapshotfs.CalculateStorageStats)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []manifest.ID{manifests[1].ID, manifests[2].ID}, toDelete)
+
+	remaining, err := snapshot.ListSnapshots(ctx, env.RepositoryWriter, src)
+	require.NoError(t, err)
+	require.Len(t, remaining, 2)
+
+	// the most recent snapshot is always retained, even if it exceeds the limit.
+	tiny := policy.OptionalInt64(1)
+
+	require.NoError(t, policy.SetPolicy(ctx, env.RepositoryWriter, src, &policy.Policy{
+		RetentionPolicy: policy.RetentionPolicy{
+			MaxTotalSize: &tiny,
+		},
+	}))
+
+	toDelete, err = policy.ApplyRetentionPolicy(ctx, env.RepositoryWriter, src, false, snapshotfs.CalculateStorageStats)
+	require.NoError(t, err)
+	require.Empty(t, toDelete)
+
+	// maximum total size can't be applied without storage statistics.
+	_, err = policy.ApplyRetentionPolicy(ctx, env.RepositoryWriter, src, false, nil)
+	require.Error(t, err)
+}
@@ -28,6 +28,11 @@ type RetentionPolicy struct {
 	KeepMonthly              *OptionalInt  `json:"keepMonthly,omitempty"`
 	KeepAnnual               *OptionalInt  `json:"keepAnnual,omitempty"`
 	IgnoreIdenticalSnapshots *OptionalBool `json:"ignoreIdenticalSnapshots,omitempty"`
+
+	// MaxSnapshots caps the total number of snapshots retained for a source.
+	MaxSnapshots *OptionalInt `json:"maxSnapshots,omitempty"`
+	// MaxTotalSize caps the estimated amount of unique data (in bytes) retained for a source.
+	MaxTotalSize *OptionalInt64 `json:"maxTotalSize,omitempty"`
 }
 
 // RetentionPolicyDefinition specifies which policy definition provided the value of a particular field.
@@ -39,6 +44,8 @@ type RetentionPolicyDefinition struct {
 	KeepMonthly              snapshot.SourceInfo `json:"keepMonthly,omitempty"`
 	KeepAnnual               snapshot.SourceInfo `json:"keepAnnual,omitempty"`
 	IgnoreIdenticalSnapshots snapshot.SourceInfo `json:"ignoreIdenticalSnapshots,omitempty"`
+	MaxSnapshots             snapshot.SourceInfo `json:"maxSnapshots,omitempty"`
+	MaxTotalSize             snapshot.SourceInfo `json:"maxTotalSize,omitempty"`
 }
 
 // ComputeRetentionReasons computes the reasons why each snapshot is retained, based on
@@ -97,6 +104,8 @@ func (r *RetentionPolicy) ComputeRetentionReasons(manifests []*snapshot.Manifest
 		}
 	}
 
+	r.applyMaxSnapshots(sorted)
+
 	// attach 'retention reason' tag to incomplete snapshots until we run into first complete one
 	// or we have enough incomplete ones and we run into an old one.
 	for i, s := range sorted {
@@ -114,6 +123,37 @@ func (r *RetentionPolicy) ComputeRetentionReasons(manifests []*snapshot.Manifest
 	}
 }
 
+// applyMaxSnapshots removes retention reasons from the oldest non-pinned complete snapshots
+// until the number of retained complete snapshots does not exceed MaxSnapshots.
+// The most recent complete snapshot is always retained. Snapshots must be sorted
+// in descending time order.
+func (r *RetentionPolicy) applyMaxSnapshots(sorted []*snapshot.Manifest) {
+	maxSnapshots := r.MaxSnapshots.OrDefault(0)
+	if maxSnapshots <= 0 {
+		return
+	}
+
+	var retained []*snapshot.Manifest
+
+	for _, s := range sorted {
+		if s.IncompleteReason == "" && (len(s.RetentionReasons) > 0 || len(s.Pins) > 0) {
+			retained = append(retained, s)
+		}
+	}
+
+	excess := len(retained) - maxSnapshots
+
+	// walk from the oldest, never dropping the most recent snapshot.
+	for i := len(retained) - 1; i > 0 && excess > 0; i-- {
+		if len(retained[i].Pins) > 0 {
+			continue
+		}
+
+		retained[i].RetentionReasons = []string{}
+		excess--
+	}
+}
+
 // EffectiveKeepLatest returns the number of "latest" snapshots to keep. If all
 // retention values are set to 0 then returns MaxInt.
 func (r *RetentionPolicy) EffectiveKeepLatest() *OptionalInt {
@@ -223,6 +263,8 @@ func (r *RetentionPolicy) Merge(src RetentionPolicy, def *RetentionPolicyDefinit
 	mergeOptionalInt(&r.KeepMonthly, src.KeepMonthly, &def.KeepMonthly, si)
 	mergeOptionalInt(&r.KeepAnnual, src.KeepAnnual, &def.KeepAnnual, si)
 	mergeOptionalBool(&r.IgnoreIdenticalSnapshots, src.IgnoreIdenticalSnapshots, &def.IgnoreIdenticalSnapshots, si)
+	mergeOptionalInt(&r.MaxSnapshots, src.MaxSnapshots, &def.MaxSnapshots, si)
+	mergeOptionalInt64(&r.MaxTotalSize, src.MaxTotalSize, &def.MaxTotalSize, si)
 }
 
 // CompactRetentionReasons returns compressed retention reasons given a list of retention reasons.
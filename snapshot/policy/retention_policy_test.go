@@ -38,6 +38,31 @@ func TestRetentionPolicyTest(t *testing.T) {
 				"2020-01-01T12:03:00Z": {"latest-1"},
 			},
 		},
+		{
+			&RetentionPolicy{
+				KeepLatest:   newOptionalInt(5),
+				MaxSnapshots: newOptionalInt(3),
+			},
+			map[string][]string{
+				"2020-01-01T12:00:00Z": {}, // not retained, exceeds maximum number of snapshots
+				"2020-01-01T12:01:00Z": {}, // not retained, exceeds maximum number of snapshots
+				"2020-01-01T12:02:00Z": {"latest-3"},
+				"2020-01-01T12:03:00Z": {"latest-2"},
+				"2020-01-01T12:04:00Z": {"latest-1"},
+			},
+		},
+		{
+			&RetentionPolicy{
+				KeepDaily:    newOptionalInt(3),
+				MaxSnapshots: newOptionalInt(2),
+			},
+			map[string][]string{
+				"2020-01-02T15:00:00Z": {}, // not retained, exceeds maximum number of snapshots
+				"2020-01-03T12:00:00Z": {},
+				"2020-01-03T15:00:00Z": {"daily-2"},
+				"2020-01-04T15:00:00Z": {"daily-1"},
+			},
+		},
 		{
 			&RetentionPolicy{
 				KeepDaily: newOptionalInt(3),
@@ -218,6 +243,41 @@ func TestRetentionPolicyTest(t *testing.T) {
 	}
 }
 
+func TestRetentionPolicyMaxSnapshotsKeepsPinned(t *testing.T) {
+	base := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var manifests []*snapshot.Manifest
+
+	for i := range 5 {
+		manifests = append(manifests, &snapshot.Manifest{
+			StartTime: fs.UTCTimestampFromTime(base.Add(time.Duration(i) * time.Minute)),
+		})
+	}
+
+	// oldest snapshot is pinned, it counts towards the limit but is never dropped.
+	manifests[0].Pins = []string{"keep"}
+
+	rp := &RetentionPolicy{
+		KeepLatest:   newOptionalInt(10),
+		MaxSnapshots: newOptionalInt(3),
+	}
+
+	rp.ComputeRetentionReasons(manifests)
+
+	require.Equal(t, []string{"latest-5"}, manifests[0].RetentionReasons)
+	require.Empty(t, manifests[1].RetentionReasons)
+	require.Empty(t, manifests[2].RetentionReasons)
+	require.Equal(t, []string{"latest-2"}, manifests[3].RetentionReasons)
+	require.Equal(t, []string{"latest-1"}, manifests[4].RetentionReasons)
+
+	// most recent snapshot is always retained.
+	rp.MaxSnapshots = newOptionalInt(1)
+	rp.ComputeRetentionReasons(manifests)
+
+	require.Empty(t, manifests[3].RetentionReasons)
+	require.Equal(t, []string{"latest-1"}, manifests[4].RetentionReasons)
+}
+
 func TestCompactPins(t *testing.T) {
 	require.Equal(t,
 		[]string{"a", "b", "d", "x", "z"},
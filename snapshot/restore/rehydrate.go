@@ -0,0 +1,186 @@
+package restore
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+const (
+	defaultRehydrateParallel     = 16
+	defaultRehydratePollInterval = 5 * time.Minute
+)
+
+// RehydrateStats represents progress of rehydration.
+type RehydrateStats struct {
+	TotalPacks int
+	ReadyPacks int
+}
+
+// RehydrateOptions provides options for Rehydrate.
+type RehydrateOptions struct {
+	Parallel     int
+	PollInterval time.Duration
+	Blob         blob.RehydrateOptions
+
+	ProgressCallback func(ctx context.Context, stats RehydrateStats)
+}
+
+// Rehydrate requests rehydration of archived pack blobs with contents of all files in the provided tree
+// and waits until all of them can be read. Index and metadata blobs are never archived, so only blobs with
+// file contents are rehydrated. The storage or one of the storages wrapped by it must implement blob.Rehydrator.
+func Rehydrate(ctx context.Context, rep repo.DirectRepository, st blob.Storage, root fs.Entry, opt RehydrateOptions) (RehydrateStats, error) {
+	var stats RehydrateStats
+
+	rh, ok := blob.As[blob.Rehydrator](st)
+	if !ok {
+		return stats, errors.Errorf("storage type '%v' does not support rehydration of archived blobs", st.ConnectionInfo().Type)
+	}
+
+	if opt.Parallel <= 0 {
+		opt.Parallel = defaultRehydrateParallel
+	}
+
+	if opt.PollInterval <= 0 {
+		opt.PollInterval = defaultRehydratePollInterval
+	}
+
+	pending, err := RequiredPacks(ctx, rep, root)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.TotalPacks = len(pending)
+
+	for {
+		pending, err = rehydratePacks(ctx, rh, pending, opt)
+		if err != nil {
+			return stats, err
+		}
+
+		stats.ReadyPacks = stats.TotalPacks - len(pending)
+
+		if opt.ProgressCallback != nil {
+			opt.ProgressCallback(ctx, stats)
+		}
+
+		if len(pending) == 0 {
+			return stats, nil
+		}
+
+		if !clock.SleepInterruptibly(ctx, opt.PollInterval) {
+			return stats, errors.Wrap(ctx.Err(), "rehydration canceled")
+		}
+	}
+}
+
+// rehydratePacks requests rehydration of the provided packs and returns the packs which are not ready yet.
+func rehydratePacks(ctx context.Context, rh blob.Rehydrator, packs []blob.ID, opt RehydrateOptions) ([]blob.ID, error) {
+	var (
+		mu       sync.Mutex
+		notReady []blob.ID
+	)
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(opt.Parallel)
+
+	for _, id := range packs {
+		eg.Go(func() error {
+			ready, err := rh.RehydrateBlob(ctx, id, opt.Blob)
+			if err != nil {
+				return errors.Wrapf(err, "unable to rehydrate %v", id)
+			}
+
+			if !ready {
+				mu.Lock()
+				notReady = append(notReady, id)
+				mu.Unlock()
+			}
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	slices.SortFunc(notReady, func(a, b blob.ID) int {
+		return cmp.Compare(a, b)
+	})
+
+	return notReady, nil
+}
+
+// RequiredPacks returns sorted IDs of pack blobs with contents of all files in the provided tree.
+func RequiredPacks(ctx context.Context, rep repo.DirectRepository, root fs.Entry) ([]blob.ID, error) {
+	var (
+		mu    sync.Mutex
+		packs = map[blob.ID]struct{}{}
+	)
+
+	tw, twerr := snapshotfs.NewTreeWalker(ctx, snapshotfs.TreeWalkerOptions{
+		EntryCallback: func(ctx context.Context, entry fs.Entry, oid object.ID, _ string) error {
+			if entry.IsDir() {
+				return nil
+			}
+
+			contentIDs, err := rep.VerifyObject(ctx, oid)
+			if err != nil {
+				return errors.Wrapf(err, "error verifying object %v", oid)
+			}
+
+			for _, cid := range contentIDs {
+				info, err := rep.ContentInfo(ctx, cid)
+				if err != nil {
+					return errors.Wrapf(err, "error getting content info for %v", cid)
+				}
+
+				if !strings.HasPrefix(string(info.PackBlobID), string(content.PackBlobIDPrefixRegular)) {
+					continue
+				}
+
+				mu.Lock()
+				packs[info.PackBlobID] = struct{}{}
+				mu.Unlock()
+			}
+
+			return nil
+		},
+	})
+	if twerr != nil {
+		return nil, errors.Wrap(twerr, "tree walker")
+	}
+
+	defer tw.Close(ctx)
+
+	if err := tw.Process(ctx, root, "."); err != nil {
+		return nil, errors.Wrap(err, "error finding required packs")
+	}
+
+	result := make([]blob.ID, 0, len(packs))
+	for id := range packs {
+		result = append(result, id)
+	}
+
+	slices.SortFunc(result, func(a, b blob.ID) int {
+		return cmp.Compare(a, b)
+	})
+
+	return result, nil
+}
@@ -0,0 +1,94 @@
+package restore_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/retrying"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/restore"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+// archiveStorage simulates storage in which blobs become readable after the second rehydration request.
+type archiveStorage struct {
+	blob.Storage
+
+	mu       sync.Mutex
+	requests map[blob.ID]int
+}
+
+func (s *archiveStorage) RehydrateBlob(_ context.Context, id blob.ID, opts blob.RehydrateOptions) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if opts.Days != 3 {
+		return false, blob.ErrInvalidRange
+	}
+
+	s.requests[id]++
+
+	return s.requests[id] >= 2, nil
+}
+
+func TestRehydrate(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	sourceRoot := mockfs.NewDirectory()
+	sourceRoot.AddDir("dir1", 0o755).AddFile("file11", []byte{1, 2, 3}, 0o644)
+	sourceRoot.AddDir("dir2", 0o755).AddFile("file21", []byte{1, 2, 3, 4}, 0o644)
+
+	man, err := upload.NewUploader(env.RepositoryWriter).Upload(ctx, sourceRoot, nil, snapshot.SourceInfo{})
+	require.NoError(t, err)
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	root, err := snapshotfs.SnapshotRoot(env.RepositoryWriter, man)
+	require.NoError(t, err)
+
+	packs, err := restore.RequiredPacks(ctx, env.RepositoryWriter, root)
+	require.NoError(t, err)
+
+	// only packs with file contents are required.
+	dataPacks, err := blob.ListAllBlobs(ctx, env.RootStorage(), "p")
+	require.NoError(t, err)
+	require.Len(t, packs, len(dataPacks))
+
+	st := &archiveStorage{Storage: env.RootStorage(), requests: map[blob.ID]int{}}
+
+	var progress []restore.RehydrateStats
+
+	// like real providers, the storage is wrapped in retrying.NewWrapper.
+	stats, err := restore.Rehydrate(ctx, env.RepositoryWriter, retrying.NewWrapper(st), root, restore.RehydrateOptions{
+		PollInterval: time.Millisecond,
+		Blob:         blob.RehydrateOptions{Days: 3},
+		ProgressCallback: func(_ context.Context, s restore.RehydrateStats) {
+			progress = append(progress, s)
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, restore.RehydrateStats{TotalPacks: len(packs), ReadyPacks: len(packs)}, stats)
+	require.Equal(t, []restore.RehydrateStats{
+		{TotalPacks: len(packs), ReadyPacks: 0},
+		{TotalPacks: len(packs), ReadyPacks: len(packs)},
+	}, progress)
+
+	for _, id := range packs {
+		require.Equal(t, 2, st.requests[id])
+	}
+
+	// errors are returned.
+	_, err = restore.Rehydrate(ctx, env.RepositoryWriter, st, root, restore.RehydrateOptions{})
+	require.ErrorIs(t, err, blob.ErrInvalidRange)
+
+	// storage without archive tiers can't rehydrate.
+	_, err = restore.Rehydrate(ctx, env.RepositoryWriter, retrying.NewWrapper(env.RootStorage()), root, restore.RehydrateOptions{})
+	require.ErrorContains(t, err, "does not support rehydration")
+}
@@ -48,6 +48,10 @@ type DirRewriterOptions struct {
 	// when != nil will be invoked to replace directory that can't be read,
 	// by default RewriteAsStub()
 	OnDirectoryReadFailure RewriteFailedEntryCallback
+
+	// when != nil directories are read from this repository instead of the one being written,
+	// which allows copying snapshot trees between repositories.
+	SourceRepository repo.Repository
 }
 
 // DirRewriter rewrites contents of directories by walking the snapshot tree recursively.
@@ -57,7 +61,8 @@ type DirRewriter struct {
 
 	cache *bigmap.Map
 
-	rep repo.RepositoryWriter
+	rep    repo.RepositoryWriter
+	srcRep repo.Repository
 }
 
 type dirRewriterRequest struct {
@@ -137,7 +142,7 @@ func (rw *DirRewriter) getCachedReplacement(ctx context.Context, parentPath stri
 func (rw *DirRewriter) processDirectory(ctx context.Context, pathFromRoot string, entry *snapshot.DirEntry, metadataComp compression.Name) (*snapshot.DirEntry, error) {
 	dirRewriterLog(ctx).Debugw("processDirectory", "path", pathFromRoot)
 
-	r, err := rw.rep.OpenObject(ctx, entry.ObjectID)
+	r, err := rw.srcRep.OpenObject(ctx, entry.ObjectID)
 	if err != nil {
 		return rw.opts.OnDirectoryReadFailure(ctx, pathFromRoot, entry, errors.Wrapf(err, "unable to open directory object %v", entry.ObjectID))
 	}
@@ -332,15 +337,21 @@ func NewDirRewriter(ctx context.Context, rep repo.RepositoryWriter, opts DirRewr
 		opts.OnDirectoryReadFailure = RewriteFail
 	}
 
+	var srcRep repo.Repository = rep
+	if opts.SourceRepository != nil {
+		srcRep = opts.SourceRepository
+	}
+
 	cache, err := bigmap.NewMap(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "new map")
 	}
 
 	return &DirRewriter{
-		ws:    workshare.NewPool[*dirRewriterRequest](opts.Parallel - 1),
-		opts:  opts,
-		rep:   rep,
-		cache: cache,
+		ws:     workshare.NewPool[*dirRewriterRequest](opts.Parallel - 1),
+		opts:   opts,
+		rep:    rep,
+		srcRep: srcRep,
+		cache:  cache,
 	}, nil
 }
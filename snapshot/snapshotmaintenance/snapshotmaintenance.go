@@ -3,14 +3,19 @@
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/acl"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/logging"
 	"github.com/kopia/kopia/repo/maintenance"
 	"github.com/kopia/kopia/snapshot/snapshotgc"
 )
 
+var log = logging.Module("snapshotmaintenance")
+
 // ErrReadonly indicates a failure when attempting to run maintenance on a read-only repository.
 var ErrReadonly = errors.New("not running maintenance on read-only repository connection")
 
@@ -23,6 +28,10 @@ func Run(ctx context.Context, dr repo.DirectRepositoryWriter, mode maintenance.M
 	//nolint:wrapcheck
 	return maintenance.RunExclusive(ctx, dr, mode, force,
 		func(ctx context.Context, runParams maintenance.RunParameters) error {
+			if err := cleanupExpiredACLs(ctx, dr, runParams.MaintenanceStartTime); err != nil {
+				return errors.Wrap(err, "expired ACL cleanup failure")
+			}
+
 			// run snapshot GC before full maintenance
 			if runParams.Mode == maintenance.ModeFull {
 				if err := snapshotgc.Run(ctx, dr, true, safety, runParams.MaintenanceStartTime); err != nil {
@@ -34,3 +43,20 @@ func(ctx context.Context, runParams maintenance.RunParameters) error {
 			return maintenance.Run(ctx, runParams, safety)
 		})
 }
+
+// cleanupExpiredACLs removes ACL entries that have expired, which are already ignored by the server.
+func cleanupExpiredACLs(ctx context.Context, dr repo.DirectRepositoryWriter, now time.Time) error {
+	//nolint:wrapcheck
+	return maintenance.ReportRun(ctx, dr, maintenance.TaskCleanupExpiredACLs, nil, func() error {
+		n, err := acl.DeleteExpiredEntries(ctx, dr, now)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if n > 0 {
+			log(ctx).Infof("Deleted %v expired ACL entries.", n)
+		}
+
+		return nil
+	})
+}
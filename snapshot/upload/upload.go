@@ -96,6 +96,10 @@ type Uploader struct {
 	// Labels to apply to every checkpoint made for this snapshot.
 	CheckpointLabels map[string]string
 
+	// Additional repositories receiving copies of all written data, see Mirror.
+	// Checkpoints are only saved in the uploader repository.
+	Mirrors []*Mirror
+
 	repo repo.RepositoryWriter
 
 	// stats must be allocated on heap to enforce 64-bit alignment due to atomic access on ARM.
@@ -135,6 +139,13 @@ func (u *Uploader) incompleteReason() string {
 }
 
 func (u *Uploader) uploadFileInternal(ctx context.Context, parentCheckpointRegistry *checkpointRegistry, relativePath string, f fs.File, pol *policy.Policy) (dirEntry *snapshot.DirEntry, ret error) {
+	if u.traceEnabled {
+		var span trace.Span
+
+		ctx, span = uploadTracer.Start(ctx, "UploadFile", trace.WithAttributes(attribute.String("file", relativePath), attribute.Int64("bytes", f.Size())))
+		defer span.End()
+	}
+
 	u.Progress.HashingFile(relativePath)
 
 	defer func() {
@@ -204,10 +215,10 @@ func (u *Uploader) uploadFileInternal(ctx context.Context, parentCheckpointRegis
 		return nil, errors.Wrap(err, "error uploading parts")
 	}
 
-	return concatenateParts(ctx, u.repo, f.Name(), parts, metadataComp)
+	return u.concatenateParts(ctx, f.Name(), parts, metadataComp)
 }
 
-func concatenateParts(ctx context.Context, rep repo.RepositoryWriter, name string, parts []*snapshot.DirEntry, metadataComp compression.Name) (*snapshot.DirEntry, error) {
+func (u *Uploader) concatenateParts(ctx context.Context, name string, parts []*snapshot.DirEntry, metadataComp compression.Name) (*snapshot.DirEntry, error) {
 	var (
 		objectIDs []object.ID
 		totalSize int64
@@ -219,11 +230,15 @@ func concatenateParts(ctx context.Context, rep repo.RepositoryWriter, name strin
 		objectIDs = append(objectIDs, part.ObjectID)
 	}
 
-	resultObject, err := rep.ConcatenateObjects(ctx, objectIDs, repo.ConcatenateOptions{Compressor: metadataComp})
+	opt := repo.ConcatenateOptions{Compressor: metadataComp}
+
+	resultObject, err := u.repo.ConcatenateObjects(ctx, objectIDs, opt)
 	if err != nil {
 		return nil, errors.Wrap(err, "concatenate")
 	}
 
+	u.mirrorConcatenatedObject(ctx, objectIDs, resultObject, opt)
+
 	de := parts[0]
 	de.Name = name
 	de.FileSize = totalSize
@@ -239,7 +254,7 @@ func (u *Uploader) uploadFileData(ctx context.Context, parentCheckpointRegistry
 	}
 	defer file.Close() //nolint:errcheck
 
-	writer := u.repo.NewObjectWriter(ctx, object.WriterOptions{
+	writer := u.newObjectWriter(ctx, object.WriterOptions{
 		Description:        "FILE:" + fname,
 		Compressor:         compressor,
 		MetadataCompressor: metadataComp,
@@ -310,7 +325,7 @@ func (u *Uploader) uploadSymlinkInternal(ctx context.Context, relativePath strin
 		return nil, errors.Wrap(err, "unable to read symlink")
 	}
 
-	writer := u.repo.NewObjectWriter(ctx, object.WriterOptions{
+	writer := u.newObjectWriter(ctx, object.WriterOptions{
 		Description:        "SYMLINK:" + f.Name(),
 		MetadataCompressor: metadataComp,
 	})
@@ -355,7 +370,7 @@ func (u *Uploader) uploadStreamingFileInternal(ctx context.Context, relativePath
 	comp := pol.CompressionPolicy.CompressorForFile(f)
 	metadataComp := pol.MetadataCompressionPolicy.MetadataCompressor()
 
-	writer := u.repo.NewObjectWriter(ctx, object.WriterOptions{
+	writer := u.newObjectWriter(ctx, object.WriterOptions{
 		Description:        "STREAMFILE:" + f.Name(),
 		Compressor:         comp,
 		MetadataCompressor: metadataComp,
@@ -538,7 +553,7 @@ func (u *Uploader) checkpointRoot(ctx context.Context, cp *checkpointRegistry, p
 		return errors.Wrap(err, "error saving checkpoint snapshot")
 	}
 
-	if _, err := policy.ApplyRetentionPolicy(ctx, u.repo, man.Source, true); err != nil {
+	if _, err := policy.ApplyRetentionPolicy(ctx, u.repo, man.Source, true, snapshotfs.CalculateStorageStats); err != nil {
 		return errors.Wrap(err, "unable to apply retention policy")
 	}
 
@@ -1118,7 +1133,20 @@ func uploadDirInternal(
 		var span trace.Span
 
 		ctx, span = uploadTracer.Start(ctx, "UploadDir", trace.WithAttributes(attribute.String("dir", dirRelativePath)))
-		defer span.End()
+		defer func() {
+			if resultDE != nil && resultDE.DirSummary != nil {
+				span.SetAttributes(
+					attribute.Int64("files", resultDE.DirSummary.TotalFileCount),
+					attribute.Int64("dirs", resultDE.DirSummary.TotalDirCount),
+					attribute.Int64("bytes", resultDE.DirSummary.TotalFileSize))
+			}
+
+			if resultErr != nil {
+				span.RecordError(resultErr)
+			}
+
+			span.End()
+		}()
 	}
 
 	t0 := timetrack.StartTimer()
@@ -1193,6 +1221,8 @@ func uploadDirInternal(
 		return nil, errors.Wrapf(err, "error writing dir manifest: %v", directory.Name())
 	}
 
+	u.mirrorDirManifest(ctx, dirRelativePath, oid, dirManifest, policyTree, metadataComp)
+
 	return newDirEntryWithSummary(directory, oid, dirManifest.Summary)
 }
 
@@ -1257,7 +1287,10 @@ func (u *Uploader) Upload(
 	sourceInfo snapshot.SourceInfo,
 	previousManifests ...*snapshot.Manifest,
 ) (*snapshot.Manifest, error) {
-	ctx, span := uploadTracer.Start(ctx, "Upload")
+	ctx, span := uploadTracer.Start(ctx, "Upload", trace.WithAttributes(
+		attribute.String("source.host", sourceInfo.Host),
+		attribute.String("source.user", sourceInfo.UserName),
+		attribute.String("source.path", sourceInfo.Path)))
 	defer span.End()
 
 	u.traceEnabled = span.IsRecording()
@@ -1311,6 +1344,11 @@ func (u *Uploader) Upload(
 	s.EndTime = fs.UTCTimestampFromTime(u.repo.Time())
 	s.Stats = *u.stats
 
+	span.SetAttributes(
+		attribute.Int("files", int(s.Stats.TotalFileCount)),
+		attribute.Int64("bytes", s.Stats.TotalFileSize),
+		attribute.Int64("writtenBytes", u.totalWrittenBytes.Load()))
+
 	return &s, nil
 }
 
@@ -1329,6 +1367,8 @@ func (u *Uploader) uploadDir(
 		}
 	}
 
+	u.primeMirrors(ctx, previousManifests)
+
 	estimationCtl := u.startDataSizeEstimation(ctx, entry, policyTree)
 	defer func() {
 		estimationCtl.Cancel()
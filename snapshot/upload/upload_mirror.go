@@ -0,0 +1,592 @@
+package upload
+
+import (
+	"context"
+	"path"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/bigmap"
+	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/compression"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+const (
+	// maximum amount of file data written by the uploader but not yet by the mirror, above which
+	// the mirror is considered to be falling behind and fails.
+	mirrorMaxBufferedBytes = 64 << 20
+
+	// maximum number of writes of a single file waiting to be written to the mirror.
+	mirrorMaxPendingWrites = 1024
+
+	// maximum time to wait for the mirror to finish writing a file after the uploader has written it.
+	defaultMirrorFinishTimeout = time.Minute
+)
+
+var errMirrorFallingBehind = errors.New("mirror is falling behind the upload")
+
+// Mirror receives copies of all objects written by an Uploader, which allows a single scan of the
+// source to produce snapshots in multiple repositories.
+//
+// Object IDs are different in each repository, so the mirror keeps track of the object IDs written to
+// its repository and translates directory manifests accordingly. File data is written to the mirror
+// asynchronously. Failures of a mirror do not affect the upload or other mirrors: after the first
+// error, or when the mirror falls behind the upload, the mirror stops receiving data and Manifest()
+// returns the error.
+type Mirror struct {
+	rep      repo.RepositoryWriter
+	previous []*snapshot.Manifest
+
+	// object IDs in the uploader repository mapped to object IDs in the mirror repository.
+	objectIDs *bigmap.Map
+
+	// file data not yet written to the mirror.
+	bufferedBytes atomic.Int64
+	finishTimeout time.Duration
+
+	mu sync.Mutex
+	// +checklocks:mu
+	err error
+}
+
+// NewMirror creates a Mirror writing to the provided repository. Previous manifests of the
+// source in the mirror repository, when provided, are used to avoid copying files which the uploader
+// finds unchanged since its own previous snapshots.
+func NewMirror(ctx context.Context, rep repo.RepositoryWriter, previousManifests ...*snapshot.Manifest) (*Mirror, error) {
+	m, err := bigmap.NewMap(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "new map")
+	}
+
+	return &Mirror{
+		rep:           rep,
+		previous:      previousManifests,
+		objectIDs:     m,
+		finishTimeout: defaultMirrorFinishTimeout,
+	}, nil
+}
+
+// Repository returns the repository the mirror writes to.
+func (m *Mirror) Repository() repo.RepositoryWriter {
+	return m.rep
+}
+
+// Err returns the error which caused the mirror to stop receiving data.
+func (m *Mirror) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.err
+}
+
+// Close releases resources used by the mirror.
+func (m *Mirror) Close(ctx context.Context) {
+	m.objectIDs.Close(ctx)
+}
+
+// Manifest returns a copy of the provided snapshot manifest created by the uploader, whose root
+// entry refers to objects in the mirror repository.
+func (m *Mirror) Manifest(ctx context.Context, man *snapshot.Manifest) (*snapshot.Manifest, error) {
+	if err := m.Err(); err != nil {
+		return nil, err
+	}
+
+	oid, ok := m.lookup(ctx, man.RootEntry.ObjectID)
+	if !ok {
+		return nil, errors.Errorf("root object %v was not written to the mirror", man.RootEntry.ObjectID)
+	}
+
+	result := man.Clone()
+	result.ID = ""
+	result.RootEntry.ObjectID = oid
+
+	return result, nil
+}
+
+func (m *Mirror) failed() bool {
+	return m.Err() != nil
+}
+
+func (m *Mirror) fail(ctx context.Context, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err == nil {
+		uploadLog(ctx).Errorf("mirror failed, it will not receive any more data: %v", err)
+
+		m.err = err
+	}
+}
+
+func (m *Mirror) add(ctx context.Context, src, dst object.ID) {
+	m.objectIDs.PutIfAbsent(ctx, []byte(src.String()), []byte(dst.String()))
+}
+
+func (m *Mirror) lookup(ctx context.Context, src object.ID) (object.ID, bool) {
+	if src == object.EmptyID {
+		return object.EmptyID, true
+	}
+
+	v, ok, err := m.objectIDs.Get(ctx, nil, []byte(src.String()))
+	if err != nil || !ok {
+		return object.EmptyID, false
+	}
+
+	oid, err := object.ParseID(string(v))
+	if err != nil {
+		return object.EmptyID, false
+	}
+
+	return oid, true
+}
+
+// prime records object IDs of files which have not changed between the previous snapshots
+// of the uploader repository and previous snapshots of the mirror repository, since the uploader
+// reuses such files without writing them again.
+func (m *Mirror) prime(ctx context.Context, rep repo.Repository, previousManifests []*snapshot.Manifest) error {
+	if len(m.previous) == 0 {
+		return nil
+	}
+
+	for _, src := range previousManifests {
+		if src == nil || src.RootEntry == nil {
+			continue
+		}
+
+		// prefer the mirror snapshot created together with the source one.
+		dst := m.previous[0]
+
+		for _, p := range m.previous {
+			if p.StartTime.Equal(src.StartTime) {
+				dst = p
+			}
+		}
+
+		if dst.RootEntry == nil {
+			continue
+		}
+
+		if err := m.primeEntry(ctx, rep, src.RootEntry, dst.RootEntry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mirror) primeEntry(ctx context.Context, rep repo.Repository, src, dst *snapshot.DirEntry) error {
+	if src.Type != dst.Type {
+		return nil
+	}
+
+	if src.Type != snapshot.EntryTypeDirectory {
+		if sameDirEntryMetadata(src, dst) {
+			m.add(ctx, src.ObjectID, dst.ObjectID)
+		}
+
+		return nil
+	}
+
+	srcEntries, err := readDirEntries(ctx, rep, src)
+	if err != nil {
+		return err
+	}
+
+	dstEntries, err := readDirEntries(ctx, m.rep, dst)
+	if err != nil {
+		return err
+	}
+
+	byName := map[string]*snapshot.DirEntry{}
+	for _, de := range dstEntries {
+		byName[de.Name] = de
+	}
+
+	for _, s := range srcEntries {
+		if d := byName[s.Name]; d != nil {
+			if err := m.primeEntry(ctx, rep, s, d); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// translateDirManifest writes a copy of the directory manifest written by the uploader
+// to the mirror repository.
+func (m *Mirror) translateDirManifest(ctx context.Context, rep repo.Repository, dirRelativePath string, srcOID object.ID, dm *snapshot.DirManifest, policyTree *policy.Tree, metadataComp compression.Name) error {
+	result := *dm
+	result.Entries = make([]*snapshot.DirEntry, len(dm.Entries))
+
+	for i, de := range dm.Entries {
+		translated, err := m.translateEntry(ctx, rep, path.Join(dirRelativePath, de.Name), de, policyTree)
+		if err != nil {
+			return err
+		}
+
+		result.Entries[i] = translated
+	}
+
+	oid, err := snapshotfs.WriteDirManifest(ctx, m.rep, dirRelativePath, &result, metadataComp)
+	if err != nil {
+		return errors.Wrap(err, "error writing dir manifest")
+	}
+
+	m.add(ctx, srcOID, oid)
+
+	return nil
+}
+
+func (m *Mirror) translateEntry(ctx context.Context, rep repo.Repository, entryPath string, de *snapshot.DirEntry, policyTree *policy.Tree) (*snapshot.DirEntry, error) {
+	result := de.Clone()
+
+	if oid, ok := m.lookup(ctx, de.ObjectID); ok {
+		result.ObjectID = oid
+		return result, nil
+	}
+
+	// repositories computing identical object IDs may already have the object.
+	if _, err := m.rep.VerifyObject(ctx, de.ObjectID); err == nil {
+		return result, nil
+	}
+
+	if de.Type == snapshot.EntryTypeDirectory {
+		return nil, errors.Errorf("directory %v was not written to the mirror", entryPath)
+	}
+
+	// the uploader has reused the entry from its previous snapshot, copy it from the uploader repository.
+	pol := policyTree.Child(de.Name).EffectivePolicy()
+
+	opt := object.WriterOptions{
+		Description:        "SYMLINK:" + de.Name,
+		MetadataCompressor: pol.MetadataCompressionPolicy.MetadataCompressor(),
+	}
+
+	if de.Type == snapshot.EntryTypeFile {
+		e := snapshotfs.EntryFromDirEntry(rep, de)
+
+		opt.Description = "FILE:" + de.Name
+		opt.Compressor = pol.CompressionPolicy.CompressorForFile(e)
+		opt.Splitter = pol.SplitterPolicy.SplitterForFile(e)
+	}
+
+	oid, err := m.copyObject(ctx, rep, de.ObjectID, opt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error copying %v", entryPath)
+	}
+
+	m.add(ctx, de.ObjectID, oid)
+
+	result.ObjectID = oid
+
+	return result, nil
+}
+
+func (m *Mirror) copyObject(ctx context.Context, rep repo.Repository, oid object.ID, opt object.WriterOptions) (object.ID, error) {
+	r, err := rep.OpenObject(ctx, oid)
+	if err != nil {
+		return object.EmptyID, errors.Wrap(err, "unable to open object")
+	}
+	defer r.Close() //nolint:errcheck
+
+	w := m.rep.NewObjectWriter(ctx, opt)
+	defer w.Close() //nolint:errcheck
+
+	if _, err := iocopy.Copy(w, r); err != nil {
+		return object.EmptyID, errors.Wrap(err, "unable to copy object data")
+	}
+
+	result, err := w.Result()
+	if err != nil {
+		return object.EmptyID, errors.Wrap(err, "unable to write object")
+	}
+
+	return result, nil
+}
+
+func (m *Mirror) concatenate(ctx context.Context, srcParts []object.ID, srcResult object.ID, opt repo.ConcatenateOptions) error {
+	parts := make([]object.ID, len(srcParts))
+
+	for i, p := range srcParts {
+		oid, ok := m.lookup(ctx, p)
+		if !ok {
+			return errors.Errorf("part %v was not written to the mirror", p)
+		}
+
+		parts[i] = oid
+	}
+
+	oid, err := m.rep.ConcatenateObjects(ctx, parts, opt)
+	if err != nil {
+		return errors.Wrap(err, "concatenate")
+	}
+
+	m.add(ctx, srcResult, oid)
+
+	return nil
+}
+
+func readDirEntries(ctx context.Context, rep repo.Repository, de *snapshot.DirEntry) ([]*snapshot.DirEntry, error) {
+	dir, ok := snapshotfs.EntryFromDirEntry(rep, de).(fs.Directory)
+	if !ok {
+		return nil, errors.Errorf("%v is not a directory", de.ObjectID)
+	}
+
+	var result []*snapshot.DirEntry
+
+	if err := fs.IterateEntries(ctx, dir, func(_ context.Context, e fs.Entry) error {
+		if h, ok := e.(snapshot.HasDirEntry); ok {
+			result = append(result, h.DirEntry())
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "unable to read directory %v", de.ObjectID)
+	}
+
+	return result, nil
+}
+
+func sameDirEntryMetadata(e1, e2 *snapshot.DirEntry) bool {
+	return e1.Name == e2.Name &&
+		e1.FileSize == e2.FileSize &&
+		e1.ModTime.Equal(e2.ModTime) &&
+		e1.Permissions == e2.Permissions &&
+		e1.UserID == e2.UserID &&
+		e1.GroupID == e2.GroupID
+}
+
+// mirrorStream writes file data to the mirror in the background, so that a slow mirror does not
+// slow down the upload.
+type mirrorStream struct {
+	mirror *Mirror
+	data   chan []byte
+	done   chan struct{}
+
+	// set before data is closed, indicates that the object should be completed rather than discarded.
+	finish bool
+
+	// set before done is closed.
+	oid object.ID
+	err error
+}
+
+func newMirrorStream(m *Mirror, w object.Writer) *mirrorStream {
+	s := &mirrorStream{
+		mirror: m,
+		data:   make(chan []byte, mirrorMaxPendingWrites),
+		done:   make(chan struct{}),
+	}
+
+	go s.run(w)
+
+	return s
+}
+
+func (s *mirrorStream) run(w object.Writer) {
+	defer close(s.done)
+	defer w.Close() //nolint:errcheck
+
+	for b := range s.data {
+		if s.err == nil && !s.mirror.failed() {
+			if _, err := w.Write(b); err != nil {
+				s.err = errors.Wrap(err, "mirror write error")
+			}
+		}
+
+		s.mirror.bufferedBytes.Add(-int64(len(b)))
+	}
+
+	if !s.finish || s.err != nil {
+		return
+	}
+
+	oid, err := w.Result()
+	if err != nil {
+		s.err = errors.Wrap(err, "mirror write error")
+		return
+	}
+
+	s.oid = oid
+}
+
+// send queues a copy of the data to be written to the mirror and returns false if the mirror
+// has fallen behind.
+func (s *mirrorStream) send(data []byte) bool {
+	n := int64(len(data))
+
+	if s.mirror.bufferedBytes.Add(n) > mirrorMaxBufferedBytes {
+		s.mirror.bufferedBytes.Add(-n)
+		return false
+	}
+
+	select {
+	case s.data <- slices.Clone(data):
+		return true
+
+	default:
+		s.mirror.bufferedBytes.Add(-n)
+		return false
+	}
+}
+
+// mirroredWriter writes data to the uploader repository and queues it to be written to all active mirrors.
+type mirroredWriter struct {
+	ctx context.Context //nolint:containedctx
+
+	object.Writer
+
+	streams []*mirrorStream
+}
+
+func (w *mirroredWriter) Write(data []byte) (int, error) {
+	n, err := w.Writer.Write(data)
+	if err != nil {
+		//nolint:wrapcheck
+		return n, err
+	}
+
+	for i, s := range w.streams {
+		if s == nil {
+			continue
+		}
+
+		if !s.send(data) {
+			w.mirrorFailed(i, errMirrorFallingBehind)
+		}
+	}
+
+	return n, nil
+}
+
+// Result returns the object ID in the uploader repository after the mirrors have finished writing
+// the object, waiting at most for the mirror finish timeout.
+func (w *mirroredWriter) Result() (object.ID, error) {
+	oid, err := w.Writer.Result()
+	if err != nil {
+		//nolint:wrapcheck
+		return oid, err
+	}
+
+	for i, s := range w.streams {
+		if s == nil {
+			continue
+		}
+
+		w.streams[i] = nil
+
+		s.finish = true
+		close(s.data)
+
+		t := time.NewTimer(s.mirror.finishTimeout)
+
+		select {
+		case <-s.done:
+			t.Stop()
+
+			if s.err != nil {
+				s.mirror.fail(w.ctx, s.err)
+				continue
+			}
+
+			s.mirror.add(w.ctx, oid, s.oid)
+
+		case <-t.C:
+			// the stream finishes in the background, but the mirror no longer receives data.
+			s.mirror.fail(w.ctx, errMirrorFallingBehind)
+		}
+	}
+
+	return oid, nil
+}
+
+func (w *mirroredWriter) Close() error {
+	for i, s := range w.streams {
+		if s != nil {
+			w.streams[i] = nil
+			close(s.data)
+		}
+	}
+
+	//nolint:wrapcheck
+	return w.Writer.Close()
+}
+
+// mirrorFailed stops writing to the mirror and discards the data written so far.
+func (w *mirroredWriter) mirrorFailed(i int, err error) {
+	w.streams[i].mirror.fail(w.ctx, err)
+	close(w.streams[i].data)
+	w.streams[i] = nil
+}
+
+// newObjectWriter returns a writer for file data, which is also written to all active mirrors.
+func (u *Uploader) newObjectWriter(ctx context.Context, opt object.WriterOptions) object.Writer {
+	w := u.repo.NewObjectWriter(ctx, opt)
+
+	var active []*Mirror
+
+	for _, m := range u.Mirrors {
+		if !m.failed() {
+			active = append(active, m)
+		}
+	}
+
+	if len(active) == 0 {
+		return w
+	}
+
+	mw := &mirroredWriter{ctx: ctx, Writer: w}
+
+	for _, m := range active {
+		mw.streams = append(mw.streams, newMirrorStream(m, m.rep.NewObjectWriter(ctx, opt)))
+	}
+
+	return mw
+}
+
+// mirrorConcatenatedObject concatenates the parts of a file in all active mirrors.
+func (u *Uploader) mirrorConcatenatedObject(ctx context.Context, parts []object.ID, result object.ID, opt repo.ConcatenateOptions) {
+	for _, m := range u.Mirrors {
+		if m.failed() {
+			continue
+		}
+
+		if err := m.concatenate(ctx, parts, result, opt); err != nil {
+			m.fail(ctx, err)
+		}
+	}
+}
+
+// mirrorDirManifest writes the directory manifest written by the uploader to all active mirrors.
+func (u *Uploader) mirrorDirManifest(ctx context.Context, dirRelativePath string, oid object.ID, dm *snapshot.DirManifest, policyTree *policy.Tree, metadataComp compression.Name) {
+	for _, m := range u.Mirrors {
+		if m.failed() {
+			continue
+		}
+
+		if err := m.translateDirManifest(ctx, u.repo, dirRelativePath, oid, dm, policyTree, metadataComp); err != nil {
+			m.fail(ctx, err)
+		}
+	}
+}
+
+// primeMirrors prepares mirrors for reusing unchanged entries of previous snapshots.
+func (u *Uploader) primeMirrors(ctx context.Context, previousManifests []*snapshot.Manifest) {
+	for _, m := range u.Mirrors {
+		if err := m.prime(ctx, u.repo, previousManifests); err != nil {
+			// not fatal, unchanged files will be copied from the uploader repository.
+			uploadLog(ctx).Debugf("unable to find unchanged files in mirror: %v", err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestUploadWithMirror(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx, t)
+	mth := newUploadTestHarness(ctx, t)
+
+	defer th.cleanup()
+	defer mth.cleanup()
+
+	policyTree := policy.BuildTree(nil, policy.DefaultPolicy)
+	si := snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/source"}
+
+	m1, err := NewMirror(ctx, mth.repo)
+	require.NoError(t, err)
+
+	defer m1.Close(ctx)
+
+	u := NewUploader(th.repo)
+	u.Mirrors = []*Mirror{m1}
+
+	s1, err := u.Upload(ctx, th.sourceDir, policyTree, si)
+	require.NoError(t, err)
+
+	ms1, err := m1.Manifest(ctx, s1)
+	require.NoError(t, err)
+
+	// repositories use different keys, so object IDs are different.
+	require.NotEqual(t, s1.RootObjectID(), ms1.RootObjectID())
+	require.Equal(t, s1.StartTime, ms1.StartTime)
+	requireSameTree(ctx, t, th.repo, s1.RootEntry, mth.repo, ms1.RootEntry)
+
+	// change one file, all other files are reused from previous snapshots.
+	th.sourceDir.AddFile("d1/f2", []byte{1, 2, 3, 4, 5, 6}, defaultPermissions)
+	th.ft.Advance(1)
+
+	m2, err := NewMirror(ctx, mth.repo, ms1)
+	require.NoError(t, err)
+
+	defer m2.Close(ctx)
+
+	u = NewUploader(th.repo)
+	u.Mirrors = []*Mirror{m2}
+
+	s2, err := u.Upload(ctx, th.sourceDir, policyTree, si, s1)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), s2.Stats.TotalFileCount)
+
+	ms2, err := m2.Manifest(ctx, s2)
+	require.NoError(t, err)
+	requireSameTree(ctx, t, th.repo, s2.RootEntry, mth.repo, ms2.RootEntry)
+
+	// the mirror snapshot can be saved and loaded in the mirror repository.
+	id, err := snapshot.SaveSnapshot(ctx, mth.repo, ms2)
+	require.NoError(t, err)
+
+	loaded, err := snapshot.LoadSnapshot(ctx, mth.repo, id)
+	require.NoError(t, err)
+	require.Equal(t, ms2.RootObjectID(), loaded.RootObjectID())
+}
+
+func TestUploadWithFailingMirror(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx, t)
+	mth1 := newUploadTestHarness(ctx, t)
+	mth2 := newUploadTestHarness(ctx, t)
+
+	defer th.cleanup()
+	defer mth1.cleanup()
+	defer mth2.cleanup()
+
+	failing, err := NewMirror(ctx, failingWriterRepository{mth1.repo})
+	require.NoError(t, err)
+
+	defer failing.Close(ctx)
+
+	healthy, err := NewMirror(ctx, mth2.repo)
+	require.NoError(t, err)
+
+	defer healthy.Close(ctx)
+
+	u := NewUploader(th.repo)
+	u.Mirrors = []*Mirror{failing, healthy}
+
+	s, err := u.Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	require.NoError(t, err)
+	require.Empty(t, s.IncompleteReason)
+
+	require.ErrorIs(t, failing.Err(), errTest)
+
+	_, err = failing.Manifest(ctx, s)
+	require.ErrorIs(t, err, errTest)
+
+	require.NoError(t, healthy.Err())
+
+	ms, err := healthy.Manifest(ctx, s)
+	require.NoError(t, err)
+	requireSameTree(ctx, t, th.repo, s.RootEntry, mth2.repo, ms.RootEntry)
+}
+
+func TestUploadWithStalledMirror(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx, t)
+	mth := newUploadTestHarness(ctx, t)
+
+	defer th.cleanup()
+	defer mth.cleanup()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	stalled, err := NewMirror(ctx, stalledWriterRepository{mth.repo, release})
+	require.NoError(t, err)
+
+	defer stalled.Close(ctx)
+
+	stalled.finishTimeout = 100 * time.Millisecond
+
+	u := NewUploader(th.repo)
+	u.Mirrors = []*Mirror{stalled}
+
+	// the upload completes even though the mirror never finishes writing.
+	s, err := u.Upload(ctx, th.sourceDir, policy.BuildTree(nil, policy.DefaultPolicy), snapshot.SourceInfo{})
+	require.NoError(t, err)
+	require.Empty(t, s.IncompleteReason)
+
+	require.ErrorIs(t, stalled.Err(), errMirrorFallingBehind)
+
+	_, err = stalled.Manifest(ctx, s)
+	require.ErrorIs(t, err, errMirrorFallingBehind)
+}
+
+// stalledWriterRepository returns object writers whose writes block until released.
+type stalledWriterRepository struct {
+	repo.RepositoryWriter
+
+	release chan struct{}
+}
+
+func (r stalledWriterRepository) NewObjectWriter(ctx context.Context, opt object.WriterOptions) object.Writer {
+	return stalledObjectWriter{r.RepositoryWriter.NewObjectWriter(ctx, opt), r.release}
+}
+
+type stalledObjectWriter struct {
+	object.Writer
+
+	release chan struct{}
+}
+
+func (w stalledObjectWriter) Write(b []byte) (int, error) {
+	<-w.release
+
+	//nolint:wrapcheck
+	return w.Writer.Write(b)
+}
+
+// failingWriterRepository returns object writers which fail to write.
+type failingWriterRepository struct {
+	repo.RepositoryWriter
+}
+
+func (r failingWriterRepository) NewObjectWriter(ctx context.Context, opt object.WriterOptions) object.Writer {
+	return failingObjectWriter{r.RepositoryWriter.NewObjectWriter(ctx, opt)}
+}
+
+type failingObjectWriter struct {
+	object.Writer
+}
+
+func (failingObjectWriter) Write(_ []byte) (int, error) {
+	return 0, errTest
+}
+
+func requireSameTree(ctx context.Context, t *testing.T, rep1 repo.Repository, de1 *snapshot.DirEntry, rep2 repo.Repository, de2 *snapshot.DirEntry) {
+	t.Helper()
+
+	require.Equal(t, de1.Name, de2.Name)
+	require.Equal(t, de1.Type, de2.Type)
+	require.Equal(t, de1.FileSize, de2.FileSize)
+
+	if de1.Type != snapshot.EntryTypeDirectory {
+		require.Equal(t, readObject(ctx, t, rep1, de1.ObjectID), readObject(ctx, t, rep2, de2.ObjectID), de1.Name)
+		return
+	}
+
+	entries1, err := readDirEntries(ctx, rep1, de1)
+	require.NoError(t, err)
+
+	entries2, err := readDirEntries(ctx, rep2, de2)
+	require.NoError(t, err)
+	require.Len(t, entries2, len(entries1))
+
+	for _, entries := range [][]*snapshot.DirEntry{entries1, entries2} {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name < entries[j].Name
+		})
+	}
+
+	for i := range entries1 {
+		requireSameTree(ctx, t, rep1, entries1[i], rep2, entries2[i])
+	}
+}
+
+func readObject(ctx context.Context, t *testing.T, rep repo.Repository, oid object.ID) []byte {
+	t.Helper()
+
+	r, err := rep.OpenObject(ctx, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return b
+}
@@ -2,6 +2,7 @@
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -192,3 +193,37 @@ func TestACL(t *testing.T) {
 		"--password", "new-password",
 	)
 }
+
+func TestACLExpiration(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--override-hostname=foo", "--override-username=foo")
+
+	e.RunAndExpectFailure(t, "server", "acl", "add", "--user", "foo@bar", "--target", "type=snapshot", "--access=READ", "--expires=soon")
+	e.RunAndExpectSuccess(t, "server", "acl", "add", "--user", "foo@bar", "--target", "type=snapshot", "--access=READ", "--expires=2d")
+	e.RunAndExpectSuccess(t, "server", "acl", "add", "--user", "foo@bar", "--target", "type=policy", "--access=READ")
+
+	lines := e.RunAndExpectSuccess(t, "server", "acl", "list")
+	require.Len(t, lines, 2)
+
+	var expiring int
+
+	for _, l := range lines {
+		if strings.Contains(l, " expires:") {
+			require.Contains(t, l, "target:type=snapshot")
+
+			expiring++
+		}
+	}
+
+	require.Equal(t, 1, expiring)
+
+	// entry has not expired yet, so maintenance keeps it.
+	e.RunAndExpectSuccess(t, "maintenance", "run", "--full")
+	require.Len(t, e.RunAndExpectSuccess(t, "server", "acl", "list"), 2)
+}
@@ -0,0 +1,123 @@
+package endtoend_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/clitestutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestAPITokens(t *testing.T) {
+	t.Parallel()
+
+	serverRunner := testenv.NewInProcRunner(t)
+	serverEnvironment := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, serverRunner)
+
+	defer serverEnvironment.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	serverEnvironment.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", serverEnvironment.RepoDir, "--override-hostname=foo", "--override-username=foo")
+
+	createToken := func(args ...string) string {
+		t.Helper()
+
+		out := serverEnvironment.RunAndExpectSuccess(t, append([]string{"server", "user", "token", "create"}, args...)...)
+		require.Len(t, out, 1)
+
+		return out[0]
+	}
+
+	writeToken := createToken("ci@builder", "--scope=snapshot:write", "--scope=policy:read", "--expires=90d")
+	readToken := createToken("ci@builder", "--scope=snapshot:read", "--expires=1h")
+	controlToken := createToken("admin-user", "--scope=server:control")
+
+	serverEnvironment.RunAndExpectFailure(t, "server", "user", "token", "create", "ci@builder", "--scope=bogus")
+	serverEnvironment.RunAndVerifyOutputLineCount(t, 3, "server", "user", "token", "list")
+	serverEnvironment.RunAndVerifyOutputLineCount(t, 2, "server", "user", "token", "list", "ci@builder")
+
+	var sp testutil.ServerParameters
+
+	wait, kill := serverEnvironment.RunAndProcessStderr(t, sp.ProcessOutput,
+		"server", "start",
+		"--address=localhost:0",
+		"--server-control-username=admin-user",
+		"--server-control-password=admin-pwd",
+		"--tls-generate-cert",
+		"--tls-generate-rsa-key-size=2048", // use shorter key size to speed up generation
+	)
+
+	defer wait()
+	defer kill()
+
+	connect := func(e *testenv.CLITest, token string, wantSuccess bool) {
+		t.Helper()
+
+		args := []string{
+			"repo", "connect", "server",
+			"--url", sp.BaseURL + "/",
+			"--server-cert-fingerprint", sp.SHA256Fingerprint,
+			"--override-username", "ci",
+			"--override-hostname", "builder",
+			"--password", token,
+		}
+
+		if wantSuccess {
+			e.RunAndExpectSuccess(t, args...)
+		} else {
+			e.RunAndExpectFailure(t, args...)
+		}
+	}
+
+	writer := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	delete(writer.Environment, "KOPIA_PASSWORD")
+
+	connect(writer, writeToken, true)
+	writer.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+	writer.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	reader := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	delete(reader.Environment, "KOPIA_PASSWORD")
+
+	connect(reader, readToken, true)
+	require.Len(t, clitestutil.ListSnapshotsAndExpectSuccess(t, reader, sharedTestDataDir1), 1)
+	reader.RunAndExpectFailure(t, "snapshot", "create", sharedTestDataDir1)
+	reader.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	// tokens are usable with the server control API, but only by the owner with the right scope.
+	refresh := func(username, password string, wantSuccess bool) {
+		t.Helper()
+
+		args := []string{
+			"server", "refresh",
+			"--address", sp.BaseURL,
+			"--server-username", username,
+			"--server-password", password,
+			"--server-cert-fingerprint", sp.SHA256Fingerprint,
+		}
+
+		if wantSuccess {
+			serverEnvironment.RunAndExpectSuccess(t, args...)
+		} else {
+			serverEnvironment.RunAndExpectFailure(t, args...)
+		}
+	}
+
+	refresh("admin-user", controlToken, true)
+	refresh("ci@builder", writeToken, false)
+
+	// revoked tokens can no longer be used.
+	var tokens []map[string]any
+
+	testutil.MustParseJSONLines(t, serverEnvironment.RunAndExpectSuccess(t, "server", "user", "token", "list", "ci@builder", "--json"), &tokens)
+	require.Len(t, tokens, 2)
+
+	for _, tok := range tokens {
+		require.NotEqual(t, "0001-01-01T00:00:00Z", tok["lastUsed"])
+		serverEnvironment.RunAndExpectSuccess(t, "server", "user", "token", "revoke", tok["id"].(string))
+	}
+
+	refresh("admin-user", controlToken, true)
+	connect(writer, writeToken, false)
+}
@@ -0,0 +1,58 @@
+package endtoend_test
+
+import (
+	"testing"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/clitestutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryReplica(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	// replica is not configured yet.
+	e.RunAndExpectFailure(t, "repo", "replica", "sync")
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	dir2 := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "repo", "replica", "set", "filesystem", "--path", dir2)
+	e.RunAndExpectSuccess(t, "repo", "replica", "sync")
+	e.RunAndExpectSuccess(t, "repo", "replica", "verify")
+
+	// changes made outside of the server are not replicated until the next sync.
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2)
+	e.RunAndExpectFailure(t, "repo", "replica", "verify")
+
+	e.RunAndExpectSuccess(t, "repo", "replica", "sync")
+	e.RunAndExpectSuccess(t, "repo", "replica", "verify", "--full")
+
+	sources := clitestutil.ListSnapshotsAndExpectSuccess(t, e)
+
+	// replica of another repository can't be used.
+	e2 := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e2.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e2.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e2.RepoDir)
+	e2.RunAndExpectFailure(t, "repo", "replica", "set", "filesystem", "--path", dir2)
+
+	e.RunAndExpectSuccess(t, "repo", "replica", "clear")
+	e.RunAndExpectFailure(t, "repo", "replica", "verify")
+
+	// replica can be connected to directly.
+	e.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", dir2)
+
+	sources2 := clitestutil.ListSnapshotsAndExpectSuccess(t, e)
+	if got, want := len(sources2), len(sources); got != want {
+		t.Errorf("unexpected number of sources: %v, want %v in %#v", got, want, sources2)
+	}
+}
@@ -1,8 +1,15 @@
 package endtoend_test
 
 import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/kopia/kopia/internal/testutil"
 	"github.com/kopia/kopia/tests/clitestutil"
 	"github.com/kopia/kopia/tests/testenv"
@@ -55,3 +62,63 @@ func TestRepositorySync(t *testing.T) {
 	// syncing to the directory should fail because it contains incompatible format blob.
 	e2.RunAndExpectFailure(t, "repo", "sync-to", "filesystem", "--path", dir2)
 }
+
+func TestRepositorySyncComposite(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	metadataDir := testutil.TempDirectory(t)
+	packsDir := testutil.TempDirectory(t)
+
+	// connection info matching the one of 'sync-to filesystem' with default flags.
+	writeConnectionInfo := func(dir string) string {
+		fname := filepath.Join(testutil.TempDirectory(t), "storage.json")
+		ci := `{"type":"filesystem","config":{"path":` + strconv.Quote(dir) + `,"fileMode":384,"dirMode":448}}`
+		require.NoError(t, os.WriteFile(fname, []byte(ci), 0o600))
+
+		return fname
+	}
+
+	e.RunAndExpectSuccess(t, "repo", "create", "composite",
+		"--default", writeConnectionInfo(metadataDir),
+		"--route", "p="+writeConnectionInfo(packsDir))
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	sources := clitestutil.ListSnapshotsAndExpectSuccess(t, e)
+
+	packsBefore := countFiles(t, packsDir)
+	require.NotZero(t, packsBefore)
+
+	// synchronizing to the storage of packs only copies metadata and leaves packs alone.
+	_, stderr := e.RunAndExpectSuccessWithErrOut(t, "repo", "sync-to", "filesystem", "--path", packsDir, "--delete")
+	require.Contains(t, strings.Join(stderr, "\n"), "Destination holds some of the source BLOBs")
+	require.Equal(t, packsBefore+countFiles(t, metadataDir), countFiles(t, packsDir))
+
+	// the storage of packs is now a complete repository.
+	e.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", packsDir)
+
+	sources2 := clitestutil.ListSnapshotsAndExpectSuccess(t, e)
+	require.Len(t, sources2, len(sources))
+}
+
+// countFiles returns the number of files in a directory tree, excluding internal ones like '.shards'.
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+
+	n := 0
+
+	require.NoError(t, filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
+			n++
+		}
+
+		return err
+	}))
+
+	return n
+}
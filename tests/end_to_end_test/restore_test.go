@@ -13,6 +13,7 @@
 	"regexp"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -937,6 +938,27 @@ func TestSnapshotRestoreByPath(t *testing.T) {
 	compareDirs(t, source, restoreDir)
 }
 
+func TestSnapshotRestoreWithRehydrate(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	// filesystem storage has no archive tiers and can't rehydrate.
+	restoreDir := testutil.TempDirectory(t)
+	_, stderr := e.RunAndExpectFailure(t, "snapshot", "restore", sharedTestDataDir1, restoreDir, "--rehydrate", "--rehydrate-poll-interval=1h")
+	require.Contains(t, strings.Join(stderr, "\n"), "does not support rehydration")
+
+	// restore without rehydration succeeds.
+	e.RunAndExpectSuccess(t, "snapshot", "restore", sharedTestDataDir1, restoreDir)
+	compareDirs(t, sharedTestDataDir1, restoreDir)
+}
+
 func TestRestoreByPathWithoutTarget(t *testing.T) {
 	t.Parallel()
 
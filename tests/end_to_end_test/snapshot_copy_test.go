@@ -0,0 +1,116 @@
+package endtoend_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotCopyToRepository(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	var man1 snapshot.Manifest
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1, "--description", "first", "--tags", "key1:value1", "--json"), &man1)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "snapshot", "pin", string(man1.ID), "--add", "keep")
+
+	var sourceManifests []cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "snapshot", "list", "--json", sharedTestDataDir1), &sourceManifests)
+	require.Len(t, sourceManifests, 2)
+
+	// destination repository uses a different format.
+	dstenv := testenv.NewCLITest(t, []string{"--block-hash=HMAC-SHA256", "--object-splitter=FIXED-1M"}, runner)
+
+	defer dstenv.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	dstenv.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", dstenv.RepoDir)
+
+	dstConfig := filepath.Join(dstenv.ConfigDir, ".kopia.config")
+
+	e.RunAndExpectFailure(t, "snapshot", "copy", "--to-config", dstConfig, "no-such-snapshot")
+	e.RunAndExpectSuccess(t, "snapshot", "copy", "--to-config", dstConfig, string(sourceManifests[0].ID), string(sourceManifests[1].ID))
+
+	var copied []cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, dstenv.RunAndExpectSuccess(t, "snapshot", "list", "--json", sharedTestDataDir1), &copied)
+	require.Len(t, copied, 2)
+
+	for i, want := range sourceManifests {
+		got := copied[i]
+
+		require.Equal(t, want.Source, got.Source)
+		require.Equal(t, want.StartTime, got.StartTime)
+		require.Equal(t, want.EndTime, got.EndTime)
+		require.Equal(t, want.RootEntry.DirSummary.TotalFileSize, got.RootEntry.DirSummary.TotalFileSize)
+		require.Equal(t, want.RootEntry.DirSummary.TotalFileCount, got.RootEntry.DirSummary.TotalFileCount)
+		require.NotEqual(t, want.RootEntry.ObjectID, got.RootEntry.ObjectID)
+	}
+
+	require.Equal(t, "first", copied[0].Description)
+	require.Equal(t, "value1", copied[0].Tags["tag:key1"])
+	require.Equal(t, []string{"keep"}, copied[0].Pins)
+
+	dstenv.RunAndExpectSuccess(t, "snapshot", "verify", "--verify-files-percent=100")
+
+	restoreDir := testutil.TempDirectory(t)
+	dstenv.RunAndExpectSuccess(t, "snapshot", "restore", string(copied[1].ID), restoreDir)
+	compareDirs(t, sharedTestDataDir1, restoreDir)
+
+	// copying again is a no-op.
+	e.RunAndExpectSuccess(t, "snapshot", "copy", "--to-config", dstConfig, string(sourceManifests[0].ID))
+	testutil.MustParseJSONLines(t, dstenv.RunAndExpectSuccess(t, "snapshot", "list", "--json", sharedTestDataDir1), &copied)
+	require.Len(t, copied, 2)
+}
+
+func TestSnapshotCopyToRepositoryReusesExistingObjects(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	// a copy of the repository computes identical content IDs.
+	dir2 := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "repo", "sync-to", "filesystem", "--path", dir2)
+
+	var man snapshot.Manifest
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1, "--json"), &man)
+
+	dstenv := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer dstenv.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	dstenv.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", dir2)
+
+	_, stderr := e.RunAndExpectSuccessWithErrOut(t, "snapshot", "copy", "--to-config", filepath.Join(dstenv.ConfigDir, ".kopia.config"), string(man.ID))
+	require.Contains(t, strings.Join(stderr, "\n"), "Copied 0 files (0 B),")
+
+	var copied []cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, dstenv.RunAndExpectSuccess(t, "snapshot", "list", "--json", sharedTestDataDir1), &copied)
+	require.Len(t, copied, 2)
+	require.Equal(t, man.RootEntry.ObjectID, copied[1].RootEntry.ObjectID)
+
+	dstenv.RunAndExpectSuccess(t, "snapshot", "verify", "--verify-files-percent=100")
+}
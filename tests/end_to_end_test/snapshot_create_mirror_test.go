@@ -0,0 +1,75 @@
+package endtoend_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotCreateAlsoToConfig(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	// the mirror uses a different format.
+	mirror := testenv.NewCLITest(t, []string{"--block-hash=HMAC-SHA256", "--object-splitter=FIXED-1M"}, runner)
+
+	defer mirror.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	mirror.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", mirror.RepoDir)
+
+	// the repository of the broken mirror is removed after connecting to it.
+	broken := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+	broken.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", broken.RepoDir)
+	require.NoError(t, os.RemoveAll(broken.RepoDir))
+
+	mirrorConfig := filepath.Join(mirror.ConfigDir, ".kopia.config")
+	brokenConfig := filepath.Join(broken.ConfigDir, ".kopia.config")
+
+	var man snapshot.Manifest
+
+	// failure of one destination does not affect others.
+	stdout, stderr := e.RunAndExpectFailure(t, "snapshot", "create", sharedTestDataDir1, "--json", "--description", "first",
+		"--also-to-config", brokenConfig, "--also-to-config", mirrorConfig)
+	testutil.MustParseJSONLines(t, stdout, &man)
+	require.Contains(t, strings.Join(stderr, "\n"), "mirror "+brokenConfig)
+
+	var primary, mirrored []cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "snapshot", "list", "--json", sharedTestDataDir1), &primary)
+	require.Len(t, primary, 1)
+	require.Equal(t, man.RootEntry.ObjectID, primary[0].RootEntry.ObjectID)
+
+	testutil.MustParseJSONLines(t, mirror.RunAndExpectSuccess(t, "snapshot", "list", "--json", sharedTestDataDir1), &mirrored)
+	require.Len(t, mirrored, 1)
+	require.NotEqual(t, primary[0].RootEntry.ObjectID, mirrored[0].RootEntry.ObjectID)
+	require.Equal(t, primary[0].StartTime, mirrored[0].StartTime)
+	require.Equal(t, "first", mirrored[0].Description)
+	require.Equal(t, primary[0].RootEntry.DirSummary.TotalFileCount, mirrored[0].RootEntry.DirSummary.TotalFileCount)
+
+	// the next snapshot reuses unchanged files in both repositories.
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1, "--also-to-config", mirrorConfig)
+
+	testutil.MustParseJSONLines(t, mirror.RunAndExpectSuccess(t, "snapshot", "list", "--json", sharedTestDataDir1), &mirrored)
+	require.Len(t, mirrored, 2)
+	require.Equal(t, mirrored[0].RootEntry.ObjectID, mirrored[1].RootEntry.ObjectID)
+
+	mirror.RunAndExpectSuccess(t, "snapshot", "verify", "--verify-files-percent=100")
+
+	restoreDir := testutil.TempDirectory(t)
+	mirror.RunAndExpectSuccess(t, "snapshot", "restore", string(mirrored[1].ID), restoreDir)
+	compareDirs(t, sharedTestDataDir1, restoreDir)
+}